@@ -0,0 +1,62 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"os"
+
+	"github.com/awslabs/ssosync/internal"
+
+	"github.com/spf13/cobra"
+)
+
+var applyCmd = &cobra.Command{
+	Use:   "apply <plan.json>",
+	Short: "Apply a plan written by ssosync plan",
+	Long: `Apply the changes of a plan written by "ssosync plan --out <file>", so
+exactly the reviewed changes are applied. The changes are computed again
+and nothing is applied when they, or the Google Workspace users they
+derive from, changed since the plan was written: compute a new plan.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		f, err := os.Open(args[0])
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		p, err := internal.ReadPlan(f)
+		if err != nil {
+			return err
+		}
+		report, err := internal.DoApply(ctx, cfg, p)
+		if err != nil {
+			return err
+		}
+		if detailedExitCode && report.HasChanges() {
+			return &exitError{code: driftExitCode}
+		}
+		return nil
+	},
+}
+
+func init() {
+	applyCmd.Flags().BoolVar(&cfg.Force, "force", false, forceUsage)
+	applyCmd.Flags().BoolVar(&detailedExitCode, "detailed-exitcode", false, detailedExitCodeUsage)
+	rootCmd.AddCommand(applyCmd)
+}
@@ -0,0 +1,200 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/awslabs/ssosync/internal/config"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+// configFile is the path of the config file, see --config
+var configFile string
+
+// configProfile is the profile of the config file read, see --profile
+var configProfile string
+
+// configFileErr is the error reading the config file, returned before any
+// command runs but the one validating the file
+var configFileErr error
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Check the config file",
+	// the config file is checked by the commands instead
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		return nil
+	},
+}
+
+var configValidateCmd = &cobra.Command{
+	Use:   "validate [file]",
+	Short: "Report the unknown keys, type errors and contradictions of a config file",
+	Long: `Read the config file, the file given or the one a sync would read,
+and report its unknown keys, the values of the wrong type and the
+contradictory settings, without sending any request. It exits with an
+error when a problem is found.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		path := configFile
+		if len(args) > 0 {
+			path = args[0]
+		}
+		if path == "" {
+			return fmt.Errorf("no config file, give its path or create %s", config.DefaultConfigFile)
+		}
+
+		c := config.New()
+		var problems []string
+		err := config.ReadFile(c, path, configProfile)
+		var fileErr *config.FileError
+		switch {
+		case errors.As(err, &fileErr):
+			problems = fileErr.Problems
+		case err != nil:
+			return err
+		default:
+			for _, p := range config.Lint(c) {
+				problems = append(problems, p.String())
+			}
+		}
+
+		for _, p := range problems {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", path, p)
+		}
+		if len(problems) > 0 {
+			return fmt.Errorf("invalid config file, %d problem(s) found", len(problems))
+		}
+		fmt.Printf("%s: valid\n", path)
+		return nil
+	},
+}
+
+// flagValue returns the value of the flag of args, e.g. "--config", read
+// before the other flags are parsed, else the environment variable env
+func flagValue(args []string, flag string, env string) string {
+	for i, a := range args {
+		if a == "--" {
+			break
+		}
+		if v := strings.TrimPrefix(a, flag+"="); v != a {
+			return v
+		}
+		if a == flag && i+1 < len(args) {
+			return args[i+1]
+		}
+	}
+	return os.Getenv(env)
+}
+
+// findConfigFile returns the path of the config file: the --config flag of
+// args, read before the other flags so they override the file, else
+// SSOSYNC_CONFIG, else DefaultConfigFile if it exists
+func findConfigFile(args []string) string {
+	if v := flagValue(args, "--config", "SSOSYNC_CONFIG"); v != "" {
+		return v
+	}
+	if _, err := os.Stat(config.DefaultConfigFile); err == nil {
+		return config.DefaultConfigFile
+	}
+	return ""
+}
+
+// readConfigFile reads the config file into cfg, with the profile of
+// --profile or SSOSYNC_PROFILE, before the flags are parsed
+// and the environment variables read, which take precedence
+func readConfigFile(args []string) {
+	configFile = findConfigFile(args)
+	configProfile = flagValue(args, "--profile", "SSOSYNC_PROFILE")
+	switch {
+	case configFile != "":
+		configFileErr = config.ReadFile(cfg, configFile, configProfile)
+	case configProfile != "":
+		configFileErr = fmt.Errorf("config profile %q selected without a config file, see --config", configProfile)
+	}
+}
+
+// configReloader returns the function reading the configuration into cfg
+// again, as when ssosync starts: the config file, then the flags set on the
+// command line of cmd, then the environment variables. cfg is left unchanged
+// when the configuration read is invalid.
+func configReloader(cmd *cobra.Command) func() error {
+	// the values of the flags, the ones bound to cfg are overwritten
+	type setFlag struct {
+		flag   *pflag.Flag
+		value  string
+		values []string
+	}
+	set := make([]setFlag, 0)
+	cmd.Flags().Visit(func(f *pflag.Flag) {
+		s := setFlag{flag: f, value: f.Value.String()}
+		if sv, ok := f.Value.(pflag.SliceValue); ok {
+			s.values = sv.GetSlice()
+		}
+		set = append(set, s)
+	})
+
+	return func() error {
+		old := *cfg
+		err := func() error {
+			*cfg = *config.New()
+			cfg.IsLambda, cfg.Version = old.IsLambda, old.Version
+			if err := config.ReadFile(cfg, configFile, configProfile); err != nil {
+				return err
+			}
+			for _, s := range set {
+				var err error
+				if sv, ok := s.flag.Value.(pflag.SliceValue); ok {
+					// Set would append to the values of the flag
+					err = sv.Replace(s.values)
+				} else {
+					err = s.flag.Value.Set(s.value)
+				}
+				if err != nil {
+					return fmt.Errorf("flag --%s: %w", s.flag.Name, err)
+				}
+			}
+			if err := viper.Unmarshal(cfg); err != nil {
+				return err
+			}
+			if problems := config.Lint(cfg); len(problems) > 0 {
+				messages := make([]string, 0, len(problems))
+				for _, p := range problems {
+					messages = append(messages, p.String())
+				}
+				return fmt.Errorf("invalid configuration: %s", strings.Join(messages, "; "))
+			}
+			return nil
+		}()
+		if err != nil {
+			*cfg = old
+			return err
+		}
+		logConfig(cfg)
+		return nil
+	}
+}
+
+func init() {
+	configCmd.AddCommand(configValidateCmd)
+	rootCmd.AddCommand(configCmd)
+}
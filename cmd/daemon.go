@@ -0,0 +1,51 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/awslabs/ssosync/internal"
+
+	"github.com/spf13/cobra"
+)
+
+var daemonCmd = &cobra.Command{
+	Use:   "daemon",
+	Short: "Run a sync on a schedule until stopped",
+	Long: `Keep running and sync AWS SSO from Google Workspace at every time of
+--schedule, until SIGINT or SIGTERM. The schedule is a cron expression or
+"every ..." with an optional time zone, e.g. "every weekday 07:00 Europe/London"
+or "0 7 * * 1-5 Europe/London", so syncs can be aligned with other jobs.
+
+The config file is watched: when it changes, the configuration is read
+again before the next sync, the flags and environment variables still
+taking precedence, and an invalid one is logged and ignored. The schedule
+itself is only read at startup.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer cancel()
+
+		return internal.DoDaemon(ctx, cfg, configFile, configReloader(cmd))
+	},
+}
+
+func init() {
+	daemonCmd.Flags().StringVar(&cfg.Schedule, "schedule", "", "when to sync, a cron expression or 'every ...' with an optional time zone, example: 'every weekday 07:00 Europe/London', '0 7 * * 1-5 Europe/London' or 'every 1h'")
+	rootCmd.AddCommand(daemonCmd)
+}
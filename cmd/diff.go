@@ -0,0 +1,50 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"os"
+
+	"github.com/awslabs/ssosync/internal"
+
+	"github.com/spf13/cobra"
+)
+
+var diffCmd = &cobra.Command{
+	Use:   "diff",
+	Short: "Show the changes a sync would make, with read-only access",
+	Long: `Compute every change a sync would make to AWS SSO, including the group
+memberships, and print them without changing anything. Only read access
+to Google Workspace and to the AWS SSO SCIM API is used.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		drift, err := internal.DoDiff(ctx, cfg, os.Stdout)
+		if err != nil {
+			return err
+		}
+		if detailedExitCode && drift {
+			return &exitError{code: driftExitCode}
+		}
+		return nil
+	},
+}
+
+func init() {
+	diffCmd.Flags().BoolVar(&detailedExitCode, "detailed-exitcode", false, detailedExitCodeUsage)
+	rootCmd.AddCommand(diffCmd)
+}
@@ -0,0 +1,75 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"os"
+
+	"github.com/awslabs/ssosync/internal"
+
+	"github.com/spf13/cobra"
+)
+
+// mappingProblemsExitCode is the exit code of mapping-report when it found
+// dead or missing groups
+const mappingProblemsExitCode = 2
+
+var mappingFormat string
+
+var mappingReportCmd = &cobra.Command{
+	Use:   "mapping-report <mappings.json>",
+	Short: "Report the AWS SSO groups out of sync with the permission set mappings",
+	Long: `Compare the AWS SSO groups with a JSON array of the permission set
+mappings, e.g. exported from Terraform:
+
+  [{"group": "AWS-dev", "permissionSet": "Developer", "accounts": ["111111111111"]}]
+
+and report the dead groups, in AWS SSO but mapped to nothing, and the
+missing groups, mapped to a permission set but not in AWS SSO. The exit
+code is 0 when there is none, 2 when there are some and 1 on errors. Only
+read access to the AWS SSO SCIM API is used.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		f, err := os.Open(args[0])
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		mappings, err := internal.ReadMappings(f)
+		if err != nil {
+			return err
+		}
+		r, err := internal.DoMappingReport(ctx, cfg, mappings)
+		if err != nil {
+			return err
+		}
+		if err := r.Write(os.Stdout, mappingFormat); err != nil {
+			return err
+		}
+		if r.Problems() {
+			return &exitError{code: mappingProblemsExitCode}
+		}
+		return nil
+	},
+}
+
+func init() {
+	mappingReportCmd.Flags().StringVar(&mappingFormat, "format", internal.MappingFormatText, "format of the report (text|json)")
+	rootCmd.AddCommand(mappingReportCmd)
+}
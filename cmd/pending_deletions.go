@@ -0,0 +1,38 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"os"
+
+	"github.com/awslabs/ssosync/internal"
+
+	"github.com/spf13/cobra"
+)
+
+var pendingDeletionsCmd = &cobra.Command{
+	Use:   "pending-deletions",
+	Short: "List the users and groups in quarantine, pending deletion",
+	Long: `List every user and group kept in quarantine by the deletion grace
+period, when it entered the quarantine and when it will be deleted, so
+false positives can be rescued in time. It reads the state file only.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return internal.WritePendingDeletions(cfg, os.Stdout)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(pendingDeletionsCmd)
+}
@@ -0,0 +1,68 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"io"
+	"os"
+
+	"github.com/awslabs/ssosync/internal"
+
+	"github.com/spf13/cobra"
+)
+
+var planOut string
+
+var planCmd = &cobra.Command{
+	Use:   "plan",
+	Short: "Write the changes a sync would make as a JSON plan",
+	Long: `Compute every change a sync would make to AWS SSO, including the group
+memberships, and write them as a JSON plan, without changing anything.
+The exit code is 0 when there is no change, 2 when there are changes and
+1 on errors. Only read access to Google Workspace and to the AWS SSO SCIM
+API is used.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		p, err := internal.DoPlan(ctx, cfg)
+		if err != nil {
+			return err
+		}
+
+		var w io.Writer = os.Stdout
+		if planOut != "" {
+			f, err := os.Create(planOut)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			w = f
+		}
+		if err := p.Write(w); err != nil {
+			return err
+		}
+		if p.Drift() {
+			return &exitError{code: driftExitCode}
+		}
+		return nil
+	},
+}
+
+func init() {
+	planCmd.Flags().StringVarP(&planOut, "out", "o", "", "path of the file to write the plan to, defaults to the standard output")
+	rootCmd.AddCommand(planCmd)
+}
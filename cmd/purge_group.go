@@ -0,0 +1,62 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/awslabs/ssosync/internal"
+	"github.com/awslabs/ssosync/internal/aws"
+
+	"github.com/spf13/cobra"
+)
+
+var purgeGroupOpts internal.PurgeOptions
+
+var purgeGroupCmd = &cobra.Command{
+	Use:   "purge-group",
+	Short: "Delete a single AWS SSO group managed by ssosync",
+	Long: `Delete a single AWS SSO group created by ssosync, removing its members
+first. The group and its members are shown and the name of the group must
+be typed to confirm, unless --yes is set. Every change is logged with
+audit=true.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if !cfg.Yes {
+			purgeGroupOpts.Confirm = confirmPurge
+		}
+		return internal.DoPurgeGroup(cfg, purgeGroupOpts)
+	},
+}
+
+// confirmPurge shows the group to purge and asks for its name to confirm
+func confirmPurge(group *aws.Group, members []*aws.User) bool {
+	fmt.Printf("Group %q (%s) and its %d membership(s) will be deleted:\n", group.DisplayName, group.ID, len(members))
+	for _, u := range members {
+		fmt.Printf("  - %s\n", u.Username)
+	}
+	fmt.Print("Type the name of the group to confirm: ")
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	return strings.TrimSpace(answer) == group.DisplayName
+}
+
+func init() {
+	purgeGroupCmd.Flags().StringVar(&purgeGroupOpts.Name, "name", "", "display name of the AWS SSO group to delete")
+	purgeGroupCmd.Flags().BoolVar(&purgeGroupOpts.Force, "force", false, "delete the group even if it was not created by ssosync")
+	_ = purgeGroupCmd.MarkFlagRequired("name")
+	rootCmd.AddCommand(purgeGroupCmd)
+}
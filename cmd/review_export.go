@@ -0,0 +1,60 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"io"
+	"os"
+
+	"github.com/awslabs/ssosync/internal"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	reviewFormat string
+	reviewOutput string
+)
+
+var reviewExportCmd = &cobra.Command{
+	Use:   "review-export",
+	Short: "Export who is in which AWS SSO group, for access reviews",
+	Long: `Export every member of every AWS SSO group, with the Google Workspace
+group it derives from and the time of the export, as CSV or JSON for
+access reviews. Only read access to Google Workspace and to the AWS SSO
+SCIM API is used.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		var w io.Writer = os.Stdout
+		if reviewOutput != "" {
+			f, err := os.Create(reviewOutput)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			w = f
+		}
+		return internal.DoReviewExport(ctx, cfg, reviewFormat, w)
+	},
+}
+
+func init() {
+	reviewExportCmd.Flags().StringVar(&reviewFormat, "format", internal.ReviewFormatCSV, "format of the export (csv|json)")
+	reviewExportCmd.Flags().StringVarP(&reviewOutput, "output", "o", "", "path of the file to write the export to, defaults to the standard output")
+	rootCmd.AddCommand(reviewExportCmd)
+}
@@ -17,14 +17,16 @@ package cmd
 
 import (
 	"context"
+	"encoding/base64"
 	"fmt"
+	"net/http"
 	"os"
 
 	"github.com/awslabs/ssosync/internal"
 	"github.com/awslabs/ssosync/internal/config"
+	"github.com/awslabs/ssosync/internal/errclass"
 
 	"github.com/aws/aws-lambda-go/lambda"
-	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/secretsmanager"
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
@@ -39,7 +41,37 @@ var (
 	builtBy = "unknown"
 )
 
-var cfg *config.Config
+// driftExitCode is the exit code when AWS SSO differs from Google Workspace,
+// or when changes were applied to make them equal
+const driftExitCode = 2
+
+// planNotApprovedExitCode is the exit code when a plan waits for its
+// approval, see --approval-deletion-threshold
+const planNotApprovedExitCode = 8
+
+// providerExitCodes are the exit codes of the runs failing with an error of
+// the AWS SSO or Google Workspace APIs, by the class of the error
+var providerExitCodes = map[errclass.Class]int{
+	errclass.Auth:       3,
+	errclass.Quota:      4,
+	errclass.Validation: 5,
+	errclass.Conflict:   6,
+	errclass.Transient:  7,
+}
+
+// detailedExitCode makes the commands exit with driftExitCode when there
+// are changes
+var detailedExitCode bool
+
+// detailedExitCodeUsage is the usage of the --detailed-exitcode flag
+const detailedExitCodeUsage = "exit with 0 when there was no change, 2 when changes were applied or found, another code on errors"
+
+// forceUsage is the usage of the --force flag of the commands applying changes
+const forceUsage = "apply the deletions even if they are over --max-user-deletions, --max-group-deletions or --max-deletion-percent"
+
+// cfg is created before any init function runs, as the commands bind their
+// flags to it in theirs
+var cfg = config.New()
 
 var rootCmd = &cobra.Command{
 	Version: "dev",
@@ -48,36 +80,155 @@ var rootCmd = &cobra.Command{
 	Long: `A command line tool to enable you to synchronise your Google
 Apps (Google Workspace) users to AWS Single Sign-on (AWS SSO)
 Complete documentation is available at https://github.com/awslabs/ssosync`,
-	RunE: func(cmd *cobra.Command, args []string) error {
-		ctx, cancel := context.WithCancel(context.Background())
-		defer cancel()
+	PersistentPreRunE: lintConfig,
+	RunE:              runSync,
+}
 
-		err := internal.DoSync(ctx, cfg)
+// lintConfig fails on contradictory settings, with the suggested fixes,
+// before any request is sent
+func lintConfig(cmd *cobra.Command, args []string) error {
+	if configFileErr != nil {
+		return configFileErr
+	}
+	if cfg.Offline && cmd != planCmd && cmd != diffCmd {
+		return fmt.Errorf("--offline only works with the plan and diff commands, not %s", cmd.CommandPath())
+	}
+	problems := config.Lint(cfg)
+	if len(problems) == 0 {
+		return nil
+	}
+	for _, p := range problems {
+		fmt.Fprintf(os.Stderr, "config: %s\n", p)
+	}
+	return fmt.Errorf("invalid configuration, %d problem(s) found", len(problems))
+}
+
+// runSync runs the synchronization, for the root and the sync commands
+func runSync(cmd *cobra.Command, args []string) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	report, err := internal.DoSync(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	if detailedExitCode && report.HasChanges() {
+		return &exitError{code: driftExitCode}
+	}
+
+	return nil
+}
+
+// exitError makes the command exit with code, without logging an error
+type exitError struct {
+	code int
+}
+
+func (e *exitError) Error() string {
+	return fmt.Sprintf("exit code %d", e.code)
+}
+
+// lambdaEvent is the payload of a Lambda invocation, other events, e.g.
+// scheduled ones, have none of its fields
+type lambdaEvent struct {
+	// ApprovalToken approves the plan held with this token
+	ApprovalToken string `json:"approvalToken"`
+	// Watch registers the channels of the push notifications instead of
+	// syncing, see the watch command
+	Watch bool `json:"watch"`
+	// Headers, Body and IsBase64Encoded are set for the requests of Amazon
+	// API Gateway, the push notifications of Google Workspace
+	Headers         map[string]string `json:"headers"`
+	Body            string            `json:"body"`
+	IsBase64Encoded bool              `json:"isBase64Encoded"`
+}
+
+// lambdaResponse is the response of the Lambda to Amazon API Gateway, nil
+// for the other events
+type lambdaResponse struct {
+	StatusCode int `json:"statusCode"`
+}
+
+// handleLambda runs ssosync for a Lambda invocation
+func handleLambda(ctx context.Context, e lambdaEvent) (*lambdaResponse, error) {
+	// the config outlives the invocations of a warm Lambda, every invocation
+	// is a run of its own
+	cfg.RunID = ""
+	cfg.ApprovalToken = e.ApprovalToken
+	if configFileErr != nil {
+		return nil, configFileErr
+	}
+	switch {
+	case e.Headers != nil:
+		return handleNotification(ctx, e)
+	case e.Watch:
+		initConfig()
+		_, err := internal.DoWatch(ctx, cfg)
+		return nil, err
+	default:
+		return nil, rootCmd.Execute()
+	}
+}
+
+// handleNotification syncs the users of a push notification delivered by
+// Amazon API Gateway. A rejected notification is answered with 403, a
+// failed sync with 500 so Google Workspace delivers it again.
+func handleNotification(ctx context.Context, e lambdaEvent) (*lambdaResponse, error) {
+	initConfig()
+	header := make(http.Header, len(e.Headers))
+	for k, v := range e.Headers {
+		header.Set(k, v)
+	}
+	body := []byte(e.Body)
+	if e.IsBase64Encoded {
+		b, err := base64.StdEncoding.DecodeString(e.Body)
 		if err != nil {
-			return err
+			return &lambdaResponse{StatusCode: http.StatusBadRequest}, nil
 		}
-
-		return nil
-	},
+		body = b
+	}
+	err := internal.DoNotification(ctx, cfg, header, body)
+	switch {
+	case errors.Is(err, internal.ErrNotificationRejected):
+		return &lambdaResponse{StatusCode: http.StatusForbidden}, nil
+	case err != nil:
+		return &lambdaResponse{StatusCode: http.StatusInternalServerError}, nil
+	default:
+		return &lambdaResponse{StatusCode: http.StatusOK}, nil
+	}
 }
 
 // Execute is the entry point of the command. If we are
 // running inside of AWS Lambda, we use the Lambda
 // execution path.
 func Execute() {
+	readConfigFile(os.Args[1:])
+
 	if cfg.IsLambda {
-		lambda.Start(rootCmd.Execute)
+		lambda.Start(handleLambda)
 	}
 
 	if err := rootCmd.Execute(); err != nil {
+		var exit *exitError
+		if errors.As(err, &exit) {
+			os.Exit(exit.code)
+		}
+		if errors.Is(err, internal.ErrPlanNotApproved) {
+			log.Error(err)
+			os.Exit(planNotApprovedExitCode)
+		}
+		if class := errclass.Of(err); class != "" {
+			log.WithField("errorClass", class).Error(err)
+			os.Exit(providerExitCodes[class])
+		}
 		log.Fatal(err)
 	}
 }
 
 func init() {
 	// init config
-	cfg = config.New()
 	cfg.IsLambda = len(os.Getenv("_LAMBDA_SERVER_PORT")) > 0
+	cfg.Version = version
 
 	// initialize cobra
 	cobra.OnInitialize(initConfig)
@@ -107,9 +258,93 @@ func initConfig() {
 		"ignore_users",
 		"ignore_groups",
 		"include_groups",
+		"include_users",
+		"allowed_domains",
+		"custom_schema_filters",
+		"skip_suspended_users",
+		"sync_extended_attributes",
+		"sync_language",
+		"sync_aliases",
+		"user_name",
+		"archived_users",
+		"include_org_units",
+		"ignore_org_units",
 		"user_match",
 		"group_match",
+		"group_labels",
+		"group_name_prefix",
+		"group_name_suffix",
+		"group_names_file",
 		"sync_method",
+		"aws_profile",
+		"scim_access_token_secret",
+		"scim_read_access_token",
+		"scim_read_aws_profile",
+		"scim_sigv4",
+		"scim_sigv4_service",
+		"scim_sigv4_region",
+		"scim_headers",
+		"state_file",
+		"snapshot_file",
+		"aws_cache_file",
+		"aws_cache_ttl",
+		"offline",
+		"skip_unchanged_users",
+		"deletion_grace_period",
+		"restore_window",
+		"max_group_members",
+		"group_overflow",
+		"missing_names",
+		"oversized_attributes",
+		"external_members",
+		"missing_name_placeholder",
+		"membership_batch_size",
+		"groups",
+		"google_concurrency",
+		"google_requests_per_second",
+		"flap_threshold",
+		"all_users",
+		"blackout_windows",
+		"schedule",
+		"watch_address",
+		"watch_token",
+		"watch_ttl",
+		"teams_webhook_url",
+		"pagerduty_routing_key",
+		"jira_url",
+		"jira_user",
+		"jira_token",
+		"jira_project",
+		"jira_approved_status",
+		"approval_deletion_threshold",
+		"max_user_deletions",
+		"max_group_deletions",
+		"max_users",
+		"max_groups",
+		"max_deletion_percent",
+		"approval_token",
+		"approval_plan_url",
+		"approval_sns_topic_arn",
+		"dry_run",
+		"scim_concurrency",
+		"scim_page_size",
+		"scim_bulk_size",
+		"scim_rps",
+		"scim_max_conns",
+		"scim_idle_conn_timeout",
+		"scim_keep_alive",
+		"scim_http2",
+		"scim_patch_users",
+		"scim_request_timeout",
+		"pprof",
+		"pprof_file",
+		"google_page_size",
+		"features",
+		"yes",
+		"fault_latency",
+		"fault_error_rate",
+		"fault_throttle_rate",
+		"fault_throttle_duration",
 	}
 
 	for _, e := range appEnvVars {
@@ -131,7 +366,10 @@ func initConfig() {
 }
 
 func configLambda() {
-	s := session.Must(session.NewSession())
+	s, err := config.NewAWSSession(cfg.AWSProfile)
+	if err != nil {
+		log.Fatalf(errors.Wrap(err, "cannot create aws session").Error())
+	}
 	svc := secretsmanager.New(s)
 	secrets := config.NewSecrets(svc)
 
@@ -161,21 +399,103 @@ func configLambda() {
 }
 
 func addFlags(cmd *cobra.Command, cfg *config.Config) {
-	rootCmd.PersistentFlags().StringVarP(&cfg.GoogleCredentials, "google-admin", "a", config.DefaultGoogleCredentials, "path to find credentials file for Google Workspace")
+	rootCmd.Flags().BoolVar(&cfg.Force, "force", false, forceUsage)
+	rootCmd.Flags().BoolVar(&detailedExitCode, "detailed-exitcode", false, detailedExitCodeUsage)
+	rootCmd.PersistentFlags().StringVar(&configProfile, "profile", "", "name of the profile of the config file to use, e.g. dev, staging or prod, its settings override the other ones of the file")
+	rootCmd.PersistentFlags().StringVar(&configFile, "config", "", "path of the YAML config file, whose keys are the SSOSYNC_ environment variables in lower case without the prefix, defaults to "+config.DefaultConfigFile+" if it exists")
 	rootCmd.PersistentFlags().BoolVarP(&cfg.Debug, "debug", "d", config.DefaultDebug, "enable verbose / debug logging")
+	rootCmd.PersistentFlags().StringSliceVar(&cfg.Features, "features", []string{}, "optional features to enable, example: 'scim_group_members'")
+	rootCmd.PersistentFlags().BoolVarP(&cfg.Yes, "yes", "y", false, "do not ask for the confirmation of destructive changes when run in a terminal")
+	rootCmd.PersistentFlags().DurationVar(&cfg.FaultLatency, "fault-latency", 0, "testing only: inject a random latency up to this duration in every request to Google Workspace and AWS SSO")
+	rootCmd.PersistentFlags().Float64Var(&cfg.FaultErrorRate, "fault-error-rate", 0, "testing only: probability, between 0 and 1, of failing a request to Google Workspace or AWS SSO with a 500 error")
+	rootCmd.PersistentFlags().Float64Var(&cfg.FaultThrottleRate, "fault-throttle-rate", 0, "testing only: probability, between 0 and 1, of a request to Google Workspace or AWS SSO starting a storm of 429 errors")
+	rootCmd.PersistentFlags().DurationVar(&cfg.FaultThrottleDuration, "fault-throttle-duration", config.DefaultFaultThrottleDuration, "testing only: duration of the storms of 429 errors started by --fault-throttle-rate")
+	rootCmd.PersistentFlags().BoolVar(&cfg.DryRun, "dry-run", false, "compute and log every change to AWS SSO without applying it, nor saving the state")
 	rootCmd.PersistentFlags().StringVarP(&cfg.LogFormat, "log-format", "", config.DefaultLogFormat, "log format")
 	rootCmd.PersistentFlags().StringVarP(&cfg.LogLevel, "log-level", "", config.DefaultLogLevel, "log level")
-	rootCmd.Flags().StringVarP(&cfg.SCIMAccessToken, "access-token", "t", "", "AWS SSO SCIM API Access Token")
-	rootCmd.Flags().StringVarP(&cfg.SCIMEndpoint, "endpoint", "e", "", "AWS SSO SCIM API Endpoint")
-	rootCmd.Flags().StringVarP(&cfg.GoogleCredentials, "google-credentials", "c", config.DefaultGoogleCredentials, "path to Google Workspace credentials file")
-	rootCmd.Flags().StringVarP(&cfg.GoogleAdmin, "google-admin", "u", "", "Google Workspace admin user email")
-	rootCmd.Flags().StringVarP(&cfg.GoogleCustomerId, "google-customer-id", "", config.DefaultGoogleCustomerId, "Google Workspace customer id")
-	rootCmd.Flags().StringSliceVar(&cfg.IgnoreUsers, "ignore-users", []string{}, "ignores these Google Workspace users")
-	rootCmd.Flags().StringSliceVar(&cfg.IgnoreGroups, "ignore-groups", []string{}, "ignores these Google Workspace groups")
-	rootCmd.Flags().StringSliceVar(&cfg.IncludeGroups, "include-groups", []string{}, "include only these Google Workspace groups, NOTE: only works when --sync-method 'users_groups'")
-	rootCmd.Flags().StringVarP(&cfg.UserMatch, "user-match", "m", "", "Google Workspace Users filter query parameter, example: 'name:John* email:admin*', see: https://developers.google.com/admin-sdk/directory/v1/guides/search-users")
-	rootCmd.Flags().StringVarP(&cfg.GroupMatch, "group-match", "g", "", "Google Workspace Groups filter query parameter, example: 'name:Admin* email:aws-*', see: https://developers.google.com/admin-sdk/directory/v1/guides/search-groups")
-	rootCmd.Flags().StringVarP(&cfg.SyncMethod, "sync-method", "s", config.DefaultSyncMethod, "Sync method to use (users_groups|groups)")
+	rootCmd.PersistentFlags().StringVarP(&cfg.SCIMAccessToken, "access-token", "t", "", "AWS SSO SCIM API Access Token")
+	rootCmd.PersistentFlags().StringVarP(&cfg.SCIMEndpoint, "endpoint", "e", "", "AWS SSO SCIM API Endpoint")
+	rootCmd.PersistentFlags().StringVar(&cfg.SCIMAccessTokenSecret, "access-token-secret", "", "name or ARN of the AWS Secrets Manager secret the AWS SSO SCIM API Access Token is read from, instead of --access-token")
+	rootCmd.PersistentFlags().StringVar(&cfg.SCIMReadAccessToken, "read-access-token", "", "AWS SSO SCIM API Access Token used instead of --access-token by the commands that only read, e.g. diff and plan")
+	rootCmd.PersistentFlags().StringVar(&cfg.SCIMReadAWSProfile, "read-aws-profile", "", "AWS shared config profile signing the SCIM requests instead of --aws-profile in the commands that only read, requires --scim-sigv4")
+	rootCmd.PersistentFlags().StringVarP(&cfg.GoogleCredentials, "google-credentials", "c", config.DefaultGoogleCredentials, "path to Google Workspace credentials file")
+	rootCmd.PersistentFlags().StringVarP(&cfg.GoogleAdmin, "google-admin", "u", "", "Google Workspace admin user email")
+	rootCmd.PersistentFlags().StringVarP(&cfg.GoogleCustomerId, "google-customer-id", "", config.DefaultGoogleCustomerId, "Google Workspace customer id")
+	rootCmd.PersistentFlags().StringSliceVar(&cfg.IgnoreUsers, "ignore-users", []string{}, "ignores these Google Workspace users")
+	rootCmd.PersistentFlags().StringSliceVar(&cfg.IgnoreGroups, "ignore-groups", []string{}, "ignores these Google Workspace groups")
+	rootCmd.PersistentFlags().StringSliceVar(&cfg.IncludeGroups, "include-groups", []string{}, "include only these Google Workspace groups, NOTE: only works when --sync-method 'users_groups'")
+	rootCmd.PersistentFlags().StringSliceVar(&cfg.IncludeUsers, "include-users", []string{}, "include only these Google Workspace users, NOTE: only works when --sync-method 'users_groups'")
+	rootCmd.PersistentFlags().StringSliceVar(&cfg.AllowedDomains, "allowed-domains", []string{}, "sync only the Google Workspace users whose primary email is in these domains, example: 'corp.com,corp.co.uk'")
+	rootCmd.PersistentFlags().StringSliceVar(&cfg.CustomSchemaFilters, "custom-schema-filters", []string{}, "sync only the Google Workspace users whose custom schemas match all of these filters, example: 'customSchemas.Employment.syncToAWS=true'")
+	rootCmd.PersistentFlags().StringVar(&cfg.ArchivedUsers, "archived-users", config.DefaultArchivedUsers, "what to do with the AWS SSO users of the archived Google Workspace users (deactivate|delete|ignore), ignore leaves them and their group memberships as they are")
+	rootCmd.PersistentFlags().BoolVarP(&cfg.SkipSuspendedUsers, "skip-suspended-users", "", false, "treat the suspended Google Workspace users as nonexistent, they are deleted from AWS SSO instead of being synced as inactive users")
+	rootCmd.PersistentFlags().BoolVar(&cfg.SyncExtendedAttributes, "sync-extended-attributes", false, "sync the phone number, title, address and enterprise attributes of the Google Workspace users to AWS SSO")
+	rootCmd.PersistentFlags().StringVar(&cfg.UserName, "user-name", config.DefaultUserName, "user name of the AWS SSO users (email|local|id) or its template, e.g. '{{.Local | lower}}', their primary email stays in their emails")
+	rootCmd.PersistentFlags().BoolVar(&cfg.SyncAliases, "sync-aliases", false, "sync the email aliases of the Google Workspace users to AWS SSO as emails of type alias, not primary")
+	rootCmd.PersistentFlags().BoolVar(&cfg.SyncLanguage, "sync-language", false, "sync the preferred language of the Google Workspace users to the preferred language and locale of the AWS SSO users")
+	rootCmd.PersistentFlags().StringSliceVar(&cfg.IncludeOrgUnits, "include-org-units", []string{}, "include only the Google Workspace users of these organizational units and their sub-units, example: '/Employees,/Interns'")
+	rootCmd.PersistentFlags().StringSliceVar(&cfg.IgnoreOrgUnits, "ignore-org-units", []string{}, "ignores the Google Workspace users of these organizational units and their sub-units, example: '/Contractors,/Service Accounts'")
+	rootCmd.PersistentFlags().StringVarP(&cfg.UserMatch, "user-match", "m", "", "Google Workspace Users filter query parameter, example: 'name:John* email:admin*', see: https://developers.google.com/admin-sdk/directory/v1/guides/search-users")
+	rootCmd.PersistentFlags().StringSliceVar(&cfg.GroupLabels, "group-labels", []string{}, "sync only the Google Workspace groups with any of these Cloud Identity labels, example: 'cloudidentity.googleapis.com/groups.security'")
+	rootCmd.PersistentFlags().StringSliceVarP(&cfg.GroupMatch, "group-match", "g", []string{}, "Google Workspace Groups filter query parameters, the groups matching any of them are synced, example: 'name:Admin* email:aws-*,email:cloud-*', see: https://developers.google.com/admin-sdk/directory/v1/guides/search-groups")
+	rootCmd.PersistentFlags().StringVar(&cfg.GroupNamePrefix, "group-name-prefix", "", "prepended to the names of the Google Workspace groups to name the AWS SSO groups, example: 'GW-'")
+	rootCmd.PersistentFlags().StringVar(&cfg.GroupNameSuffix, "group-name-suffix", "", "appended to the names of the Google Workspace groups to name the AWS SSO groups, example: '-GW'")
+	rootCmd.PersistentFlags().StringVar(&cfg.GroupNamesFile, "group-names-file", "", "path of a JSON object of the names of the AWS SSO groups by Google Workspace group email, example: '{\"aws-dev@corp.com\": \"Developers\"}'")
+	rootCmd.PersistentFlags().StringVarP(&cfg.SyncMethod, "sync-method", "s", config.DefaultSyncMethod, "Sync method to use (users_groups|groups)")
+	rootCmd.PersistentFlags().StringVarP(&cfg.AWSProfile, "aws-profile", "", "", "AWS shared config profile to use for AWS API calls, defaults to the standard AWS credential chain")
+	rootCmd.PersistentFlags().BoolVarP(&cfg.SCIMSigV4, "scim-sigv4", "", false, "sign AWS SSO SCIM API requests with AWS Signature Version 4, e.g. when proxied by Amazon API Gateway")
+	rootCmd.PersistentFlags().StringVarP(&cfg.SCIMSigV4Service, "scim-sigv4-service", "", config.DefaultSCIMSigV4Service, "service name used to sign AWS SSO SCIM API requests")
+	rootCmd.PersistentFlags().StringVarP(&cfg.SCIMSigV4Region, "scim-sigv4-region", "", "", "region used to sign AWS SSO SCIM API requests, defaults to the region of the AWS credential chain")
+	rootCmd.PersistentFlags().StringSliceVar(&cfg.SCIMHeaders, "scim-headers", []string{}, "extra headers added to every AWS SSO SCIM API request, example: 'X-Waf-Token=secret,X-Trace=ssosync'")
+	rootCmd.PersistentFlags().StringVarP(&cfg.StateFile, "state-file", "", "", "path of the file keeping the sync state between runs, or s3://bucket/key to keep it in S3")
+	rootCmd.PersistentFlags().StringVar(&cfg.AWSCacheFile, "aws-cache-file", "", "path of the file keeping the AWS SSO users, groups and members seen by the last run, which the next runs diff against, only verifying the changes found with the SCIM API")
+	rootCmd.PersistentFlags().DurationVar(&cfg.AWSCacheTTL, "aws-cache-ttl", config.DefaultAWSCacheTTL, "age of the AWS cache after which AWS SSO is read again, catching the changes made outside of ssosync")
+	rootCmd.PersistentFlags().StringVar(&cfg.Pprof, "pprof", "", "write a profile of the sync run to --pprof-file, to report performance issues (cpu|mem|trace)")
+	rootCmd.PersistentFlags().StringVar(&cfg.PprofFile, "pprof-file", "", "path of the file --pprof is written to, defaults to ssosync.<profile>.pprof in the temporary directory")
+	rootCmd.PersistentFlags().StringVar(&cfg.SnapshotFile, "snapshot-file", "", "path of the file plan and diff write a copy of the Google Workspace and AWS SSO data they read to, see --offline")
+	rootCmd.PersistentFlags().BoolVar(&cfg.Offline, "offline", false, "make plan and diff read from --snapshot-file instead of Google Workspace and AWS SSO, the changes may be stale, the other commands fail with it")
+	rootCmd.PersistentFlags().BoolVarP(&cfg.SkipUnchangedUsers, "skip-unchanged-users", "", false, "skip Google Workspace users not changed since the last run, NOTE: requires --state-file")
+	rootCmd.PersistentFlags().DurationVar(&cfg.DeletionGracePeriod, "deletion-grace-period", 0, "keep users and groups removed from Google Workspace in quarantine for this long before deleting them, example: '72h', NOTE: requires --state-file")
+	rootCmd.PersistentFlags().DurationVar(&cfg.RestoreWindow, "restore-window", 0, "restore the group memberships of the users deleted and restored in Google Workspace within this long, example: '480h', NOTE: requires --state-file")
+	rootCmd.PersistentFlags().IntVar(&cfg.MaxGroupMembers, "max-group-members", 0, "maximum number of members of an AWS SSO group, 0 is unlimited, NOTE: only works when --sync-method 'groups'")
+	rootCmd.PersistentFlags().StringVar(&cfg.GroupOverflow, "group-overflow", config.DefaultGroupOverflow, "what to do with groups over --max-group-members (fail|truncate|split)")
+	rootCmd.PersistentFlags().StringVar(&cfg.MissingNames, "missing-names", config.DefaultMissingNames, "what to do with Google users without a given or family name, e.g. service mailboxes (fail|skip|placeholder)")
+	rootCmd.PersistentFlags().StringVar(&cfg.OversizedAttributes, "oversized-attributes", config.DefaultOversizedAttributes, "what to do with Google users with attributes longer than AWS SSO allows (fail|truncate|skip)")
+	rootCmd.PersistentFlags().StringVar(&cfg.ExternalMembers, "external-members", config.DefaultExternalMembers, "what to do with the members of Google Workspace groups who aren't users of the Workspace, e.g. of other domains (skip|warn|fail), NOTE: only works when --sync-method 'groups'")
+	rootCmd.PersistentFlags().StringVar(&cfg.MissingNamePlaceholder, "missing-name-placeholder", config.DefaultMissingNamePlaceholder, "template of the names missing with --missing-names placeholder, with the fields .Email and .Local, the part of the email before the @")
+	rootCmd.PersistentFlags().IntVar(&cfg.MembershipBatchSize, "membership-batch-size", config.DefaultMembershipBatchSize, "number of group membership changes applied between two checkpoints of the state")
+	rootCmd.PersistentFlags().IntVar(&cfg.SCIMConcurrency, "scim-concurrency", config.DefaultSCIMConcurrency, "number of concurrent AWS SSO SCIM requests applying changes")
+	rootCmd.PersistentFlags().IntVar(&cfg.SCIMPageSize, "scim-page-size", 0, "number of users or groups in each page listed from AWS SSO, 0 is the endpoint default")
+	rootCmd.PersistentFlags().IntVar(&cfg.SCIMBulkSize, "scim-bulk-size", 0, "number of users created per request to the SCIM /Bulk endpoint, when it supports bulk operations, 0 creates them one by one")
+	rootCmd.PersistentFlags().Float64Var(&cfg.SCIMRequestsPerSecond, "scim-rps", 0, "maximum rate of requests to AWS SSO SCIM, 0 is unlimited")
+	rootCmd.PersistentFlags().IntVar(&cfg.SCIMMaxConns, "scim-max-conns", 0, "maximum number of connections to AWS SSO SCIM, all kept open when idle, 0 is unlimited")
+	rootCmd.PersistentFlags().DurationVar(&cfg.SCIMIdleConnTimeout, "scim-idle-conn-timeout", config.DefaultSCIMIdleConnTimeout, "how long an idle connection to AWS SSO SCIM is kept open for the next requests")
+	rootCmd.PersistentFlags().BoolVar(&cfg.SCIMKeepAlive, "scim-keep-alive", true, "reuse the connections to AWS SSO SCIM between requests, --scim-keep-alive=false opens one per request")
+	rootCmd.PersistentFlags().BoolVar(&cfg.SCIMHTTP2, "scim-http2", true, "attempt HTTP/2 with AWS SSO SCIM, --scim-http2=false uses HTTP/1.1 connections only")
+	rootCmd.PersistentFlags().BoolVar(&cfg.SCIMPatchUsers, "scim-patch-users", true, "update the AWS SSO users with PATCH requests of their changed attributes, --scim-patch-users=false replaces them with PUT")
+	rootCmd.PersistentFlags().DurationVar(&cfg.SCIMRequestTimeout, "scim-request-timeout", 0, "timeout of each request to AWS SSO SCIM, each retry having its own, 0 is none")
+	rootCmd.PersistentFlags().Int64Var(&cfg.GooglePageSize, "google-page-size", 0, "number of users, groups or members in each page listed from Google Workspace, 0 is the API maximum")
+	rootCmd.PersistentFlags().IntVar(&cfg.GoogleConcurrency, "google-concurrency", config.DefaultGoogleConcurrency, "number of concurrent requests fetching the members of Google Workspace groups and looking up their users")
+	rootCmd.PersistentFlags().Float64Var(&cfg.GoogleRequestsPerSecond, "google-requests-per-second", config.DefaultGoogleRequestsPerSecond, "maximum rate of requests to Google Workspace, 0 is unlimited")
+	rootCmd.PersistentFlags().IntVar(&cfg.FlapThreshold, "flap-threshold", 0, "suppress the changes to users, groups and memberships flipping between add and delete for this many consecutive runs, 0 disables it, NOTE: requires --state-file")
+	rootCmd.PersistentFlags().BoolVar(&cfg.AllUsers, "all-users", false, "provision every Google Workspace user matching --user-match, not only the members of the groups, NOTE: only works when --sync-method 'groups'")
+	rootCmd.PersistentFlags().StringSliceVar(&cfg.BlackoutWindows, "blackout-windows", []string{}, "windows during which deletions and membership removals are deferred, example: 'Mon-Fri 09:00-18:00 Europe/London,2026-12-20..2027-01-03'")
+	rootCmd.PersistentFlags().StringVar(&cfg.TeamsWebhookURL, "teams-webhook-url", "", "Microsoft Teams incoming webhook URL receiving the summary card of every run")
+	rootCmd.PersistentFlags().StringVar(&cfg.PagerDutyRoutingKey, "pagerduty-routing-key", "", "PagerDuty Events API v2 integration key, an alert is triggered when a run fails")
+	rootCmd.PersistentFlags().StringVar(&cfg.JiraURL, "jira-url", "", "base URL of the Jira tracking the approval of plans with more than --approval-deletion-threshold deletions, example: 'https://corp.atlassian.net'")
+	rootCmd.PersistentFlags().StringVar(&cfg.JiraUser, "jira-user", "", "Jira user opening the approval issues")
+	rootCmd.PersistentFlags().StringVar(&cfg.JiraToken, "jira-token", "", "Jira API token of --jira-user")
+	rootCmd.PersistentFlags().StringVar(&cfg.JiraProject, "jira-project", "", "key of the Jira project of the approval issues")
+	rootCmd.PersistentFlags().StringVar(&cfg.JiraApprovedStatus, "jira-approved-status", config.DefaultJiraApprovedStatus, "status of approved Jira issues")
+	rootCmd.PersistentFlags().IntVar(&cfg.MaxUserDeletions, "max-user-deletions", config.DefaultMaxUserDeletions, "maximum number of users deleted by a run, 0 is unlimited, see --force")
+	rootCmd.PersistentFlags().IntVar(&cfg.MaxGroupDeletions, "max-group-deletions", config.DefaultMaxGroupDeletions, "maximum number of groups deleted by a run, 0 is unlimited, see --force")
+	rootCmd.PersistentFlags().IntVar(&cfg.MaxUsers, "max-users", 0, "maximum number of Google Workspace users synced, a run finding more is aborted before any change, 0 is unlimited, NOTE: only works when --sync-method 'groups'")
+	rootCmd.PersistentFlags().IntVar(&cfg.MaxGroups, "max-groups", 0, "maximum number of Google Workspace groups synced, a run finding more is aborted before any change, 0 is unlimited, NOTE: only works when --sync-method 'groups'")
+	rootCmd.PersistentFlags().Float64Var(&cfg.MaxDeletionPercent, "max-deletion-percent", 0, "maximum percentage of the AWS SSO users, or groups, deleted by a run, 0 is unlimited, see --force")
+	rootCmd.PersistentFlags().IntVar(&cfg.ApprovalDeletionThreshold, "approval-deletion-threshold", 0, "number of user and group deletions above which a plan must be approved before it is applied, NOTE: requires --jira-url, --approval-plan-url or --approval-token")
+	rootCmd.PersistentFlags().StringVar(&cfg.ApprovalPlanURL, "approval-plan-url", "", "s3://bucket/prefix where the plans waiting for an approval are held until a run with their --approval-token applies them")
+	rootCmd.PersistentFlags().StringVar(&cfg.ApprovalSNSTopicARN, "approval-sns-topic-arn", "", "ARN of the SNS topic notifying the approvers of the plans held in --approval-plan-url")
+	rootCmd.PersistentFlags().StringVar(&cfg.ApprovalToken, "approval-token", "", "approves the plan with this token, as given by the run waiting for the approval")
 }
 
 func logConfig(cfg *config.Config) {
@@ -0,0 +1,37 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+var syncCmd = &cobra.Command{
+	Use:   "sync",
+	Short: "Sync AWS SSO from Google Workspace, optionally for some groups only",
+	Long: `Sync the users and groups of AWS SSO from Google Workspace, like ssosync
+without a command. With --groups, fetching, diffing and applying are
+restricted to these groups and their members, for quick targeted fixes
+without a full reconciliation: users and groups out of scope are never
+deleted.`,
+	RunE: runSync,
+}
+
+func init() {
+	syncCmd.Flags().StringSliceVar(&cfg.Groups, "groups", []string{}, "sync only these Google Workspace groups, by email, and their members, example: 'aws-dev@corp.com,aws-ops@corp.com'")
+	syncCmd.Flags().BoolVar(&cfg.Force, "force", false, forceUsage)
+	syncCmd.Flags().BoolVar(&detailedExitCode, "detailed-exitcode", false, detailedExitCodeUsage)
+	rootCmd.AddCommand(syncCmd)
+}
@@ -0,0 +1,44 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+
+	"github.com/awslabs/ssosync/internal"
+
+	"github.com/spf13/cobra"
+)
+
+var syncUserCmd = &cobra.Command{
+	Use:   "sync-user <email>",
+	Short: "Sync a single user and its group memberships",
+	Long: `Reconcile exactly one Google Workspace user with AWS SSO: its attributes
+and its membership of every group in scope (see --group-match,
+--ignore-groups and --groups). Useful when someone reports missing AWS
+access.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		return internal.DoSyncUser(ctx, cfg, args[0])
+	},
+}
+
+func init() {
+	syncUserCmd.Flags().StringSliceVar(&cfg.Groups, "groups", []string{}, "reconcile only the memberships of these Google Workspace groups, by email, example: 'aws-dev@corp.com,aws-ops@corp.com'")
+	rootCmd.AddCommand(syncUserCmd)
+}
@@ -0,0 +1,59 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"os"
+
+	"github.com/awslabs/ssosync/internal"
+
+	"github.com/spf13/cobra"
+)
+
+// notReadyExitCode is the exit code of validate when a check failed
+const notReadyExitCode = 2
+
+var validateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Check ssosync is ready to sync, without changing anything",
+	Long: `Check the configuration, the Google Workspace credentials, the
+impersonation of the admin and the scopes granted to the service account,
+the user and group queries, and the SCIM endpoint and access tokens, then
+print a readiness report. Only a page of the users and groups is read, and
+nothing is changed. The exit code is 0 when every check passed, 2 when one
+failed and 1 on errors.`,
+	// the contradictory settings are reported with the other checks
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		return configFileErr
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		r := internal.DoPreflight(ctx, cfg)
+		if err := r.Write(os.Stdout); err != nil {
+			return err
+		}
+		if !r.Ready() {
+			return &exitError{code: notReadyExitCode}
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(validateCmd)
+}
@@ -0,0 +1,54 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/awslabs/ssosync/internal"
+	"github.com/awslabs/ssosync/internal/config"
+
+	"github.com/spf13/cobra"
+)
+
+var watchCmd = &cobra.Command{
+	Use:   "watch",
+	Short: "Register the channels of the Google Workspace push notifications",
+	Long: `Register the channels delivering push notifications of the changes to the
+users and group memberships of Google Workspace to --watch-address, e.g. an
+Amazon API Gateway in front of the ssosync Lambda function, which then syncs
+only the users notified. The channels expire after --watch-ttl, 6h at most,
+so watch must be run again before, e.g. on a schedule. The users deleted in
+Google Workspace are still deleted by the scheduled full syncs.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		channels, err := internal.DoWatch(ctx, cfg)
+		for _, c := range channels {
+			fmt.Printf("%s\t%s\texpires %s\n", c.ID, c.Resource, c.Expiration.Format(time.RFC3339))
+		}
+		return err
+	},
+}
+
+func init() {
+	watchCmd.Flags().StringVar(&cfg.WatchAddress, "watch-address", "", "https URL the notifications are delivered to, e.g. of Amazon API Gateway")
+	watchCmd.Flags().StringVar(&cfg.WatchToken, "watch-token", "", "secret token of the channels, the notifications without it are rejected")
+	watchCmd.Flags().DurationVar(&cfg.WatchTTL, "watch-ttl", config.DefaultWatchTTL, "lifetime of the channels, 6h at most")
+	rootCmd.AddCommand(watchCmd)
+}
@@ -0,0 +1,77 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"github.com/awslabs/ssosync/internal/aws"
+	admin "google.golang.org/api/admin/directory/v1"
+)
+
+// aliasEmailType is the type of the emails of the aliases of a user
+const aliasEmailType = "alias"
+
+// withAliases adds the aliases of the Google user gUser to the emails of u,
+// not primary, and returns u. The aliases Google Workspace derives from the
+// domain aliases are added too.
+func withAliases(u *aws.User, gUser *admin.User) *aws.User {
+	for _, a := range googleAliases(gUser) {
+		u.Emails = append(u.Emails, aws.UserEmail{Value: a, Type: aliasEmailType})
+	}
+	return u
+}
+
+// googleAliases returns the aliases of the Google user gUser, editable or
+// not, without duplicates nor its primary email. The previous primary email
+// of a renamed user is one of them.
+func googleAliases(gUser *admin.User) []string {
+	seen := map[string]bool{aws.NormalizeName(gUser.PrimaryEmail): true}
+	aliases := make([]string, 0, len(gUser.Aliases)+len(gUser.NonEditableAliases))
+	for _, a := range append(append([]string(nil), gUser.Aliases...), gUser.NonEditableAliases...) {
+		if seen[aws.NormalizeName(a)] {
+			continue
+		}
+		seen[aws.NormalizeName(a)] = true
+		aliases = append(aliases, a)
+	}
+	return aliases
+}
+
+// aliasesOf returns the emails of the aliases of u
+func aliasesOf(u *aws.User) []string {
+	aliases := make([]string, 0)
+	for _, e := range u.Emails {
+		if e.Type == aliasEmailType && !e.Primary {
+			aliases = append(aliases, e.Value)
+		}
+	}
+	return aliases
+}
+
+// copyAliases replaces the aliases of dst with the ones of src, the other
+// emails of dst are kept
+func copyAliases(dst *aws.User, src *aws.User) {
+	emails := make([]aws.UserEmail, 0, len(dst.Emails))
+	for _, e := range dst.Emails {
+		if e.Type != aliasEmailType || e.Primary {
+			emails = append(emails, e)
+		}
+	}
+	for _, e := range src.Emails {
+		if e.Type == aliasEmailType && !e.Primary {
+			emails = append(emails, e)
+		}
+	}
+	dst.Emails = emails
+}
@@ -0,0 +1,85 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"testing"
+
+	"github.com/awslabs/ssosync/internal/aws"
+	awsfake "github.com/awslabs/ssosync/internal/aws/fake"
+	"github.com/awslabs/ssosync/internal/config"
+	googlefake "github.com/awslabs/ssosync/internal/google/fake"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_withAliases(t *testing.T) {
+	g := googlefake.User("ann@corp.com")
+	g.Aliases = []string{"ann.smith@corp.com", "Ann@corp.com"}
+	g.NonEditableAliases = []string{"ann@corp.io", "ann.smith@corp.com"}
+	u := withAliases(aws.NewUser("ann", "ann", "ann@corp.com", true), g)
+	assert.Equal(t, []aws.UserEmail{
+		{Value: "ann@corp.com", Type: "work", Primary: true},
+		{Value: "ann.smith@corp.com", Type: "alias"},
+		{Value: "ann@corp.io", Type: "alias"},
+	}, u.Emails)
+	assert.Equal(t, []string{"ann.smith@corp.com", "ann@corp.io"}, aliasesOf(u))
+}
+
+func Test_copyAliases(t *testing.T) {
+	dst := aws.NewUser("ann", "ann", "ann@corp.com", true)
+	dst.Emails = append(dst.Emails, aws.UserEmail{Value: "old@corp.com", Type: "alias"}, aws.UserEmail{Value: "ann@home.com", Type: "home"})
+	src := aws.NewUser("ann", "ann", "ann@corp.com", true)
+	src.Emails = append(src.Emails, aws.UserEmail{Value: "new@corp.com", Type: "alias"})
+	copyAliases(dst, src)
+	assert.Equal(t, []aws.UserEmail{
+		{Value: "ann@corp.com", Type: "work", Primary: true},
+		{Value: "ann@home.com", Type: "home"},
+		{Value: "new@corp.com", Type: "alias"},
+	}, dst.Emails)
+}
+
+func TestSyncGroupsUsersAliases(t *testing.T) {
+	gUser := googlefake.User("a@email.com")
+	gUser.Aliases = []string{"alias@email.com"}
+	googleClient := googlefake.NewClient().
+		WithUsers(gUser).
+		WithGroup(googlefake.Group("aws-dev@email.com"), "a@email.com")
+	awsClient := awsfake.NewClient().
+		WithUsers(syncedUser("a@email.com")).
+		WithGroup(aws.NewGroup("aws-dev"), "a@email.com")
+	cfg := config.New()
+	cfg.Yes = true
+
+	changes, err := newSyncGSuite(cfg, awsClient, googleClient, nil).getChanges(nil)
+	assert.NoError(t, err)
+	assert.Empty(t, changes.updateUsers)
+
+	cfg.SyncAliases = true
+	assert.NoError(t, newSyncGSuite(cfg, awsClient, googleClient, nil).SyncGroupsUsers(nil))
+	u, err := awsClient.FindUserByEmail("a@email.com")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"alias@email.com"}, aliasesOf(u))
+
+	changes, err = newSyncGSuite(cfg, awsClient, googleClient, nil).getChanges(nil)
+	assert.NoError(t, err)
+	assert.Empty(t, changes.updateUsers)
+
+	// an alias removed in Google Workspace is removed in AWS SSO
+	gUser.Aliases = nil
+	assert.NoError(t, newSyncGSuite(cfg, awsClient, googleClient, nil).SyncGroupsUsers(nil))
+	u, err = awsClient.FindUserByEmail("a@email.com")
+	assert.NoError(t, err)
+	assert.Empty(t, aliasesOf(u))
+}
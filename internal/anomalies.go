@@ -0,0 +1,85 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"github.com/awslabs/ssosync/internal/state"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// anomaly is a change to an entity already changed by the previous run.
+// Once a run succeeded AWS SSO should be in sync, so changing the same
+// entity again, e.g. a user added then deleted on alternating runs, usually
+// indicates a configuration or normalization bug.
+type anomaly struct {
+	change   state.Change
+	previous state.Change
+}
+
+// reason describes the anomaly
+func (a anomaly) reason() string {
+	switch {
+	case a.change.Op == a.previous.Op:
+		return "repeats the change of the previous run"
+	case a.change.Op == state.OpAdd && a.previous.Op == state.OpDelete,
+		a.change.Op == state.OpDelete && a.previous.Op == state.OpAdd:
+		return "undoes the change of the previous run"
+	default:
+		return "changes again an entity changed by the previous run"
+	}
+}
+
+// changeKey identifies the entity of a change
+type changeKey struct {
+	kind  string
+	name  string
+	group string
+}
+
+// findAnomalies returns the changes to entities changed by the previous
+// run, prev may be nil
+func findAnomalies(prev *state.Report, changes []state.Change) []anomaly {
+	if prev == nil {
+		return nil
+	}
+	previous := make(map[changeKey]state.Change, len(prev.Changes))
+	for _, c := range prev.Changes {
+		previous[changeKey{c.Kind, c.Name, c.Group}] = c
+	}
+	anomalies := make([]anomaly, 0)
+	for _, c := range changes {
+		if p, ok := previous[changeKey{c.Kind, c.Name, c.Group}]; ok {
+			anomalies = append(anomalies, anomaly{change: c, previous: p})
+		}
+	}
+	return anomalies
+}
+
+// flagAnomalies logs the anomalies of changes compared to the last run
+func (s *syncGSuite) flagAnomalies(changes []state.Change) {
+	prev := s.state.LastReport
+	for _, a := range findAnomalies(prev, changes) {
+		log.WithFields(log.Fields{
+			"kind":         a.change.Kind,
+			"name":         a.change.Name,
+			"group":        a.change.Group,
+			"op":           a.change.Op,
+			"previousOp":   a.previous.Op,
+			"previousRun":  prev.RunID,
+			"previousTime": prev.At,
+		}).Warn("Anomaly: change " + a.reason() + ", check the configuration and the normalization of names")
+	}
+}
@@ -0,0 +1,48 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"testing"
+
+	"github.com/awslabs/ssosync/internal/state"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_findAnomalies(t *testing.T) {
+	prev := &state.Report{
+		RunID: "run-1",
+		Changes: []state.Change{
+			{Op: state.OpAdd, Kind: state.KindUser, Name: "user-1@email.com"},
+			{Op: state.OpAdd, Kind: state.KindMember, Name: "user-2@email.com", Group: "group-1"},
+			{Op: state.OpUpdate, Kind: state.KindUser, Name: "user-3@email.com"},
+		},
+	}
+	changes := []state.Change{
+		{Op: state.OpDelete, Kind: state.KindUser, Name: "user-1@email.com"},
+		{Op: state.OpAdd, Kind: state.KindMember, Name: "user-2@email.com", Group: "group-2"},
+		{Op: state.OpUpdate, Kind: state.KindUser, Name: "user-3@email.com"},
+		{Op: state.OpAdd, Kind: state.KindUser, Name: "user-4@email.com"},
+	}
+
+	assert.Nil(t, findAnomalies(nil, changes))
+
+	got := findAnomalies(prev, changes)
+	assert.Len(t, got, 2)
+	assert.Equal(t, "user-1@email.com", got[0].change.Name)
+	assert.Equal(t, "undoes the change of the previous run", got[0].reason())
+	assert.Equal(t, "user-3@email.com", got[1].change.Name)
+	assert.Equal(t, "repeats the change of the previous run", got[1].reason())
+}
@@ -0,0 +1,127 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/awslabs/ssosync/internal/config"
+	"github.com/awslabs/ssosync/internal/jira"
+	log "github.com/sirupsen/logrus"
+)
+
+// ErrPlanNotApproved is returned when a plan needs an approval which wasn't
+// given yet, nothing is applied
+var ErrPlanNotApproved = errors.New("plan not approved")
+
+// newJiraClient creates the Jira client tracking approvals, nil when Jira
+// isn't configured
+func newJiraClient(cfg *config.Config) (jira.Client, error) {
+	if cfg.JiraURL == "" {
+		return nil, nil
+	}
+	if cfg.JiraProject == "" {
+		return nil, errors.New("a Jira project is required to track approvals")
+	}
+	return jira.NewClient(&http.Client{Timeout: 30 * time.Second}, &jira.Config{
+		URL:   cfg.JiraURL,
+		User:  cfg.JiraUser,
+		Token: cfg.JiraToken,
+	})
+}
+
+// planToken returns the plan of changes, as written by the diff, and a
+// token identifying it: the same changes have the same token.
+func planToken(changes *changeSet) (string, string, error) {
+	var plan bytes.Buffer
+	if err := changes.write(&plan); err != nil {
+		return "", "", err
+	}
+	sum := sha256.Sum256(plan.Bytes())
+	return plan.String(), hex.EncodeToString(sum[:])[:12], nil
+}
+
+// approvePlan returns true when the changes need an approval, i.e. they
+// delete more users and groups than the approval deletion threshold, and
+// they were approved, either with the approval token or by the approved
+// status of their Jira issue. The issue is opened with the plan when it
+// doesn't exist yet. ErrPlanNotApproved is returned while the approval is
+// pending. Without Jira, the plan is held until a run with its approval token
+// applies it, when a holder is configured. An approved plan isn't subject to
+// the deletion limits.
+func (s *syncGSuite) approvePlan(changes *changeSet) (bool, error) {
+	deletions := len(changes.deleteUsers) + len(changes.deleteGroups)
+	// a dry run applies nothing, there is nothing to approve
+	if s.cfg.DryRun || s.cfg.ApprovalDeletionThreshold <= 0 || deletions <= s.cfg.ApprovalDeletionThreshold {
+		return false, nil
+	}
+	if s.jira == nil && s.holder == nil && s.cfg.ApprovalToken == "" {
+		return false, errors.New("plans over the approval deletion threshold need Jira, held plans or an approval token")
+	}
+
+	plan, token, err := planToken(changes)
+	if err != nil {
+		return false, err
+	}
+	log := log.WithFields(log.Fields{"deletions": deletions, "token": token})
+	if s.cfg.ApprovalToken != "" {
+		if s.cfg.ApprovalToken == token {
+			log.Warn("Plan approved by its approval token")
+			return true, nil
+		}
+		log.Warn("The approval token doesn't match the plan, the plan changed since it was approved")
+	}
+	if s.jira == nil {
+		if s.holder != nil {
+			if err := s.holdPlan(changes, plan, token); err != nil {
+				return false, err
+			}
+		}
+		return false, fmt.Errorf("%w, approve it with the approval token %s", ErrPlanNotApproved, token)
+	}
+
+	label := "ssosync-plan-" + token
+	issue, err := s.jira.FindIssue(s.cfg.JiraProject, label)
+	if errors.Is(err, jira.ErrIssueNotFound) {
+		issue, err = s.jira.CreateIssue(
+			s.cfg.JiraProject,
+			fmt.Sprintf("ssosync: approve %d deletions (plan %s)", deletions, token),
+			fmt.Sprintf("ssosync run %s will apply the plan below once this issue is %s, or when run with the approval token %s.\n\n{noformat}\n%s{noformat}",
+				s.cfg.RunID, s.cfg.JiraApprovedStatus, token, plan),
+			[]string{"ssosync", label},
+		)
+		if err != nil {
+			return false, err
+		}
+		log.WithField("issue", issue.Key).Warn("Opened a Jira issue for the approval of the plan")
+		return false, fmt.Errorf("%w, waiting for the approval of %s", ErrPlanNotApproved, issue.Key)
+	}
+	if err != nil {
+		return false, err
+	}
+	if !strings.EqualFold(issue.Status, s.cfg.JiraApprovedStatus) {
+		log.WithFields(Fields{"issue": issue.Key, "status": issue.Status}).Warn("Plan not approved yet")
+		return false, fmt.Errorf("%w, waiting for the approval of %s (status %q)", ErrPlanNotApproved, issue.Key, issue.Status)
+	}
+	log.WithField("issue", issue.Key).Warn("Plan approved in Jira")
+	return true, nil
+}
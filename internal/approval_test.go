@@ -0,0 +1,93 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/awslabs/ssosync/internal/aws"
+	"github.com/awslabs/ssosync/internal/config"
+	"github.com/awslabs/ssosync/internal/jira"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeJira struct {
+	issues  map[string]*jira.Issue
+	created int
+}
+
+func (f *fakeJira) FindIssue(project string, label string) (*jira.Issue, error) {
+	if issue, ok := f.issues[label]; ok {
+		return issue, nil
+	}
+	return nil, jira.ErrIssueNotFound
+}
+
+func (f *fakeJira) CreateIssue(project string, summary string, description string, labels []string) (*jira.Issue, error) {
+	f.created++
+	issue := &jira.Issue{Key: "OPS-1", Status: "Open"}
+	f.issues[labels[1]] = issue
+	return issue, nil
+}
+
+func TestApprovePlan(t *testing.T) {
+	changes := &changeSet{
+		deleteUsers: []*aws.User{
+			{Username: "a@example.com"},
+			{Username: "b@example.com"},
+			{Username: "c@example.com"},
+		},
+	}
+	_, token, err := planToken(changes)
+	assert.NoError(t, err)
+
+	cfg := config.New()
+	s := newSyncGSuite(cfg, nil, nil, nil)
+
+	// no approval needed
+	approved, err := s.approvePlan(changes)
+	assert.NoError(t, err)
+	assert.False(t, approved)
+
+	// approval needed, but nothing to approve with
+	cfg.ApprovalDeletionThreshold = 2
+	_, err = s.approvePlan(changes)
+	assert.Error(t, err)
+
+	// approval token
+	cfg.ApprovalToken = "other"
+	_, err = s.approvePlan(changes)
+	assert.True(t, errors.Is(err, ErrPlanNotApproved))
+	cfg.ApprovalToken = token
+	approved, err = s.approvePlan(changes)
+	assert.NoError(t, err)
+	assert.True(t, approved)
+
+	// jira: the issue is opened, then approved
+	cfg.ApprovalToken = ""
+	f := &fakeJira{issues: map[string]*jira.Issue{}}
+	s.jira = f
+	_, err = s.approvePlan(changes)
+	assert.True(t, errors.Is(err, ErrPlanNotApproved))
+	_, err = s.approvePlan(changes)
+	assert.True(t, errors.Is(err, ErrPlanNotApproved))
+	assert.Equal(t, 1, f.created)
+
+	f.issues["ssosync-plan-"+token].Status = "approved"
+	approved, err = s.approvePlan(changes)
+	assert.NoError(t, err)
+	assert.True(t, approved)
+}
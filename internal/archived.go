@@ -0,0 +1,69 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"github.com/awslabs/ssosync/internal/aws"
+	"github.com/awslabs/ssosync/internal/state"
+
+	log "github.com/sirupsen/logrus"
+	admin "google.golang.org/api/admin/directory/v1"
+)
+
+// keepUntouched records the Google user u, out of scope for reason, when it
+// is an archived user whose AWS user is left untouched
+func (s *syncGSuite) keepUntouched(u *admin.User, reason string) {
+	if reason != untouchedArchival {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.untouched == nil {
+		s.untouched = make(map[string]bool)
+	}
+	s.untouched[aws.NormalizeName(u.PrimaryEmail)] = true
+}
+
+// withoutUntouchedUsers removes from changes the deletions of the AWS users
+// of the archived users left untouched with --archived-users ignore, and
+// their removals from groups, as they are out of scope like the users
+// deleted from Google Workspace
+func (s *syncGSuite) withoutUntouchedUsers(changes *changeSet) {
+	if len(s.untouched) == 0 {
+		return
+	}
+	kept := make(map[string]bool)
+	keep := func(c state.Change) {
+		log.WithFields(log.Fields{
+			"kind":  c.Kind,
+			"name":  c.Name,
+			"group": c.Group,
+		}).Info("Archived user left untouched, skipping its removal")
+		kept[c.Key()] = true
+	}
+	for _, u := range changes.deleteUsers {
+		if s.untouched[aws.NormalizeName(u.Username)] {
+			keep(state.Change{Op: state.OpDelete, Kind: state.KindUser, Name: u.Username})
+		}
+	}
+	for group, members := range changes.removeMembers {
+		for _, u := range members {
+			if s.untouched[aws.NormalizeName(u.Username)] {
+				keep(state.Change{Op: state.OpDelete, Kind: state.KindMember, Name: u.Username, Group: group})
+			}
+		}
+	}
+	changes.without(kept)
+}
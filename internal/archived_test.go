@@ -0,0 +1,77 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"testing"
+
+	"github.com/awslabs/ssosync/internal/aws"
+	awsfake "github.com/awslabs/ssosync/internal/aws/fake"
+	"github.com/awslabs/ssosync/internal/config"
+	googlefake "github.com/awslabs/ssosync/internal/google/fake"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSyncGroupsUsersArchivedUsers(t *testing.T) {
+	tests := []struct {
+		policy        string
+		wantUpdated   bool
+		wantDeleted   bool
+		wantRemoved   bool
+		wantActive    bool
+		wantAWSMember bool
+	}{
+		{config.ArchivedUsersDeactivate, true, false, false, false, true},
+		{config.ArchivedUsersDelete, false, true, true, false, false},
+		{config.ArchivedUsersIgnore, false, false, false, true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			archived := googlefake.User("a@email.com")
+			archived.Archived = true
+			googleClient := googlefake.NewClient().
+				WithUsers(archived, googlefake.User("b@email.com")).
+				WithGroup(googlefake.Group("aws-dev@email.com"), "a@email.com", "b@email.com")
+			awsClient := awsfake.NewClient().
+				WithUsers(syncedUser("a@email.com"), syncedUser("b@email.com")).
+				WithGroup(aws.NewGroup("aws-dev"), "a@email.com", "b@email.com")
+			cfg := config.New()
+			cfg.Yes = true
+			cfg.ArchivedUsers = tt.policy
+
+			changes, err := newSyncGSuite(cfg, awsClient, googleClient, nil).getChanges(nil)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantUpdated, len(changes.updateUsers) == 1)
+			assert.Equal(t, tt.wantDeleted, len(changes.deleteUsers) == 1)
+			assert.Equal(t, tt.wantRemoved, len(changes.removeMembers["aws-dev"]) == 1)
+			assert.Empty(t, changes.addUsers)
+			assert.Empty(t, changes.addMembers)
+
+			assert.NoError(t, newSyncGSuite(cfg, awsClient, googleClient, nil).SyncGroupsUsers(nil))
+			u, err := awsClient.FindUserByEmail("a@email.com")
+			if tt.wantDeleted {
+				assert.ErrorIs(t, err, aws.ErrUserNotFound)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantActive, u.Active)
+			group, err := awsClient.FindGroupByDisplayName("aws-dev")
+			assert.NoError(t, err)
+			members, err := awsClient.GetGroupMemberIDs(group)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantAWSMember, containsString(members, u.ID))
+		})
+	}
+}
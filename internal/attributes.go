@@ -0,0 +1,146 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/awslabs/ssosync/internal/aws"
+	"github.com/awslabs/ssosync/internal/config"
+	"github.com/awslabs/ssosync/internal/state"
+	admin "google.golang.org/api/admin/directory/v1"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ErrOversizedAttributes is returned when Google users have attributes over
+// the limits of AWS SSO, which would reject them, and --oversized-attributes
+// is fail
+var ErrOversizedAttributes = errors.New("google users with attributes over the limits of AWS SSO")
+
+// oversizedAttributes returns the attributes of u sent to AWS SSO which are
+// over its limits
+func oversizedAttributes(u *admin.User) []state.OversizedAttribute {
+	found := make([]state.OversizedAttribute, 0)
+	check := func(attribute string, value string, limit int) {
+		if n := utf8.RuneCountInString(value); n > limit {
+			found = append(found, state.OversizedAttribute{User: u.PrimaryEmail, Attribute: attribute, Length: n, Limit: limit})
+		}
+	}
+	check("userName", u.PrimaryEmail, aws.MaxUserNameLength)
+	if u.Name != nil {
+		check("givenName", u.Name.GivenName, aws.MaxNameLength)
+		check("familyName", u.Name.FamilyName, aws.MaxNameLength)
+		check("displayName", u.Name.GivenName+" "+u.Name.FamilyName, aws.MaxDisplayNameLength)
+	}
+	return found
+}
+
+// handleOversizedAttributes applies the --oversized-attributes policy to the
+// users with attributes over the limits of AWS SSO, before anything is sent
+// to it: all of them are listed in the error with fail, they are left out of
+// the users returned with skip, and their names are cut to the limits with
+// truncate, the display name is cut by aws.NewUser. A user name, the email of
+// the user, can't be truncated, the user is skipped instead. The emails of
+// the users left out are returned too, and the attributes are recorded for
+// the report of the run.
+func (s *syncGSuite) handleOversizedAttributes(users []*admin.User) ([]*admin.User, map[string]bool, error) {
+	offenders := make(map[string][]state.OversizedAttribute)
+	for _, u := range users {
+		if found := oversizedAttributes(u); len(found) > 0 {
+			offenders[u.PrimaryEmail] = found
+		}
+	}
+	if len(offenders) == 0 {
+		return users, nil, nil
+	}
+	if s.cfg.OversizedAttributes != config.OversizedAttributesSkip && s.cfg.OversizedAttributes != config.OversizedAttributesTruncate {
+		lines := make([]string, 0)
+		for _, found := range offenders {
+			for _, a := range found {
+				lines = append(lines, fmt.Sprintf("%s %s (%d > %d characters)", a.User, a.Attribute, a.Length, a.Limit))
+			}
+		}
+		sort.Strings(lines)
+		log.WithField("attributes", lines).Error("Users with attributes over the limits of AWS SSO, see --oversized-attributes")
+		return nil, nil, fmt.Errorf("%w: %s", ErrOversizedAttributes, strings.Join(lines, ", "))
+	}
+	skipped := make(map[string]bool)
+	kept := make([]*admin.User, 0, len(users))
+	for _, u := range users {
+		found, ok := offenders[u.PrimaryEmail]
+		if !ok {
+			kept = append(kept, u)
+			continue
+		}
+		action := "truncated"
+		if s.cfg.OversizedAttributes == config.OversizedAttributesSkip || found[0].Attribute == "userName" {
+			action = "skipped"
+		}
+		for _, a := range found {
+			a.Action = action
+			s.recordOversized(a)
+			log.WithFields(log.Fields{
+				"user":      a.User,
+				"attribute": a.Attribute,
+				"length":    a.Length,
+				"limit":     a.Limit,
+			}).Warn("User attribute over the limit of AWS SSO, " + action)
+		}
+		if action == "skipped" {
+			skipped[u.PrimaryEmail] = true
+			continue
+		}
+		u.Name.GivenName = aws.Truncate(u.Name.GivenName, aws.MaxNameLength)
+		u.Name.FamilyName = aws.Truncate(u.Name.FamilyName, aws.MaxNameLength)
+		kept = append(kept, u)
+	}
+	return kept, skipped, nil
+}
+
+// recordOversized records an attribute over the limit for the report of the
+// run, once per user and attribute
+func (s *syncGSuite) recordOversized(a state.OversizedAttribute) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.oversized == nil {
+		s.oversized = make(map[string]state.OversizedAttribute)
+	}
+	s.oversized[a.User+" "+a.Attribute] = a
+}
+
+// oversizedReport returns the attributes over the limits recorded during the
+// run, sorted by user and attribute, nil when there are none
+func (s *syncGSuite) oversizedReport() []state.OversizedAttribute {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.oversized) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(s.oversized))
+	for k := range s.oversized {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	report := make([]state.OversizedAttribute, 0, len(keys))
+	for _, k := range keys {
+		report = append(report, s.oversized[k])
+	}
+	return report
+}
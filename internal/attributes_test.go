@@ -0,0 +1,63 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/awslabs/ssosync/internal/config"
+	"github.com/awslabs/ssosync/internal/state"
+	"github.com/stretchr/testify/assert"
+	admin "google.golang.org/api/admin/directory/v1"
+)
+
+func Test_handleOversizedAttributes(t *testing.T) {
+	long := strings.Repeat("é", 1100)
+	newUsers := func() []*admin.User {
+		return []*admin.User{
+			{PrimaryEmail: "user@email.com", Name: &admin.UserName{GivenName: "n", FamilyName: "l"}},
+			{PrimaryEmail: "title@email.com", Name: &admin.UserName{GivenName: "n", FamilyName: long}},
+			{PrimaryEmail: strings.Repeat("x", 130) + "@email.com", Name: &admin.UserName{GivenName: "n", FamilyName: "l"}},
+		}
+	}
+	cfg := config.New()
+	s := newSyncGSuite(cfg, nil, nil, nil)
+
+	_, _, err := s.handleOversizedAttributes(newUsers())
+	assert.True(t, errors.Is(err, ErrOversizedAttributes))
+	assert.Contains(t, err.Error(), "title@email.com familyName (1100 > 1024 characters)")
+	assert.Nil(t, s.oversizedReport())
+
+	cfg.OversizedAttributes = config.OversizedAttributesSkip
+	kept, skipped, err := s.handleOversizedAttributes(newUsers())
+	assert.NoError(t, err)
+	assert.Len(t, kept, 1)
+	assert.Len(t, skipped, 2)
+
+	// the user name can't be truncated, its user is skipped
+	s = newSyncGSuite(cfg, nil, nil, nil)
+	cfg.OversizedAttributes = config.OversizedAttributesTruncate
+	kept, skipped, err = s.handleOversizedAttributes(newUsers())
+	assert.NoError(t, err)
+	assert.Len(t, kept, 2)
+	assert.Len(t, skipped, 1)
+	assert.Equal(t, strings.Repeat("é", 1024), kept[1].Name.FamilyName)
+	report := s.oversizedReport()
+	assert.Len(t, report, 3)
+	assert.Equal(t, state.OversizedAttribute{User: "title@email.com", Attribute: "displayName", Length: 1102, Limit: 1024, Action: "truncated"}, report[0])
+	assert.Equal(t, "skipped", report[2].Action)
+}
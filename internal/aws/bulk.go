@@ -0,0 +1,125 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aws
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// BulkResult is the outcome of the creation of a user in a bulk request
+type BulkResult struct {
+	// User is the user created, nil when its operation failed
+	User *User
+	// Err is the error of the operation, an *ErrHttpNotOK with the status of
+	// the operation when the endpoint rejected it
+	Err error
+}
+
+// errBulkOperationMissing is the error of an operation missing from the
+// bulk response, e.g. when the endpoint stopped after too many errors
+var errBulkOperationMissing = errors.New("operation missing from the bulk response")
+
+// CreateUsers creates the users with a single request to the /Bulk endpoint,
+// the result of each user is at its index, the users are created or fail
+// independently. ErrBulkNotSupported is returned when the endpoint doesn't
+// support bulk operations, the users must then be created one by one.
+func (c *client) CreateUsers(users []*User) ([]BulkResult, error) {
+	startURL, err := url.Parse(c.endpointURL.String())
+	if err != nil {
+		return nil, err
+	}
+	req := BulkRequest{
+		Schemas:    []string{"urn:ietf:params:scim:api:messages:2.0:BulkRequest"},
+		Operations: make([]BulkOperation, 0, len(users)),
+	}
+	for i, u := range users {
+		if u == nil {
+			return nil, ErrUserNotSpecified
+		}
+		req.Operations = append(req.Operations, BulkOperation{
+			Method: http.MethodPost,
+			Path:   "/Users",
+			BulkID: strconv.Itoa(i),
+			Data:   u,
+		})
+	}
+
+	startURL.Path = path.Join(startURL.Path, "/Bulk")
+	resp, err := c.sendRequestWithBody(http.MethodPost, startURL.String(), req)
+	var httpErr *ErrHttpNotOK
+	if errors.As(err, &httpErr) {
+		switch httpErr.StatusCode {
+		case http.StatusNotFound, http.StatusMethodNotAllowed, http.StatusNotImplemented:
+			return nil, ErrBulkNotSupported
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var r BulkResponse
+	if err := json.Unmarshal(resp, &r); err != nil {
+		return nil, err
+	}
+	results := make([]BulkResult, len(users))
+	for i := range results {
+		results[i].Err = errBulkOperationMissing
+	}
+	for _, op := range r.Operations {
+		i, err := strconv.Atoi(op.BulkID)
+		if err != nil || i < 0 || i >= len(users) {
+			continue
+		}
+		results[i] = c.bulkUserResult(users[i], op)
+	}
+	return results, nil
+}
+
+// bulkUserResult returns the result of the operation creating u, the user
+// is read again when the endpoint answered without it
+func (c *client) bulkUserResult(u *User, op BulkOperationResponse) BulkResult {
+	status, err := strconv.Atoi(strings.Trim(string(op.Status), `"`))
+	if err != nil {
+		return BulkResult{Err: fmt.Errorf("invalid status %s of bulk operation", op.Status)}
+	}
+	if status < http.StatusOK || status > http.StatusNoContent {
+		var scimErr struct {
+			Detail string `json:"detail"`
+		}
+		_ = json.Unmarshal(op.Response, &scimErr)
+		if scimErr.Detail == "" {
+			return BulkResult{Err: &ErrHttpNotOK{StatusCode: status}}
+		}
+		return BulkResult{Err: fmt.Errorf("%w: %s", &ErrHttpNotOK{StatusCode: status}, scimErr.Detail)}
+	}
+	var created User
+	if err := json.Unmarshal(op.Response, &created); err == nil && created.ID != "" {
+		return BulkResult{User: &created}
+	}
+	var found *User
+	if op.Location != "" {
+		found, err = c.FindUserByID(path.Base(op.Location))
+	} else {
+		found, err = c.FindUserByEmail(u.Username)
+	}
+	return BulkResult{User: found, Err: err}
+}
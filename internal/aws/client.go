@@ -23,7 +23,10 @@ import (
 	"net/http"
 	"net/url"
 	"path"
+	"strconv"
+	"sync/atomic"
 
+	"github.com/awslabs/ssosync/internal/errclass"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -33,16 +36,34 @@ var (
 	ErrNoGroupsFound     = errors.New("no groups found")
 	ErrUserNotSpecified  = errors.New("user not specified")
 	ErrGroupNotSpecified = errors.New("group not specified")
+	// ErrMembersNotSupported is returned when the SCIM endpoint doesn't
+	// return the members of groups
+	ErrMembersNotSupported = errors.New("group members not supported by the SCIM endpoint")
+	// ErrBulkNotSupported is returned when the SCIM endpoint doesn't
+	// support bulk operations
+	ErrBulkNotSupported = errors.New("bulk operations not supported by the SCIM endpoint")
 )
 
 type ErrHttpNotOK struct {
 	StatusCode int
+	RequestID  string
 }
 
 func (e *ErrHttpNotOK) Error() string {
+	if e.RequestID != "" {
+		return fmt.Sprintf("status of http response was %d (request id %s)", e.StatusCode, e.RequestID)
+	}
 	return fmt.Sprintf("status of http response was %d", e.StatusCode)
 }
 
+// ErrorClass implements errclass.Classifier
+func (e *ErrHttpNotOK) ErrorClass() errclass.Class {
+	return errclass.FromStatus(e.StatusCode)
+}
+
+// requestIDHeader is the response header holding the AWS request ID
+const requestIDHeader = "X-Amzn-Requestid"
+
 // OperationType handle patch operations for add/remove
 type OperationType string
 
@@ -52,6 +73,9 @@ const (
 
 	// OperationRemove is the remove operation for a patch
 	OperationRemove = "remove"
+
+	// OperationReplace is the replace operation for a patch
+	OperationReplace = "replace"
 )
 
 // Client represents an interface of methods used
@@ -60,15 +84,21 @@ type Client interface {
 	AddUserToGroup(*User, *Group) error
 	CreateGroup(*Group) (*Group, error)
 	CreateUser(*User) (*User, error)
+	CreateUsers([]*User) ([]BulkResult, error)
 	DeleteGroup(*Group) error
+	RenameGroup(*Group, string) error
 	DeleteUser(*User) error
 	FindGroupByDisplayName(string) (*Group, error)
 	FindUserByEmail(string) (*User, error)
 	FindUserByID(string) (*User, error)
 	GetUsers() ([]*User, error)
+	ForEachUser(func(*User) error) error
 	GetGroupMembers(*Group) ([]*User, error)
+	GetGroupMemberIDs(*Group) ([]string, error)
+	GetMemberGroupIDs(*User) ([]string, error)
 	IsUserInGroup(*User, *Group) (bool, error)
 	GetGroups() ([]*Group, error)
+	ForEachGroup(func(*Group) error) error
 	UpdateUser(*User) (*User, error)
 	RemoveUserFromGroup(*User, *Group) error
 }
@@ -77,6 +107,15 @@ type client struct {
 	httpClient  HttpClient
 	endpointURL *url.URL
 	bearerToken string
+	headers     map[string]string
+	pageSize    int
+	patchUsers  bool
+	// managedPaths are the paths the PATCH requests remove, see
+	// Config.ManagedPaths
+	managedPaths map[string]bool
+	// patchNotSupported is set to 1 once the endpoint rejected the PATCH
+	// method for users, which are then replaced
+	patchNotSupported int32
 }
 
 // NewClient creates a new client to talk with AWS SSO's SCIM endpoint. It
@@ -88,12 +127,27 @@ func NewClient(c HttpClient, config *Config) (Client, error) {
 		return nil, err
 	}
 	return &client{
-		httpClient:  c,
-		endpointURL: u,
-		bearerToken: config.Token,
+		httpClient:   c,
+		endpointURL:  u,
+		bearerToken:  config.Token,
+		headers:      config.Headers,
+		pageSize:     config.PageSize,
+		patchUsers:   config.PatchUsers,
+		managedPaths: managedPaths(config.ManagedPaths),
 	}, nil
 }
 
+// setHeaders sets the configured static headers and the authorization
+// header on the request
+func (c *client) setHeaders(r *http.Request) {
+	for k, v := range c.headers {
+		r.Header.Set(k, v)
+	}
+	if c.bearerToken != "" {
+		r.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.bearerToken))
+	}
+}
+
 // sendRequestWithBody will send the body given to the url/method combination
 // with the right Bearer token as well as the correct content type for SCIM.
 func (c *client) sendRequestWithBody(method string, url string, body interface{}) (response []byte, err error) {
@@ -112,8 +166,8 @@ func (c *client) sendRequestWithBody(method string, url string, body interface{}
 	log.WithFields(log.Fields{"url": url, "method": method})
 
 	// Set the content-type and authorization headers
+	c.setHeaders(r)
 	r.Header.Set("Content-Type", "application/scim+json")
-	r.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.bearerToken))
 
 	// Call the URL
 	resp, err := c.httpClient.Do(r)
@@ -130,7 +184,7 @@ func (c *client) sendRequestWithBody(method string, url string, body interface{}
 
 	// If we get a non-2xx status code, raise that via an error
 	if resp.StatusCode < http.StatusOK || resp.StatusCode > http.StatusNoContent {
-		err = &ErrHttpNotOK{resp.StatusCode}
+		err = &ErrHttpNotOK{resp.StatusCode, resp.Header.Get(requestIDHeader)}
 	}
 
 	return
@@ -144,7 +198,7 @@ func (c *client) sendRequest(method string, url string) (response []byte, err er
 
 	log.WithFields(log.Fields{"url": url, "method": method})
 
-	r.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.bearerToken))
+	c.setHeaders(r)
 
 	resp, err := c.httpClient.Do(r)
 	if err != nil {
@@ -158,7 +212,7 @@ func (c *client) sendRequest(method string, url string) (response []byte, err er
 	}
 
 	if resp.StatusCode < http.StatusOK || resp.StatusCode > http.StatusNoContent {
-		err = fmt.Errorf("status of http response was %d", resp.StatusCode)
+		err = &ErrHttpNotOK{resp.StatusCode, resp.Header.Get(requestIDHeader)}
 	}
 
 	return
@@ -281,7 +335,8 @@ func (c *client) FindUserByEmail(email string) (*User, error) {
 	return &r.Resources[0], nil
 }
 
-// FindUserByID will find the user by the email address specified
+// FindUserByID will find the user by its id, the endpoint returns the user
+// itself rather than a list of results
 func (c *client) FindUserByID(id string) (*User, error) {
 	startURL, err := url.Parse(c.endpointURL.String())
 	if err != nil {
@@ -291,21 +346,25 @@ func (c *client) FindUserByID(id string) (*User, error) {
 	startURL.Path = path.Join(startURL.Path, fmt.Sprintf("/Users/%s", id))
 
 	resp, err := c.sendRequest(http.MethodGet, startURL.String())
+	var httpErr *ErrHttpNotOK
+	if errors.As(err, &httpErr) && httpErr.StatusCode == http.StatusNotFound {
+		return nil, ErrUserNotFound
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	var r UserFilterResults
-	err = json.Unmarshal(resp, &r)
+	var u User
+	err = json.Unmarshal(resp, &u)
 	if err != nil {
 		return nil, err
 	}
 
-	if r.TotalResults != 1 {
+	if u.ID == "" {
 		return nil, ErrUserNotFound
 	}
 
-	return &r.Resources[0], nil
+	return &u, nil
 }
 
 // FindGroupByDisplayName will find the group by its displayname.
@@ -371,7 +430,12 @@ func (c *client) CreateUser(u *User) (*User, error) {
 	return &newUser, nil
 }
 
-// UpdateUser will update/replace the user specified
+// UpdateUser will update/replace the user specified. With PatchUsers,
+// only the attributes which differ from the ones of the user in AWS SSO
+// are sent in a PATCH request, so the attributes ssosync doesn't know are
+// kept. The user is replaced with PUT when the endpoint rejects the PATCH
+// request as a bad request, and from then on when it doesn't support the
+// method.
 func (c *client) UpdateUser(u *User) (*User, error) {
 	startURL, err := url.Parse(c.endpointURL.String())
 	if err != nil {
@@ -383,6 +447,22 @@ func (c *client) UpdateUser(u *User) (*User, error) {
 		return nil, err
 	}
 
+	if c.patchUsers && atomic.LoadInt32(&c.patchNotSupported) == 0 {
+		updated, err := c.patchUser(u)
+		var httpErr *ErrHttpNotOK
+		switch {
+		case err == nil:
+			return updated, nil
+		case errors.As(err, &httpErr) && (httpErr.StatusCode == http.StatusMethodNotAllowed || httpErr.StatusCode == http.StatusNotImplemented):
+			log.WithError(err).Warn("PATCH of users not supported by the SCIM endpoint, replacing them")
+			atomic.StoreInt32(&c.patchNotSupported, 1)
+		case errors.As(err, &httpErr) && httpErr.StatusCode == http.StatusBadRequest:
+			log.WithField("user", u.Username).WithError(err).Warn("PATCH of user rejected, replacing it")
+		default:
+			return nil, err
+		}
+	}
+
 	startURL.Path = path.Join(startURL.Path, fmt.Sprintf("/Users/%s", u.ID))
 	resp, err := c.sendRequestWithBody(http.MethodPut, startURL.String(), *u)
 	if err != nil {
@@ -468,111 +548,233 @@ func (c *client) DeleteGroup(g *Group) error {
 	return nil
 }
 
-// GetGroups will return existing groups
-func (c *client) GetGroups() ([]*Group, error) {
+// RenameGroup will replace the display name of the group specified, the
+// group keeps its id, members and the permission sets assigned to it
+func (c *client) RenameGroup(g *Group, name string) error {
 	startURL, err := url.Parse(c.endpointURL.String())
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	startURL.Path = path.Join(startURL.Path, "/Groups")
+	if g == nil {
+		return ErrGroupNotSpecified
+	}
 
-	resp, err := c.sendRequest(http.MethodGet, startURL.String())
-	if err != nil {
-		return nil, err
+	gc := &GroupAttributeChange{
+		Schemas: []string{"urn:ietf:params:scim:api:messages:2.0:PatchOp"},
+		Operations: []GroupAttributeOperation{
+			{
+				Operation: OperationReplace,
+				Path:      "displayName",
+				Value:     name,
+			},
+		},
 	}
 
-	var r GroupFilterResults
-	err = json.Unmarshal(resp, &r)
+	startURL.Path = path.Join(startURL.Path, fmt.Sprintf("/Groups/%s", g.ID))
+	_, err = c.sendRequestWithBody(http.MethodPatch, startURL.String(), *gc)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	// if r.TotalResults != 1 {
-	// 	return nil, ErrNoGroupsFound
-	// }
+	return nil
+}
 
-	gps := make([]*Group, len(r.Resources))
-	for i := range r.Resources {
-		gps[i] = &r.Resources[i]
+// GetGroups will return existing groups
+func (c *client) GetGroups() ([]*Group, error) {
+	gps := make([]*Group, 0)
+	err := c.ForEachGroup(func(g *Group) error {
+		gps = append(gps, g)
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	return gps, nil
 }
 
-// GetGroupMembers will return existing groups
-func (c *client) GetGroupMembers(g *Group) ([]*User, error) {
-	startURL, err := url.Parse(c.endpointURL.String())
+// ForEachGroup calls fn with each group of the endpoint, reading them a page
+// at a time. It stops at the first error returned by fn.
+func (c *client) ForEachGroup(fn func(*Group) error) error {
+	return c.listPages("/Groups", "", func(resp []byte) (int, int, error) {
+		var r GroupFilterResults
+		if err := json.Unmarshal(resp, &r); err != nil {
+			return 0, 0, err
+		}
+		for i := range r.Resources {
+			if err := fn(&r.Resources[i]); err != nil {
+				return 0, 0, err
+			}
+		}
+		return len(r.Resources), r.TotalResults, nil
+	})
+}
+
+// GetMemberGroupIDs will return the ids of the groups the user is a member
+// of, like the ListGroupMembershipsForMember API of the Identity Store, with
+// the filter members eq, instead of checking each group with IsUserInGroup.
+// ErrMembersNotSupported is returned when the endpoint rejects the filter.
+func (c *client) GetMemberGroupIDs(u *User) ([]string, error) {
+	if u == nil {
+		return nil, ErrUserNotSpecified
+	}
+
+	ids := make([]string, 0)
+	filter := fmt.Sprintf("members eq \"%s\"", u.ID)
+	err := c.listPages("/Groups", filter, func(resp []byte) (int, int, error) {
+		var r GroupFilterResults
+		if err := json.Unmarshal(resp, &r); err != nil {
+			return 0, 0, err
+		}
+		for _, g := range r.Resources {
+			ids = append(ids, g.ID)
+		}
+		return len(r.Resources), r.TotalResults, nil
+	})
+	var httpErr *ErrHttpNotOK
+	if errors.As(err, &httpErr) && httpErr.StatusCode == http.StatusBadRequest {
+		return nil, ErrMembersNotSupported
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	if g == nil {
-		return nil, ErrGroupNotSpecified
-	}
+	return ids, nil
+}
 
-	filter := fmt.Sprintf("displayName eq \"%s\"", g.DisplayName)
+// listPages requests the list endpoint p, with the filter unless empty, one
+// page after another, until the endpoint returns an empty page or all of its
+// results have been read. page decodes each response and returns its number
+// of resources and the total number of results.
+func (c *client) listPages(p string, filter string, page func([]byte) (int, int, error)) error {
+	startIndex := 1
+	for {
+		u, err := url.Parse(c.endpointURL.String())
+		if err != nil {
+			return err
+		}
+		u.Path = path.Join(u.Path, p)
 
-	startURL.Path = path.Join(startURL.Path, "/Groups")
-	q := startURL.Query()
-	q.Add("filter", filter)
+		q := u.Query()
+		if filter != "" {
+			q.Set("filter", filter)
+		}
+		if startIndex > 1 {
+			q.Set("startIndex", strconv.Itoa(startIndex))
+		}
+		if c.pageSize > 0 {
+			q.Set("count", strconv.Itoa(c.pageSize))
+		}
+		u.RawQuery = q.Encode()
 
-	startURL.RawQuery = q.Encode()
+		resp, err := c.sendRequest(http.MethodGet, u.String())
+		if err != nil {
+			return err
+		}
 
-	resp, err := c.sendRequest(http.MethodGet, startURL.String())
-	if err != nil {
-		return nil, err
+		n, total, err := page(resp)
+		if err != nil {
+			return err
+		}
+
+		startIndex += n
+		if n == 0 || startIndex > total {
+			return nil
+		}
 	}
+}
 
-	var r GroupFilterResults
-	err = json.Unmarshal(resp, &r)
+// GetGroupMembers will return the members of the group, their ids are read
+// with GetGroupMemberIDs, so ErrMembersNotSupported is returned when the
+// endpoint doesn't return them
+func (c *client) GetGroupMembers(g *Group) ([]*User, error) {
+	ids, err := c.GetGroupMemberIDs(g)
 	if err != nil {
 		return nil, err
 	}
 
-	var users = make([]*User, 0)
-	for _, res := range r.Resources {
-		for _, uID := range res.Members { // NOTE: Not Implemented Yet https://docs.aws.amazon.com/singlesignon/latest/developerguide/listgroups.html
-
-			user, err := c.FindUserByID(uID)
-			if err != nil {
-				return nil, err
-			}
-			users = append(users, user)
+	users := make([]*User, 0, len(ids))
+	for _, id := range ids {
+		user, err := c.FindUserByID(id)
+		if err != nil {
+			return nil, err
 		}
+		users = append(users, user)
 	}
 
 	return users, nil
 }
 
-// GetUsers will return existing users
-func (c *client) GetUsers() ([]*User, error) {
+// GetGroupMemberIDs will return the ids of the members of the group with a
+// single request. ErrMembersNotSupported is returned when the endpoint
+// doesn't return the members of groups, like the AWS SSO SCIM endpoint:
+// https://docs.aws.amazon.com/singlesignon/latest/developerguide/listgroups.html
+func (c *client) GetGroupMemberIDs(g *Group) ([]string, error) {
 	startURL, err := url.Parse(c.endpointURL.String())
 	if err != nil {
 		return nil, err
 	}
 
-	startURL.Path = path.Join(startURL.Path, "/Users")
+	if g == nil {
+		return nil, ErrGroupNotSpecified
+	}
+
+	startURL.Path = path.Join(startURL.Path, fmt.Sprintf("/Groups/%s", g.ID))
+	q := startURL.Query()
+	q.Add("attributes", "members")
+	startURL.RawQuery = q.Encode()
 
 	resp, err := c.sendRequest(http.MethodGet, startURL.String())
 	if err != nil {
 		return nil, err
 	}
 
-	var r UserFilterResults
+	var r GroupMembers
 	err = json.Unmarshal(resp, &r)
 	if err != nil {
 		return nil, err
 	}
 
-	// if r.TotalResults != 1 {
-	// 	return nil, ErrUserNotFound
-	// }
+	if r.Members == nil {
+		return nil, ErrMembersNotSupported
+	}
 
-	usrs := make([]*User, len(r.Resources))
-	for i := range r.Resources {
-		usrs[i] = &r.Resources[i]
+	ids := make([]string, len(*r.Members))
+	for i, m := range *r.Members {
+		ids[i] = m.Value
+	}
+
+	return ids, nil
+}
+
+// GetUsers will return existing users
+func (c *client) GetUsers() ([]*User, error) {
+	usrs := make([]*User, 0)
+	err := c.ForEachUser(func(u *User) error {
+		usrs = append(usrs, u)
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	return usrs, nil
 }
+
+// ForEachUser calls fn with each user of the endpoint, reading them a page
+// at a time. It stops at the first error returned by fn.
+func (c *client) ForEachUser(fn func(*User) error) error {
+	return c.listPages("/Users", "", func(resp []byte) (int, int, error) {
+		var r UserFilterResults
+		if err := json.Unmarshal(resp, &r); err != nil {
+			return 0, 0, err
+		}
+		for i := range r.Resources {
+			if err := fn(&r.Resources[i]); err != nil {
+				return 0, 0, err
+			}
+		}
+		return len(r.Resources), r.TotalResults, nil
+	})
+}
@@ -17,6 +17,7 @@ package aws
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -56,6 +57,8 @@ func (r *httpReqMatcher) Matches(req interface{}) bool {
 
 	if m.Body != nil {
 		got, _ := ioutil.ReadAll(m.Body)
+		// the body is read again by the other matchers
+		m.Body = ioutil.NopCloser(bytes.NewReader(got))
 		if string(got) != r.body {
 			return false
 		}
@@ -165,6 +168,46 @@ func TestSendRequestCheckAuthHeader(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+func TestSendRequestCheckCustomHeaders(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	x := mock.NewMockIHttpClient(ctrl)
+
+	c, err := NewClient(x, &Config{
+		Endpoint: "https://scim.example.com/",
+		Token:    "bearerToken",
+		Headers: map[string]string{
+			"X-Waf-Token":   "secret",
+			"Authorization": "overridden",
+		},
+	})
+	assert.NoError(t, err)
+	cc := c.(*client)
+
+	calledURL, _ := url.Parse("https://scim.example.com/")
+
+	req := httpReqMatcher{
+		httpReq: &http.Request{
+			URL:    calledURL,
+			Method: http.MethodGet,
+		},
+		headers: map[string]string{
+			"Authorization": "Bearer bearerToken",
+			"X-Waf-Token":   "secret",
+		},
+	}
+
+	x.EXPECT().Do(&req).MaxTimes(1).Return(&http.Response{
+		Status:     "OK",
+		StatusCode: 200,
+		Body:       nopCloser{bytes.NewBufferString("")},
+	}, nil)
+
+	_, err = cc.sendRequest(http.MethodGet, "https://scim.example.com/")
+	assert.NoError(t, err)
+}
+
 func TestSendRequestWithBodyCheckHeaders(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -610,6 +653,224 @@ func TestClient_UpdateUser(t *testing.T) {
 	}
 }
 
+func TestClient_UpdateUserPatch(t *testing.T) {
+	current := UpdateUser("userId", "Lee", "Packham", "test@example.com", true)
+	current.SetEnterprise(&EnterpriseUser{CostCenter: "R&D", Division: "Research"})
+	nu := UpdateUser("userId", "Leigh", "Packham", "test@example.com", true)
+	nu.SetEnterprise(&EnterpriseUser{CostCenter: "Sales", Division: "Research"})
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	x := mock.NewMockIHttpClient(ctrl)
+
+	c, err := NewClient(x, &Config{
+		Endpoint:   "https://scim.example.com/",
+		Token:      "bearerToken",
+		PatchUsers: true,
+	})
+	assert.NoError(t, err)
+
+	calledURL, _ := url.Parse("https://scim.example.com/Users/userId")
+	currentJSON, _ := json.Marshal(current)
+	patchJSON, _ := json.Marshal(UserPatch{
+		Schemas: []string{"urn:ietf:params:scim:api:messages:2.0:PatchOp"},
+		Operations: []UserPatchOperation{
+			{Operation: OperationReplace, Path: "displayName", Value: json.RawMessage(`"Leigh Packham"`)},
+			{Operation: OperationReplace, Path: "name", Value: json.RawMessage(`{"familyName":"Packham","givenName":"Leigh"}`)},
+			{Operation: OperationReplace, Path: EnterpriseUserSchema + ":costCenter", Value: json.RawMessage(`"Sales"`)},
+		},
+	})
+	response, _ := json.Marshal(nu)
+
+	gomock.InOrder(
+		x.EXPECT().Do(&httpReqMatcher{httpReq: &http.Request{URL: calledURL, Method: http.MethodGet}}).Return(&http.Response{
+			Status:     "OK",
+			StatusCode: 200,
+			Body:       nopCloser{bytes.NewBuffer(currentJSON)},
+		}, nil),
+		x.EXPECT().Do(&httpReqMatcher{httpReq: &http.Request{URL: calledURL, Method: http.MethodPatch}, body: string(patchJSON)}).Return(&http.Response{
+			Status:     "OK",
+			StatusCode: 200,
+			Body:       nopCloser{bytes.NewBuffer(response)},
+		}, nil),
+		// nothing changed, nothing is sent
+		x.EXPECT().Do(&httpReqMatcher{httpReq: &http.Request{URL: calledURL, Method: http.MethodGet}}).Return(&http.Response{
+			Status:     "OK",
+			StatusCode: 200,
+			Body:       nopCloser{bytes.NewBuffer(response)},
+		}, nil),
+	)
+
+	r, err := c.UpdateUser(nu)
+	assert.NoError(t, err)
+	assert.Equal(t, nu, r)
+
+	r, err = c.UpdateUser(nu)
+	assert.NoError(t, err)
+	assert.Equal(t, nu, r)
+}
+
+func Test_userPatchOperationsManagedPaths(t *testing.T) {
+	current := UpdateUser("userId", "Lee", "Packham", "test@example.com", true)
+	current.Title = "Engineer"
+	current.Timezone = "Europe/London"
+	current.SetEnterprise(&EnterpriseUser{CostCenter: "R&D"})
+	nu := UpdateUser("userId", "Lee", "Packham", "test@example.com", true)
+
+	// the title and the enterprise extension are managed, not the timezone
+	ops, err := userPatchOperations(current, nu, managedPaths([]string{"name", "title", EnterpriseUserSchema}))
+	assert.NoError(t, err)
+	assert.Equal(t, []UserPatchOperation{
+		{Operation: OperationRemove, Path: "title"},
+		{Operation: OperationRemove, Path: EnterpriseUserSchema + ":costCenter"},
+	}, ops)
+
+	// without managed paths, all the attributes are
+	ops, err = userPatchOperations(current, nu, nil)
+	assert.NoError(t, err)
+	assert.Len(t, ops, 3)
+}
+
+func TestClient_UpdateUserPatchNotSupported(t *testing.T) {
+	current := UpdateUser("userId", "Lee", "Packham", "test@example.com", true)
+	nu := UpdateUser("userId", "Leigh", "Packham", "test@example.com", true)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	x := mock.NewMockIHttpClient(ctrl)
+
+	c, err := NewClient(x, &Config{
+		Endpoint:   "https://scim.example.com/",
+		Token:      "bearerToken",
+		PatchUsers: true,
+	})
+	assert.NoError(t, err)
+
+	calledURL, _ := url.Parse("https://scim.example.com/Users/userId")
+	currentJSON, _ := json.Marshal(current)
+	requestJSON, _ := json.Marshal(nu)
+	put := func() *http.Response {
+		return &http.Response{
+			Status:     "OK",
+			StatusCode: 200,
+			Body:       nopCloser{bytes.NewBuffer(requestJSON)},
+		}
+	}
+
+	gomock.InOrder(
+		x.EXPECT().Do(&httpReqMatcher{httpReq: &http.Request{URL: calledURL, Method: http.MethodGet}}).Return(&http.Response{
+			Status:     "OK",
+			StatusCode: 200,
+			Body:       nopCloser{bytes.NewBuffer(currentJSON)},
+		}, nil),
+		x.EXPECT().Do(gomock.Any()).Return(&http.Response{
+			Status:     "Not Implemented",
+			StatusCode: http.StatusNotImplemented,
+			Body:       nopCloser{bytes.NewBufferString("")},
+		}, nil),
+		x.EXPECT().Do(&httpReqMatcher{httpReq: &http.Request{URL: calledURL, Method: http.MethodPut}, body: string(requestJSON)}).Return(put(), nil),
+		// the users are replaced from then on
+		x.EXPECT().Do(&httpReqMatcher{httpReq: &http.Request{URL: calledURL, Method: http.MethodPut}, body: string(requestJSON)}).Return(put(), nil),
+	)
+
+	r, err := c.UpdateUser(nu)
+	assert.NoError(t, err)
+	assert.Equal(t, nu, r)
+
+	r, err = c.UpdateUser(nu)
+	assert.NoError(t, err)
+	assert.Equal(t, nu, r)
+}
+
+func TestClient_CreateUsers(t *testing.T) {
+	a := NewUser("Lee", "Packham", "lee@example.com", true)
+	b := NewUser("Ann", "Smith", "ann@example.com", true)
+	c := NewUser("Bob", "Jones", "bob@example.com", true)
+	created := *a
+	created.ID = "userA"
+	createdJSON, _ := json.Marshal(created)
+	fetched := *c
+	fetched.ID = "userC"
+	fetchedJSON, _ := json.Marshal(fetched)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	x := mock.NewMockIHttpClient(ctrl)
+
+	client, err := NewClient(x, &Config{
+		Endpoint: "https://scim.example.com/",
+		Token:    "bearerToken",
+	})
+	assert.NoError(t, err)
+
+	bulkURL, _ := url.Parse("https://scim.example.com/Bulk")
+	requestJSON, _ := json.Marshal(BulkRequest{
+		Schemas: []string{"urn:ietf:params:scim:api:messages:2.0:BulkRequest"},
+		Operations: []BulkOperation{
+			{Method: http.MethodPost, Path: "/Users", BulkID: "0", Data: a},
+			{Method: http.MethodPost, Path: "/Users", BulkID: "1", Data: b},
+			{Method: http.MethodPost, Path: "/Users", BulkID: "2", Data: c},
+		},
+	})
+	// the statuses are strings or numbers, the user created may be missing
+	responseJSON := `{"schemas":["urn:ietf:params:scim:api:messages:2.0:BulkResponse"],"Operations":[` +
+		`{"method":"POST","bulkId":"0","status":"201","response":` + string(createdJSON) + `},` +
+		`{"method":"POST","bulkId":"1","status":409,"response":{"detail":"Duplicate userName"}},` +
+		`{"method":"POST","bulkId":"2","status":"201","location":"https://scim.example.com/Users/userC"}]}`
+	userURL, _ := url.Parse("https://scim.example.com/Users/userC")
+
+	gomock.InOrder(
+		x.EXPECT().Do(&httpReqMatcher{httpReq: &http.Request{URL: bulkURL, Method: http.MethodPost}, body: string(requestJSON)}).Return(&http.Response{
+			Status:     "OK",
+			StatusCode: 200,
+			Body:       nopCloser{bytes.NewBufferString(responseJSON)},
+		}, nil),
+		x.EXPECT().Do(&httpReqMatcher{httpReq: &http.Request{URL: userURL, Method: http.MethodGet}}).Return(&http.Response{
+			Status:     "OK",
+			StatusCode: 200,
+			Body:       nopCloser{bytes.NewBuffer(fetchedJSON)},
+		}, nil),
+	)
+
+	results, err := client.CreateUsers([]*User{a, b, c})
+	assert.NoError(t, err)
+	assert.Len(t, results, 3)
+	assert.NoError(t, results[0].Err)
+	assert.Equal(t, &created, results[0].User)
+	var httpErr *ErrHttpNotOK
+	assert.ErrorAs(t, results[1].Err, &httpErr)
+	assert.Equal(t, http.StatusConflict, httpErr.StatusCode)
+	assert.Contains(t, results[1].Err.Error(), "Duplicate userName")
+	assert.Nil(t, results[1].User)
+	assert.NoError(t, results[2].Err)
+	assert.Equal(t, &fetched, results[2].User)
+}
+
+func TestClient_CreateUsersBulkNotSupported(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	x := mock.NewMockIHttpClient(ctrl)
+
+	client, err := NewClient(x, &Config{
+		Endpoint: "https://scim.example.com/",
+		Token:    "bearerToken",
+	})
+	assert.NoError(t, err)
+
+	x.EXPECT().Do(gomock.Any()).Return(&http.Response{
+		Status:     "Not Implemented",
+		StatusCode: http.StatusNotImplemented,
+		Body:       nopCloser{bytes.NewBufferString("")},
+	}, nil)
+
+	_, err = client.CreateUsers([]*User{NewUser("Lee", "Packham", "lee@example.com", true)})
+	assert.ErrorIs(t, err, ErrBulkNotSupported)
+}
+
 func TestClient_CreateGroup(t *testing.T) {
 	ng := NewGroup("test_group@example.com")
 	ngResult := *ng
@@ -701,6 +962,46 @@ func TestClient_AddUserToGroup(t *testing.T) {
 	assert.Error(t, err)
 }
 
+func TestClient_RenameGroup(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	x := mock.NewMockIHttpClient(ctrl)
+
+	c, err := NewClient(x, &Config{
+		Endpoint: "https://scim.example.com/",
+		Token:    "bearerToken",
+	})
+	assert.NoError(t, err)
+
+	g := &Group{
+		ID:          "groupId",
+		DisplayName: "old",
+	}
+
+	calledURL, _ := url.Parse("https://scim.example.com/Groups/groupId")
+
+	req := httpReqMatcher{
+		httpReq: &http.Request{
+			URL:    calledURL,
+			Method: http.MethodPatch,
+		},
+		body: "{\"schemas\":[\"urn:ietf:params:scim:api:messages:2.0:PatchOp\"],\"Operations\":[{\"op\":\"replace\",\"path\":\"displayName\",\"value\":\"new\"}]}",
+	}
+
+	x.EXPECT().Do(&req).MaxTimes(1).Return(&http.Response{
+		Status:     "OK",
+		StatusCode: 200,
+		Body:       nopCloser{bytes.NewBufferString("")},
+	}, nil)
+
+	err = c.RenameGroup(g, "new")
+	assert.NoError(t, err)
+
+	err = c.RenameGroup(nil, "new")
+	assert.Error(t, err)
+}
+
 func TestClient_RemoveUserFromGroup(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -746,3 +1047,423 @@ func TestClient_RemoveUserFromGroup(t *testing.T) {
 	err = c.RemoveUserFromGroup(u, nil)
 	assert.Error(t, err)
 }
+
+func TestReadOnlyClient(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	x := mock.NewMockIHttpClient(ctrl)
+
+	c, err := NewClient(NewReadOnlyClient(x), &Config{
+		Endpoint: "https://scim.example.com/",
+		Token:    "bearerToken",
+	})
+	assert.NoError(t, err)
+
+	calledURL, _ := url.Parse("https://scim.example.com/Groups")
+
+	req := httpReqMatcher{httpReq: &http.Request{
+		URL:    calledURL,
+		Method: http.MethodGet,
+	}}
+
+	x.EXPECT().Do(&req).MaxTimes(1).Return(&http.Response{
+		Status:     "OK",
+		StatusCode: 200,
+		Body:       nopCloser{bytes.NewBufferString(`{"totalResults":0,"Resources":[]}`)},
+	}, nil)
+
+	_, err = c.GetGroups()
+	assert.NoError(t, err)
+
+	_, err = c.CreateGroup(NewGroup("group"))
+	assert.ErrorIs(t, err, ErrReadOnly)
+
+	err = c.DeleteUser(&User{ID: "123"})
+	assert.ErrorIs(t, err, ErrReadOnly)
+}
+
+func TestMembershipCacheClient(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	x := mock.NewMockIHttpClient(ctrl)
+
+	client, err := NewClient(x, &Config{
+		Endpoint: "https://scim.example.com/",
+		Token:    "bearerToken",
+	})
+	assert.NoError(t, err)
+	c := NewMembershipCacheClient(client)
+
+	u := &User{ID: "userId"}
+	g := &Group{ID: "groupId"}
+
+	checkURL, _ := url.Parse("https://scim.example.com/Groups")
+	q := checkURL.Query()
+	q.Add("filter", "id eq \"groupId\" and members eq \"userId\"")
+	checkURL.RawQuery = q.Encode()
+	checkReq := httpReqMatcher{httpReq: &http.Request{URL: checkURL, Method: http.MethodGet}}
+
+	falseResult, _ := json.Marshal(&GroupFilterResults{TotalResults: 0})
+	x.EXPECT().Do(&checkReq).Times(1).Return(&http.Response{
+		Status:     "OK",
+		StatusCode: 200,
+		Body:       nopCloser{bytes.NewBuffer(falseResult)},
+	}, nil)
+
+	// only the first check is sent
+	for i := 0; i < 3; i++ {
+		v, err := c.IsUserInGroup(u, g)
+		assert.NoError(t, err)
+		assert.False(t, v)
+	}
+
+	// adding the user updates the cache
+	patchURL, _ := url.Parse("https://scim.example.com/Groups/groupId")
+	patchReq := httpReqMatcher{
+		httpReq: &http.Request{URL: patchURL, Method: http.MethodPatch},
+		body:    "{\"schemas\":[\"urn:ietf:params:scim:api:messages:2.0:PatchOp\"],\"Operations\":[{\"op\":\"add\",\"path\":\"members\",\"value\":[{\"value\":\"userId\"}]}]}",
+	}
+	x.EXPECT().Do(&patchReq).Times(1).Return(&http.Response{
+		Status:     "OK",
+		StatusCode: 200,
+		Body:       nopCloser{bytes.NewBufferString("")},
+	}, nil)
+	assert.NoError(t, c.AddUserToGroup(u, g))
+
+	v, err := c.IsUserInGroup(u, g)
+	assert.NoError(t, err)
+	assert.True(t, v)
+}
+
+func TestClient_GetGroupMemberIDs(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	x := mock.NewMockIHttpClient(ctrl)
+
+	c, err := NewClient(x, &Config{
+		Endpoint: "https://scim.example.com/",
+		Token:    "bearerToken",
+	})
+	assert.NoError(t, err)
+
+	_, err = c.GetGroupMemberIDs(nil)
+	assert.Error(t, err)
+
+	calledURL, _ := url.Parse("https://scim.example.com/Groups/groupId?attributes=members")
+	req := httpReqMatcher{
+		httpReq: &http.Request{
+			URL:    calledURL,
+			Method: http.MethodGet,
+		},
+	}
+
+	// endpoint returning the members
+	x.EXPECT().Do(&req).MaxTimes(1).Return(&http.Response{
+		Status:     "OK",
+		StatusCode: 200,
+		Body:       nopCloser{bytes.NewBufferString(`{"id":"groupId","members":[{"value":"userId1"},{"value":"userId2"}]}`)},
+	}, nil)
+
+	ids, err := c.GetGroupMemberIDs(&Group{ID: "groupId"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"userId1", "userId2"}, ids)
+
+	// endpoint not returning the members
+	x.EXPECT().Do(&req).MaxTimes(1).Return(&http.Response{
+		Status:     "OK",
+		StatusCode: 200,
+		Body:       nopCloser{bytes.NewBufferString(`{"id":"groupId","displayName":"group"}`)},
+	}, nil)
+
+	_, err = c.GetGroupMemberIDs(&Group{ID: "groupId"})
+	assert.Equal(t, ErrMembersNotSupported, err)
+}
+
+func TestClient_GetMemberGroupIDs(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	x := mock.NewMockIHttpClient(ctrl)
+
+	c, err := NewClient(x, &Config{
+		Endpoint: "https://scim.example.com/",
+		Token:    "bearerToken",
+	})
+	assert.NoError(t, err)
+
+	_, err = c.GetMemberGroupIDs(nil)
+	assert.Error(t, err)
+
+	calledURL, _ := url.Parse("https://scim.example.com/Groups")
+	q := calledURL.Query()
+	q.Add("filter", "members eq \"userId\"")
+	calledURL.RawQuery = q.Encode()
+	req := httpReqMatcher{
+		httpReq: &http.Request{
+			URL:    calledURL,
+			Method: http.MethodGet,
+		},
+	}
+
+	// endpoint filtering the groups by member
+	x.EXPECT().Do(&req).MaxTimes(1).Return(&http.Response{
+		Status:     "OK",
+		StatusCode: 200,
+		Body:       nopCloser{bytes.NewBufferString(`{"totalResults":2,"Resources":[{"id":"groupId1"},{"id":"groupId2"}]}`)},
+	}, nil)
+
+	ids, err := c.GetMemberGroupIDs(&User{ID: "userId"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"groupId1", "groupId2"}, ids)
+
+	// endpoint rejecting the filter
+	x.EXPECT().Do(&req).MaxTimes(1).Return(&http.Response{
+		Status:     "Bad Request",
+		StatusCode: 400,
+		Body:       nopCloser{bytes.NewBufferString(`{"detail":"unsupported filter"}`)},
+	}, nil)
+
+	_, err = c.GetMemberGroupIDs(&User{ID: "userId"})
+	assert.Equal(t, ErrMembersNotSupported, err)
+}
+
+func TestClient_GetGroupMembers(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	x := mock.NewMockIHttpClient(ctrl)
+
+	c, err := NewClient(x, &Config{
+		Endpoint: "https://scim.example.com/",
+		Token:    "bearerToken",
+	})
+	assert.NoError(t, err)
+
+	membersURL, _ := url.Parse("https://scim.example.com/Groups/groupId?attributes=members")
+	userURL, _ := url.Parse("https://scim.example.com/Users/userId1")
+
+	gomock.InOrder(
+		x.EXPECT().Do(&httpReqMatcher{httpReq: &http.Request{URL: membersURL, Method: http.MethodGet}}).Return(&http.Response{
+			Status:     "OK",
+			StatusCode: 200,
+			Body:       nopCloser{bytes.NewBufferString(`{"id":"groupId","members":[{"value":"userId1"}]}`)},
+		}, nil),
+		x.EXPECT().Do(&httpReqMatcher{httpReq: &http.Request{URL: userURL, Method: http.MethodGet}}).Return(&http.Response{
+			Status:     "OK",
+			StatusCode: 200,
+			Body:       nopCloser{bytes.NewBufferString(`{"id":"userId1","userName":"user-1@example.com"}`)},
+		}, nil),
+	)
+
+	users, err := c.GetGroupMembers(&Group{ID: "groupId"})
+	assert.NoError(t, err)
+	assert.Len(t, users, 1)
+	assert.Equal(t, "user-1@example.com", users[0].Username)
+}
+
+func TestClient_GetUsersPages(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	x := mock.NewMockIHttpClient(ctrl)
+
+	c, err := NewClient(x, &Config{
+		Endpoint: "https://scim.example.com/",
+		Token:    "bearerToken",
+		PageSize: 2,
+	})
+	assert.NoError(t, err)
+
+	for _, page := range []struct {
+		url  string
+		body string
+	}{
+		{"https://scim.example.com/Users?count=2", `{"totalResults":3,"Resources":[{"userName":"user-1"},{"userName":"user-2"}]}`},
+		{"https://scim.example.com/Users?count=2&startIndex=3", `{"totalResults":3,"Resources":[{"userName":"user-3"}]}`},
+	} {
+		calledURL, _ := url.Parse(page.url)
+		x.EXPECT().Do(&httpReqMatcher{
+			httpReq: &http.Request{
+				URL:    calledURL,
+				Method: http.MethodGet,
+			},
+		}).Times(1).Return(&http.Response{
+			Status:     "OK",
+			StatusCode: 200,
+			Body:       nopCloser{bytes.NewBufferString(page.body)},
+		}, nil)
+	}
+
+	users, err := c.GetUsers()
+	assert.NoError(t, err)
+	if assert.Len(t, users, 3) {
+		assert.Equal(t, "user-1", users[0].Username)
+		assert.Equal(t, "user-3", users[2].Username)
+	}
+
+	// an error of fn stops the listing without reading the next pages
+	calledURL, _ := url.Parse("https://scim.example.com/Groups?count=2")
+	x.EXPECT().Do(&httpReqMatcher{
+		httpReq: &http.Request{
+			URL:    calledURL,
+			Method: http.MethodGet,
+		},
+	}).Times(1).Return(&http.Response{
+		Status:     "OK",
+		StatusCode: 200,
+		Body:       nopCloser{bytes.NewBufferString(`{"totalResults":5,"Resources":[{"displayName":"group-1"},{"displayName":"group-2"}]}`)},
+	}, nil)
+
+	stop := errors.New("stop")
+	seen := 0
+	err = c.ForEachGroup(func(g *Group) error {
+		seen++
+		return stop
+	})
+	assert.Equal(t, stop, err)
+	assert.Equal(t, 1, seen)
+}
+
+func TestDryRunClient(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	// no request is expected: writes must not reach the endpoint
+	x := mock.NewMockIHttpClient(ctrl)
+
+	client, err := NewClient(x, &Config{
+		Endpoint: "https://scim.example.com/",
+		Token:    "bearerToken",
+	})
+	assert.NoError(t, err)
+	c := NewDryRunClient(client)
+
+	u := &User{ID: "userId", Username: "user@example.com"}
+	g := &Group{ID: "groupId", DisplayName: "group"}
+
+	created, err := c.CreateUser(u)
+	assert.NoError(t, err)
+	assert.Equal(t, u, created)
+	found, err := c.FindUserByEmail("user@example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, u, found)
+
+	_, err = c.UpdateUser(u)
+	assert.NoError(t, err)
+	newGroup, err := c.CreateGroup(g)
+	assert.NoError(t, err)
+	assert.Equal(t, g, newGroup)
+	assert.NoError(t, c.AddUserToGroup(u, g))
+	assert.NoError(t, c.RemoveUserFromGroup(u, g))
+	assert.NoError(t, c.DeleteUser(u))
+	assert.NoError(t, c.DeleteGroup(g))
+
+	assert.Equal(t, ErrUserNotSpecified, c.AddUserToGroup(nil, g))
+	assert.Equal(t, ErrGroupNotSpecified, c.DeleteGroup(nil))
+}
+
+// countingClient counts the lookups reaching it
+type countingClient struct {
+	Client
+	calls map[string]int
+}
+
+func (c *countingClient) FindUserByEmail(email string) (*User, error) {
+	c.calls["FindUserByEmail"]++
+	if email == "missing@example.com" {
+		return nil, ErrUserNotFound
+	}
+	return &User{ID: "userId", Username: email}, nil
+}
+
+func (c *countingClient) UpdateUser(u *User) (*User, error) {
+	return u, nil
+}
+
+func (c *countingClient) GetUsers() ([]*User, error) {
+	c.calls["GetUsers"]++
+	return []*User{{ID: "listedId", Username: "listed@example.com"}}, nil
+}
+
+func (c *countingClient) FindUserByID(id string) (*User, error) {
+	c.calls["FindUserByID"]++
+	return &User{ID: id}, nil
+}
+
+func (c *countingClient) FindGroupByDisplayName(name string) (*Group, error) {
+	c.calls["FindGroupByDisplayName"]++
+	return &Group{DisplayName: name}, nil
+}
+
+func (c *countingClient) GetGroups() ([]*Group, error) {
+	c.calls["GetGroups"]++
+	return []*Group{{ID: "groupId", DisplayName: "group"}}, nil
+}
+
+func (c *countingClient) CreateGroup(g *Group) (*Group, error) {
+	return g, nil
+}
+
+func TestResponseCacheClient(t *testing.T) {
+	base := &countingClient{calls: map[string]int{}}
+	c := NewResponseCacheClient(base)
+
+	for i := 0; i < 3; i++ {
+		u, err := c.FindUserByEmail("user@example.com")
+		assert.NoError(t, err)
+		assert.Equal(t, "userId", u.ID)
+		// callers can't alter the cache
+		u.ID = "changed"
+	}
+	assert.Equal(t, 1, base.calls["FindUserByEmail"])
+
+	// errors aren't cached
+	for i := 0; i < 2; i++ {
+		_, err := c.FindUserByEmail("missing@example.com")
+		assert.Equal(t, ErrUserNotFound, err)
+	}
+	assert.Equal(t, 3, base.calls["FindUserByEmail"])
+
+	// writes invalidate the entries
+	_, err := c.UpdateUser(&User{ID: "userId", Username: "user@example.com"})
+	assert.NoError(t, err)
+	_, err = c.FindUserByEmail("user@example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, 4, base.calls["FindUserByEmail"])
+
+	_, err = c.GetGroups()
+	assert.NoError(t, err)
+	_, err = c.GetGroups()
+	assert.NoError(t, err)
+	_, err = c.CreateGroup(&Group{DisplayName: "other"})
+	assert.NoError(t, err)
+	_, err = c.GetGroups()
+	assert.NoError(t, err)
+	assert.Equal(t, 2, base.calls["GetGroups"])
+
+	assert.Equal(t, CacheStats{Hits: 3, Misses: 6}, c.(CacheStatsReporter).CacheStats())
+}
+
+func TestResponseCacheClientIndexesLists(t *testing.T) {
+	base := &countingClient{calls: map[string]int{}}
+	c := NewResponseCacheClient(base)
+
+	_, err := c.GetUsers()
+	assert.NoError(t, err)
+	_, err = c.GetGroups()
+	assert.NoError(t, err)
+
+	u, err := c.FindUserByEmail("listed@example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, "listedId", u.ID)
+	u, err = c.FindUserByID("listedId")
+	assert.NoError(t, err)
+	assert.Equal(t, "listed@example.com", u.Username)
+	g, err := c.FindGroupByDisplayName("group")
+	assert.NoError(t, err)
+	assert.Equal(t, "groupId", g.ID)
+	assert.Equal(t, 0, base.calls["FindUserByEmail"]+base.calls["FindUserByID"]+base.calls["FindGroupByDisplayName"])
+}
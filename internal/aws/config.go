@@ -20,6 +20,18 @@ import "github.com/BurntSushi/toml"
 type Config struct {
 	Endpoint string
 	Token    string
+	Headers  map[string]string
+	// PageSize is the number of resources asked for in each page of a
+	// list, 0 leaves it to the endpoint
+	PageSize int
+	// PatchUsers updates the users with PATCH requests of their changed
+	// attributes rather than replacing them, see Client.UpdateUser
+	PatchUsers bool
+	// ManagedPaths are the paths of the user attributes the caller syncs,
+	// the only ones a PATCH request removes, so the attributes set by other
+	// tools are kept. The attributes of the enterprise extension are managed
+	// when EnterpriseUserSchema is. Without any, all of them are.
+	ManagedPaths []string
 }
 
 // ReadConfigFromFile will read a TOML file into the Config Struct
@@ -0,0 +1,149 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aws
+
+import (
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// dryRunClient logs the writes instead of executing them, reads are sent to
+// the wrapped client. The users created during the run can be found by
+// email, as later steps of a sync look them up.
+type dryRunClient struct {
+	Client
+
+	mu      sync.Mutex
+	created map[string]*User
+}
+
+// NewDryRunClient returns a Client which only logs the creations, updates
+// and deletions, without sending them
+func NewDryRunClient(c Client) Client {
+	return &dryRunClient{
+		Client:  c,
+		created: make(map[string]*User),
+	}
+}
+
+func dryRun(action string) *log.Entry {
+	return log.WithFields(log.Fields{"dryRun": true, "action": action})
+}
+
+// AddUserToGroup will log the addition of the user to the group
+func (c *dryRunClient) AddUserToGroup(u *User, g *Group) error {
+	if u == nil {
+		return ErrUserNotSpecified
+	}
+	if g == nil {
+		return ErrGroupNotSpecified
+	}
+	dryRun("add member").WithFields(log.Fields{"user": u.Username, "group": g.DisplayName}).Info("Dry run, not adding user to group")
+	return nil
+}
+
+// RemoveUserFromGroup will log the removal of the user from the group
+func (c *dryRunClient) RemoveUserFromGroup(u *User, g *Group) error {
+	if u == nil {
+		return ErrUserNotSpecified
+	}
+	if g == nil {
+		return ErrGroupNotSpecified
+	}
+	dryRun("remove member").WithFields(log.Fields{"user": u.Username, "group": g.DisplayName}).Info("Dry run, not removing user from group")
+	return nil
+}
+
+// CreateUser will log the creation of the user and return it
+func (c *dryRunClient) CreateUser(u *User) (*User, error) {
+	if u == nil {
+		return nil, ErrUserNotSpecified
+	}
+	dryRun("create user").WithField("user", u.Username).Info("Dry run, not creating user")
+	created := *u
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.created[NormalizeName(u.Username)] = &created
+	return &created, nil
+}
+
+// CreateUsers will log the creation of the users and return them
+func (c *dryRunClient) CreateUsers(users []*User) ([]BulkResult, error) {
+	results := make([]BulkResult, len(users))
+	for i, u := range users {
+		created, err := c.CreateUser(u)
+		results[i] = BulkResult{User: created, Err: err}
+	}
+	return results, nil
+}
+
+// UpdateUser will log the update of the user and return it
+func (c *dryRunClient) UpdateUser(u *User) (*User, error) {
+	if u == nil {
+		return nil, ErrUserNotFound
+	}
+	dryRun("update user").WithField("user", u.Username).Info("Dry run, not updating user")
+	return u, nil
+}
+
+// DeleteUser will log the deletion of the user
+func (c *dryRunClient) DeleteUser(u *User) error {
+	if u == nil {
+		return ErrUserNotSpecified
+	}
+	dryRun("delete user").WithField("user", u.Username).Info("Dry run, not deleting user")
+	return nil
+}
+
+// CreateGroup will log the creation of the group and return it
+func (c *dryRunClient) CreateGroup(g *Group) (*Group, error) {
+	if g == nil {
+		return nil, ErrGroupNotSpecified
+	}
+	dryRun("create group").WithField("group", g.DisplayName).Info("Dry run, not creating group")
+	created := *g
+	return &created, nil
+}
+
+// DeleteGroup will log the deletion of the group
+func (c *dryRunClient) DeleteGroup(g *Group) error {
+	if g == nil {
+		return ErrGroupNotSpecified
+	}
+	dryRun("delete group").WithField("group", g.DisplayName).Info("Dry run, not deleting group")
+	return nil
+}
+
+// RenameGroup will log the renaming of the group
+func (c *dryRunClient) RenameGroup(g *Group, name string) error {
+	if g == nil {
+		return ErrGroupNotSpecified
+	}
+	dryRun("rename group").WithFields(log.Fields{"group": g.DisplayName, "name": name}).Info("Dry run, not renaming group")
+	return nil
+}
+
+// FindUserByEmail will find the user by the email address specified, among
+// the users created during the dry run first
+func (c *dryRunClient) FindUserByEmail(email string) (*User, error) {
+	c.mu.Lock()
+	u, ok := c.created[NormalizeName(email)]
+	c.mu.Unlock()
+	if ok {
+		return u, nil
+	}
+	return c.Client.FindUserByEmail(email)
+}
@@ -0,0 +1,83 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aws
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	// scimHostRegexp matches the host of the AWS SSO SCIM endpoints,
+	// e.g. scim.eu-west-1.amazonaws.com
+	scimHostRegexp = regexp.MustCompile(`^scim\.([a-z0-9-]+)\.amazonaws\.com(\.cn)?$`)
+	// regionRegexp matches the AWS region names, e.g. us-gov-west-1
+	regionRegexp = regexp.MustCompile(`^[a-z]{2}(-gov|-iso[a-z]*)?-[a-z]+-\d+$`)
+	// scimPathRegexp matches the path of the AWS SSO SCIM endpoints, made of
+	// the tenant id and /scim/v2
+	scimPathRegexp = regexp.MustCompile(`^/([A-Za-z0-9-]+)/scim/v2/?$`)
+)
+
+// ValidateEndpoint checks that endpoint is a valid SCIM endpoint, and that an
+// AWS SSO SCIM endpoint has the expected form:
+// https://scim.<region>.amazonaws.com/<tenant id>/scim/v2/
+// Mistakes that don't make the endpoint unusable, like a region other than
+// region, are logged as warnings. Other endpoints, e.g. proxies, are only
+// checked to be absolute URLs.
+func ValidateEndpoint(endpoint string, region string) error {
+	if endpoint == "" {
+		return fmt.Errorf("the SCIM endpoint is not set")
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return fmt.Errorf("invalid SCIM endpoint %q: %w", endpoint, err)
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return fmt.Errorf("invalid SCIM endpoint %q: an absolute URL such as https://scim.<region>.amazonaws.com/<tenant id>/scim/v2/ is expected", endpoint)
+	}
+	m := scimHostRegexp.FindStringSubmatch(u.Host)
+	if m == nil {
+		log.WithField("endpoint", endpoint).Info("SCIM endpoint is not an AWS SSO endpoint, its format is not validated")
+		return nil
+	}
+	if u.Scheme != "https" {
+		return fmt.Errorf("invalid SCIM endpoint %q: AWS SSO requires https", endpoint)
+	}
+	endpointRegion := m[1]
+	if !regionRegexp.MatchString(endpointRegion) {
+		return fmt.Errorf("invalid SCIM endpoint %q: %q is not an AWS region", endpoint, endpointRegion)
+	}
+	if !scimPathRegexp.MatchString(u.Path) {
+		if !strings.Contains(u.Path, "/scim/v2") {
+			return fmt.Errorf("invalid SCIM endpoint %q: the path must be /<tenant id>/scim/v2/, /scim/v2 is missing", endpoint)
+		}
+		return fmt.Errorf("invalid SCIM endpoint %q: the path must be /<tenant id>/scim/v2/", endpoint)
+	}
+	if u.RawQuery != "" || u.Fragment != "" {
+		log.WithField("endpoint", endpoint).Warn("SCIM endpoint has a query or fragment, it is ignored by AWS SSO")
+	}
+	if region != "" && region != endpointRegion {
+		log.WithFields(log.Fields{
+			"endpoint":       endpoint,
+			"endpointRegion": endpointRegion,
+			"region":         region,
+		}).Warn("SCIM endpoint is in another region than the AWS region configured, make sure it is the region of the AWS SSO instance")
+	}
+	return nil
+}
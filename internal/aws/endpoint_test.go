@@ -0,0 +1,46 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aws
+
+import (
+	"testing"
+)
+
+func TestValidateEndpoint(t *testing.T) {
+	tests := []struct {
+		name     string
+		endpoint string
+		wantErr  bool
+	}{
+		{name: "valid", endpoint: "https://scim.eu-west-1.amazonaws.com/a1b2c3d4-5678-90ab-cdef-EXAMPLE11111/scim/v2/"},
+		{name: "valid without trailing slash", endpoint: "https://scim.us-east-1.amazonaws.com/a1b2c3d4/scim/v2"},
+		{name: "valid gov region", endpoint: "https://scim.us-gov-west-1.amazonaws.com/a1b2c3d4/scim/v2/"},
+		{name: "proxy", endpoint: "https://scim-proxy.example.com/v2"},
+		{name: "empty", endpoint: "", wantErr: true},
+		{name: "not absolute", endpoint: "scim.eu-west-1.amazonaws.com/a1b2c3d4/scim/v2/", wantErr: true},
+		{name: "http", endpoint: "http://scim.eu-west-1.amazonaws.com/a1b2c3d4/scim/v2/", wantErr: true},
+		{name: "missing scim/v2", endpoint: "https://scim.eu-west-1.amazonaws.com/a1b2c3d4/", wantErr: true},
+		{name: "missing tenant", endpoint: "https://scim.eu-west-1.amazonaws.com/scim/v2/", wantErr: true},
+		{name: "trailing path", endpoint: "https://scim.eu-west-1.amazonaws.com/a1b2c3d4/scim/v2/Users", wantErr: true},
+		{name: "not a region", endpoint: "https://scim.europe.amazonaws.com/a1b2c3d4/scim/v2/", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateEndpoint(tt.endpoint, "eu-west-1"); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateEndpoint() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,416 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package fake provides an in-memory AWS SSO SCIM client, to test the code
+// using an aws.Client without a SCIM endpoint, or to compute changes offline
+// from a snapshot.
+package fake
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/awslabs/ssosync/internal/aws"
+)
+
+// Client is an in-memory aws.Client. Users and groups are identified by
+// generated ids, the objects returned are copies of the stored ones. Like
+// the SCIM API, creating a user or a group which exists fails with a 409.
+type Client struct {
+	// BulkNotSupported makes CreateUsers fail like an endpoint without bulk
+	// operations
+	BulkNotSupported bool
+
+	mu      sync.Mutex
+	nextID  int
+	users   map[string]*aws.User
+	groups  map[string]*aws.Group
+	members map[string]map[string]bool
+}
+
+var _ aws.Client = (*Client)(nil)
+
+// NewClient returns an empty Client
+func NewClient() *Client {
+	return &Client{
+		users:   make(map[string]*aws.User),
+		groups:  make(map[string]*aws.Group),
+		members: make(map[string]map[string]bool),
+	}
+}
+
+// WithUsers creates the users, e.g. built with aws.NewUser, and returns c
+func (c *Client) WithUsers(users ...*aws.User) *Client {
+	for _, u := range users {
+		if _, err := c.CreateUser(u); err != nil {
+			panic(err)
+		}
+	}
+	return c
+}
+
+// WithGroup creates the group, e.g. built with aws.NewGroup, with the users
+// of emails as members, and returns c. The users must exist.
+func (c *Client) WithGroup(g *aws.Group, emails ...string) *Client {
+	g, err := c.CreateGroup(g)
+	if err != nil {
+		panic(err)
+	}
+	for _, email := range emails {
+		u, err := c.FindUserByEmail(email)
+		if err == nil {
+			err = c.AddUserToGroup(u, g)
+		}
+		if err != nil {
+			panic(fmt.Sprintf("adding %s to %s: %v", email, g.DisplayName, err))
+		}
+	}
+	return c
+}
+
+// id returns a new id with prefix, c.mu must be held
+func (c *Client) id(prefix string) string {
+	c.nextID++
+	return fmt.Sprintf("%s-%d", prefix, c.nextID)
+}
+
+// CreateUser implements aws.Client
+func (c *Client) CreateUser(u *aws.User) (*aws.User, error) {
+	if u == nil {
+		return nil, aws.ErrUserNotSpecified
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, existing := range c.users {
+		if existing.Username == u.Username {
+			return nil, &aws.ErrHttpNotOK{StatusCode: http.StatusConflict}
+		}
+	}
+	created := *u
+	created.ID = c.id("user")
+	c.users[created.ID] = &created
+	return copyUser(&created), nil
+}
+
+// CreateUsers implements aws.Client, each user is created like with
+// CreateUser
+func (c *Client) CreateUsers(users []*aws.User) ([]aws.BulkResult, error) {
+	if c.BulkNotSupported {
+		return nil, aws.ErrBulkNotSupported
+	}
+	results := make([]aws.BulkResult, len(users))
+	for i, u := range users {
+		created, err := c.CreateUser(u)
+		results[i] = aws.BulkResult{User: created, Err: err}
+	}
+	return results, nil
+}
+
+// UpdateUser implements aws.Client
+func (c *Client) UpdateUser(u *aws.User) (*aws.User, error) {
+	if u == nil {
+		return nil, aws.ErrUserNotFound
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.users[u.ID]; !ok {
+		return nil, aws.ErrUserNotFound
+	}
+	c.users[u.ID] = copyUser(u)
+	return copyUser(u), nil
+}
+
+// DeleteUser implements aws.Client, the user is removed from its groups
+func (c *Client) DeleteUser(u *aws.User) error {
+	if u == nil {
+		return aws.ErrUserNotSpecified
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.users[u.ID]; !ok {
+		return aws.ErrUserNotFound
+	}
+	delete(c.users, u.ID)
+	for _, members := range c.members {
+		delete(members, u.ID)
+	}
+	return nil
+}
+
+// FindUserByEmail implements aws.Client
+func (c *Client) FindUserByEmail(email string) (*aws.User, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, u := range c.users {
+		if aws.NormalizeName(u.Username) == aws.NormalizeName(email) {
+			return copyUser(u), nil
+		}
+	}
+	return nil, aws.ErrUserNotFound
+}
+
+// FindUserByID implements aws.Client
+func (c *Client) FindUserByID(id string) (*aws.User, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	u, ok := c.users[id]
+	if !ok {
+		return nil, aws.ErrUserNotFound
+	}
+	return copyUser(u), nil
+}
+
+// GetUsers implements aws.Client, the users are sorted by user name
+func (c *Client) GetUsers() ([]*aws.User, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	users := make([]*aws.User, 0, len(c.users))
+	for _, u := range c.users {
+		users = append(users, copyUser(u))
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].Username < users[j].Username })
+	return users, nil
+}
+
+// ForEachUser implements aws.Client, fn is called without holding the lock
+// so it can call the client
+func (c *Client) ForEachUser(fn func(*aws.User) error) error {
+	users, _ := c.GetUsers()
+	for _, u := range users {
+		if err := fn(u); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CreateGroup implements aws.Client
+func (c *Client) CreateGroup(g *aws.Group) (*aws.Group, error) {
+	if g == nil {
+		return nil, aws.ErrGroupNotSpecified
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, existing := range c.groups {
+		if existing.DisplayName == g.DisplayName {
+			return nil, &aws.ErrHttpNotOK{StatusCode: http.StatusConflict}
+		}
+	}
+	created := *g
+	created.ID = c.id("group")
+	created.Members = nil
+	c.groups[created.ID] = &created
+	c.members[created.ID] = make(map[string]bool)
+	return copyGroup(&created), nil
+}
+
+// DeleteGroup implements aws.Client
+func (c *Client) DeleteGroup(g *aws.Group) error {
+	if g == nil {
+		return aws.ErrGroupNotSpecified
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.groups[g.ID]; !ok {
+		return aws.ErrGroupNotFound
+	}
+	delete(c.groups, g.ID)
+	delete(c.members, g.ID)
+	return nil
+}
+
+// RenameGroup implements aws.Client
+func (c *Client) RenameGroup(g *aws.Group, name string) error {
+	if g == nil {
+		return aws.ErrGroupNotSpecified
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	existing, ok := c.groups[g.ID]
+	if !ok {
+		return aws.ErrGroupNotFound
+	}
+	for _, other := range c.groups {
+		if other.DisplayName == name && other.ID != g.ID {
+			return &aws.ErrHttpNotOK{StatusCode: http.StatusConflict}
+		}
+	}
+	existing.DisplayName = name
+	return nil
+}
+
+// FindGroupByDisplayName implements aws.Client
+func (c *Client) FindGroupByDisplayName(name string) (*aws.Group, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, g := range c.groups {
+		if aws.NormalizeName(g.DisplayName) == aws.NormalizeName(name) {
+			return copyGroup(g), nil
+		}
+	}
+	return nil, aws.ErrGroupNotFound
+}
+
+// GetGroups implements aws.Client, the groups are sorted by display name
+func (c *Client) GetGroups() ([]*aws.Group, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	groups := make([]*aws.Group, 0, len(c.groups))
+	for _, g := range c.groups {
+		groups = append(groups, copyGroup(g))
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].DisplayName < groups[j].DisplayName })
+	return groups, nil
+}
+
+// ForEachGroup implements aws.Client, fn is called without holding the lock
+// so it can call the client
+func (c *Client) ForEachGroup(fn func(*aws.Group) error) error {
+	groups, _ := c.GetGroups()
+	for _, g := range groups {
+		if err := fn(g); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AddUserToGroup implements aws.Client
+func (c *Client) AddUserToGroup(u *aws.User, g *aws.Group) error {
+	return c.setMember(u, g, true)
+}
+
+// RemoveUserFromGroup implements aws.Client
+func (c *Client) RemoveUserFromGroup(u *aws.User, g *aws.Group) error {
+	return c.setMember(u, g, false)
+}
+
+// setMember adds or removes u to or from g. Removing a user which isn't a
+// member succeeds, even when the user was deleted, as a sync removes the
+// memberships of the users it deleted.
+func (c *Client) setMember(u *aws.User, g *aws.Group, member bool) error {
+	if u == nil {
+		return aws.ErrUserNotSpecified
+	}
+	if g == nil {
+		return aws.ErrGroupNotSpecified
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.users[u.ID]; !ok && member {
+		return aws.ErrUserNotFound
+	}
+	members, ok := c.members[g.ID]
+	if !ok {
+		return aws.ErrGroupNotFound
+	}
+	if member {
+		members[u.ID] = true
+	} else {
+		delete(members, u.ID)
+	}
+	return nil
+}
+
+// IsUserInGroup implements aws.Client
+func (c *Client) IsUserInGroup(u *aws.User, g *aws.Group) (bool, error) {
+	if u == nil {
+		return false, aws.ErrUserNotSpecified
+	}
+	if g == nil {
+		return false, aws.ErrGroupNotSpecified
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	members, ok := c.members[g.ID]
+	if !ok {
+		return false, aws.ErrGroupNotFound
+	}
+	return members[u.ID], nil
+}
+
+// GetMemberGroupIDs implements aws.Client, the ids are sorted
+func (c *Client) GetMemberGroupIDs(u *aws.User) ([]string, error) {
+	if u == nil {
+		return nil, aws.ErrUserNotSpecified
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ids := make([]string, 0)
+	for id, members := range c.members {
+		if members[u.ID] {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// GetGroupMemberIDs implements aws.Client, the ids are sorted
+func (c *Client) GetGroupMemberIDs(g *aws.Group) ([]string, error) {
+	if g == nil {
+		return nil, aws.ErrGroupNotSpecified
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	members, ok := c.members[g.ID]
+	if !ok {
+		return nil, aws.ErrGroupNotFound
+	}
+	ids := make([]string, 0, len(members))
+	for id := range members {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// GetGroupMembers implements aws.Client, the users are sorted by user name
+func (c *Client) GetGroupMembers(g *aws.Group) ([]*aws.User, error) {
+	ids, err := c.GetGroupMemberIDs(g)
+	if err != nil {
+		return nil, err
+	}
+	users := make([]*aws.User, 0, len(ids))
+	for _, id := range ids {
+		u, err := c.FindUserByID(id)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].Username < users[j].Username })
+	return users, nil
+}
+
+// copyUser returns a copy of u, so the stored users can't be modified
+func copyUser(u *aws.User) *aws.User {
+	c := *u
+	c.Emails = append([]aws.UserEmail(nil), u.Emails...)
+	c.Addresses = append([]aws.UserAddress(nil), u.Addresses...)
+	if u.Enterprise != nil {
+		e := *u.Enterprise
+		c.Enterprise = &e
+	}
+	return &c
+}
+
+// copyGroup returns a copy of g, so the stored groups can't be modified
+func copyGroup(g *aws.Group) *aws.Group {
+	c := *g
+	c.Members = append([]string(nil), g.Members...)
+	return &c
+}
@@ -14,6 +14,19 @@
 
 package aws
 
+import (
+	"regexp"
+	"strings"
+)
+
+// OwnershipMarkerPrefix starts the marker stamped on the groups created by
+// earlier versions of ssosync, the external id of these groups
+const OwnershipMarkerPrefix = "managed-by: ssosync"
+
+// googleGroupID matches the ids of the Google groups, e.g. 0279ka6510ez4vx,
+// and of their overflow groups, e.g. 0279ka6510ez4vx-2
+var googleGroupID = regexp.MustCompile(`^[0-9a-z]{15}(-[0-9]+)?$`)
+
 // NewGroup creates an object representing a group with the given name
 func NewGroup(groupName string) *Group {
 	return &Group{
@@ -21,3 +34,32 @@ func NewGroup(groupName string) *Group {
 		DisplayName: groupName,
 	}
 }
+
+// NewManagedGroup creates an object representing a group with the given
+// name, whose external id is the id of its Google group, so other tools can
+// correlate the groups without matching their names
+func NewManagedGroup(groupName string, googleID string) *Group {
+	g := NewGroup(groupName)
+	g.ExternalID = googleID
+	return g
+}
+
+// Managed reports if the group was provisioned by ssosync: its external id
+// looks like the id of a Google group, or is the ownership marker set by
+// earlier versions. The groups created in the AWS SSO console have none, the
+// groups provisioned by other SCIM clients have another one.
+//
+// This is a heuristic, for the groups whose Google group isn't known, e.g.
+// deleted in Google Workspace: an id of another tool with the shape of a
+// Google group id counts as managed. ManagedFor is exact, use it when the
+// Google group is known.
+func (g *Group) Managed() bool {
+	return strings.HasPrefix(g.ExternalID, OwnershipMarkerPrefix) || googleGroupID.MatchString(g.ExternalID)
+}
+
+// ManagedFor reports if the group was provisioned by ssosync for the Google
+// group with googleID: its external id is this id, or the ownership marker
+// set by earlier versions
+func (g *Group) ManagedFor(googleID string) bool {
+	return strings.HasPrefix(g.ExternalID, OwnershipMarkerPrefix) || g.ExternalID == googleID
+}
@@ -27,3 +27,29 @@ func TestNewGroup(t *testing.T) {
 	assert.Equal(t, g.Schemas[0], "urn:ietf:params:scim:schemas:core:2.0:Group")
 	assert.Equal(t, g.DisplayName, "test_group@example.com")
 }
+
+func TestNewManagedGroup(t *testing.T) {
+	g := NewManagedGroup("test_group@example.com", "03x8tuzt2j3l8ys")
+
+	assert.Equal(t, g.DisplayName, "test_group@example.com")
+	assert.Equal(t, g.ExternalID, "03x8tuzt2j3l8ys")
+	assert.True(t, g.Managed())
+	// the ownership marker of earlier versions
+	assert.True(t, (&Group{ExternalID: "managed-by: ssosync run run-1"}).Managed())
+	// an overflow group
+	assert.True(t, (&Group{ExternalID: "03x8tuzt2j3l8ys-2"}).Managed())
+	assert.False(t, NewGroup("test_group@example.com").Managed())
+	// the external ids of other SCIM clients
+	assert.False(t, (&Group{ExternalID: "test_group@example.com"}).Managed())
+	assert.False(t, (&Group{ExternalID: "7f1c2a4e-9b0d-4c1e-8a3f-2d5e6b7c8d9e"}).Managed())
+}
+
+func TestGroupManagedFor(t *testing.T) {
+	g := NewManagedGroup("test_group@example.com", "03x8tuzt2j3l8ys")
+
+	assert.True(t, g.ManagedFor("03x8tuzt2j3l8ys"))
+	// the id of another Google group, or of another tool with the same shape
+	assert.False(t, g.ManagedFor("0279ka6510ez4vx"))
+	assert.True(t, (&Group{ExternalID: "managed-by: ssosync run run-1"}).ManagedFor("03x8tuzt2j3l8ys"))
+	assert.False(t, NewGroup("test_group@example.com").ManagedFor("03x8tuzt2j3l8ys"))
+}
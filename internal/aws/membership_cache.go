@@ -0,0 +1,100 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aws
+
+import (
+	"sync"
+)
+
+type membershipKey struct {
+	groupID string
+	userID  string
+}
+
+// membershipCacheClient remembers the result of the membership checks of a
+// run, so the same (user, group) pair is only queried once. The cache is
+// kept up to date by the membership changes made with the client.
+type membershipCacheClient struct {
+	Client
+
+	mu          sync.Mutex
+	memberships map[membershipKey]bool
+}
+
+// NewMembershipCacheClient returns a Client caching the results of
+// IsUserInGroup, it is meant to be used for a single run
+func NewMembershipCacheClient(c Client) Client {
+	return &membershipCacheClient{
+		Client:      c,
+		memberships: make(map[membershipKey]bool),
+	}
+}
+
+// IsUserInGroup will determine if user (u) is in group (g)
+func (c *membershipCacheClient) IsUserInGroup(u *User, g *Group) (bool, error) {
+	if u == nil || g == nil {
+		return c.Client.IsUserInGroup(u, g)
+	}
+	key := membershipKey{groupID: g.ID, userID: u.ID}
+	c.mu.Lock()
+	member, ok := c.memberships[key]
+	c.mu.Unlock()
+	if ok {
+		return member, nil
+	}
+	member, err := c.Client.IsUserInGroup(u, g)
+	if err != nil {
+		return false, err
+	}
+	c.set(key, member)
+	return member, nil
+}
+
+// GetMemberGroupIDs will return the ids of the groups the user is a member
+// of, the memberships are cached
+func (c *membershipCacheClient) GetMemberGroupIDs(u *User) ([]string, error) {
+	ids, err := c.Client.GetMemberGroupIDs(u)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		c.set(membershipKey{groupID: id, userID: u.ID}, true)
+	}
+	return ids, nil
+}
+
+// AddUserToGroup will add the user specified to the group specified
+func (c *membershipCacheClient) AddUserToGroup(u *User, g *Group) error {
+	if err := c.Client.AddUserToGroup(u, g); err != nil {
+		return err
+	}
+	c.set(membershipKey{groupID: g.ID, userID: u.ID}, true)
+	return nil
+}
+
+// RemoveUserFromGroup will remove the user specified from the group specified
+func (c *membershipCacheClient) RemoveUserFromGroup(u *User, g *Group) error {
+	if err := c.Client.RemoveUserFromGroup(u, g); err != nil {
+		return err
+	}
+	c.set(membershipKey{groupID: g.ID, userID: u.ID}, false)
+	return nil
+}
+
+func (c *membershipCacheClient) set(key membershipKey, member bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.memberships[key] = member
+}
@@ -0,0 +1,138 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aws
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+)
+
+// patchUser sends the attributes of u which differ from the ones of the
+// user in AWS SSO in a PATCH request, see UpdateUser
+func (c *client) patchUser(u *User) (*User, error) {
+	current, err := c.FindUserByID(u.ID)
+	if err != nil {
+		return nil, err
+	}
+	ops, err := userPatchOperations(current, u, c.managedPaths)
+	if err != nil {
+		return nil, err
+	}
+	if len(ops) == 0 {
+		return current, nil
+	}
+
+	startURL, err := url.Parse(c.endpointURL.String())
+	if err != nil {
+		return nil, err
+	}
+	startURL.Path = path.Join(startURL.Path, fmt.Sprintf("/Users/%s", u.ID))
+	resp, err := c.sendRequestWithBody(http.MethodPatch, startURL.String(), UserPatch{
+		Schemas:    []string{"urn:ietf:params:scim:api:messages:2.0:PatchOp"},
+		Operations: ops,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// the endpoint may answer without the user
+	var updated User
+	if err := json.Unmarshal(resp, &updated); err != nil || updated.ID == "" {
+		return c.FindUserByID(u.ID)
+	}
+	return &updated, nil
+}
+
+// userPatchOperations returns the operations changing the attributes of
+// current to the ones of u, sorted by path. The attributes are replaced
+// whole, but the ones of the enterprise extension which are replaced each,
+// and the attributes u doesn't have are removed when managed has them, see
+// Config.ManagedPaths, or managed is nil.
+func userPatchOperations(current *User, u *User, managed map[string]bool) ([]UserPatchOperation, error) {
+	from, err := patchAttributes(current)
+	if err != nil {
+		return nil, err
+	}
+	to, err := patchAttributes(u)
+	if err != nil {
+		return nil, err
+	}
+	ops := make([]UserPatchOperation, 0)
+	for p, v := range to {
+		if !bytes.Equal(from[p], v) {
+			ops = append(ops, UserPatchOperation{Operation: OperationReplace, Path: p, Value: v})
+		}
+	}
+	for p := range from {
+		if _, ok := to[p]; !ok && isManagedPath(managed, p) {
+			ops = append(ops, UserPatchOperation{Operation: OperationRemove, Path: p})
+		}
+	}
+	sort.Slice(ops, func(i, j int) bool { return ops[i].Path < ops[j].Path })
+	return ops, nil
+}
+
+// managedPaths returns the set of paths, nil when there is none
+func managedPaths(paths []string) map[string]bool {
+	if len(paths) == 0 {
+		return nil
+	}
+	set := make(map[string]bool, len(paths))
+	for _, p := range paths {
+		set[p] = true
+	}
+	return set
+}
+
+// isManagedPath tells whether managed, see Config.ManagedPaths, has the path
+// p, all the paths are when it is nil
+func isManagedPath(managed map[string]bool, p string) bool {
+	if managed == nil || managed[p] {
+		return true
+	}
+	return managed[EnterpriseUserSchema] && strings.HasPrefix(p, EnterpriseUserSchema+":")
+}
+
+// patchAttributes returns the JSON of the attributes of u by path, without
+// its id and schemas
+func patchAttributes(u *User) (map[string]json.RawMessage, error) {
+	b, err := json.Marshal(u)
+	if err != nil {
+		return nil, err
+	}
+	var attrs map[string]json.RawMessage
+	if err := json.Unmarshal(b, &attrs); err != nil {
+		return nil, err
+	}
+	delete(attrs, "id")
+	delete(attrs, "schemas")
+	if raw, ok := attrs[EnterpriseUserSchema]; ok {
+		delete(attrs, EnterpriseUserSchema)
+		var enterprise map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &enterprise); err != nil {
+			return nil, err
+		}
+		for k, v := range enterprise {
+			attrs[EnterpriseUserSchema+":"+k] = v
+		}
+	}
+	return attrs, nil
+}
@@ -0,0 +1,42 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aws
+
+import (
+	"errors"
+	"net/http"
+)
+
+// ErrReadOnly is returned when a write is attempted with a read-only client
+var ErrReadOnly = errors.New("write attempted with a read-only client")
+
+type readOnlyClient struct {
+	httpClient HttpClient
+}
+
+// NewReadOnlyClient wraps the given HttpClient so only GET and HEAD requests
+// are sent, every other request fails with ErrReadOnly without reaching
+// the endpoint.
+func NewReadOnlyClient(c HttpClient) HttpClient {
+	return &readOnlyClient{httpClient: c}
+}
+
+// Do sends the request if it doesn't write
+func (c *readOnlyClient) Do(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return nil, ErrReadOnly
+	}
+	return c.httpClient.Do(req)
+}
@@ -0,0 +1,312 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aws
+
+import (
+	"sync"
+)
+
+// CacheStats are the hits and misses of the lookups of a cache
+type CacheStats struct {
+	Hits   int
+	Misses int
+}
+
+// CacheStatsReporter is implemented by the clients caching responses
+type CacheStatsReporter interface {
+	CacheStats() CacheStats
+}
+
+// responseCacheClient remembers the users and groups looked up during a run,
+// so the same lookup is only sent once. The users and groups listed are
+// indexed too, so they aren't looked up again one by one. The entries
+// affected by a write made with the client are invalidated, errors are never
+// cached.
+type responseCacheClient struct {
+	Client
+
+	mu           sync.Mutex
+	stats        CacheStats
+	usersByEmail map[string]*User
+	usersByID    map[string]*User
+	groupsByName map[string]*Group
+	memberIDs    map[string][]string
+	users        []*User
+	groups       []*Group
+}
+
+// NewResponseCacheClient returns a Client caching the user and group
+// lookups, it is meant to be used for a single run
+func NewResponseCacheClient(c Client) Client {
+	return &responseCacheClient{
+		Client:       c,
+		usersByEmail: make(map[string]*User),
+		usersByID:    make(map[string]*User),
+		groupsByName: make(map[string]*Group),
+		memberIDs:    make(map[string][]string),
+	}
+}
+
+// CacheStats returns the hits and misses of the cache
+func (c *responseCacheClient) CacheStats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stats
+}
+
+// hit counts a lookup, found tells whether it was in the cache
+func (c *responseCacheClient) hit(found bool) {
+	if found {
+		c.stats.Hits++
+	} else {
+		c.stats.Misses++
+	}
+}
+
+func copyUser(u *User) *User {
+	cp := *u
+	return &cp
+}
+
+func copyGroup(g *Group) *Group {
+	cp := *g
+	return &cp
+}
+
+// FindUserByEmail will find the user by the email address specified
+func (c *responseCacheClient) FindUserByEmail(email string) (*User, error) {
+	c.mu.Lock()
+	u, ok := c.usersByEmail[NormalizeName(email)]
+	c.hit(ok)
+	c.mu.Unlock()
+	if ok {
+		return copyUser(u), nil
+	}
+	u, err := c.Client.FindUserByEmail(email)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	c.usersByEmail[NormalizeName(email)] = copyUser(u)
+	c.mu.Unlock()
+	return u, nil
+}
+
+// FindUserByID will find the user by its id
+func (c *responseCacheClient) FindUserByID(id string) (*User, error) {
+	c.mu.Lock()
+	u, ok := c.usersByID[id]
+	c.hit(ok)
+	c.mu.Unlock()
+	if ok {
+		return copyUser(u), nil
+	}
+	u, err := c.Client.FindUserByID(id)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	c.usersByID[id] = copyUser(u)
+	c.mu.Unlock()
+	return u, nil
+}
+
+// FindGroupByDisplayName will find the group by its displayname
+func (c *responseCacheClient) FindGroupByDisplayName(name string) (*Group, error) {
+	c.mu.Lock()
+	g, ok := c.groupsByName[NormalizeName(name)]
+	c.hit(ok)
+	c.mu.Unlock()
+	if ok {
+		return copyGroup(g), nil
+	}
+	g, err := c.Client.FindGroupByDisplayName(name)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	c.groupsByName[NormalizeName(name)] = copyGroup(g)
+	c.mu.Unlock()
+	return g, nil
+}
+
+// GetUsers will return existing users
+func (c *responseCacheClient) GetUsers() ([]*User, error) {
+	c.mu.Lock()
+	users := c.users
+	c.hit(users != nil)
+	c.mu.Unlock()
+	if users == nil {
+		var err error
+		if users, err = c.Client.GetUsers(); err != nil {
+			return nil, err
+		}
+		c.mu.Lock()
+		c.users = users
+		for _, u := range users {
+			c.usersByEmail[NormalizeName(u.Username)] = copyUser(u)
+			c.usersByID[u.ID] = copyUser(u)
+		}
+		c.mu.Unlock()
+	}
+	cp := make([]*User, len(users))
+	for i, u := range users {
+		cp[i] = copyUser(u)
+	}
+	return cp, nil
+}
+
+// GetGroups will return existing groups
+func (c *responseCacheClient) GetGroups() ([]*Group, error) {
+	c.mu.Lock()
+	groups := c.groups
+	c.hit(groups != nil)
+	c.mu.Unlock()
+	if groups == nil {
+		var err error
+		if groups, err = c.Client.GetGroups(); err != nil {
+			return nil, err
+		}
+		c.mu.Lock()
+		c.groups = groups
+		for _, g := range groups {
+			c.groupsByName[NormalizeName(g.DisplayName)] = copyGroup(g)
+		}
+		c.mu.Unlock()
+	}
+	cp := make([]*Group, len(groups))
+	for i, g := range groups {
+		cp[i] = copyGroup(g)
+	}
+	return cp, nil
+}
+
+// GetGroupMemberIDs will return the ids of the members of the group
+func (c *responseCacheClient) GetGroupMemberIDs(g *Group) ([]string, error) {
+	if g == nil {
+		return c.Client.GetGroupMemberIDs(g)
+	}
+	c.mu.Lock()
+	ids, ok := c.memberIDs[g.ID]
+	c.hit(ok)
+	c.mu.Unlock()
+	if !ok {
+		var err error
+		if ids, err = c.Client.GetGroupMemberIDs(g); err != nil {
+			return nil, err
+		}
+		c.mu.Lock()
+		c.memberIDs[g.ID] = ids
+		c.mu.Unlock()
+	}
+	return append([]string(nil), ids...), nil
+}
+
+// CreateUser will create the user specified
+func (c *responseCacheClient) CreateUser(u *User) (*User, error) {
+	c.invalidateUser(u)
+	return c.Client.CreateUser(u)
+}
+
+// CreateUsers will create the users specified
+func (c *responseCacheClient) CreateUsers(users []*User) ([]BulkResult, error) {
+	for _, u := range users {
+		c.invalidateUser(u)
+	}
+	return c.Client.CreateUsers(users)
+}
+
+// UpdateUser will update/replace the user specified
+func (c *responseCacheClient) UpdateUser(u *User) (*User, error) {
+	c.invalidateUser(u)
+	return c.Client.UpdateUser(u)
+}
+
+// DeleteUser will remove the current user from the directory
+func (c *responseCacheClient) DeleteUser(u *User) error {
+	c.invalidateUser(u)
+	// the user is no longer a member of any group
+	c.mu.Lock()
+	c.memberIDs = make(map[string][]string)
+	c.mu.Unlock()
+	return c.Client.DeleteUser(u)
+}
+
+// CreateGroup will create a group given
+func (c *responseCacheClient) CreateGroup(g *Group) (*Group, error) {
+	c.invalidateGroup(g)
+	return c.Client.CreateGroup(g)
+}
+
+// DeleteGroup will delete the group specified
+func (c *responseCacheClient) DeleteGroup(g *Group) error {
+	c.invalidateGroup(g)
+	return c.Client.DeleteGroup(g)
+}
+
+// RenameGroup will replace the display name of the group specified
+func (c *responseCacheClient) RenameGroup(g *Group, name string) error {
+	c.invalidateGroup(g)
+	return c.Client.RenameGroup(g, name)
+}
+
+// AddUserToGroup will add the user specified to the group specified
+func (c *responseCacheClient) AddUserToGroup(u *User, g *Group) error {
+	c.invalidateMembers(g)
+	return c.Client.AddUserToGroup(u, g)
+}
+
+// RemoveUserFromGroup will remove the user specified from the group specified
+func (c *responseCacheClient) RemoveUserFromGroup(u *User, g *Group) error {
+	c.invalidateMembers(g)
+	return c.Client.RemoveUserFromGroup(u, g)
+}
+
+func (c *responseCacheClient) invalidateUser(u *User) {
+	if u == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.usersByEmail, NormalizeName(u.Username))
+	// and under its previous email, when it changed
+	for email, cached := range c.usersByEmail {
+		if cached != nil && u.ID != "" && cached.ID == u.ID {
+			delete(c.usersByEmail, email)
+		}
+	}
+	delete(c.usersByID, u.ID)
+	c.users = nil
+}
+
+func (c *responseCacheClient) invalidateGroup(g *Group) {
+	if g == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.groupsByName, NormalizeName(g.DisplayName))
+	delete(c.memberIDs, g.ID)
+	c.groups = nil
+}
+
+func (c *responseCacheClient) invalidateMembers(g *Group) {
+	if g == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.memberIDs, g.ID)
+}
@@ -14,12 +14,16 @@
 
 package aws
 
+import "encoding/json"
+
 // Group represents a Group in AWS SSO
 type Group struct {
 	ID          string   `json:"id,omitempty"`
 	Schemas     []string `json:"schemas"`
 	DisplayName string   `json:"displayName"`
 	Members     []string `json:"members"`
+	// ExternalID is the id of the Google group of the groups created by ssosync
+	ExternalID string `json:"externalId,omitempty"`
 }
 
 // GroupFilterResults represents filtered results when we search for
@@ -32,6 +36,14 @@ type GroupFilterResults struct {
 	Resources    []Group  `json:"Resources"`
 }
 
+// GroupMembers is a group with its members, as returned by SCIM endpoints
+// supporting the members attribute. Members is nil when the endpoint doesn't
+// return the attribute.
+type GroupMembers struct {
+	ID      string                     `json:"id"`
+	Members *[]GroupMemberChangeMember `json:"members"`
+}
+
 // GroupMemberChangeMember is a value needed for the ID of the member
 // to add/remove
 type GroupMemberChangeMember struct {
@@ -52,6 +64,65 @@ type GroupMemberChange struct {
 	Operations []GroupMemberChangeOperation `json:"Operations"`
 }
 
+// GroupAttributeOperation replaces an attribute of a group
+type GroupAttributeOperation struct {
+	Operation string `json:"op"`
+	Path      string `json:"path"`
+	Value     string `json:"value"`
+}
+
+// GroupAttributeChange represents a change of the attributes
+// of a group
+type GroupAttributeChange struct {
+	Schemas    []string                  `json:"schemas"`
+	Operations []GroupAttributeOperation `json:"Operations"`
+}
+
+// UserPatchOperation replaces or removes an attribute of a user, the
+// attributes of the enterprise extension are prefixed with its schema
+type UserPatchOperation struct {
+	Operation string          `json:"op"`
+	Path      string          `json:"path"`
+	Value     json.RawMessage `json:"value,omitempty"`
+}
+
+// UserPatch represents a change of the attributes of a user
+type UserPatch struct {
+	Schemas    []string             `json:"schemas"`
+	Operations []UserPatchOperation `json:"Operations"`
+}
+
+// BulkOperation is an operation of a bulk request, bulkId identifies its
+// response
+type BulkOperation struct {
+	Method string `json:"method"`
+	Path   string `json:"path"`
+	BulkID string `json:"bulkId"`
+	Data   *User  `json:"data,omitempty"`
+}
+
+// BulkRequest represents a request to the /Bulk endpoint
+type BulkRequest struct {
+	Schemas    []string        `json:"schemas"`
+	Operations []BulkOperation `json:"Operations"`
+}
+
+// BulkOperationResponse is the response of an operation of a bulk request,
+// its status is a string or a number depending on the endpoint
+type BulkOperationResponse struct {
+	Method   string          `json:"method"`
+	BulkID   string          `json:"bulkId"`
+	Location string          `json:"location"`
+	Status   json.RawMessage `json:"status"`
+	Response json.RawMessage `json:"response,omitempty"`
+}
+
+// BulkResponse represents the response of the /Bulk endpoint
+type BulkResponse struct {
+	Schemas    []string                `json:"schemas"`
+	Operations []BulkOperationResponse `json:"Operations"`
+}
+
 // UserEmail represents a user email address
 type UserEmail struct {
 	Value   string `json:"value"`
@@ -61,7 +132,41 @@ type UserEmail struct {
 
 // UserAddress represents address values of users
 type UserAddress struct {
-	Type string `json:"type"`
+	Type          string `json:"type"`
+	Formatted     string `json:"formatted,omitempty"`
+	StreetAddress string `json:"streetAddress,omitempty"`
+	Locality      string `json:"locality,omitempty"`
+	Region        string `json:"region,omitempty"`
+	PostalCode    string `json:"postalCode,omitempty"`
+	Country       string `json:"country,omitempty"`
+	Primary       bool   `json:"primary,omitempty"`
+}
+
+// UserPhoneNumber represents a phone number of users
+type UserPhoneNumber struct {
+	Value   string `json:"value"`
+	Type    string `json:"type"`
+	Primary bool   `json:"primary,omitempty"`
+}
+
+// EnterpriseUserSchema is the schema of the enterprise extension of users
+const EnterpriseUserSchema = "urn:ietf:params:scim:schemas:extension:enterprise:2.0:User"
+
+// EnterpriseUser represents the attributes of the enterprise extension of
+// users
+type EnterpriseUser struct {
+	EmployeeNumber string             `json:"employeeNumber,omitempty"`
+	CostCenter     string             `json:"costCenter,omitempty"`
+	Organization   string             `json:"organization,omitempty"`
+	Division       string             `json:"division,omitempty"`
+	Department     string             `json:"department,omitempty"`
+	Manager        *EnterpriseManager `json:"manager,omitempty"`
+}
+
+// EnterpriseManager represents the manager of a user, Value is the id of the
+// user who is the manager
+type EnterpriseManager struct {
+	Value string `json:"value"`
 }
 
 // User represents a User in AWS SSO
@@ -69,14 +174,26 @@ type User struct {
 	ID       string   `json:"id,omitempty"`
 	Schemas  []string `json:"schemas"`
 	Username string   `json:"userName"`
-	Name     struct {
+	// SCIMUserName is the userName of the user in AWS SSO when it isn't its
+	// primary email, Username is then its primary email, see
+	// NewUserNameClient
+	SCIMUserName string `json:"-"`
+	// ExternalID is the id of the Google user of the users created by ssosync
+	ExternalID string `json:"externalId,omitempty"`
+	Name       struct {
 		FamilyName string `json:"familyName"`
 		GivenName  string `json:"givenName"`
 	} `json:"name"`
-	DisplayName string        `json:"displayName"`
-	Active      bool          `json:"active"`
-	Emails      []UserEmail   `json:"emails"`
-	Addresses   []UserAddress `json:"addresses"`
+	DisplayName       string            `json:"displayName"`
+	Title             string            `json:"title,omitempty"`
+	PreferredLanguage string            `json:"preferredLanguage,omitempty"`
+	Locale            string            `json:"locale,omitempty"`
+	Timezone          string            `json:"timezone,omitempty"`
+	Active            bool              `json:"active"`
+	Emails            []UserEmail       `json:"emails"`
+	Addresses         []UserAddress     `json:"addresses"`
+	PhoneNumbers      []UserPhoneNumber `json:"phoneNumbers,omitempty"`
+	Enterprise        *EnterpriseUser   `json:"urn:ietf:params:scim:schemas:extension:enterprise:2.0:User,omitempty"`
 }
 
 // UserFilterResults represents filtered results when we search for
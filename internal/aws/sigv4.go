@@ -0,0 +1,74 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aws
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	v4 "github.com/aws/aws-sdk-go/aws/signer/v4"
+)
+
+// SigV4BearerHeader is the header carrying the SCIM bearer token when
+// requests are signed, as the Authorization header holds the signature
+const SigV4BearerHeader = "X-SCIM-Authorization"
+
+type sigV4Client struct {
+	httpClient HttpClient
+	signer     *v4.Signer
+	service    string
+	region     string
+}
+
+// NewSigV4Client wraps the given HttpClient so every request is signed with
+// AWS Signature Version 4 for the given service and region before it is sent.
+// A bearer token already set on the request is moved to the
+// SigV4BearerHeader header.
+func NewSigV4Client(c HttpClient, creds *credentials.Credentials, service string, region string) HttpClient {
+	return &sigV4Client{
+		httpClient: c,
+		signer:     v4.NewSigner(creds),
+		service:    service,
+		region:     region,
+	}
+}
+
+// Do signs the request and sends it with the wrapped HttpClient
+func (c *sigV4Client) Do(req *http.Request) (*http.Response, error) {
+	var body io.ReadSeeker
+	if req.Body != nil {
+		b, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+		body = bytes.NewReader(b)
+	}
+
+	if token := req.Header.Get("Authorization"); token != "" {
+		req.Header.Del("Authorization")
+		req.Header.Set(SigV4BearerHeader, token)
+	}
+
+	if _, err := c.signer.Sign(req, body, c.service, c.region, time.Now()); err != nil {
+		return nil, err
+	}
+
+	return c.httpClient.Do(req)
+}
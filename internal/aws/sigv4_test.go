@@ -0,0 +1,60 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aws
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/awslabs/ssosync/internal/aws/mock"
+)
+
+func TestSigV4ClientSignsRequest(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	x := mock.NewMockIHttpClient(ctrl)
+
+	s := NewSigV4Client(x, credentials.NewStaticCredentials("AKID", "SECRET", ""), "execute-api", "eu-west-1")
+
+	x.EXPECT().Do(gomock.Any()).MaxTimes(1).DoAndReturn(func(req *http.Request) (*http.Response, error) {
+		assert.True(t, strings.HasPrefix(req.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/"))
+		assert.Contains(t, req.Header.Get("Authorization"), "/eu-west-1/execute-api/aws4_request")
+		assert.Equal(t, "Bearer bearerToken", req.Header.Get(SigV4BearerHeader))
+		assert.NotEmpty(t, req.Header.Get("X-Amz-Date"))
+
+		body, _ := ioutil.ReadAll(req.Body)
+		assert.Equal(t, "{}", string(body))
+
+		return &http.Response{
+			Status:     "OK",
+			StatusCode: 200,
+			Body:       nopCloser{bytes.NewBufferString("")},
+		}, nil
+	})
+
+	req, _ := http.NewRequest(http.MethodPost, "https://scim.example.com/Users", bytes.NewBufferString("{}"))
+	req.Header.Set("Authorization", "Bearer bearerToken")
+
+	_, err := s.Do(req)
+	assert.NoError(t, err)
+}
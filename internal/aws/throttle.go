@@ -0,0 +1,149 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aws
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// throttledTransport limits the rate of the requests to the SCIM endpoint
+// with a token bucket, so concurrent changes aren't throttled by AWS. When
+// the endpoint answers 429 Too Many Requests or 503 Service Unavailable with
+// a Retry-After header, every request is held until it has passed, not only
+// the throttled one, instead of each retry of retryablehttp hitting the
+// endpoint on its own schedule. The throttled response is returned to be
+// retried.
+type throttledTransport struct {
+	base  http.RoundTripper
+	rate  float64
+	burst float64
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+	paused time.Time
+}
+
+// NewThrottledTransport returns a transport sending at most
+// requestsPerSecond requests per second with base, in bursts of up to a
+// second of requests, 0 is unlimited
+func NewThrottledTransport(base http.RoundTripper, requestsPerSecond float64) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	burst := requestsPerSecond
+	if burst < 1 {
+		burst = 1
+	}
+	return &throttledTransport{
+		base:   base,
+		rate:   requestsPerSecond,
+		burst:  burst,
+		tokens: burst,
+		last:   time.Now(),
+	}
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *throttledTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.wait(req); err != nil {
+		return nil, err
+	}
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable {
+		if d, ok := retryAfter(resp); ok {
+			log.WithFields(log.Fields{
+				"status":     resp.StatusCode,
+				"retryAfter": d,
+			}).Warn("AWS SSO SCIM throttled the requests, pausing them")
+			t.pause(d)
+		}
+	}
+	return resp, nil
+}
+
+// wait blocks until the request can be sent, once a token is available and
+// the requests aren't paused
+func (t *throttledTransport) wait(req *http.Request) error {
+	for {
+		d := t.reserve()
+		if d <= 0 {
+			return nil
+		}
+		timer := time.NewTimer(d)
+		select {
+		case <-timer.C:
+		case <-req.Context().Done():
+			timer.Stop()
+			return req.Context().Err()
+		}
+	}
+}
+
+// reserve takes a token and returns 0, or returns how long to wait before
+// trying again
+func (t *throttledTransport) reserve() time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := time.Now()
+	if now.Before(t.paused) {
+		return t.paused.Sub(now)
+	}
+	if t.rate <= 0 {
+		return 0
+	}
+	t.tokens += now.Sub(t.last).Seconds() * t.rate
+	if t.tokens > t.burst {
+		t.tokens = t.burst
+	}
+	t.last = now
+	if t.tokens >= 1 {
+		t.tokens--
+		return 0
+	}
+	return time.Duration((1 - t.tokens) / t.rate * float64(time.Second))
+}
+
+// pause holds all the requests for d
+func (t *throttledTransport) pause(d time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if at := time.Now().Add(d); at.After(t.paused) {
+		t.paused = at
+	}
+}
+
+// retryAfter returns the delay of the Retry-After header of resp, in
+// seconds or as a HTTP date
+func retryAfter(resp *http.Response) (time.Duration, bool) {
+	v := resp.Header.Get("Retry-After")
+	if s, err := strconv.Atoi(v); err == nil && s > 0 {
+		return time.Duration(s) * time.Second, true
+	}
+	if at, err := http.ParseTime(v); err == nil {
+		if d := time.Until(at); d > 0 {
+			return d, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,67 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aws
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestThrottledTransportRate(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	c := &http.Client{Transport: NewThrottledTransport(nil, 50)}
+	start := time.Now()
+	for i := 0; i < 60; i++ {
+		resp, err := c.Get(ts.URL)
+		assert.NoError(t, err)
+		resp.Body.Close()
+	}
+	// a burst of 50 requests is sent right away, the next ones every 20ms
+	assert.True(t, time.Since(start) >= 180*time.Millisecond)
+}
+
+func TestThrottledTransportRetryAfter(t *testing.T) {
+	calls := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+		}
+	}))
+	defer ts.Close()
+
+	c := &http.Client{Transport: NewThrottledTransport(nil, 0)}
+	resp, err := c.Get(ts.URL)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	// the throttled response is returned to be retried
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+
+	// and every request waits for the Retry-After
+	start := time.Now()
+	resp, err = c.Get(ts.URL)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.True(t, time.Since(start) >= 900*time.Millisecond)
+	assert.Equal(t, 2, calls)
+}
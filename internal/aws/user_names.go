@@ -0,0 +1,253 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aws
+
+import (
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// userNameClient names the users of AWS SSO after something else than their
+// primary email, e.g. the part before the @, while the clients wrapping it
+// keep finding them by email: the users read have their primary email as
+// Username and their AWS SSO userName as SCIMUserName, the users written are
+// sent with their SCIMUserName as userName. The user names are indexed by
+// email as users are read, a user looked up by an email not indexed yet
+// lists all the users once.
+type userNameClient struct {
+	Client
+
+	mu     sync.Mutex
+	names  map[string]string
+	listed bool
+	// listing serializes the listing of the users on a lookup
+	listing sync.Mutex
+}
+
+// NewUserNameClient returns a Client sending the SCIMUserName of the users
+// as their userName, and reading the users with their primary email as
+// Username
+func NewUserNameClient(c Client) Client {
+	return &userNameClient{
+		Client: c,
+		names:  make(map[string]string),
+	}
+}
+
+// primaryEmail returns the primary email of u, else its first one
+func primaryEmail(u *User) string {
+	for _, e := range u.Emails {
+		if e.Primary {
+			return e.Value
+		}
+	}
+	if len(u.Emails) > 0 {
+		return u.Emails[0].Value
+	}
+	return ""
+}
+
+// read returns a copy of the user u read from AWS SSO, with its primary
+// email as Username, and indexes its user name
+func (c *userNameClient) read(u *User) *User {
+	if u == nil {
+		return nil
+	}
+	cp := *u
+	cp.SCIMUserName = u.Username
+	if email := primaryEmail(u); email != "" {
+		cp.Username = email
+	}
+	c.mu.Lock()
+	c.names[NormalizeName(cp.Username)] = cp.SCIMUserName
+	c.mu.Unlock()
+	return &cp
+}
+
+// write returns a copy of the user u to send to AWS SSO, with its user name
+// as Username: its SCIMUserName, else the one indexed for its email, else
+// its email
+func (c *userNameClient) write(u *User) *User {
+	if u == nil {
+		return nil
+	}
+	cp := *u
+	if u.SCIMUserName != "" {
+		cp.Username = u.SCIMUserName
+	} else if name, ok := c.indexed(u.Username); ok {
+		cp.Username = name
+	}
+	return &cp
+}
+
+// indexed returns the user name indexed for email
+func (c *userNameClient) indexed(email string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	name, ok := c.names[NormalizeName(email)]
+	return name, ok
+}
+
+// userName returns the user name of the user with email, the users are
+// listed to index their names the first time one isn't indexed. The email
+// is returned when no user has it.
+func (c *userNameClient) userName(email string) (string, error) {
+	if name, ok := c.indexed(email); ok {
+		return name, nil
+	}
+	c.listing.Lock()
+	defer c.listing.Unlock()
+	c.mu.Lock()
+	listed := c.listed
+	c.mu.Unlock()
+	if !listed {
+		// once per run, but a full listing of a big directory is slow
+		log.WithField("email", email).Info("User name not known yet, listing all the AWS SSO users to index their user names")
+		if err := c.ForEachUser(func(*User) error { return nil }); err != nil {
+			return "", err
+		}
+	}
+	if name, ok := c.indexed(email); ok {
+		return name, nil
+	}
+	return email, nil
+}
+
+func (c *userNameClient) readAll(users []*User, err error) ([]*User, error) {
+	if err != nil {
+		return nil, err
+	}
+	read := make([]*User, 0, len(users))
+	for _, u := range users {
+		read = append(read, c.read(u))
+	}
+	return read, nil
+}
+
+// FindUserByEmail will find the user by the email address specified
+func (c *userNameClient) FindUserByEmail(email string) (*User, error) {
+	name, err := c.userName(email)
+	if err != nil {
+		return nil, err
+	}
+	u, err := c.Client.FindUserByEmail(name)
+	if err != nil {
+		return nil, err
+	}
+	return c.read(u), nil
+}
+
+// FindUserByID will find the user by its id
+func (c *userNameClient) FindUserByID(id string) (*User, error) {
+	u, err := c.Client.FindUserByID(id)
+	if err != nil {
+		return nil, err
+	}
+	return c.read(u), nil
+}
+
+// GetUsers will return all the users, whose user names are then all indexed
+func (c *userNameClient) GetUsers() ([]*User, error) {
+	users, err := c.readAll(c.Client.GetUsers())
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	c.listed = true
+	c.mu.Unlock()
+	return users, nil
+}
+
+// ForEachUser calls fn with each user, once all of them are read their user
+// names are all indexed
+func (c *userNameClient) ForEachUser(fn func(*User) error) error {
+	err := c.Client.ForEachUser(func(u *User) error {
+		return fn(c.read(u))
+	})
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	c.listed = true
+	c.mu.Unlock()
+	return nil
+}
+
+// GetGroupMembers will return the members of the group
+func (c *userNameClient) GetGroupMembers(g *Group) ([]*User, error) {
+	return c.readAll(c.Client.GetGroupMembers(g))
+}
+
+// CreateUser will create the user with its user name
+func (c *userNameClient) CreateUser(u *User) (*User, error) {
+	created, err := c.Client.CreateUser(c.write(u))
+	if err != nil {
+		return nil, err
+	}
+	return c.read(created), nil
+}
+
+// CreateUsers will create the users with their user names
+func (c *userNameClient) CreateUsers(users []*User) ([]BulkResult, error) {
+	written := make([]*User, 0, len(users))
+	for _, u := range users {
+		written = append(written, c.write(u))
+	}
+	results, err := c.Client.CreateUsers(written)
+	if err != nil {
+		return nil, err
+	}
+	for i := range results {
+		if results[i].User != nil {
+			results[i].User = c.read(results[i].User)
+		}
+	}
+	return results, nil
+}
+
+// UpdateUser will update the user, renaming it to its user name
+func (c *userNameClient) UpdateUser(u *User) (*User, error) {
+	updated, err := c.Client.UpdateUser(c.write(u))
+	if err != nil {
+		return nil, err
+	}
+	return c.read(updated), nil
+}
+
+// DeleteUser will delete the user
+func (c *userNameClient) DeleteUser(u *User) error {
+	return c.Client.DeleteUser(c.write(u))
+}
+
+// AddUserToGroup will add the user to the group
+func (c *userNameClient) AddUserToGroup(u *User, g *Group) error {
+	return c.Client.AddUserToGroup(c.write(u), g)
+}
+
+// RemoveUserFromGroup will remove the user from the group
+func (c *userNameClient) RemoveUserFromGroup(u *User, g *Group) error {
+	return c.Client.RemoveUserFromGroup(c.write(u), g)
+}
+
+// IsUserInGroup will tell whether the user is in the group
+func (c *userNameClient) IsUserInGroup(u *User, g *Group) (bool, error) {
+	return c.Client.IsUserInGroup(c.write(u), g)
+}
+
+// GetMemberGroupIDs will return the ids of the groups of the user
+func (c *userNameClient) GetMemberGroupIDs(u *User) ([]string, error) {
+	return c.Client.GetMemberGroupIDs(c.write(u))
+}
@@ -18,6 +18,31 @@ import (
 	"strings"
 )
 
+// The maximum lengths, in characters, of the attributes of the users of
+// AWS SSO
+const (
+	MaxUserNameLength    = 128
+	MaxNameLength        = 1024
+	MaxDisplayNameLength = 1024
+)
+
+// Truncate returns s cut to its first n characters
+func Truncate(s string, n int) string {
+	for i := range s {
+		if n == 0 {
+			return s[:i]
+		}
+		n--
+	}
+	return s
+}
+
+// NormalizeName returns the key of an email or a display name in lookups,
+// Google Workspace and AWS SSO don't always keep the same casing
+func NormalizeName(s string) string {
+	return strings.ToLower(strings.TrimSpace(s))
+}
+
 // NewUser creates a user object representing a user with the given
 // details.
 func NewUser(firstName string, lastName string, email string, active bool) *User {
@@ -43,13 +68,28 @@ func NewUser(firstName string, lastName string, email string, active bool) *User
 			FamilyName: lastName,
 			GivenName:  firstName,
 		},
-		DisplayName: strings.Join([]string{firstName, lastName}, " "),
+		DisplayName: Truncate(strings.Join([]string{firstName, lastName}, " "), MaxDisplayNameLength),
 		Active:      active,
 		Emails:      e,
 		Addresses:   a,
 	}
 }
 
+// SetEnterprise sets the enterprise extension of the user, with its schema,
+// nil removes it
+func (u *User) SetEnterprise(e *EnterpriseUser) {
+	schemas := make([]string, 0, len(u.Schemas)+1)
+	for _, s := range u.Schemas {
+		if s != EnterpriseUserSchema {
+			schemas = append(schemas, s)
+		}
+	}
+	if e != nil {
+		schemas = append(schemas, EnterpriseUserSchema)
+	}
+	u.Schemas, u.Enterprise = schemas, e
+}
+
 // UpdateUser updates a user object representing a user with the given
 // details.
 func UpdateUser(id string, firstName string, lastName string, email string, active bool) *User {
@@ -76,7 +116,7 @@ func UpdateUser(id string, firstName string, lastName string, email string, acti
 			FamilyName: lastName,
 			GivenName:  firstName,
 		},
-		DisplayName: strings.Join([]string{firstName, lastName}, " "),
+		DisplayName: Truncate(strings.Join([]string{firstName, lastName}, " "), MaxDisplayNameLength),
 		Active:      active,
 		Emails:      e,
 		Addresses:   a,
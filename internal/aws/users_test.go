@@ -15,6 +15,7 @@
 package aws
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -51,3 +52,11 @@ func TestUpdateUser(t *testing.T) {
 	assert.Len(t, u.Schemas, 1)
 	assert.Equal(t, u.Schemas[0], "urn:ietf:params:scim:schemas:core:2.0:User")
 }
+
+func TestTruncate(t *testing.T) {
+	assert.Equal(t, "Lee", Truncate("Lee", 10))
+	assert.Equal(t, "Le", Truncate("Lee", 2))
+	// characters, not bytes
+	assert.Equal(t, "Zoë", Truncate("Zoë Smith", 3))
+	assert.Len(t, NewUser(strings.Repeat("a", MaxNameLength), "Packham", "test@email.com", true).DisplayName, MaxDisplayNameLength)
+}
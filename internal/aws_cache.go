@@ -0,0 +1,455 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/awslabs/ssosync/internal/aws"
+	"github.com/awslabs/ssosync/internal/config"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const awsCacheFormatVersion = "1"
+
+// awsCache is the AWS SSO state seen by the previous run, kept in
+// --aws-cache-file so the next run diffs against it instead of listing all
+// the users, groups and members from the SCIM API
+type awsCache struct {
+	FormatVersion string       `json:"formatVersion"`
+	SavedAt       time.Time    `json:"savedAt"`
+	Users         []*aws.User  `json:"users"`
+	Groups        []*aws.Group `json:"groups"`
+	// Members are the ids of the members of the groups, by group id
+	Members map[string][]string `json:"members"`
+	// UserNames are the user names of the users with --user-name, by user
+	// id, see userNamesOf
+	UserNames map[string]string `json:"userNames,omitempty"`
+}
+
+// cachedAWSClient serves the users, groups and members of the cache once
+// loaded, and keeps the cache up to date with what is read and written with
+// it
+type cachedAWSClient struct {
+	aws.Client
+
+	mu    sync.Mutex
+	cache *awsCache
+	// loaded is true when the lists are served from the cache
+	loaded bool
+	// stale is true when the cache missed changes, or a write failed and
+	// may have been applied anyway
+	stale bool
+}
+
+// newCachedAWSClient returns a client serving the lists from the cache in
+// path, unless it's missing, unreadable or older than ttl
+func newCachedAWSClient(c aws.Client, path string, ttl time.Duration, now time.Time) *cachedAWSClient {
+	cached := &cachedAWSClient{
+		Client: c,
+		cache:  &awsCache{FormatVersion: awsCacheFormatVersion, Members: make(map[string][]string)},
+	}
+	cache, err := readAWSCache(path)
+	log := log.WithField("path", path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		log.Info("No AWS cache yet, reading AWS SSO")
+	case err != nil:
+		log.WithError(err).Warn("Ignoring the AWS cache, reading AWS SSO")
+	case now.Sub(cache.SavedAt) > ttl:
+		log.WithField("savedAt", cache.SavedAt.Format(time.RFC3339)).Info("AWS cache expired, reading AWS SSO")
+	default:
+		log.WithField("savedAt", cache.SavedAt.Format(time.RFC3339)).Info("Diffing against the AWS cache")
+		cached.cache, cached.loaded = cache, true
+	}
+	return cached
+}
+
+// readAWSCache reads the cache written to path by save
+func readAWSCache(path string) (*awsCache, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var c awsCache
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, fmt.Errorf("invalid AWS cache: %w", err)
+	}
+	if c.FormatVersion != awsCacheFormatVersion {
+		return nil, fmt.Errorf("unsupported AWS cache format version %q, expected %q", c.FormatVersion, awsCacheFormatVersion)
+	}
+	if c.Members == nil {
+		c.Members = make(map[string][]string)
+	}
+	withUserNames(c.Users, c.UserNames)
+	return &c, nil
+}
+
+// save writes the cache to the cache file after a run, or removes the file
+// when the run failed or the cache is stale, so the next run reads AWS SSO.
+// A dry run leaves the file as it is, as its writes weren't applied. The
+// cache being optional, the errors are only logged.
+func (c *cachedAWSClient) save(cfg *config.Config, runErr error, now time.Time) {
+	if cfg.DryRun {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ll := log.WithField("path", cfg.AWSCacheFile)
+	if runErr != nil || c.stale {
+		ll.Info("Dropping the AWS cache, the next run reads AWS SSO")
+		if err := os.Remove(cfg.AWSCacheFile); err != nil && !errors.Is(err, os.ErrNotExist) {
+			ll.WithError(err).Warn("Error removing the AWS cache")
+		}
+		return
+	}
+	c.cache.SavedAt = now
+	c.cache.UserNames = userNamesOf(c.cache.Users)
+	b, err := json.Marshal(c.cache)
+	if err == nil {
+		err = replaceFile(cfg.AWSCacheFile, b)
+	}
+	if err != nil {
+		ll.WithError(err).Warn("Error saving the AWS cache")
+		return
+	}
+	ll.WithFields(log.Fields{
+		"users":  len(c.cache.Users),
+		"groups": len(c.cache.Groups),
+	}).Info("AWS cache saved")
+}
+
+// CacheStats implements aws.CacheStatsReporter, the statistics of the
+// response cache of the client wrapped, none when it has none
+func (c *cachedAWSClient) CacheStats() aws.CacheStats {
+	if r, ok := c.Client.(aws.CacheStatsReporter); ok {
+		return r.CacheStats()
+	}
+	return aws.CacheStats{}
+}
+
+// markStale drops the cache at the end of the run
+func (c *cachedAWSClient) markStale() {
+	c.mu.Lock()
+	c.stale = true
+	c.mu.Unlock()
+}
+
+// written records the outcome of a write, a failed one may have been applied
+func (c *cachedAWSClient) written(err error, update func()) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err != nil {
+		c.stale = true
+		return err
+	}
+	update()
+	return nil
+}
+
+func (c *cachedAWSClient) GetUsers() ([]*aws.User, error) {
+	c.mu.Lock()
+	if c.loaded {
+		users := append([]*aws.User(nil), c.cache.Users...)
+		c.mu.Unlock()
+		return users, nil
+	}
+	c.mu.Unlock()
+	users, err := c.Client.GetUsers()
+	if err == nil {
+		c.mu.Lock()
+		c.cache.Users = append([]*aws.User(nil), users...)
+		c.mu.Unlock()
+	}
+	return users, err
+}
+
+func (c *cachedAWSClient) GetGroups() ([]*aws.Group, error) {
+	c.mu.Lock()
+	if c.loaded {
+		groups := append([]*aws.Group(nil), c.cache.Groups...)
+		c.mu.Unlock()
+		return groups, nil
+	}
+	c.mu.Unlock()
+	groups, err := c.Client.GetGroups()
+	if err == nil {
+		c.mu.Lock()
+		c.cache.Groups = append([]*aws.Group(nil), groups...)
+		c.mu.Unlock()
+	}
+	return groups, err
+}
+
+func (c *cachedAWSClient) GetGroupMemberIDs(g *aws.Group) ([]string, error) {
+	c.mu.Lock()
+	ids, ok := c.cache.Members[g.ID]
+	if c.loaded && ok {
+		ids = append([]string(nil), ids...)
+		c.mu.Unlock()
+		return ids, nil
+	}
+	c.mu.Unlock()
+	ids, err := c.Client.GetGroupMemberIDs(g)
+	if err == nil {
+		c.mu.Lock()
+		c.cache.Members[g.ID] = append([]string(nil), ids...)
+		c.mu.Unlock()
+	}
+	return ids, err
+}
+
+func (c *cachedAWSClient) CreateUser(u *aws.User) (*aws.User, error) {
+	created, err := c.Client.CreateUser(u)
+	return created, c.written(err, func() {
+		c.cache.Users = append(c.cache.Users, created)
+	})
+}
+
+func (c *cachedAWSClient) CreateUsers(users []*aws.User) ([]aws.BulkResult, error) {
+	results, err := c.Client.CreateUsers(users)
+	if errors.Is(err, aws.ErrBulkNotSupported) {
+		return nil, err
+	}
+	return results, c.written(err, func() {
+		for _, r := range results {
+			if r.Err != nil {
+				// the operation may have been applied anyway
+				c.stale = true
+				continue
+			}
+			c.cache.Users = append(c.cache.Users, r.User)
+		}
+	})
+}
+
+func (c *cachedAWSClient) UpdateUser(u *aws.User) (*aws.User, error) {
+	updated, err := c.Client.UpdateUser(u)
+	return updated, c.written(err, func() {
+		for i, cached := range c.cache.Users {
+			if cached.ID == updated.ID {
+				c.cache.Users[i] = updated
+			}
+		}
+	})
+}
+
+func (c *cachedAWSClient) DeleteUser(u *aws.User) error {
+	return c.written(c.Client.DeleteUser(u), func() {
+		users := c.cache.Users[:0]
+		for _, cached := range c.cache.Users {
+			if cached.ID != u.ID {
+				users = append(users, cached)
+			}
+		}
+		c.cache.Users = users
+		for id, members := range c.cache.Members {
+			c.cache.Members[id] = without(members, u.ID)
+		}
+	})
+}
+
+func (c *cachedAWSClient) CreateGroup(g *aws.Group) (*aws.Group, error) {
+	created, err := c.Client.CreateGroup(g)
+	return created, c.written(err, func() {
+		c.cache.Groups = append(c.cache.Groups, created)
+		c.cache.Members[created.ID] = []string{}
+	})
+}
+
+func (c *cachedAWSClient) DeleteGroup(g *aws.Group) error {
+	return c.written(c.Client.DeleteGroup(g), func() {
+		groups := c.cache.Groups[:0]
+		for _, cached := range c.cache.Groups {
+			if cached.ID != g.ID {
+				groups = append(groups, cached)
+			}
+		}
+		c.cache.Groups = groups
+		delete(c.cache.Members, g.ID)
+	})
+}
+
+func (c *cachedAWSClient) RenameGroup(g *aws.Group, name string) error {
+	return c.written(c.Client.RenameGroup(g, name), func() {
+		for i, cached := range c.cache.Groups {
+			if cached.ID == g.ID {
+				renamed := *cached
+				renamed.DisplayName = name
+				c.cache.Groups[i] = &renamed
+			}
+		}
+	})
+}
+
+func (c *cachedAWSClient) AddUserToGroup(u *aws.User, g *aws.Group) error {
+	return c.written(c.Client.AddUserToGroup(u, g), func() {
+		if members, ok := c.cache.Members[g.ID]; ok {
+			c.cache.Members[g.ID] = append(without(members, u.ID), u.ID)
+		}
+	})
+}
+
+func (c *cachedAWSClient) RemoveUserFromGroup(u *aws.User, g *aws.Group) error {
+	return c.written(c.Client.RemoveUserFromGroup(u, g), func() {
+		if members, ok := c.cache.Members[g.ID]; ok {
+			c.cache.Members[g.ID] = without(members, u.ID)
+		}
+	})
+}
+
+// without returns ids without id
+func without(ids []string, id string) []string {
+	kept := make([]string, 0, len(ids))
+	for _, i := range ids {
+		if i != id {
+			kept = append(kept, i)
+		}
+	}
+	return kept
+}
+
+// verifyCachedChanges checks the changes computed from the AWS cache against
+// the SCIM API, as AWS SSO may have been changed since the cache was saved,
+// e.g. by hand. The changes already made are left out, and the cache is
+// dropped at the end of the run when it missed some. The group memberships
+// aren't checked, adding or removing them again is harmless.
+func (s *syncGSuite) verifyCachedChanges(changes *changeSet) error {
+	if s.awsCache == nil || !s.awsCache.loaded {
+		return nil
+	}
+	log.WithFields(log.Fields{
+		"users":  len(changes.addUsers) + len(changes.updateUsers) + len(changes.deleteUsers),
+		"groups": len(changes.addGroups) + len(changes.deleteGroups),
+	}).Info("Verifying the changes computed from the AWS cache")
+	missed := 0
+	addUsers := make([]*aws.User, 0, len(changes.addUsers))
+	updateUsers := make([]*aws.User, 0, len(changes.updateUsers))
+	for _, u := range changes.addUsers {
+		found, err := s.findCachedUser(u.Username)
+		switch {
+		case err != nil:
+			return err
+		case found == nil:
+			addUsers = append(addUsers, u)
+		case userHash(found, s.mapping) != userHash(u, s.mapping):
+			missed++
+			updateUsers = append(updateUsers, u)
+		default:
+			missed++
+		}
+	}
+	for _, u := range changes.updateUsers {
+		var found *aws.User
+		var err error
+		if u.ID != "" {
+			// the email of the user changed, see getUserOperations
+			found, err = s.findCachedUserByID(u.ID)
+		} else {
+			found, err = s.findCachedUser(u.Username)
+		}
+		switch {
+		case err != nil:
+			return err
+		case found == nil:
+			missed++
+			addUsers = append(addUsers, u)
+		case userHash(found, s.mapping) == userHash(u, s.mapping):
+			missed++
+		default:
+			updateUsers = append(updateUsers, u)
+		}
+	}
+	deleteUsers := make([]*aws.User, 0, len(changes.deleteUsers))
+	for _, u := range changes.deleteUsers {
+		found, err := s.findCachedUser(u.Username)
+		if err != nil {
+			return err
+		}
+		if found == nil {
+			missed++
+			continue
+		}
+		deleteUsers = append(deleteUsers, u)
+	}
+	addGroups := make([]*aws.Group, 0, len(changes.addGroups))
+	for _, g := range changes.addGroups {
+		found, err := s.findCachedGroup(g.DisplayName)
+		if err != nil {
+			return err
+		}
+		if found != nil {
+			missed++
+			changes.equalGroups = append(changes.equalGroups, found)
+			continue
+		}
+		addGroups = append(addGroups, g)
+	}
+	deleteGroups := make([]*aws.Group, 0, len(changes.deleteGroups))
+	for _, g := range changes.deleteGroups {
+		found, err := s.findCachedGroup(g.DisplayName)
+		if err != nil {
+			return err
+		}
+		if found == nil {
+			missed++
+			continue
+		}
+		deleteGroups = append(deleteGroups, g)
+	}
+	changes.addUsers, changes.updateUsers, changes.deleteUsers = addUsers, updateUsers, deleteUsers
+	changes.addGroups, changes.deleteGroups = addGroups, deleteGroups
+	if missed > 0 {
+		log.WithField("count", missed).Warn("AWS SSO changed since the AWS cache was saved, the next run reads AWS SSO")
+		s.awsCache.markStale()
+	}
+	return nil
+}
+
+// findCachedUser looks up the user with the SCIM API, nil when there is none
+func (s *syncGSuite) findCachedUser(name string) (*aws.User, error) {
+	u, err := s.awsCache.Client.FindUserByEmail(name)
+	if errors.Is(err, aws.ErrUserNotFound) {
+		return nil, nil
+	}
+	return u, err
+}
+
+// findCachedUserByID looks up the user with the SCIM API by its id, nil when
+// there is none
+func (s *syncGSuite) findCachedUserByID(id string) (*aws.User, error) {
+	u, err := s.awsCache.Client.FindUserByID(id)
+	if errors.Is(err, aws.ErrUserNotFound) {
+		return nil, nil
+	}
+	return u, err
+}
+
+// findCachedGroup looks up the group with the SCIM API, nil when there is
+// none
+func (s *syncGSuite) findCachedGroup(name string) (*aws.Group, error) {
+	g, err := s.awsCache.Client.FindGroupByDisplayName(name)
+	if errors.Is(err, aws.ErrGroupNotFound) {
+		return nil, nil
+	}
+	return g, err
+}
@@ -0,0 +1,125 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/awslabs/ssosync/internal/aws"
+	awsfake "github.com/awslabs/ssosync/internal/aws/fake"
+	"github.com/awslabs/ssosync/internal/config"
+	googlefake "github.com/awslabs/ssosync/internal/google/fake"
+	"github.com/awslabs/ssosync/internal/state"
+	"github.com/stretchr/testify/assert"
+)
+
+// listCountingAWSClient counts the lists of users and groups
+type listCountingAWSClient struct {
+	aws.Client
+	lists int
+}
+
+func (c *listCountingAWSClient) GetUsers() ([]*aws.User, error) {
+	c.lists++
+	return c.Client.GetUsers()
+}
+
+func (c *listCountingAWSClient) GetGroups() ([]*aws.Group, error) {
+	c.lists++
+	return c.Client.GetGroups()
+}
+
+func TestAWSCache(t *testing.T) {
+	googleClient := googlefake.NewClient().
+		WithUsers(googlefake.User("a@email.com"), googlefake.User("b@email.com"), googlefake.User("c@email.com")).
+		WithGroup(googlefake.Group("aws-dev@email.com"), "a@email.com", "b@email.com")
+	awsClient := &listCountingAWSClient{Client: awsfake.NewClient()}
+	cfg := config.New()
+	cfg.Yes = true
+	cfg.AWSCacheFile = filepath.Join(t.TempDir(), "aws.json")
+	run := func() {
+		cached := newCachedAWSClient(awsClient, cfg.AWSCacheFile, cfg.AWSCacheTTL, time.Now())
+		s := newSyncGSuite(cfg, cached, googleClient, nil)
+		s.awsCache = cached
+		err := s.SyncGroupsUsers(nil)
+		assert.NoError(t, err)
+		cached.save(cfg, err, time.Now())
+	}
+
+	run()
+	cache, err := readAWSCache(cfg.AWSCacheFile)
+	assert.NoError(t, err)
+	assert.Len(t, cache.Users, 2)
+	if assert.Len(t, cache.Groups, 1) {
+		assert.Len(t, cache.Members[cache.Groups[0].ID], 2)
+	}
+
+	// the next run diffs against the cache
+	awsClient.lists = 0
+	run()
+	assert.Equal(t, 0, awsClient.lists)
+
+	// the changes made outside of ssosync are verified, and drop the cache
+	_, err = awsClient.CreateUser(aws.NewUser("c", "c", "c@email.com", true))
+	assert.NoError(t, err)
+	googleClient.WithGroup(googlefake.Group("aws-ops@email.com"), "c@email.com")
+	run()
+	_, err = os.Stat(cfg.AWSCacheFile)
+	assert.True(t, os.IsNotExist(err))
+	ops, err := awsClient.FindGroupByDisplayName("aws-ops")
+	if assert.NoError(t, err) {
+		ids, _ := awsClient.GetGroupMemberIDs(ops)
+		assert.Len(t, ids, 1)
+	}
+
+	// so the next run reads AWS SSO again
+	awsClient.lists = 0
+	run()
+	assert.Equal(t, 2, awsClient.lists)
+	cache, err = readAWSCache(cfg.AWSCacheFile)
+	assert.NoError(t, err)
+	assert.Len(t, cache.Users, 3)
+	assert.Len(t, cache.Groups, 2)
+}
+
+func TestAWSCacheExpired(t *testing.T) {
+	awsClient := &listCountingAWSClient{Client: awsfake.NewClient()}
+	cfg := config.New()
+	cfg.AWSCacheFile = filepath.Join(t.TempDir(), "aws.json")
+	cached := newCachedAWSClient(awsClient, cfg.AWSCacheFile, cfg.AWSCacheTTL, time.Now())
+	cached.save(cfg, nil, time.Now().Add(-25*time.Hour))
+
+	cached = newCachedAWSClient(awsClient, cfg.AWSCacheFile, cfg.AWSCacheTTL, time.Now())
+	assert.False(t, cached.loaded)
+	_, err := cached.GetUsers()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, awsClient.lists)
+}
+
+func TestAWSCacheStats(t *testing.T) {
+	responses := aws.NewResponseCacheClient(awsfake.NewClient().WithUsers(aws.NewUser("a", "a", "a@email.com", true)))
+	cached := newCachedAWSClient(responses, filepath.Join(t.TempDir(), "aws.json"), time.Hour, time.Now())
+	s := newSyncGSuite(config.New(), cached, nil, nil)
+
+	// the statistics of the response cache are reported through the cache
+	for i := 0; i < 2; i++ {
+		_, err := cached.FindUserByEmail("a@email.com")
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, &state.CacheStats{Hits: 1, Misses: 1}, s.scimCacheStats())
+}
@@ -0,0 +1,87 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"time"
+
+	"github.com/awslabs/ssosync/internal/schedule"
+	"github.com/awslabs/ssosync/internal/state"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// openBlackoutWindow returns the first of the blackout windows open at now,
+// or nil
+func openBlackoutWindow(specs []string, now time.Time) (*schedule.Window, error) {
+	for _, spec := range specs {
+		w, err := schedule.ParseWindow(spec)
+		if err != nil {
+			return nil, err
+		}
+		if w.Contains(now) {
+			return w, nil
+		}
+	}
+	return nil, nil
+}
+
+// deferDestructiveChanges removes the deletions and membership removals from
+// changes while a blackout window is open, and keeps them in the state until
+// the window closes. As changes are computed by every run, the deferred
+// changes which are still needed are applied by the first run after the
+// window.
+func (s *syncGSuite) deferDestructiveChanges(changes *changeSet, now time.Time) error {
+	w, err := openBlackoutWindow(s.cfg.BlackoutWindows, now)
+	if err != nil {
+		log.WithError(err).Error("Invalid blackout window")
+		return err
+	}
+	if w == nil {
+		if len(s.state.Deferred) > 0 {
+			log.WithField("count", len(s.state.Deferred)).Info("Blackout window closed, applying the deferred changes still needed")
+			s.state.Deferred = make(map[string]*state.Deferred)
+		}
+		return nil
+	}
+	deferred := make(map[string]bool)
+	for _, c := range changes.records() {
+		if c.Op != state.OpDelete {
+			continue
+		}
+		key := c.Key()
+		deferred[key] = true
+		if _, ok := s.state.Deferred[key]; !ok {
+			s.state.Deferred[key] = &state.Deferred{Change: c, Since: now}
+		}
+	}
+	// changes no longer needed are no longer deferred
+	for key := range s.state.Deferred {
+		if !deferred[key] {
+			delete(s.state.Deferred, key)
+		}
+	}
+	for _, d := range s.state.Deferred {
+		log.WithFields(log.Fields{
+			"kind":   d.Change.Kind,
+			"name":   d.Change.Name,
+			"group":  d.Change.Group,
+			"since":  d.Since,
+			"window": w.String(),
+		}).Warn("Destructive change deferred by blackout window")
+	}
+	changes.without(deferred)
+	return nil
+}
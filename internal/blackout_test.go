@@ -0,0 +1,90 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"testing"
+	"time"
+
+	"github.com/awslabs/ssosync/internal/aws"
+	awsfake "github.com/awslabs/ssosync/internal/aws/fake"
+	"github.com/awslabs/ssosync/internal/config"
+	googlefake "github.com/awslabs/ssosync/internal/google/fake"
+	"github.com/stretchr/testify/assert"
+	admin "google.golang.org/api/admin/directory/v1"
+)
+
+func Test_deferDestructiveChanges(t *testing.T) {
+	cfg := config.New()
+	cfg.BlackoutWindows = []string{"Mon-Fri 09:00-18:00"}
+	s := newSyncGSuite(cfg, nil, nil, nil)
+	newChanges := func() *changeSet {
+		return &changeSet{
+			addUsers:    []*aws.User{aws.NewUser("n", "l", "user-1@email.com", true)},
+			deleteUsers: []*aws.User{aws.NewUser("n", "l", "user-2@email.com", true)},
+			addMembers: map[string][]*admin.User{
+				"group-1": {{PrimaryEmail: "user-1@email.com"}},
+			},
+			removeMembers: map[string][]*aws.User{
+				"group-1": {aws.NewUser("n", "l", "user-3@email.com", true)},
+			},
+		}
+	}
+
+	// Friday 10:00, in the window
+	changes := newChanges()
+	assert.NoError(t, s.deferDestructiveChanges(changes, time.Date(2026, 10, 16, 10, 0, 0, 0, time.UTC)))
+	assert.Len(t, changes.addUsers, 1)
+	assert.Empty(t, changes.deleteUsers)
+	assert.Len(t, changes.addMembers["group-1"], 1)
+	assert.Empty(t, changes.removeMembers["group-1"])
+	assert.Len(t, s.state.Deferred, 2)
+
+	// Friday 19:00, after the window
+	changes = newChanges()
+	assert.NoError(t, s.deferDestructiveChanges(changes, time.Date(2026, 10, 16, 19, 0, 0, 0, time.UTC)))
+	assert.Len(t, changes.deleteUsers, 1)
+	assert.Len(t, changes.removeMembers["group-1"], 1)
+	assert.Empty(t, s.state.Deferred)
+
+	cfg.BlackoutWindows = []string{"invalid"}
+	assert.Error(t, s.deferDestructiveChanges(newChanges(), time.Now()))
+}
+
+func TestSyncUserBlackoutWindow(t *testing.T) {
+	googleClient := googlefake.NewClient().
+		WithUsers(googlefake.User("a@email.com")).
+		WithGroup(googlefake.Group("aws-dev@email.com"))
+	awsClient := awsfake.NewClient().
+		WithUsers(aws.NewUser("a", "a", "a@email.com", true)).
+		WithGroup(aws.NewGroup("aws-dev"), "a@email.com")
+	cfg := config.New()
+	cfg.BlackoutWindows = []string{"2000-01-01..2100-01-01"}
+	s := newSyncGSuite(cfg, awsClient, googleClient, nil)
+
+	// a is no longer a member of aws-dev in google, the removal is deferred
+	assert.NoError(t, s.SyncUser("a@email.com", nil))
+	user, _ := awsClient.FindUserByEmail("a@email.com")
+	group, _ := awsClient.FindGroupByDisplayName("aws-dev")
+	member, _ := awsClient.IsUserInGroup(user, group)
+	assert.True(t, member)
+	assert.Contains(t, s.state.Deferred, "member:a@email.com:aws-dev")
+
+	// after the window, the user is removed
+	cfg.BlackoutWindows = []string{"2000-01-01..2000-01-02"}
+	assert.NoError(t, s.SyncUser("a@email.com", nil))
+	member, _ = awsClient.IsUserInGroup(user, group)
+	assert.False(t, member)
+}
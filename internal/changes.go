@@ -0,0 +1,122 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/awslabs/ssosync/internal/aws"
+	"github.com/awslabs/ssosync/internal/state"
+	admin "google.golang.org/api/admin/directory/v1"
+)
+
+// changeSet holds the changes needed to make AWS SSO equal to Google Workspace
+type changeSet struct {
+	addUsers     []*aws.User
+	deleteUsers  []*aws.User
+	updateUsers  []*aws.User
+	addGroups    []*aws.Group
+	deleteGroups []*aws.Group
+	equalGroups  []*aws.Group
+	// renameGroups are the aws groups whose google group was renamed, they
+	// are in equalGroups with their new names
+	renameGroups []groupRename
+	// userRenames are the old user names of the users in updateUsers whose
+	// email changed, by their new user names
+	userRenames map[string]string
+	// addMembers are the google users to add to each group, by group name
+	addMembers map[string][]*admin.User
+	// removeMembers are the aws users to remove from each group, by group name
+	removeMembers map[string][]*aws.User
+	// googleUsers are all the google users in the scope of the sync
+	googleUsers []*admin.User
+	// awsUsers and awsGroups are the numbers of aws users and groups in the
+	// scope of the sync, before the changes
+	awsUsers  int
+	awsGroups int
+}
+
+// records returns the changes as a list, sorted like the output of write
+func (c *changeSet) records() []state.Change {
+	changes := make([]state.Change, 0)
+	for _, u := range c.addUsers {
+		changes = append(changes, state.Change{Op: state.OpAdd, Kind: state.KindUser, Name: u.Username})
+	}
+	for _, u := range c.updateUsers {
+		changes = append(changes, state.Change{Op: state.OpUpdate, Kind: state.KindUser, Name: u.Username, From: c.userRenames[u.Username]})
+	}
+	for _, u := range c.deleteUsers {
+		changes = append(changes, state.Change{Op: state.OpDelete, Kind: state.KindUser, Name: u.Username})
+	}
+	for _, g := range c.addGroups {
+		changes = append(changes, state.Change{Op: state.OpAdd, Kind: state.KindGroup, Name: g.DisplayName})
+	}
+	for _, g := range c.deleteGroups {
+		changes = append(changes, state.Change{Op: state.OpDelete, Kind: state.KindGroup, Name: g.DisplayName})
+	}
+	for _, r := range c.renameGroups {
+		changes = append(changes, state.Change{Op: state.OpUpdate, Kind: state.KindGroup, Name: r.name, From: r.group.DisplayName})
+	}
+	for group, users := range c.addMembers {
+		for _, u := range users {
+			changes = append(changes, state.Change{Op: state.OpAdd, Kind: state.KindMember, Name: u.PrimaryEmail, Group: group})
+		}
+	}
+	for group, users := range c.removeMembers {
+		for _, u := range users {
+			changes = append(changes, state.Change{Op: state.OpDelete, Kind: state.KindMember, Name: u.Username, Group: group})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return formatChange(changes[i]) < formatChange(changes[j])
+	})
+	return changes
+}
+
+// formatChange formats a change as a line of diff, e.g. "+ member x in g"
+func formatChange(c state.Change) string {
+	op := map[string]string{state.OpAdd: "+", state.OpUpdate: "~", state.OpDelete: "-"}[c.Op]
+	line := fmt.Sprintf("%s %-6s %s", op, c.Kind, c.Name)
+	if c.Group != "" {
+		line += " in " + c.Group
+	}
+	if c.From != "" {
+		line += " (renamed from " + c.From + ")"
+	}
+	return line
+}
+
+// write writes the changes in a human readable diff format to w, sorted so
+// the output of two runs can be compared
+func (c *changeSet) write(w io.Writer) error {
+	lines := make([]string, 0)
+	for _, change := range c.records() {
+		lines = append(lines, formatChange(change))
+	}
+
+	if len(lines) == 0 {
+		_, err := fmt.Fprintln(w, "No changes, AWS SSO is in sync with Google Workspace")
+		return err
+	}
+	for _, l := range lines {
+		if _, err := fmt.Fprintln(w, l); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(w, "\n%d change(s)\n", len(lines))
+	return err
+}
@@ -1,10 +1,12 @@
 // Package config ...
 package config
 
+import "time"
+
 // Config ...
 type Config struct {
 	// Verbose toggles the verbosity
-	Debug bool
+	Debug bool `mapstructure:"debug"`
 	// LogLevel is the level with with to log for this config
 	LogLevel string `mapstructure:"log_level"`
 	// LogFormat is the format that is used for logging
@@ -17,22 +19,209 @@ type Config struct {
 	GoogleCustomerId string `mapstructure:"google_customer_id"`
 	// UserMatch ...
 	UserMatch string `mapstructure:"user_match"`
-	// GroupFilter ...
-	GroupMatch string `mapstructure:"group_match"`
+	// GroupMatch are the Google groups filter queries, the groups matching
+	// any of them are synced
+	GroupMatch []string `mapstructure:"group_match"`
+	// GroupLabels restricts the groups to the ones with any of these Cloud
+	// Identity labels, all the groups when empty
+	GroupLabels []string `mapstructure:"group_labels"`
 	// SCIMEndpoint ....
 	SCIMEndpoint string `mapstructure:"scim_endpoint"`
 	// SCIMAccessToken ...
 	SCIMAccessToken string `mapstructure:"scim_access_token"`
+	// SCIMAccessTokenSecret is the name or ARN of the Secrets Manager secret the SCIM access token is read from, replacing SCIMAccessToken
+	SCIMAccessTokenSecret string `mapstructure:"scim_access_token_secret"`
+	// SCIMReadAccessToken replaces SCIMAccessToken for the commands that only read
+	SCIMReadAccessToken string `mapstructure:"scim_read_access_token"`
 	// IsLambda ...
-	IsLambda bool
-	// Ignore users ...
+	IsLambda bool `mapstructure:"-"`
+	// Version is the version of ssosync, used in the User-Agent of requests
+	Version string `mapstructure:"-"`
+	// RunID identifies a single sync run, it is generated if not set
+	RunID string `mapstructure:"-"`
+	// Ignore users ..., see matcher.Match
 	IgnoreUsers []string `mapstructure:"ignore_users"`
-	// Ignore groups ...
+	// Ignore groups ..., see matcher.Match
 	IgnoreGroups []string `mapstructure:"ignore_groups"`
-	// Include groups ...
+	// Include groups ..., see matcher.Match
 	IncludeGroups []string `mapstructure:"include_groups"`
+	// Include users ..., see matcher.Match, all the users when empty
+	IncludeUsers []string `mapstructure:"include_users"`
+	// AllowedDomains restricts the users to the ones with a primary email in these domains
+	AllowedDomains []string `mapstructure:"allowed_domains"`
+	// CustomSchemaFilters restricts the users to the ones whose custom schemas match all of these filters, see ParseSchemaFilter
+	CustomSchemaFilters []string `mapstructure:"custom_schema_filters"`
+	// SkipSuspendedUsers treats the suspended Google users as nonexistent, they are deleted from AWS SSO
+	SkipSuspendedUsers bool `mapstructure:"skip_suspended_users"`
+	// ArchivedUsers is what to do with the AWS users of the archived Google
+	// users (deactivate|delete|ignore)
+	ArchivedUsers string `mapstructure:"archived_users"`
+	// IncludeOrgUnits restricts the users to these Google organizational units and their sub-units, by path
+	IncludeOrgUnits []string `mapstructure:"include_org_units"`
+	// IgnoreOrgUnits ignores the users of these Google organizational units and their sub-units, by path
+	IgnoreOrgUnits []string `mapstructure:"ignore_org_units"`
+	// GroupNamePrefix is prepended to the names of the Google groups to name the AWS groups
+	GroupNamePrefix string `mapstructure:"group_name_prefix"`
+	// GroupNameSuffix is appended to the names of the Google groups to name the AWS groups
+	GroupNameSuffix string `mapstructure:"group_name_suffix"`
+	// GroupNamesFile is the path of the JSON object of the AWS group names by Google group email
+	GroupNamesFile string `mapstructure:"group_names_file"`
+	// GroupPolicies protect the AWS groups of sensitive Google groups from automated removals
+	GroupPolicies []GroupPolicy `mapstructure:"group_policies"`
 	// SyncMethod allow to defined the sync method used to get the user and groups from Google Workspace
 	SyncMethod string `mapstructure:"sync_method"`
+	// AWSProfile is the shared config profile used when calling AWS APIs
+	AWSProfile string `mapstructure:"aws_profile"`
+	// SCIMReadAWSProfile replaces AWSProfile to sign the SCIM requests of the commands that only read
+	SCIMReadAWSProfile string `mapstructure:"scim_read_aws_profile"`
+	// SCIMSigV4 enables AWS Signature Version 4 signing of SCIM requests
+	SCIMSigV4 bool `mapstructure:"scim_sigv4"`
+	// SCIMSigV4Service is the service name used to sign SCIM requests
+	SCIMSigV4Service string `mapstructure:"scim_sigv4_service"`
+	// SCIMSigV4Region is the region used to sign SCIM requests
+	SCIMSigV4Region string `mapstructure:"scim_sigv4_region"`
+	// SCIMHeaders are extra "Name=Value" headers added to every SCIM request
+	SCIMHeaders []string `mapstructure:"scim_headers"`
+	// StateFile is the path of the file keeping the state between runs
+	StateFile string `mapstructure:"state_file"`
+	// SnapshotFile is the path of the copy of the data read by plan and diff
+	SnapshotFile string `mapstructure:"snapshot_file"`
+	// Offline makes plan and diff read from SnapshotFile instead of the providers
+	Offline bool `mapstructure:"offline"`
+	// AWSCacheFile is the path of the file keeping the AWS state seen by the last run
+	AWSCacheFile string `mapstructure:"aws_cache_file"`
+	// AWSCacheTTL is how long the AWS cache is diffed against before AWS is read again
+	AWSCacheTTL time.Duration `mapstructure:"aws_cache_ttl"`
+	// SkipUnchangedUsers skips the users whose Google etag didn't change since the last run
+	SkipUnchangedUsers bool `mapstructure:"skip_unchanged_users"`
+	// DeletionGracePeriod delays the deletion of users and groups removed from Google
+	DeletionGracePeriod time.Duration `mapstructure:"deletion_grace_period"`
+	// RestoreWindow is how long the group memberships of deleted users are kept, to restore them with the users
+	RestoreWindow time.Duration `mapstructure:"restore_window"`
+	// MaxGroupMembers is the maximum number of members of an AWS group, 0 is unlimited
+	MaxGroupMembers int `mapstructure:"max_group_members"`
+	// GroupOverflow is what to do with groups over MaxGroupMembers (fail|truncate|split)
+	GroupOverflow string `mapstructure:"group_overflow"`
+	// MissingNames is what to do with Google users without a given or family name (fail|skip|placeholder)
+	MissingNames string `mapstructure:"missing_names"`
+	// OversizedAttributes is what to do with Google users with attributes over the limits of AWS SSO (fail|truncate|skip)
+	OversizedAttributes string `mapstructure:"oversized_attributes"`
+	// ExternalMembers is what to do with the members of the Google groups who aren't users of the Workspace (skip|warn|fail)
+	ExternalMembers string `mapstructure:"external_members"`
+	// MissingNamePlaceholder is the template of the names missing, with the fields .Email and .Local
+	MissingNamePlaceholder string `mapstructure:"missing_name_placeholder"`
+	// MembershipBatchSize is the number of membership changes applied between checkpoints
+	MembershipBatchSize int `mapstructure:"membership_batch_size"`
+	// Groups restricts the sync to these Google groups, by email, and their members
+	Groups []string `mapstructure:"groups"`
+	// GoogleConcurrency is the number of concurrent requests fetching Google group members and their users
+	GoogleConcurrency int `mapstructure:"google_concurrency"`
+	// GoogleRequestsPerSecond limits the rate of requests to Google, 0 is unlimited
+	GoogleRequestsPerSecond float64 `mapstructure:"google_requests_per_second"`
+	// FlapThreshold is the number of consecutive reverted changes after which an entity is suppressed, 0 disables it
+	FlapThreshold int `mapstructure:"flap_threshold"`
+	// SyncExtendedAttributes syncs the phone number, title, address and
+	// enterprise attributes of the users
+	SyncExtendedAttributes bool `mapstructure:"sync_extended_attributes"`
+	// SyncLanguage syncs the preferred language of the users to their
+	// preferred language and locale
+	SyncLanguage bool `mapstructure:"sync_language"`
+	// SyncAliases syncs the aliases of the users as emails, not primary
+	SyncAliases bool `mapstructure:"sync_aliases"`
+	// UserAttributes derive attributes of the AWS users from templates,
+	// instead of the default mapping of the Google users
+	UserAttributes []UserAttribute `mapstructure:"user_attributes"`
+	// UserName is the SCIM userName of the AWS users (email|local|id) or its
+	// template, the primary email stays in their emails
+	UserName string `mapstructure:"user_name"`
+	// AllUsers provisions every Google user matching UserMatch, not only the members of the groups
+	AllUsers bool `mapstructure:"all_users"`
+	// BlackoutWindows are the windows during which destructive changes are deferred
+	BlackoutWindows []string `mapstructure:"blackout_windows"`
+	// Schedule is when the daemon runs a sync, a cron expression or "every ..." with an optional time zone
+	Schedule string `mapstructure:"schedule"`
+	// WatchAddress is the https URL the push notifications of Google Workspace are delivered to
+	WatchAddress string `mapstructure:"watch_address"`
+	// WatchToken is the token of the notification channels, the notifications without it are rejected
+	WatchToken string `mapstructure:"watch_token"`
+	// WatchTTL is how long the notification channels live before they must be registered again
+	WatchTTL time.Duration `mapstructure:"watch_ttl"`
+	// TeamsWebhookURL is the Microsoft Teams incoming webhook receiving the summary of runs
+	TeamsWebhookURL string `mapstructure:"teams_webhook_url"`
+	// PagerDutyRoutingKey is the PagerDuty Events API v2 integration key alerted when a run fails
+	PagerDutyRoutingKey string `mapstructure:"pagerduty_routing_key"`
+	// JiraURL is the base URL of the Jira tracking the approval of destructive plans
+	JiraURL string `mapstructure:"jira_url"`
+	// JiraUser is the user authenticating to Jira
+	JiraUser string `mapstructure:"jira_user"`
+	// JiraToken is the API token of JiraUser
+	JiraToken string `mapstructure:"jira_token"`
+	// JiraProject is the key of the project of the approval issues
+	JiraProject string `mapstructure:"jira_project"`
+	// JiraApprovedStatus is the status of approved issues
+	JiraApprovedStatus string `mapstructure:"jira_approved_status"`
+	// ApprovalDeletionThreshold is the number of deletions above which a plan needs an approval
+	ApprovalDeletionThreshold int `mapstructure:"approval_deletion_threshold"`
+	// MaxUserDeletions is the maximum number of users deleted by a run, 0 is unlimited
+	MaxUserDeletions int `mapstructure:"max_user_deletions"`
+	// MaxGroupDeletions is the maximum number of groups deleted by a run, 0 is unlimited
+	MaxGroupDeletions int `mapstructure:"max_group_deletions"`
+	// MaxUsers is the maximum number of Google users a run syncs, over it the run is aborted, 0 is unlimited
+	MaxUsers int `mapstructure:"max_users"`
+	// MaxGroups is the maximum number of Google groups a run syncs, over it the run is aborted, 0 is unlimited
+	MaxGroups int `mapstructure:"max_groups"`
+	// MaxDeletionPercent is the maximum percentage of the AWS users, or groups, deleted by a run, 0 is unlimited
+	MaxDeletionPercent float64 `mapstructure:"max_deletion_percent"`
+	// Force applies the deletions over the deletion limits
+	Force bool `mapstructure:"force"`
+	// ApprovalToken approves the plan with this token, without Jira
+	ApprovalToken string `mapstructure:"approval_token"`
+	// ApprovalPlanURL is the s3://bucket/prefix where the plans waiting for an approval are held
+	ApprovalPlanURL string `mapstructure:"approval_plan_url"`
+	// ApprovalSNSTopicARN is the SNS topic notified of the plans held for an approval
+	ApprovalSNSTopicARN string `mapstructure:"approval_sns_topic_arn"`
+	// DryRun logs the changes to AWS SSO instead of applying them
+	DryRun bool `mapstructure:"dry_run"`
+	// SCIMConcurrency is the number of concurrent requests applying changes to AWS SSO
+	SCIMConcurrency int `mapstructure:"scim_concurrency"`
+	// SCIMPageSize is the number of users or groups in each page listed from AWS SSO, 0 is the endpoint default
+	SCIMPageSize int `mapstructure:"scim_page_size"`
+	// SCIMBulkSize is the number of users created per request to the SCIM
+	// /Bulk endpoint, 0 creates them one by one
+	SCIMBulkSize int `mapstructure:"scim_bulk_size"`
+	// SCIMRequestsPerSecond limits the rate of requests to AWS SSO, 0 is unlimited
+	SCIMRequestsPerSecond float64 `mapstructure:"scim_rps"`
+	// SCIMMaxConns is the maximum number of connections to AWS SSO, 0 is unlimited
+	SCIMMaxConns int `mapstructure:"scim_max_conns"`
+	// SCIMIdleConnTimeout is how long an idle connection to AWS SSO is kept open
+	SCIMIdleConnTimeout time.Duration `mapstructure:"scim_idle_conn_timeout"`
+	// SCIMKeepAlive reuses the connections to AWS SSO between requests
+	SCIMKeepAlive bool `mapstructure:"scim_keep_alive"`
+	// SCIMHTTP2 attempts HTTP/2 with AWS SSO
+	SCIMHTTP2 bool `mapstructure:"scim_http2"`
+	// SCIMPatchUsers updates the users with PATCH requests of their changed
+	// attributes rather than replacing them with PUT
+	SCIMPatchUsers bool `mapstructure:"scim_patch_users"`
+	// Pprof is the profile of a sync run written to PprofFile (cpu|mem|trace), none when empty
+	Pprof string `mapstructure:"pprof"`
+	// PprofFile is the path of the profile, ssosync.<profile>.pprof in the temporary directory when empty
+	PprofFile string `mapstructure:"pprof_file"`
+	// SCIMRequestTimeout is the timeout of each request to AWS SSO, retries included separately, 0 is none
+	SCIMRequestTimeout time.Duration `mapstructure:"scim_request_timeout"`
+	// GooglePageSize is the number of users, groups or members in each page listed from Google, 0 is the API maximum
+	GooglePageSize int64 `mapstructure:"google_page_size"`
+	// Features are the optional features enabled, see KnownFeatures
+	Features []string `mapstructure:"features"`
+	// FaultLatency is the maximum random latency injected in every request to the providers, for testing
+	FaultLatency time.Duration `mapstructure:"fault_latency"`
+	// FaultErrorRate is the probability of an injected 500 error on a request to the providers, for testing
+	FaultErrorRate float64 `mapstructure:"fault_error_rate"`
+	// FaultThrottleRate is the probability of a request to the providers starting an injected storm of 429s, for testing
+	FaultThrottleRate float64 `mapstructure:"fault_throttle_rate"`
+	// FaultThrottleDuration is the duration of the injected storms of 429s
+	FaultThrottleDuration time.Duration `mapstructure:"fault_throttle_duration"`
+	// Yes skips the confirmation of destructive changes asked in a terminal
+	Yes bool `mapstructure:"yes"`
 }
 
 const (
@@ -44,20 +233,177 @@ const (
 	DefaultDebug = false
 	// DefaultGoogleCredentials is the default credentials path
 	DefaultGoogleCredentials = "credentials.json"
+	// DefaultConfigFile is the config file read from the working directory
+	// when no other is given
+	DefaultConfigFile = "ssosync.yaml"
 	// DefaultSyncMethod is the default sync method to use.
 	DefaultSyncMethod = "groups"
+	// SyncMethodUsersGroups is the alternative sync method, syncing users then groups
+	SyncMethodUsersGroups = "users_groups"
 	// DefaultGoogleCustomerId is the default customer id
 	DefaultGoogleCustomerId = "my_customer"
+	// DefaultSCIMSigV4Service is the default service name to sign SCIM requests for
+	DefaultSCIMSigV4Service = "execute-api"
+	// DefaultGroupOverflow is the default strategy for groups over the members cap
+	DefaultGroupOverflow = GroupOverflowFail
+	// DefaultMissingNames is the default handling of the users without a name
+	DefaultMissingNames = MissingNamesFail
+	// DefaultOversizedAttributes is the default handling of the users with
+	// attributes over the limits of AWS SSO
+	DefaultOversizedAttributes = OversizedAttributesFail
+	// DefaultExternalMembers is the default handling of the members of the
+	// groups who aren't users of the Workspace
+	DefaultExternalMembers = ExternalMembersSkip
+	// DefaultMissingNamePlaceholder is the default template of the names
+	// missing, the part of the email before the @
+	DefaultMissingNamePlaceholder = "{{.Local}}"
+	// DefaultArchivedUsers is the default handling of the archived users
+	DefaultArchivedUsers = ArchivedUsersDeactivate
+	// DefaultUserName is the default user name of the AWS users, their
+	// primary email
+	DefaultUserName = UserNameEmail
+	// DefaultMembershipBatchSize is the default number of membership changes per batch
+	DefaultMembershipBatchSize = 100
+	// DefaultGoogleConcurrency is the default number of concurrent requests to Google
+	DefaultGoogleConcurrency = 4
+	// DefaultSCIMConcurrency is the default number of concurrent requests applying changes
+	DefaultSCIMConcurrency = 4
+	// DefaultGoogleRequestsPerSecond keeps the requests under the Admin SDK
+	// default quota of 2400 queries per minute per user
+	DefaultGoogleRequestsPerSecond = 30
+	// DefaultMaxUserDeletions is the default maximum number of users deleted by a run
+	DefaultMaxUserDeletions = 2
+	// DefaultMaxGroupDeletions is the default maximum number of groups deleted by a run
+	DefaultMaxGroupDeletions = 2
+	// DefaultFaultThrottleDuration is the default duration of the injected storms of 429s
+	DefaultFaultThrottleDuration = 5 * time.Second
+	// DefaultJiraApprovedStatus is the default status of approved Jira issues
+	DefaultJiraApprovedStatus = "Approved"
+	// DefaultWatchTTL is the default lifetime of the notification channels,
+	// the longest Google Workspace allows
+	DefaultWatchTTL = 6 * time.Hour
+	// DefaultSCIMIdleConnTimeout is the default time an idle connection to
+	// AWS SSO is kept open
+	DefaultSCIMIdleConnTimeout = 90 * time.Second
+	// DefaultAWSCacheTTL is the default age of the AWS cache after which
+	// AWS is read again, catching the changes made outside of ssosync
+	DefaultAWSCacheTTL = 24 * time.Hour
+)
+
+const (
+	// GroupOverflowFail fails the sync when a group is over the members cap
+	GroupOverflowFail = "fail"
+	// GroupOverflowTruncate keeps only the first members of a group, by email
+	GroupOverflowTruncate = "truncate"
+	// GroupOverflowSplit splits a group into numbered overflow groups
+	GroupOverflowSplit = "split"
+)
+
+const (
+	// ProfileCPU profiles the CPU usage of a sync run
+	ProfileCPU = "cpu"
+	// ProfileMem profiles the memory allocated by a sync run
+	ProfileMem = "mem"
+	// ProfileTrace traces the execution of a sync run, see go tool trace
+	ProfileTrace = "trace"
+)
+
+const (
+	// MissingNamesFail fails the sync, listing the users without a name
+	MissingNamesFail = "fail"
+	// MissingNamesSkip leaves the users without a name out of the sync
+	MissingNamesSkip = "skip"
+	// MissingNamesPlaceholder fills the names missing from a template
+	MissingNamesPlaceholder = "placeholder"
+)
+
+const (
+	// ArchivedUsersDeactivate syncs the archived users as inactive users
+	ArchivedUsersDeactivate = "deactivate"
+	// ArchivedUsersDelete treats the archived users as nonexistent, they
+	// are deleted from AWS SSO
+	ArchivedUsersDelete = "delete"
+	// ArchivedUsersIgnore leaves the AWS users of the archived users as
+	// they are, with their group memberships
+	ArchivedUsersIgnore = "ignore"
+)
+
+const (
+	// UserNameEmail names the AWS users after their primary email
+	UserNameEmail = "email"
+	// UserNameLocal names the AWS users after the part of their primary
+	// email before the @
+	UserNameLocal = "local"
+	// UserNameID names the AWS users after the id of their Google user
+	UserNameID = "id"
+)
+
+const (
+	// OversizedAttributesFail fails the sync, listing the attributes over
+	// the limits
+	OversizedAttributesFail = "fail"
+	// OversizedAttributesTruncate cuts the attributes to the limits, the
+	// users whose user name is over the limit are skipped
+	OversizedAttributesTruncate = "truncate"
+	// OversizedAttributesSkip leaves the users out of the sync
+	OversizedAttributesSkip = "skip"
+)
+
+const (
+	// ExternalMembersSkip leaves the external members out of the groups,
+	// logging them at debug level
+	ExternalMembersSkip = "skip"
+	// ExternalMembersWarn leaves the external members out of the groups
+	// with a warning
+	ExternalMembersWarn = "warn"
+	// ExternalMembersFail fails the sync, listing the external members
+	ExternalMembersFail = "fail"
 )
 
+// GroupPolicy protects the AWS groups of the Google groups it matches from
+// automated removals, they are still created and their members added
+type GroupPolicy struct {
+	// Match is the email of the Google groups or the name of their AWS
+	// groups, see matcher.Match
+	Match string `mapstructure:"match"`
+	// NeverDeleteMembers keeps the members of the AWS groups, even when they
+	// are no longer members of the Google groups
+	NeverDeleteMembers bool `mapstructure:"never_delete_members"`
+	// NeverDeleteGroup keeps the AWS groups, even when the Google groups are
+	// deleted or out of scope
+	NeverDeleteGroup bool `mapstructure:"never_delete_group"`
+}
+
 // New returns a new Config
 func New() *Config {
 	return &Config{
-		Debug:             DefaultDebug,
-		LogLevel:          DefaultLogLevel,
-		LogFormat:         DefaultLogFormat,
-		SyncMethod:        DefaultSyncMethod,
-		GoogleCredentials: DefaultGoogleCredentials,
-		GoogleCustomerId:  DefaultGoogleCustomerId,
+		Debug:                   DefaultDebug,
+		LogLevel:                DefaultLogLevel,
+		LogFormat:               DefaultLogFormat,
+		SyncMethod:              DefaultSyncMethod,
+		GoogleCredentials:       DefaultGoogleCredentials,
+		GoogleCustomerId:        DefaultGoogleCustomerId,
+		SCIMSigV4Service:        DefaultSCIMSigV4Service,
+		GroupOverflow:           DefaultGroupOverflow,
+		MissingNames:            DefaultMissingNames,
+		OversizedAttributes:     DefaultOversizedAttributes,
+		ExternalMembers:         DefaultExternalMembers,
+		MissingNamePlaceholder:  DefaultMissingNamePlaceholder,
+		UserName:                DefaultUserName,
+		ArchivedUsers:           DefaultArchivedUsers,
+		MembershipBatchSize:     DefaultMembershipBatchSize,
+		GoogleConcurrency:       DefaultGoogleConcurrency,
+		SCIMConcurrency:         DefaultSCIMConcurrency,
+		GoogleRequestsPerSecond: DefaultGoogleRequestsPerSecond,
+		JiraApprovedStatus:      DefaultJiraApprovedStatus,
+		MaxUserDeletions:        DefaultMaxUserDeletions,
+		MaxGroupDeletions:       DefaultMaxGroupDeletions,
+		FaultThrottleDuration:   DefaultFaultThrottleDuration,
+		WatchTTL:                DefaultWatchTTL,
+		AWSCacheTTL:             DefaultAWSCacheTTL,
+		SCIMIdleConnTimeout:     DefaultSCIMIdleConnTimeout,
+		SCIMKeepAlive:           true,
+		SCIMHTTP2:               true,
+		SCIMPatchUsers:          true,
 	}
 }
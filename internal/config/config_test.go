@@ -20,4 +20,15 @@ func TestConfig(t *testing.T) {
 	assert.Equal(cfg.Debug, DefaultDebug)
 	assert.Equal(cfg.GoogleCredentials, DefaultGoogleCredentials)
 	assert.Equal(cfg.GoogleCustomerId, DefaultGoogleCustomerId)
+	assert.Equal(cfg.SCIMSigV4Service, DefaultSCIMSigV4Service)
+	assert.Equal(cfg.GroupOverflow, DefaultGroupOverflow)
+	assert.Equal(cfg.MembershipBatchSize, DefaultMembershipBatchSize)
+	assert.Equal(cfg.GoogleConcurrency, DefaultGoogleConcurrency)
+	assert.Equal(cfg.GoogleRequestsPerSecond, float64(DefaultGoogleRequestsPerSecond))
+	assert.Equal(cfg.JiraApprovedStatus, DefaultJiraApprovedStatus)
+	assert.Equal(cfg.SCIMConcurrency, DefaultSCIMConcurrency)
+	assert.False(cfg.Enabled(FeatureSCIMGroupMembers))
+
+	cfg.Features = []string{string(FeatureSCIMGroupMembers)}
+	assert.True(cfg.Enabled(FeatureSCIMGroupMembers))
 }
@@ -0,0 +1,59 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"sort"
+)
+
+// Feature is an optional behaviour, disabled unless it is listed in the
+// features of the configuration, so new behaviours can ship disabled and be
+// enabled per deployment
+type Feature string
+
+const (
+	// FeatureSCIMGroupMembers reads the members of an AWS SSO group with a
+	// single request, for SCIM endpoints returning the members attribute
+	FeatureSCIMGroupMembers Feature = "scim_group_members"
+	// FeatureGoogleUsersList resolves the members of the Google groups from a
+	// single list of the users, instead of looking up every member
+	FeatureGoogleUsersList Feature = "google_users_list"
+)
+
+// KnownFeatures are the features which can be enabled, with their description
+var KnownFeatures = map[Feature]string{
+	FeatureSCIMGroupMembers: "read the members of AWS SSO groups with a single request, when the SCIM endpoint returns the members attribute",
+	FeatureGoogleUsersList:  "resolve the members of Google Workspace groups from a single list of the users, instead of a request per member",
+}
+
+// Enabled tells whether the feature is enabled
+func (c *Config) Enabled(f Feature) bool {
+	for _, name := range c.Features {
+		if Feature(name) == f {
+			return true
+		}
+	}
+	return false
+}
+
+// knownFeatureNames returns the names of the known features, sorted
+func knownFeatureNames() []string {
+	names := make([]string, 0, len(KnownFeatures))
+	for f := range KnownFeatures {
+		names = append(names, string(f))
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,142 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/spf13/viper"
+)
+
+// ProfilesKey is the key of the named profiles of the config file, each
+// with settings read over the other ones of the file when selected
+const ProfilesKey = "profiles"
+
+// FileError lists the problems of a config file, its unknown keys and the
+// values of the wrong type
+type FileError struct {
+	Path     string
+	Problems []string
+}
+
+func (e *FileError) Error() string {
+	return fmt.Sprintf("config file %s: %s", e.Path, strings.Join(e.Problems, "; "))
+}
+
+// Keys returns the keys of the config file, the names of the environment
+// variables without the SSOSYNC_ prefix, sorted
+func Keys() []string {
+	t := reflect.TypeOf(Config{})
+	keys := make([]string, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		if k := t.Field(i).Tag.Get("mapstructure"); k != "" && k != "-" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// ReadFile reads the config file at path into cfg, the settings it doesn't
+// have keep their values. The format is told by the extension of the file,
+// YAML for ssosync.yaml. If profile is not empty, the settings of this
+// profile of the file, under profiles, are then read over the other ones.
+// A key which isn't one of Keys, or a value which can't be converted to the
+// type of its key, in any profile, is a *FileError, listing every problem
+// of the file rather than the first one.
+func ReadFile(cfg *Config, path string, profile string) error {
+	v := viper.New()
+	v.SetConfigFile(path)
+	if err := v.ReadInConfig(); err != nil {
+		return fmt.Errorf("cannot read config file %s: %w", path, err)
+	}
+
+	problems := readSettings(v, cfg)
+	profiles, ok := v.Get(ProfilesKey).(map[string]interface{})
+	if v.IsSet(ProfilesKey) && !ok {
+		problems = append(problems, fmt.Sprintf("%s must map the profile names to their settings", ProfilesKey))
+	}
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		// the profiles not selected are checked too
+		c := cfg
+		if name != strings.ToLower(profile) {
+			c = New()
+		}
+		sub := v.Sub(ProfilesKey + "." + name)
+		if sub == nil {
+			problems = append(problems, fmt.Sprintf("profile %q must be a map of settings", name))
+			continue
+		}
+		if sub.IsSet(ProfilesKey) {
+			problems = append(problems, fmt.Sprintf("profile %q: profiles can't be nested", name))
+		}
+		for _, p := range readSettings(sub, c) {
+			problems = append(problems, fmt.Sprintf("profile %q: %s", name, p))
+		}
+	}
+	if _, ok := profiles[strings.ToLower(profile)]; profile != "" && !ok {
+		problems = append(problems, fmt.Sprintf("unknown profile %q, the profiles are %s", profile, strings.Join(names, ", ")))
+	}
+
+	if len(problems) > 0 {
+		return &FileError{Path: path, Problems: problems}
+	}
+	return nil
+}
+
+// readSettings reads the settings of v into cfg and returns the unknown keys
+// and the values of the wrong type
+func readSettings(v *viper.Viper, cfg *Config) []string {
+	known := map[string]bool{ProfilesKey: true}
+	for _, k := range Keys() {
+		known[k] = true
+	}
+	problems := make([]string, 0)
+	for _, k := range v.AllKeys() {
+		if !known[k] && !strings.HasPrefix(k, ProfilesKey+".") {
+			problems = append(problems, fmt.Sprintf("unknown key %q", k))
+		}
+	}
+	sort.Strings(problems)
+
+	// the unknown keys of the settings, e.g. of the group policies, are
+	// errors too, the ones of the file are reported above already
+	var decodeErr *mapstructure.Error
+	err := v.Unmarshal(cfg, func(c *mapstructure.DecoderConfig) { c.ErrorUnused = true })
+	switch {
+	case errors.As(err, &decodeErr):
+		errs := make([]string, 0, len(decodeErr.Errors))
+		for _, e := range decodeErr.Errors {
+			if !strings.HasPrefix(e, "'' has invalid keys") {
+				errs = append(errs, e)
+			}
+		}
+		sort.Strings(errs)
+		problems = append(problems, errs...)
+	case err != nil:
+		problems = append(problems, err.Error())
+	}
+	return problems
+}
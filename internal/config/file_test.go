@@ -0,0 +1,244 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/awslabs/ssosync/internal/config"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeConfigFile(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), DefaultConfigFile)
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestReadFile(t *testing.T) {
+	assert := assert.New(t)
+
+	path := writeConfigFile(t, `
+scim_endpoint: https://scim.eu-west-1.amazonaws.com/abc/scim/v2/
+ignore_users:
+  - admin@example.com
+  - re:^svc-.*
+ignore_groups: a@example.com,b@example.com
+max_user_deletions: 10
+max_deletion_percent: 5.5
+deletion_grace_period: 72h
+dry_run: true
+`)
+
+	cfg := New()
+	assert.NoError(ReadFile(cfg, path, ""))
+	assert.Equal("https://scim.eu-west-1.amazonaws.com/abc/scim/v2/", cfg.SCIMEndpoint)
+	assert.Equal([]string{"admin@example.com", "re:^svc-.*"}, cfg.IgnoreUsers)
+	assert.Equal([]string{"a@example.com", "b@example.com"}, cfg.IgnoreGroups)
+	assert.Equal(10, cfg.MaxUserDeletions)
+	assert.Equal(5.5, cfg.MaxDeletionPercent)
+	assert.Equal(72*time.Hour, cfg.DeletionGracePeriod)
+	assert.True(cfg.DryRun)
+
+	// the settings missing from the file keep their values
+	assert.Equal(DefaultSyncMethod, cfg.SyncMethod)
+	assert.Equal(DefaultMaxGroupDeletions, cfg.MaxGroupDeletions)
+}
+
+func TestReadFileProblems(t *testing.T) {
+	assert := assert.New(t)
+
+	path := writeConfigFile(t, `
+scim_endpoint: https://scim.eu-west-1.amazonaws.com/abc/scim/v2/
+max_user_deletions: ten
+dry_run: maybe
+ignore_user: admin@example.com
+version: v9
+google:
+  admin: admin@example.com
+`)
+
+	err := ReadFile(New(), path, "")
+	var fileErr *FileError
+	if !errors.As(err, &fileErr) {
+		t.Fatalf("expected a *FileError, got %v", err)
+	}
+	assert.Equal(path, fileErr.Path)
+	if assert.Len(fileErr.Problems, 5) {
+		assert.Equal(`unknown key "google.admin"`, fileErr.Problems[0])
+		assert.Equal(`unknown key "ignore_user"`, fileErr.Problems[1])
+		assert.Equal(`unknown key "version"`, fileErr.Problems[2])
+		assert.Contains(fileErr.Problems[3], "dry_run")
+		assert.Contains(fileErr.Problems[4], "max_user_deletions")
+	}
+}
+
+func TestReadFileGroupPolicies(t *testing.T) {
+	assert := assert.New(t)
+
+	path := writeConfigFile(t, `
+group_policies:
+  - match: finance@corp.com
+    never_delete_members: true
+    never_delete_group: true
+  - match: re:audit-.*@corp\.com
+    never_delete_group: true
+`)
+	cfg := New()
+	assert.NoError(ReadFile(cfg, path, ""))
+	assert.Equal([]GroupPolicy{
+		{Match: "finance@corp.com", NeverDeleteMembers: true, NeverDeleteGroup: true},
+		{Match: `re:audit-.*@corp\.com`, NeverDeleteGroup: true},
+	}, cfg.GroupPolicies)
+
+	path = writeConfigFile(t, `
+group_policies:
+  - match: finance@corp.com
+    never_delete: true
+`)
+	err := ReadFile(New(), path, "")
+	var fileErr *FileError
+	if assert.True(errors.As(err, &fileErr)) && assert.Len(fileErr.Problems, 1) {
+		assert.Contains(fileErr.Problems[0], "never_delete")
+	}
+}
+
+func TestReadFileMissing(t *testing.T) {
+	err := ReadFile(New(), filepath.Join(t.TempDir(), DefaultConfigFile), "")
+	assert.Error(t, err)
+	var fileErr *FileError
+	assert.False(t, errors.As(err, &fileErr))
+}
+
+func TestKeys(t *testing.T) {
+	keys := Keys()
+	assert.Contains(t, keys, "scim_endpoint")
+	assert.Contains(t, keys, "debug")
+	assert.NotContains(t, keys, "version")
+	assert.NotContains(t, keys, "run_id")
+}
+
+func TestParseSchemaFilter(t *testing.T) {
+	f, err := ParseSchemaFilter("customSchemas.Employment.syncToAWS = true")
+	assert.NoError(t, err)
+	assert.Equal(t, SchemaFilter{Schema: "Employment", Field: "syncToAWS", Value: "true"}, f)
+	assert.Equal(t, "customSchemas.Employment.syncToAWS=true", f.String())
+
+	for _, expr := range []string{"Employment.syncToAWS=true", "customSchemas.Employment=true", "customSchemas.Employment.syncToAWS", "customSchemas..syncToAWS=true"} {
+		_, err := ParseSchemaFilter(expr)
+		assert.Error(t, err, expr)
+	}
+
+	assert.Equal(t, []string{"Employment", "HR"}, SchemaNames([]string{
+		"customSchemas.Employment.syncToAWS=true",
+		"customSchemas.HR.costCenter=R&D",
+		"customSchemas.Employment.level=3",
+		"invalid",
+	}))
+}
+
+func TestReadSchemaNames(t *testing.T) {
+	schema, field, err := ParseSchemaField("customSchemas.Employment.costCenter")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Employment", "costCenter"}, []string{schema, field})
+	for _, path := range []string{"Employment.costCenter", "customSchemas.Employment", "customSchemas.Employment.cost.center"} {
+		_, _, err := ParseSchemaField(path)
+		assert.Error(t, err, path)
+	}
+
+	cfg := New()
+	cfg.CustomSchemaFilters = []string{"customSchemas.Employment.syncToAWS=true"}
+	cfg.UserAttributes = []UserAttribute{
+		{Attribute: UserAttributeCostCenter, Source: "customSchemas.HR.costCenter"},
+		{Attribute: UserAttributeEmployeeNumber, Source: "customSchemas.Employment.id"},
+		{Attribute: UserAttributeTitle, Template: "{{.User.OrgUnitPath}}"},
+	}
+	assert.Equal(t, []string{"Employment", "HR"}, ReadSchemaNames(cfg))
+}
+
+func TestReadFileGroupMatch(t *testing.T) {
+	for _, content := range []string{
+		"group_match: email:aws-*\n",
+		"group_match:\n  - email:aws-*\n  - name:Cloud*\n",
+	} {
+		path := filepath.Join(t.TempDir(), "ssosync.yaml")
+		assert.NoError(t, ioutil.WriteFile(path, []byte(content), 0600))
+		cfg := New()
+		assert.NoError(t, ReadFile(cfg, path, ""))
+		assert.Equal(t, "email:aws-*", cfg.GroupMatch[0])
+	}
+}
+
+func TestReadFileProfiles(t *testing.T) {
+	assert := assert.New(t)
+
+	path := writeConfigFile(t, `
+google_admin: admin@corp.com
+group_match: email:aws-*
+max_user_deletions: 5
+profiles:
+  dev:
+    scim_endpoint: https://scim.eu-west-1.amazonaws.com/dev/scim/v2/
+    scim_access_token_secret: ssosync/dev/scim-token
+    group_match: email:aws-dev-*
+  Prod:
+    scim_endpoint: https://scim.eu-west-1.amazonaws.com/prod/scim/v2/
+    scim_access_token_secret: arn:aws:secretsmanager:eu-west-1:123456789012:secret:ssosync/prod
+    max_user_deletions: 1
+`)
+	cfg := New()
+	assert.NoError(ReadFile(cfg, path, ""))
+	assert.Equal("admin@corp.com", cfg.GoogleAdmin)
+	assert.Equal("", cfg.SCIMEndpoint)
+
+	cfg = New()
+	assert.NoError(ReadFile(cfg, path, "dev"))
+	assert.Equal("admin@corp.com", cfg.GoogleAdmin)
+	assert.Equal("https://scim.eu-west-1.amazonaws.com/dev/scim/v2/", cfg.SCIMEndpoint)
+	assert.Equal("ssosync/dev/scim-token", cfg.SCIMAccessTokenSecret)
+	assert.Equal([]string{"email:aws-dev-*"}, cfg.GroupMatch)
+	assert.Equal(5, cfg.MaxUserDeletions)
+
+	cfg = New()
+	assert.NoError(ReadFile(cfg, path, "prod"))
+	assert.Equal([]string{"email:aws-*"}, cfg.GroupMatch)
+	assert.Equal(1, cfg.MaxUserDeletions)
+
+	err := ReadFile(New(), path, "staging")
+	var fileErr *FileError
+	if assert.True(errors.As(err, &fileErr)) && assert.Len(fileErr.Problems, 1) {
+		assert.Equal(`unknown profile "staging", the profiles are dev, prod`, fileErr.Problems[0])
+	}
+
+	path = writeConfigFile(t, `
+profiles:
+  dev:
+    scim_endpont: https://scim.eu-west-1.amazonaws.com/dev/scim/v2/
+  prod:
+    max_user_deletions: many
+`)
+	err = ReadFile(New(), path, "dev")
+	if assert.True(errors.As(err, &fileErr)) && assert.Len(fileErr.Problems, 2) {
+		assert.Equal(`profile "dev": unknown key "scim_endpont"`, fileErr.Problems[0])
+		assert.Contains(fileErr.Problems[1], `profile "prod": `)
+	}
+}
@@ -0,0 +1,371 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/awslabs/ssosync/internal/matcher"
+)
+
+// Problem is a contradiction in the configuration, with a suggested fix
+type Problem struct {
+	Message string
+	Fix     string
+}
+
+func (p Problem) String() string {
+	return fmt.Sprintf("%s\n  fix: %s", p.Message, p.Fix)
+}
+
+// Lint checks the configuration for contradictory settings, it only looks
+// at the configuration and doesn't send any request
+func Lint(cfg *Config) []Problem {
+	problems := make([]Problem, 0)
+	add := func(fix string, format string, args ...interface{}) {
+		problems = append(problems, Problem{Message: fmt.Sprintf(format, args...), Fix: fix})
+	}
+
+	switch cfg.SyncMethod {
+	case DefaultSyncMethod:
+		if len(cfg.IncludeGroups) > 0 {
+			add("filter the groups with --group-match or --groups, or use --sync-method users_groups",
+				"--include-groups is ignored by the %q sync method", cfg.SyncMethod)
+		}
+		if len(cfg.IncludeUsers) > 0 {
+			add("filter the users with --user-match or --ignore-users, or use --sync-method users_groups",
+				"--include-users is ignored by the %q sync method", cfg.SyncMethod)
+		}
+	case SyncMethodUsersGroups:
+		groupsOnly := map[string]bool{
+			"--groups":            len(cfg.Groups) > 0,
+			"--all-users":         cfg.AllUsers,
+			"--max-group-members": cfg.MaxGroupMembers > 0,
+			"--external-members":  cfg.ExternalMembers != DefaultExternalMembers,
+			"--max-users":         cfg.MaxUsers > 0,
+			"--max-groups":        cfg.MaxGroups > 0,
+			"--blackout-windows":  len(cfg.BlackoutWindows) > 0,
+		}
+		for _, flag := range []string{"--groups", "--all-users", "--max-group-members", "--external-members", "--max-users", "--max-groups", "--blackout-windows"} {
+			if groupsOnly[flag] {
+				add(fmt.Sprintf("remove %s or use --sync-method %s", flag, DefaultSyncMethod),
+					"%s only works with the %q sync method", flag, DefaultSyncMethod)
+			}
+		}
+		for _, g := range cfg.IncludeGroups {
+			if !matcher.IsPattern(g) && !queriesMayMatchEmail(cfg.GroupMatch, g) {
+				add("add the group to --group-match or remove it from --include-groups",
+					"included group %q can't match --group-match %q, it is never synced", g, strings.Join(cfg.GroupMatch, ","))
+			}
+		}
+	default:
+		add(fmt.Sprintf("use --sync-method %s or %s", DefaultSyncMethod, SyncMethodUsersGroups),
+			"unknown sync method %q", cfg.SyncMethod)
+	}
+
+	lists := []struct {
+		flag    string
+		entries []string
+	}{
+		{"--ignore-users", cfg.IgnoreUsers},
+		{"--ignore-groups", cfg.IgnoreGroups},
+		{"--include-groups", cfg.IncludeGroups},
+		{"--include-users", cfg.IncludeUsers},
+	}
+	for _, l := range lists {
+		for _, e := range l.entries {
+			if err := matcher.Check(e); err != nil {
+				add(fmt.Sprintf("fix the glob or the regular expression in %s, see https://golang.org/s/re2syntax", l.flag),
+					"invalid pattern %q in %s: %s", e, l.flag, err)
+			}
+		}
+	}
+
+	for _, d := range cfg.AllowedDomains {
+		if d == "" || strings.Contains(d, "@") {
+			add("use the domains of the emails in --allowed-domains, e.g. 'corp.com'",
+				"allowed domain %q isn't a domain, it matches no user", d)
+		}
+	}
+
+	for _, expr := range cfg.CustomSchemaFilters {
+		if _, err := ParseSchemaFilter(expr); err != nil {
+			add("write the filter customSchemas.<schema>.<field>=<value>, e.g. 'customSchemas.Employment.syncToAWS=true'",
+				"%s, it matches no user", err)
+		}
+	}
+
+	units := []struct {
+		flag    string
+		entries []string
+	}{
+		{"--include-org-units", cfg.IncludeOrgUnits},
+		{"--ignore-org-units", cfg.IgnoreOrgUnits},
+	}
+	for _, l := range units {
+		for _, u := range l.entries {
+			if !strings.HasPrefix(u, "/") {
+				add(fmt.Sprintf("use the path of the organizational unit in %s, e.g. '/%s'", l.flag, u),
+					"organizational unit %q in %s isn't a path, it matches no user", u, l.flag)
+			}
+		}
+	}
+	for i, p := range cfg.GroupPolicies {
+		switch {
+		case p.Match == "":
+			add("set the email of the Google groups or the name of their AWS groups in match",
+				"group policy %d has no match, it protects no group", i+1)
+		case matcher.Check(p.Match) != nil:
+			add("fix the glob or the regular expression of the group policy, see https://golang.org/s/re2syntax",
+				"invalid pattern %q in group policy %d: %s", p.Match, i+1, matcher.Check(p.Match))
+		}
+		if !p.NeverDeleteMembers && !p.NeverDeleteGroup {
+			add("set never_delete_members or never_delete_group, or remove the policy",
+				"group policy %d protects nothing", i+1)
+		}
+	}
+	if len(cfg.GroupPolicies) > 0 && cfg.SyncMethod != DefaultSyncMethod {
+		add(fmt.Sprintf("remove group_policies or use --sync-method %s", DefaultSyncMethod),
+			"group_policies only work with the %q sync method", DefaultSyncMethod)
+	}
+
+	ignoredUnits := make(map[string]bool, len(cfg.IgnoreOrgUnits))
+	for _, u := range cfg.IgnoreOrgUnits {
+		ignoredUnits[u] = true
+	}
+	for _, u := range cfg.IncludeOrgUnits {
+		if ignoredUnits[u] {
+			add("remove it from --ignore-org-units or from --include-org-units",
+				"organizational unit %q is both included and ignored, its users are never synced", u)
+		}
+	}
+
+	ignoredUsers := make(map[string]bool, len(cfg.IgnoreUsers))
+	for _, u := range cfg.IgnoreUsers {
+		ignoredUsers[u] = true
+	}
+	for _, u := range cfg.IncludeUsers {
+		if ignoredUsers[u] {
+			add("remove it from --ignore-users or from --include-users",
+				"user %q is both included and ignored, it is never synced", u)
+		}
+	}
+
+	ignored := make(map[string]bool, len(cfg.IgnoreGroups))
+	for _, g := range cfg.IgnoreGroups {
+		ignored[g] = true
+	}
+	for _, g := range cfg.IncludeGroups {
+		if ignored[g] {
+			add("remove it from --ignore-groups or from --include-groups",
+				"group %q is both included and ignored, it is never synced", g)
+		}
+	}
+	for _, g := range cfg.Groups {
+		if ignored[g] {
+			add("remove it from --ignore-groups or from --groups",
+				"group %q is both in --groups and ignored, it is never synced", g)
+		}
+	}
+	for _, l := range cfg.GroupLabels {
+		if l == "" || strings.ContainsAny(l, "'\\") {
+			add("use the key of the label in --group-labels, e.g. 'cloudidentity.googleapis.com/groups.security'",
+				"invalid group label %q", l)
+		}
+	}
+	if len(cfg.GroupLabels) > 0 && len(cfg.Groups) > 0 {
+		add("remove --group-labels or --groups",
+			"--group-labels is ignored with --groups, the groups of --groups are synced whatever their labels")
+	}
+
+	switch cfg.GroupOverflow {
+	case GroupOverflowFail, GroupOverflowTruncate, GroupOverflowSplit:
+	default:
+		add(fmt.Sprintf("use --group-overflow %s, %s or %s", GroupOverflowFail, GroupOverflowTruncate, GroupOverflowSplit),
+			"unknown group overflow strategy %q", cfg.GroupOverflow)
+	}
+
+	if cfg.AWSCacheFile != "" && cfg.SyncMethod != DefaultSyncMethod {
+		add(fmt.Sprintf("remove --aws-cache-file or use --sync-method %s", DefaultSyncMethod),
+			"--aws-cache-file only works with the %q sync method", DefaultSyncMethod)
+	}
+	if cfg.AWSCacheFile != "" && cfg.AWSCacheTTL <= 0 {
+		add("set --aws-cache-ttl to a positive duration, e.g. '24h'",
+			"--aws-cache-ttl %s never lets the AWS cache be used", cfg.AWSCacheTTL)
+	}
+
+	if cfg.Offline && cfg.SnapshotFile == "" {
+		add("set --snapshot-file to a snapshot written by plan or diff", "--offline reads from a snapshot, but no --snapshot-file is set")
+	}
+
+	switch cfg.ArchivedUsers {
+	case ArchivedUsersDeactivate, ArchivedUsersDelete, ArchivedUsersIgnore:
+	default:
+		add(fmt.Sprintf("use --archived-users %s, %s or %s", ArchivedUsersDeactivate, ArchivedUsersDelete, ArchivedUsersIgnore),
+			"unknown archived users policy %q", cfg.ArchivedUsers)
+	}
+
+	switch cfg.MissingNames {
+	case MissingNamesFail, MissingNamesSkip, MissingNamesPlaceholder:
+	default:
+		add(fmt.Sprintf("use --missing-names %s, %s or %s", MissingNamesFail, MissingNamesSkip, MissingNamesPlaceholder),
+			"unknown missing names policy %q", cfg.MissingNames)
+	}
+	if cfg.MissingNames == MissingNamesPlaceholder {
+		if _, err := template.New("placeholder").Parse(cfg.MissingNamePlaceholder); err != nil {
+			add("fix the template of --missing-name-placeholder, e.g. '{{.Local}}'",
+				"invalid missing name placeholder: %s", err)
+		}
+	}
+
+	if _, err := ParseUserName(cfg.UserName); err != nil {
+		add(fmt.Sprintf("use --user-name %s, %s, %s or a template, e.g. '{{.Local | lower}}'", UserNameEmail, UserNameLocal, UserNameID),
+			"invalid user name: %s", err)
+	}
+	attributes := make(map[string]bool, len(cfg.UserAttributes))
+	for i, a := range cfg.UserAttributes {
+		if _, err := a.Parse(); err != nil {
+			add("fix the attribute or the template of the user attribute, e.g. '{{.GivenName}}'",
+				"invalid user attribute %d: %s", i+1, err)
+		}
+		if attributes[a.Attribute] {
+			add("keep a single template for the attribute in user_attributes",
+				"user attribute %q is set more than once", a.Attribute)
+		}
+		attributes[a.Attribute] = true
+	}
+
+	switch cfg.OversizedAttributes {
+	case OversizedAttributesFail, OversizedAttributesTruncate, OversizedAttributesSkip:
+	default:
+		add(fmt.Sprintf("use --oversized-attributes %s, %s or %s", OversizedAttributesFail, OversizedAttributesTruncate, OversizedAttributesSkip),
+			"unknown oversized attributes policy %q", cfg.OversizedAttributes)
+	}
+
+	switch cfg.ExternalMembers {
+	case ExternalMembersSkip, ExternalMembersWarn, ExternalMembersFail:
+	default:
+		add(fmt.Sprintf("use --external-members %s, %s or %s", ExternalMembersSkip, ExternalMembersWarn, ExternalMembersFail),
+			"unknown external members policy %q", cfg.ExternalMembers)
+	}
+
+	for _, f := range cfg.Features {
+		if _, ok := KnownFeatures[Feature(f)]; !ok {
+			add(fmt.Sprintf("remove it from --features, the known features are %s", strings.Join(knownFeatureNames(), ", ")),
+				"unknown feature %q", f)
+		}
+	}
+
+	if cfg.JiraURL != "" && cfg.JiraProject == "" {
+		add("set --jira-project", "--jira-url is set without a Jira project for the approval issues")
+	}
+	if (cfg.ApprovalPlanURL == "") != (cfg.ApprovalSNSTopicARN == "") {
+		add("set both --approval-plan-url and --approval-sns-topic-arn, or none",
+			"held plans need both a location and a topic notifying the approvers")
+	}
+	if cfg.ApprovalDeletionThreshold > 0 && cfg.JiraURL == "" && cfg.ApprovalPlanURL == "" && cfg.ApprovalToken == "" {
+		add("set --jira-url to track approvals in Jira, --approval-plan-url to hold plans, or approve plans with --approval-token",
+			"--approval-deletion-threshold is set but plans can't be approved")
+	}
+	if cfg.MaxUserDeletions < 0 || cfg.MaxGroupDeletions < 0 {
+		add("use 0 for no limit", "negative maximum number of deletions")
+	}
+	if cfg.MaxUsers < 0 || cfg.MaxGroups < 0 {
+		add("use 0 for no limit", "negative maximum number of users or groups")
+	}
+	if cfg.MaxDeletionPercent < 0 || cfg.MaxDeletionPercent > 100 {
+		add("use a percentage between 0 and 100, 0 for no limit", "--max-deletion-percent %v is not a percentage", cfg.MaxDeletionPercent)
+	}
+	if cfg.FaultErrorRate < 0 || cfg.FaultErrorRate > 1 || cfg.FaultThrottleRate < 0 || cfg.FaultThrottleRate > 1 {
+		add("use a probability between 0 and 1", "the rates of injected faults must be probabilities")
+	}
+	switch cfg.Pprof {
+	case "", ProfileCPU, ProfileMem, ProfileTrace:
+	default:
+		add(fmt.Sprintf("use --pprof %s, %s or %s", ProfileCPU, ProfileMem, ProfileTrace),
+			"unknown profile %q", cfg.Pprof)
+	}
+	if cfg.PprofFile != "" && cfg.Pprof == "" {
+		add("set --pprof to cpu, mem or trace", "--pprof-file is set, but no --pprof is written to it")
+	}
+	if cfg.SCIMMaxConns > 0 && cfg.SCIMMaxConns < cfg.SCIMConcurrency {
+		add(fmt.Sprintf("raise --scim-max-conns to --scim-concurrency %d at least, or use 0 for no limit", cfg.SCIMConcurrency),
+			"--scim-max-conns %d is lower than --scim-concurrency, the concurrent requests wait for a connection", cfg.SCIMMaxConns)
+	}
+	if cfg.SCIMMaxConns < 0 || cfg.SCIMRequestTimeout < 0 {
+		add("use 0 for no limit", "negative --scim-max-conns or --scim-request-timeout")
+	}
+	if cfg.SCIMBulkSize < 0 {
+		add("use 0 to create the users one by one", "negative --scim-bulk-size %d", cfg.SCIMBulkSize)
+	}
+	if cfg.WatchAddress != "" && !strings.HasPrefix(cfg.WatchAddress, "https://") {
+		add("use the https URL of the webhook, e.g. of Amazon API Gateway", "--watch-address %q isn't an https URL, Google Workspace only delivers notifications over https", cfg.WatchAddress)
+	}
+	if cfg.WatchAddress != "" && cfg.WatchToken == "" {
+		add("set --watch-token to a random secret", "--watch-address is set without a token authenticating the notifications")
+	}
+	if cfg.SCIMAccessToken != "" && cfg.SCIMAccessTokenSecret != "" {
+		add("remove --access-token, or --access-token-secret", "both --access-token and --access-token-secret are set, only one of them can be the token")
+	}
+	if cfg.SCIMReadAWSProfile != "" && !cfg.SCIMSigV4 {
+		add("set --scim-sigv4, or remove --read-aws-profile", "--read-aws-profile is set but SCIM requests aren't signed")
+	}
+
+	return problems
+}
+
+// queriesMayMatchEmail tells whether a group with email may be returned by
+// one of the Google Workspace groups queries, no query returns all the groups
+func queriesMayMatchEmail(queries []string, email string) bool {
+	if len(queries) == 0 {
+		return true
+	}
+	for _, query := range queries {
+		if queryMayMatchEmail(query, email) {
+			return true
+		}
+	}
+	return false
+}
+
+// queryMayMatchEmail tells whether a group with email may be returned by the
+// Google Workspace groups query. Only the email clauses of the query are
+// evaluated, e.g. "email:aws-*" or "email=x@corp.com", the other clauses are
+// assumed to match.
+func queryMayMatchEmail(query string, email string) bool {
+	email = strings.ToLower(email)
+	for _, clause := range strings.Fields(query) {
+		var value string
+		switch {
+		case strings.HasPrefix(clause, "email:"):
+			value = clause[len("email:"):]
+		case strings.HasPrefix(clause, "email="):
+			value = clause[len("email="):]
+		default:
+			continue
+		}
+		value = strings.ToLower(strings.Trim(value, `'"`))
+		if strings.HasSuffix(value, "*") {
+			if !strings.HasPrefix(email, strings.TrimSuffix(value, "*")) {
+				return false
+			}
+		} else if email != value {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,222 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config_test
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/awslabs/ssosync/internal/config"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLint(t *testing.T) {
+	tests := []struct {
+		name     string
+		edit     func(cfg *Config)
+		problems int
+	}{
+		{"defaults", func(cfg *Config) {}, 0},
+		{"unknown sync method", func(cfg *Config) { cfg.SyncMethod = "users" }, 1},
+		{"include groups with groups", func(cfg *Config) { cfg.IncludeGroups = []string{"a@corp.com"} }, 1},
+		{"groups with users_groups", func(cfg *Config) {
+			cfg.SyncMethod = SyncMethodUsersGroups
+			cfg.Groups = []string{"a@corp.com"}
+			cfg.AllUsers = true
+		}, 2},
+		{"include groups matching", func(cfg *Config) {
+			cfg.SyncMethod = SyncMethodUsersGroups
+			cfg.GroupMatch = []string{"name:AWS* email:aws-*"}
+			cfg.IncludeGroups = []string{"AWS-dev@corp.com", "aws-ops@corp.com"}
+		}, 0},
+		{"include groups not matching", func(cfg *Config) {
+			cfg.SyncMethod = SyncMethodUsersGroups
+			cfg.GroupMatch = []string{"email:aws-*"}
+			cfg.IncludeGroups = []string{"aws-dev@corp.com", "dev@corp.com"}
+		}, 1},
+		{"include groups matching any query", func(cfg *Config) {
+			cfg.SyncMethod = SyncMethodUsersGroups
+			cfg.GroupMatch = []string{"email:aws-*", "email:cloud-*"}
+			cfg.IncludeGroups = []string{"aws-dev@corp.com", "cloud-ops@corp.com", "dev@corp.com"}
+		}, 1},
+		{"include group exact match", func(cfg *Config) {
+			cfg.SyncMethod = SyncMethodUsersGroups
+			cfg.GroupMatch = []string{"email='aws-dev@corp.com'"}
+			cfg.IncludeGroups = []string{"aws-dev@corp.com", "aws-ops@corp.com"}
+		}, 1},
+		{"user attributes", func(cfg *Config) {
+			cfg.UserAttributes = []UserAttribute{
+				{Attribute: UserAttributeDisplayName, Template: "{{.GivenName}} {{.FamilyName | upper}}"},
+				{Attribute: UserAttributeTitle, Template: "{{.User.OrgUnitPath}}"},
+				{Attribute: UserAttributeCostCenter, Source: "customSchemas.HR.costCenter"},
+			}
+		}, 0},
+		{"invalid user attributes", func(cfg *Config) {
+			cfg.UserAttributes = []UserAttribute{
+				{Attribute: "nickName", Template: "{{.GivenName}}"},
+				{Attribute: UserAttributeGivenName, Template: "{{.GivenName"},
+				{Attribute: UserAttributeGivenName, Template: "{{.Local | title}}"},
+				{Attribute: UserAttributeDivision, Source: "customSchemas.HR"},
+				{Attribute: UserAttributeDepartment, Source: "customSchemas.HR.department", Template: "{{.Local}}"},
+				{Attribute: UserAttributeOrganization},
+			}
+		}, 7},
+		{"user name", func(cfg *Config) { cfg.UserName = UserNameLocal }, 0},
+		{"user name template", func(cfg *Config) { cfg.UserName = "{{.Local | lower}}" }, 0},
+		{"unknown user name", func(cfg *Config) { cfg.UserName = "upn" }, 1},
+		{"invalid user name template", func(cfg *Config) { cfg.UserName = "{{.Local" }, 1},
+		{"group labels", func(cfg *Config) {
+			cfg.GroupLabels = []string{"cloudidentity.googleapis.com/groups.security"}
+		}, 0},
+		{"invalid group label", func(cfg *Config) {
+			cfg.GroupLabels = []string{"security' in labels || 'x", ""}
+		}, 2},
+		{"group labels with groups", func(cfg *Config) {
+			cfg.GroupLabels = []string{"cloudidentity.googleapis.com/groups.security"}
+			cfg.Groups = []string{"aws-dev@corp.com"}
+		}, 1},
+		{"ignored and included", func(cfg *Config) {
+			cfg.SyncMethod = SyncMethodUsersGroups
+			cfg.IncludeGroups = []string{"a@corp.com"}
+			cfg.IgnoreGroups = []string{"a@corp.com"}
+		}, 1},
+		{"include users", func(cfg *Config) {
+			cfg.SyncMethod = SyncMethodUsersGroups
+			cfg.IncludeUsers = []string{"a@corp.com", "re:.*@ops\\.corp\\.com"}
+		}, 0},
+		{"caps", func(cfg *Config) { cfg.MaxUsers, cfg.MaxGroups = 1000, 50 }, 0},
+		{"negative caps", func(cfg *Config) { cfg.MaxUsers = -1 }, 1},
+		{"caps with users_groups", func(cfg *Config) {
+			cfg.SyncMethod = SyncMethodUsersGroups
+			cfg.MaxUsers, cfg.MaxGroups = 1000, 50
+		}, 2},
+		{"blackout windows with users_groups", func(cfg *Config) {
+			cfg.SyncMethod = SyncMethodUsersGroups
+			cfg.BlackoutWindows = []string{"Mon-Fri 09:00-18:00"}
+		}, 1},
+		{"include users with groups", func(cfg *Config) { cfg.IncludeUsers = []string{"a@corp.com"} }, 1},
+		{"ignored and included user", func(cfg *Config) {
+			cfg.SyncMethod = SyncMethodUsersGroups
+			cfg.IncludeUsers = []string{"a@corp.com", "re:(.*"}
+			cfg.IgnoreUsers = []string{"a@corp.com"}
+		}, 2},
+		{"ignored and in groups", func(cfg *Config) {
+			cfg.Groups = []string{"a@corp.com"}
+			cfg.IgnoreGroups = []string{"a@corp.com"}
+		}, 1},
+		{"known feature", func(cfg *Config) { cfg.Features = []string{string(FeatureSCIMGroupMembers)} }, 0},
+		{"unknown feature", func(cfg *Config) { cfg.Features = []string{"bulk_patch"} }, 1},
+		{"unknown overflow", func(cfg *Config) { cfg.GroupOverflow = "drop" }, 1},
+		{"offline without snapshot", func(cfg *Config) { cfg.Offline = true }, 1},
+		{"archived users", func(cfg *Config) { cfg.ArchivedUsers = ArchivedUsersIgnore }, 0},
+		{"unknown archived users policy", func(cfg *Config) { cfg.ArchivedUsers = "suspend" }, 1},
+		{"unknown missing names policy", func(cfg *Config) { cfg.MissingNames = "ignore" }, 1},
+		{"invalid missing name placeholder", func(cfg *Config) {
+			cfg.MissingNames = MissingNamesPlaceholder
+			cfg.MissingNamePlaceholder = "{{.Local"
+		}, 1},
+		{"oversized attributes", func(cfg *Config) { cfg.OversizedAttributes = OversizedAttributesTruncate }, 0},
+		{"unknown oversized attributes policy", func(cfg *Config) { cfg.OversizedAttributes = "cut" }, 1},
+		{"external members", func(cfg *Config) { cfg.ExternalMembers = ExternalMembersWarn }, 0},
+		{"unknown external members policy", func(cfg *Config) { cfg.ExternalMembers = "ignore" }, 1},
+		{"external members with users_groups", func(cfg *Config) {
+			cfg.SyncMethod = SyncMethodUsersGroups
+			cfg.ExternalMembers = ExternalMembersFail
+		}, 1},
+		{"approval without jira", func(cfg *Config) { cfg.ApprovalDeletionThreshold = 10 }, 1},
+		{"jira without project", func(cfg *Config) {
+			cfg.ApprovalDeletionThreshold = 10
+			cfg.JiraURL = "https://corp.atlassian.net"
+		}, 1},
+		{"held plans", func(cfg *Config) {
+			cfg.ApprovalDeletionThreshold = 10
+			cfg.ApprovalPlanURL = "s3://bucket/ssosync/plans/"
+			cfg.ApprovalSNSTopicARN = "arn:aws:sns:eu-west-1:123456789012:ssosync-approvals"
+		}, 0},
+		{"held plans without topic", func(cfg *Config) { cfg.ApprovalPlanURL = "s3://bucket/ssosync/plans/" }, 1},
+		{"negative max deletions", func(cfg *Config) { cfg.MaxGroupDeletions = -1 }, 1},
+		{"max deletion percent", func(cfg *Config) { cfg.MaxDeletionPercent = 10 }, 0},
+		{"max deletion percent over 100", func(cfg *Config) { cfg.MaxDeletionPercent = 150 }, 1},
+		{"regular expressions", func(cfg *Config) {
+			cfg.IgnoreUsers = []string{`re:.*-bots@corp\.com`}
+			cfg.SyncMethod = SyncMethodUsersGroups
+			cfg.IncludeGroups = []string{"re:aws-.*@corp\\.com"}
+		}, 0},
+		{"invalid regular expression", func(cfg *Config) { cfg.IgnoreGroups = []string{"re:aws-(.*"} }, 1},
+		{"globs", func(cfg *Config) {
+			cfg.SyncMethod, cfg.IncludeGroups = SyncMethodUsersGroups, []string{"aws-*@corp.com"}
+		}, 0},
+		{"invalid glob", func(cfg *Config) { cfg.IgnoreGroups = []string{"aws-[@corp.com"} }, 1},
+		{"group policies", func(cfg *Config) {
+			cfg.GroupPolicies = []GroupPolicy{
+				{Match: "finance@corp.com", NeverDeleteMembers: true, NeverDeleteGroup: true},
+				{Match: "re:audit-.*@corp\\.com", NeverDeleteGroup: true},
+			}
+		}, 0},
+		{"invalid group policies", func(cfg *Config) {
+			cfg.GroupPolicies = []GroupPolicy{{NeverDeleteGroup: true}, {Match: "finance@corp.com"}, {Match: "re:(", NeverDeleteMembers: true}}
+		}, 3},
+		{"group policies with users_groups", func(cfg *Config) {
+			cfg.SyncMethod = SyncMethodUsersGroups
+			cfg.GroupPolicies = []GroupPolicy{{Match: "finance@corp.com", NeverDeleteGroup: true}}
+		}, 1},
+		{"allowed domains", func(cfg *Config) { cfg.AllowedDomains = []string{"corp.com", "corp.co.uk"} }, 0},
+		{"allowed domain not a domain", func(cfg *Config) { cfg.AllowedDomains = []string{"@corp.com"} }, 1},
+		{"custom schema filters", func(cfg *Config) {
+			cfg.CustomSchemaFilters = []string{"customSchemas.Employment.syncToAWS=true", "customSchemas.Employment.costCenter=R&D"}
+		}, 0},
+		{"invalid custom schema filters", func(cfg *Config) {
+			cfg.CustomSchemaFilters = []string{"Employment.syncToAWS=true", "customSchemas.Employment=true", "customSchemas.Employment.syncToAWS"}
+		}, 3},
+		{"org units", func(cfg *Config) {
+			cfg.IncludeOrgUnits, cfg.IgnoreOrgUnits = []string{"/Employees"}, []string{"/Employees/Interns"}
+		}, 0},
+		{"org unit not a path", func(cfg *Config) { cfg.IgnoreOrgUnits = []string{"Contractors"} }, 1},
+		{"org unit included and ignored", func(cfg *Config) {
+			cfg.IncludeOrgUnits, cfg.IgnoreOrgUnits = []string{"/Contractors"}, []string{"/Contractors"}
+		}, 1},
+		{"profile", func(cfg *Config) { cfg.Pprof, cfg.PprofFile = ProfileTrace, "/tmp/ssosync.trace" }, 0},
+		{"unknown profile", func(cfg *Config) { cfg.Pprof = "block" }, 1},
+		{"profile file without profile", func(cfg *Config) { cfg.PprofFile = "/tmp/ssosync.pprof" }, 1},
+		{"scim transport", func(cfg *Config) { cfg.SCIMMaxConns, cfg.SCIMRequestTimeout = 16, 30*time.Second }, 0},
+		{"scim max conns under concurrency", func(cfg *Config) { cfg.SCIMMaxConns = 2 }, 1},
+		{"scim bulk size", func(cfg *Config) { cfg.SCIMBulkSize = 100 }, 0},
+		{"negative scim bulk size", func(cfg *Config) { cfg.SCIMBulkSize = -1 }, 1},
+		{"negative scim request timeout", func(cfg *Config) { cfg.SCIMRequestTimeout = -time.Second }, 1},
+		{"fault rates", func(cfg *Config) { cfg.FaultErrorRate, cfg.FaultThrottleRate = 0.1, 0.01 }, 0},
+		{"fault rate over 1", func(cfg *Config) { cfg.FaultErrorRate = 10 }, 1},
+		{"read profile without sigv4", func(cfg *Config) { cfg.SCIMReadAWSProfile = "readonly" }, 1},
+		{"watch", func(cfg *Config) {
+			cfg.WatchAddress = "https://example.execute-api.eu-west-1.amazonaws.com/prod/notifications"
+			cfg.WatchToken = "secret"
+		}, 0},
+		{"aws cache", func(cfg *Config) { cfg.AWSCacheFile = "/var/lib/ssosync/aws.json" }, 0},
+		{"aws cache with users_groups", func(cfg *Config) {
+			cfg.AWSCacheFile = "/var/lib/ssosync/aws.json"
+			cfg.SyncMethod = SyncMethodUsersGroups
+		}, 1},
+		{"aws cache never used", func(cfg *Config) { cfg.AWSCacheFile, cfg.AWSCacheTTL = "/var/lib/ssosync/aws.json", 0 }, 1},
+		{"watch over http", func(cfg *Config) { cfg.WatchAddress, cfg.WatchToken = "http://example.com/notifications", "secret" }, 1},
+		{"watch without token", func(cfg *Config) { cfg.WatchAddress = "https://example.com/notifications" }, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := New()
+			tt.edit(cfg)
+			assert.Len(t, Lint(cfg), tt.problems)
+		})
+	}
+}
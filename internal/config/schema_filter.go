@@ -0,0 +1,103 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// schemaFilterPrefix starts the custom schema filters
+const schemaFilterPrefix = "customSchemas."
+
+// SchemaFilter is a condition on a field of a custom schema of the Google
+// users, e.g. customSchemas.Employment.syncToAWS=true
+type SchemaFilter struct {
+	// Schema is the name of the custom schema
+	Schema string
+	// Field is the name of the field of the schema
+	Field string
+	// Value is the value the field must have
+	Value string
+}
+
+func (f SchemaFilter) String() string {
+	return fmt.Sprintf("%s%s.%s=%s", schemaFilterPrefix, f.Schema, f.Field, f.Value)
+}
+
+// ParseSchemaField parses a field of a custom schema written
+// customSchemas.<schema>.<field>
+func ParseSchemaField(path string) (schema string, field string, err error) {
+	parts := strings.Split(strings.TrimSpace(path), ".")
+	if len(parts) != 3 || parts[0]+"." != schemaFilterPrefix || parts[1] == "" || parts[2] == "" {
+		return "", "", fmt.Errorf("invalid custom schema field %q, expected %s<schema>.<field>", path, schemaFilterPrefix)
+	}
+	return parts[1], parts[2], nil
+}
+
+// ParseSchemaFilter parses a custom schema filter written
+// customSchemas.<schema>.<field>=<value>
+func ParseSchemaFilter(expr string) (SchemaFilter, error) {
+	invalid := fmt.Errorf("invalid custom schema filter %q, expected %s<schema>.<field>=<value>", expr, schemaFilterPrefix)
+	if !strings.HasPrefix(expr, schemaFilterPrefix) {
+		return SchemaFilter{}, invalid
+	}
+	kv := strings.SplitN(strings.TrimPrefix(expr, schemaFilterPrefix), "=", 2)
+	if len(kv) != 2 {
+		return SchemaFilter{}, invalid
+	}
+	path := strings.Split(strings.TrimSpace(kv[0]), ".")
+	if len(path) != 2 || path[0] == "" || path[1] == "" {
+		return SchemaFilter{}, invalid
+	}
+	return SchemaFilter{Schema: path[0], Field: path[1], Value: strings.TrimSpace(kv[1])}, nil
+}
+
+// SchemaNames returns the names of the custom schemas of the valid filters,
+// the schemas the Google users must be read with
+func SchemaNames(filters []string) []string {
+	return schemaNames(filters, nil)
+}
+
+// ReadSchemaNames returns the names of the custom schemas the Google users
+// must be read with, the ones of the valid custom schema filters and of the
+// sources of the user attributes
+func ReadSchemaNames(cfg *Config) []string {
+	return schemaNames(cfg.CustomSchemaFilters, cfg.UserAttributes)
+}
+
+// schemaNames returns the names of the custom schemas of the valid filters
+// and sources of attributes, once each
+func schemaNames(filters []string, attributes []UserAttribute) []string {
+	names := make([]string, 0, len(filters))
+	seen := make(map[string]bool, len(filters))
+	add := func(schema string) {
+		if !seen[schema] {
+			seen[schema] = true
+			names = append(names, schema)
+		}
+	}
+	for _, expr := range filters {
+		if f, err := ParseSchemaFilter(expr); err == nil {
+			add(f.Schema)
+		}
+	}
+	for _, a := range attributes {
+		if schema, _, err := ParseSchemaField(a.Source); a.Source != "" && err == nil {
+			add(schema)
+		}
+	}
+	return names
+}
@@ -41,6 +41,11 @@ func (s *Secrets) GoogleCredentials() (string, error) {
 	return s.getSecret("SSOSyncGoogleCredentials", false)
 }
 
+// Get returns the value of the secret with name, its name or ARN
+func (s *Secrets) Get(name string) (string, error) {
+	return s.getSecret(name, false)
+}
+
 func (s *Secrets) getSecret(secretKey string, optional bool) (string, error) {
 	r, err := s.svc.GetSecretValue(&secretsmanager.GetSecretValueInput{
 		SecretId:     aws.String(secretKey),
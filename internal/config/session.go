@@ -0,0 +1,17 @@
+package config
+
+import (
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+// NewAWSSession creates a session for calling native AWS APIs. Credentials
+// are resolved with the standard AWS credential chain: environment variables,
+// the shared config and credentials files (including SSO login sessions),
+// web identity, container credentials and the instance metadata service
+// (IMDSv2). If profile is not empty, the named shared config profile is used.
+func NewAWSSession(profile string) (*session.Session, error) {
+	return session.NewSessionWithOptions(session.Options{
+		Profile:           profile,
+		SharedConfigState: session.SharedConfigEnable,
+	})
+}
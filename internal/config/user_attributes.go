@@ -0,0 +1,146 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// The SCIM attributes of the AWS users user_attributes can derive from the
+// Google users
+const (
+	// UserAttributeGivenName is the given name of the user
+	UserAttributeGivenName = "name.givenName"
+	// UserAttributeFamilyName is the family name of the user
+	UserAttributeFamilyName = "name.familyName"
+	// UserAttributeDisplayName is the name of the user as displayed
+	UserAttributeDisplayName = "displayName"
+	// UserAttributeEmail is the value of the primary email of the user, its
+	// user name stays the primary email of the Google user
+	UserAttributeEmail = "email"
+	// UserAttributeTitle is the job title of the user
+	UserAttributeTitle = "title"
+	// UserAttributePreferredLanguage is the preferred language of the user,
+	// e.g. en-GB
+	UserAttributePreferredLanguage = "preferredLanguage"
+	// UserAttributeLocale is the locale of the user, e.g. en-GB
+	UserAttributeLocale = "locale"
+	// UserAttributeTimezone is the time zone of the user, e.g. Europe/London
+	UserAttributeTimezone = "timezone"
+	// UserAttributeEmployeeNumber is the employee number of the enterprise
+	// extension
+	UserAttributeEmployeeNumber = "enterprise.employeeNumber"
+	// UserAttributeCostCenter is the cost center of the enterprise extension
+	UserAttributeCostCenter = "enterprise.costCenter"
+	// UserAttributeOrganization is the organization of the enterprise
+	// extension
+	UserAttributeOrganization = "enterprise.organization"
+	// UserAttributeDivision is the division of the enterprise extension
+	UserAttributeDivision = "enterprise.division"
+	// UserAttributeDepartment is the department of the enterprise extension
+	UserAttributeDepartment = "enterprise.department"
+)
+
+// UserAttributeNames are the attributes user_attributes can set
+var UserAttributeNames = []string{
+	UserAttributeGivenName,
+	UserAttributeFamilyName,
+	UserAttributeDisplayName,
+	UserAttributeEmail,
+	UserAttributeTitle,
+	UserAttributePreferredLanguage,
+	UserAttributeLocale,
+	UserAttributeTimezone,
+	UserAttributeEmployeeNumber,
+	UserAttributeCostCenter,
+	UserAttributeOrganization,
+	UserAttributeDivision,
+	UserAttributeDepartment,
+}
+
+// UserAttribute derives a SCIM attribute of the AWS users from the Google
+// users, replacing the default mapping of this attribute
+type UserAttribute struct {
+	// Attribute is the SCIM attribute set, one of UserAttributeNames
+	Attribute string `mapstructure:"attribute"`
+	// Template is the Go template of the value, see Parse
+	Template string `mapstructure:"template"`
+	// Source is the field of a custom schema of the Google users the value
+	// is, customSchemas.<schema>.<field>, instead of a template
+	Source string `mapstructure:"source"`
+}
+
+// userAttributeFuncs are the functions of the templates of the attributes,
+// besides the ones of text/template
+var userAttributeFuncs = template.FuncMap{
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+	"trim":  strings.TrimSpace,
+	"replace": func(old string, new string, s string) string {
+		return strings.ReplaceAll(s, old, new)
+	},
+}
+
+// Parse returns the template of the attribute, which can use the functions
+// lower, upper, trim and replace, e.g. '{{.GivenName | upper}}'. The
+// template of a source is '{{.CustomSchemas.Field "<schema>" "<field>"}}'.
+// It fails when the attribute isn't one of UserAttributeNames, when it
+// hasn't either a template or a source, or when they are invalid.
+func (a UserAttribute) Parse() (*template.Template, error) {
+	known := false
+	for _, name := range UserAttributeNames {
+		known = known || a.Attribute == name
+	}
+	if !known {
+		return nil, fmt.Errorf("unknown user attribute %q, expected one of %s", a.Attribute, strings.Join(UserAttributeNames, ", "))
+	}
+	text := a.Template
+	switch {
+	case a.Source != "" && a.Template != "":
+		return nil, fmt.Errorf("user attribute %q has both a template and a source", a.Attribute)
+	case a.Source == "" && a.Template == "":
+		return nil, fmt.Errorf("user attribute %q has neither a template nor a source", a.Attribute)
+	case a.Source != "":
+		schema, field, err := ParseSchemaField(a.Source)
+		if err != nil {
+			return nil, err
+		}
+		text = fmt.Sprintf("{{.CustomSchemas.Field %q %q}}", schema, field)
+	}
+	return template.New(a.Attribute).Funcs(userAttributeFuncs).Parse(text)
+}
+
+// ParseUserName returns the template of the user name name: nil for
+// UserNameEmail, which keeps the primary email, '{{.Local}}' for
+// UserNameLocal, '{{.ID}}' for UserNameID, else name itself, a template with
+// the fields and functions of the templates of the user attributes.
+func ParseUserName(name string) (*template.Template, error) {
+	text := name
+	switch name {
+	case "", UserNameEmail:
+		return nil, nil
+	case UserNameLocal:
+		text = "{{.Local}}"
+	case UserNameID:
+		text = "{{.ID}}"
+	default:
+		if !strings.Contains(name, "{{") {
+			return nil, fmt.Errorf("unknown user name %q, expected %s, %s, %s or a template", name, UserNameEmail, UserNameLocal, UserNameID)
+		}
+	}
+	return template.New("userName").Funcs(userAttributeFuncs).Parse(text)
+}
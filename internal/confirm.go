@@ -0,0 +1,105 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// ErrChangesNotConfirmed is returned when the operator doesn't confirm the
+// destructive changes of a sync
+var ErrChangesNotConfirmed = errors.New("destructive changes not confirmed")
+
+// confirmSampleSize is the number of names of each kind of destructive
+// change shown to the operator
+const confirmSampleSize = 5
+
+// isTerminal tells whether f is a terminal. /dev/null is a character device
+// too, e.g. the standard input of cron jobs, it isn't a terminal.
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	if err != nil || fi.Mode()&os.ModeCharDevice == 0 {
+		return false
+	}
+	null, err := os.Stat(os.DevNull)
+	return err != nil || !os.SameFile(fi, null)
+}
+
+// confirmDestructiveChanges asks the operator to confirm the deletions of
+// users and groups and the removals of members of changes, when run in a
+// terminal and unless confirmation is skipped
+func (s *syncGSuite) confirmDestructiveChanges(changes *changeSet) error {
+	if s.cfg.Yes || s.cfg.DryRun || !isTerminal(os.Stdin) {
+		return nil
+	}
+	if !confirmChanges(os.Stdin, os.Stdout, changes) {
+		return ErrChangesNotConfirmed
+	}
+	return nil
+}
+
+// confirmChanges writes the counts and a sample of the destructive changes
+// to out and reads the answer of the operator from in. It returns true when
+// there is no destructive change, or when the operator answered yes.
+func confirmChanges(in io.Reader, out io.Writer, changes *changeSet) bool {
+	users := make([]string, 0, len(changes.deleteUsers))
+	for _, u := range changes.deleteUsers {
+		users = append(users, u.Username)
+	}
+	groups := make([]string, 0, len(changes.deleteGroups))
+	for _, g := range changes.deleteGroups {
+		groups = append(groups, g.DisplayName)
+	}
+	members := make([]string, 0)
+	for group, removed := range changes.removeMembers {
+		for _, u := range removed {
+			members = append(members, fmt.Sprintf("%s from %s", u.Username, group))
+		}
+	}
+	if len(users)+len(groups)+len(members) == 0 {
+		return true
+	}
+
+	fmt.Fprintln(out, "The sync will make the following destructive changes:")
+	writeSample(out, "user deletion(s)", users)
+	writeSample(out, "group deletion(s)", groups)
+	writeSample(out, "membership removal(s)", members)
+	fmt.Fprint(out, "Apply them? [y/N] ")
+	answer, _ := bufio.NewReader(in).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+// writeSample writes the count of names and the first ones, sorted
+func writeSample(out io.Writer, what string, names []string) {
+	if len(names) == 0 {
+		return
+	}
+	sort.Strings(names)
+	fmt.Fprintf(out, "  %d %s:\n", len(names), what)
+	for i, name := range names {
+		if i == confirmSampleSize {
+			fmt.Fprintf(out, "    ... and %d more\n", len(names)-confirmSampleSize)
+			break
+		}
+		fmt.Fprintf(out, "    - %s\n", name)
+	}
+}
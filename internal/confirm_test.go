@@ -0,0 +1,72 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/awslabs/ssosync/internal/aws"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfirmChanges(t *testing.T) {
+	var out bytes.Buffer
+
+	// nothing to confirm
+	assert.True(t, confirmChanges(strings.NewReader(""), &out, &changeSet{}))
+	assert.Empty(t, out.String())
+
+	changes := &changeSet{
+		deleteUsers: []*aws.User{
+			{Username: "f@example.com"}, {Username: "e@example.com"}, {Username: "d@example.com"},
+			{Username: "c@example.com"}, {Username: "b@example.com"}, {Username: "a@example.com"},
+		},
+		removeMembers: map[string][]*aws.User{"dev": {{Username: "a@example.com"}}},
+	}
+	assert.True(t, confirmChanges(strings.NewReader("yes\n"), &out, changes))
+	assert.Equal(t, `The sync will make the following destructive changes:
+  6 user deletion(s):
+    - a@example.com
+    - b@example.com
+    - c@example.com
+    - d@example.com
+    - e@example.com
+    ... and 1 more
+  1 membership removal(s):
+    - a@example.com from dev
+Apply them? [y/N] `, out.String())
+
+	assert.True(t, confirmChanges(strings.NewReader("Y\n"), &out, changes))
+	assert.False(t, confirmChanges(strings.NewReader("\n"), &out, changes))
+	assert.False(t, confirmChanges(strings.NewReader("no\n"), &out, changes))
+	assert.False(t, confirmChanges(strings.NewReader(""), &out, changes))
+}
+
+func TestIsTerminal(t *testing.T) {
+	null, err := os.Open(os.DevNull)
+	assert.NoError(t, err)
+	defer null.Close()
+	assert.False(t, isTerminal(null))
+
+	f, err := ioutil.TempFile("", "ssosync")
+	assert.NoError(t, err)
+	defer os.Remove(f.Name())
+	defer f.Close()
+	assert.False(t, isTerminal(f))
+}
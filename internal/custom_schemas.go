@@ -0,0 +1,139 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/awslabs/ssosync/internal/config"
+	"github.com/awslabs/ssosync/internal/google"
+	admin "google.golang.org/api/admin/directory/v1"
+	"google.golang.org/api/googleapi"
+)
+
+// suspension is the reason a suspended user is out of scope
+const suspension = "suspension"
+
+// archival is the reason an archived user is out of scope with
+// --archived-users delete, its AWS user is deleted
+const archival = "archival"
+
+// untouchedArchival is the reason an archived user is out of scope with
+// --archived-users ignore, its AWS user is left as it is
+const untouchedArchival = "archival, left untouched"
+
+// outOfScope returns why the Google user is out of the scope of the sync by
+// its attributes, its organizational unit, its custom schemas, its archival
+// or its suspension, "" when it is in scope
+func (s *syncGSuite) outOfScope(u *admin.User) string {
+	if s.ignoreOrgUnit(u) {
+		return "organizational unit " + u.OrgUnitPath
+	}
+	for _, expr := range s.cfg.CustomSchemaFilters {
+		// an invalid filter, reported by the lint, matches no user
+		f, err := config.ParseSchemaFilter(expr)
+		if err != nil || !matchesSchemaFilter(u, f) {
+			return "custom schema filter " + expr
+		}
+	}
+	if google.StatusOf(u) == google.UserArchived {
+		switch s.cfg.ArchivedUsers {
+		case config.ArchivedUsersDelete:
+			return archival
+		case config.ArchivedUsersIgnore:
+			return untouchedArchival
+		}
+	}
+	if s.cfg.SkipSuspendedUsers && u.Suspended {
+		return suspension
+	}
+	return ""
+}
+
+// matchesSchemaFilter tells if the field of the custom schema of u has the
+// value of f. The values of a multi-valued field are matched each, the
+// booleans are compared without case.
+func matchesSchemaFilter(u *admin.User, f config.SchemaFilter) bool {
+	raw, ok := u.CustomSchemas[f.Schema]
+	if !ok {
+		return false
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return false
+	}
+	return schemaValueEquals(fields[f.Field], f.Value)
+}
+
+// schemaValueEquals tells if the value of a custom schema field is want
+func schemaValueEquals(v interface{}, want string) bool {
+	switch v := v.(type) {
+	case nil:
+		return false
+	case []interface{}:
+		// multi-valued fields are lists of {"value": ..., "type": ...}
+		for _, e := range v {
+			if m, ok := e.(map[string]interface{}); ok && schemaValueEquals(m["value"], want) {
+				return true
+			}
+		}
+		return false
+	case bool:
+		return strings.EqualFold(fmt.Sprint(v), want)
+	default:
+		return fmt.Sprint(v) == want
+	}
+}
+
+// customSchemas are the custom schemas of a Google user, by name
+type customSchemas map[string]googleapi.RawMessage
+
+// Field returns the value of field of schema, "" when the user has none.
+// The values of a multi-valued field are joined with commas.
+func (c customSchemas) Field(schema string, field string) string {
+	raw, ok := c[schema]
+	if !ok {
+		return ""
+	}
+	var fields map[string]interface{}
+	d := json.NewDecoder(bytes.NewReader(raw))
+	// the numbers are kept as written, e.g. no 1.234e+06
+	d.UseNumber()
+	if err := d.Decode(&fields); err != nil {
+		return ""
+	}
+	return schemaValueString(fields[field])
+}
+
+// schemaValueString returns the value of a custom schema field as a string
+func schemaValueString(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, e := range v {
+			if m, ok := e.(map[string]interface{}); ok && m["value"] != nil {
+				values = append(values, schemaValueString(m["value"]))
+			}
+		}
+		return strings.Join(values, ",")
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,74 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"testing"
+
+	"github.com/awslabs/ssosync/internal/config"
+	googlefake "github.com/awslabs/ssosync/internal/google/fake"
+	"github.com/stretchr/testify/assert"
+	admin "google.golang.org/api/admin/directory/v1"
+	"google.golang.org/api/googleapi"
+)
+
+func Test_outOfScopeCustomSchemas(t *testing.T) {
+	withSchemas := func(email string, schemas string) *admin.User {
+		u := googlefake.User(email)
+		u.CustomSchemas = map[string]googleapi.RawMessage{"Employment": googleapi.RawMessage(schemas)}
+		return u
+	}
+	users := []*admin.User{
+		withSchemas("flagged@email.com", `{"syncToAWS": true, "costCenter": "R&D"}`),
+		withSchemas("other-center@email.com", `{"syncToAWS": true, "costCenter": "Sales"}`),
+		withSchemas("not-flagged@email.com", `{"syncToAWS": false}`),
+		withSchemas("multi@email.com", `{"syncToAWS": true, "costCenter": [{"value": "Sales"}, {"value": "R&D"}]}`),
+		googlefake.User("no-schema@email.com"),
+	}
+	tests := []struct {
+		name    string
+		filters []string
+		want    []string
+	}{
+		{"none", nil, []string{"flagged@email.com", "other-center@email.com", "not-flagged@email.com", "multi@email.com", "no-schema@email.com"}},
+		{"flag", []string{"customSchemas.Employment.syncToAWS=true"}, []string{"flagged@email.com", "other-center@email.com", "multi@email.com"}},
+		{"all filters", []string{"customSchemas.Employment.syncToAWS=true", "customSchemas.Employment.costCenter=R&D"}, []string{"flagged@email.com", "multi@email.com"}},
+		{"invalid", []string{"Employment.syncToAWS=true"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.New()
+			cfg.CustomSchemaFilters = tt.filters
+			s := newSyncGSuite(cfg, nil, nil, nil)
+			var got []string
+			for _, u := range users {
+				if s.outOfScope(u) == "" {
+					got = append(got, u.PrimaryEmail)
+				}
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_customSchemasField(t *testing.T) {
+	c := customSchemas{"Employment": googleapi.RawMessage(`{"id": 1234567, "costCenter": "R&D", "remote": true, "sites": [{"value": "London"}, {"value": "Cambridge"}]}`)}
+	assert.Equal(t, "1234567", c.Field("Employment", "id"))
+	assert.Equal(t, "R&D", c.Field("Employment", "costCenter"))
+	assert.Equal(t, "true", c.Field("Employment", "remote"))
+	assert.Equal(t, "London,Cambridge", c.Field("Employment", "sites"))
+	assert.Equal(t, "", c.Field("Employment", "level"))
+	assert.Equal(t, "", c.Field("HR", "id"))
+}
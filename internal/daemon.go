@@ -0,0 +1,142 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	"github.com/awslabs/ssosync/internal/config"
+	"github.com/awslabs/ssosync/internal/schedule"
+	"github.com/fsnotify/fsnotify"
+	log "github.com/sirupsen/logrus"
+)
+
+// ErrScheduleNotSpecified is returned when the daemon is run without a schedule
+var ErrScheduleNotSpecified = errors.New("schedule not specified")
+
+// runDaemon calls run at every time of the schedule until ctx is done. A
+// failed run is logged and doesn't stop the daemon.
+func runDaemon(ctx context.Context, s schedule.Schedule, now func() time.Time, run func(context.Context) error) error {
+	for {
+		next := s.Next(now())
+		if next.IsZero() {
+			return errors.New("the schedule has no next run")
+		}
+		log.WithField("next", next.Format(time.RFC3339)).Info("Waiting for the next scheduled sync")
+
+		timer := time.NewTimer(next.Sub(now()))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			log.Info("Daemon stopped")
+			return nil
+		case <-timer.C:
+		}
+
+		if err := run(ctx); err != nil {
+			log.WithError(err).Error("Scheduled sync failed")
+		}
+	}
+}
+
+// watchConfigFile sets changed when the config file at path is written,
+// created, renamed or removed, until ctx is done. Its directory is watched,
+// as editors and Kubernetes ConfigMap volumes replace the file rather than
+// write it, the latter by swapping the ..data symbolic link.
+func watchConfigFile(ctx context.Context, path string, changed *int32) error {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	if err := w.Add(filepath.Dir(path)); err != nil {
+		w.Close()
+		return err
+	}
+	go func() {
+		defer w.Close()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case e, ok := <-w.Events:
+				if !ok {
+					return
+				}
+				if filepath.Clean(e.Name) == filepath.Clean(path) || filepath.Base(e.Name) == "..data" {
+					atomic.StoreInt32(changed, 1)
+				}
+			case err, ok := <-w.Errors:
+				if !ok {
+					return
+				}
+				log.WithError(err).Warn("Error watching the config file")
+			}
+		}
+	}()
+	return nil
+}
+
+// reloadConfig reads the configuration again with reload, which leaves cfg
+// unchanged when the new configuration is invalid
+func reloadConfig(cfg *config.Config, reload func() error) {
+	schedule := cfg.Schedule
+	if err := reload(); err != nil {
+		log.WithError(err).Error("Invalid configuration, keeping the current one")
+		return
+	}
+	if cfg.Schedule != schedule {
+		log.WithField("schedule", schedule).Warn("The schedule can't be reloaded, restart the daemon to change it")
+	}
+	log.Info("Configuration reloaded")
+}
+
+// DoDaemon runs a sync at every time of cfg.Schedule until ctx is done. If
+// configFile is not empty, the configuration is read again with reload
+// before the next sync when the file changes, so the filters and thresholds
+// can be changed without restarting the daemon.
+func DoDaemon(ctx context.Context, cfg *config.Config, configFile string, reload func() error) error {
+	if cfg.Schedule == "" {
+		return ErrScheduleNotSpecified
+	}
+	s, err := schedule.Parse(cfg.Schedule)
+	if err != nil {
+		return err
+	}
+	log.WithField("schedule", cfg.Schedule).Info("Starting daemon")
+
+	var changed int32
+	if configFile != "" && reload != nil {
+		if err := watchConfigFile(ctx, configFile, &changed); err != nil {
+			return err
+		}
+		log.WithField("file", configFile).Info("Watching the config file for changes")
+	}
+	return runDaemon(ctx, s, time.Now, func(ctx context.Context) error {
+		// the changes are applied between two runs, never during one
+		if atomic.CompareAndSwapInt32(&changed, 1, 0) {
+			reloadConfig(cfg, reload)
+		}
+		// nobody is there to confirm the changes of scheduled runs
+		cfg.Yes = true
+		// every run has its own id
+		cfg.RunID = ""
+		_, err := DoSync(ctx, cfg)
+		return err
+	})
+}
@@ -0,0 +1,89 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/awslabs/ssosync/internal/config"
+	"github.com/awslabs/ssosync/internal/schedule"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunDaemon(t *testing.T) {
+	s, err := schedule.Parse("every 10ms")
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	runs := 0
+	err = runDaemon(ctx, s, time.Now, func(context.Context) error {
+		runs++
+		if runs == 3 {
+			cancel()
+		}
+		// failed runs don't stop the daemon
+		return errors.New("failed")
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, runs)
+}
+
+func TestDoDaemon_InvalidSchedule(t *testing.T) {
+	cfg := config.New()
+	assert.Equal(t, ErrScheduleNotSpecified, DoDaemon(context.Background(), cfg, "", nil))
+
+	cfg.Schedule = "every weekday 07:00 Nowhere/Land"
+	assert.Error(t, DoDaemon(context.Background(), cfg, "", nil))
+}
+
+func TestWatchConfigFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, config.DefaultConfigFile)
+	assert.NoError(t, ioutil.WriteFile(path, []byte("max_user_deletions: 2\n"), 0600))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var changed int32
+	assert.NoError(t, watchConfigFile(ctx, path, &changed))
+
+	// the other files of the directory are not watched
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "other.yaml"), nil, 0600))
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, int32(0), atomic.LoadInt32(&changed))
+
+	assert.NoError(t, ioutil.WriteFile(path, []byte("max_user_deletions: 5\n"), 0600))
+	assert.Eventually(t, func() bool { return atomic.LoadInt32(&changed) == 1 }, time.Second, 10*time.Millisecond)
+}
+
+func Test_reloadConfig(t *testing.T) {
+	cfg := config.New()
+	reloadConfig(cfg, func() error {
+		cfg.MaxUserDeletions = 5
+		return nil
+	})
+	assert.Equal(t, 5, cfg.MaxUserDeletions)
+
+	// the reload restores the configuration when it fails
+	reloadConfig(cfg, func() error { return errors.New("invalid") })
+	assert.Equal(t, 5, cfg.MaxUserDeletions)
+}
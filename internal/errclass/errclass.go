@@ -0,0 +1,88 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package errclass classifies the errors of the AWS SSO and Google Workspace
+// APIs, so a failure can be reported and handled by its cause rather than by
+// its status code
+package errclass
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+)
+
+// Class is the class of an error of a provider API
+type Class string
+
+const (
+	// Auth is the class of the errors of missing, invalid or unauthorized
+	// credentials
+	Auth Class = "auth"
+	// Quota is the class of the errors of rate limits and exhausted quotas
+	Quota Class = "quota"
+	// Validation is the class of the errors of requests rejected as invalid,
+	// or of entities not found
+	Validation Class = "validation"
+	// Conflict is the class of the errors of entities which already exist or
+	// were changed concurrently
+	Conflict Class = "conflict"
+	// Transient is the class of the server errors and network failures,
+	// which a later run may not have
+	Transient Class = "transient"
+)
+
+// Classes are the classes of the errors, in the order of their exit codes
+var Classes = []Class{Auth, Quota, Validation, Conflict, Transient}
+
+// Classifier is implemented by the errors of the provider clients
+type Classifier interface {
+	ErrorClass() Class
+}
+
+// FromStatus returns the class of an error response with the HTTP status
+// code, "" when the status isn't an error
+func FromStatus(code int) Class {
+	switch {
+	case code == http.StatusUnauthorized, code == http.StatusForbidden:
+		return Auth
+	case code == http.StatusTooManyRequests:
+		return Quota
+	case code == http.StatusConflict, code == http.StatusPreconditionFailed:
+		return Conflict
+	case code == http.StatusRequestTimeout, code >= http.StatusInternalServerError:
+		return Transient
+	case code >= http.StatusBadRequest:
+		return Validation
+	default:
+		return ""
+	}
+}
+
+// Of returns the class of err, "" when it isn't an error of a provider
+func Of(err error) Class {
+	var c Classifier
+	var netErr net.Error
+	switch {
+	case err == nil, errors.Is(err, context.Canceled):
+		return ""
+	case errors.As(err, &c):
+		return c.ErrorClass()
+	case errors.As(err, &netErr):
+		return Transient
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,59 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package errclass
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type statusError int
+
+func (e statusError) Error() string { return fmt.Sprintf("status %d", int(e)) }
+
+func (e statusError) ErrorClass() Class { return FromStatus(int(e)) }
+
+func TestFromStatus(t *testing.T) {
+	tests := map[int]Class{
+		200: "",
+		204: "",
+		400: Validation,
+		401: Auth,
+		403: Auth,
+		404: Validation,
+		409: Conflict,
+		429: Quota,
+		500: Transient,
+		503: Transient,
+	}
+	for code, want := range tests {
+		assert.Equal(t, want, FromStatus(code), "status %d", code)
+	}
+}
+
+func TestOf(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal(Class(""), Of(nil))
+	assert.Equal(Class(""), Of(errors.New("parsing failed")))
+	assert.Equal(Class(""), Of(context.Canceled))
+	assert.Equal(Quota, Of(fmt.Errorf("creating user: %w", statusError(429))))
+	assert.Equal(Transient, Of(&net.OpError{Op: "dial", Err: errors.New("connection refused")}))
+}
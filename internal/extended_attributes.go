@@ -0,0 +1,184 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/awslabs/ssosync/internal/aws"
+	admin "google.golang.org/api/admin/directory/v1"
+)
+
+// extendedAttributes are the attributes of a user synced with
+// --sync-extended-attributes, the ones of AWS SSO keeping a single phone
+// number and address
+type extendedAttributes struct {
+	Phone      string             `json:"phone"`
+	PhoneType  string             `json:"phoneType"`
+	Title      string             `json:"title"`
+	Enterprise aws.EnterpriseUser `json:"enterprise"`
+	Manager    string             `json:"manager"`
+	Address    aws.UserAddress    `json:"address"`
+}
+
+// extendedAttributesOf returns the extended attributes of the AWS user u
+func extendedAttributesOf(u *aws.User) extendedAttributes {
+	a := extendedAttributes{Title: u.Title}
+	if len(u.PhoneNumbers) > 0 {
+		a.Phone, a.PhoneType = u.PhoneNumbers[0].Value, u.PhoneNumbers[0].Type
+	}
+	if u.Enterprise != nil {
+		a.Enterprise = *u.Enterprise
+		if a.Enterprise.Manager != nil {
+			a.Manager = a.Enterprise.Manager.Value
+		}
+		a.Enterprise.Manager = nil
+	}
+	if len(u.Addresses) > 0 {
+		a.Address = u.Addresses[0]
+		// ssosync always sends a work address, even an empty one
+		a.Address.Type, a.Address.Primary = "", false
+	}
+	return a
+}
+
+// String returns the attributes in a canonical form, for the hash of a user
+func (a extendedAttributes) String() string {
+	b, _ := json.Marshal(a)
+	return string(b)
+}
+
+// decodeUserField decodes the field v of a Google user, e.g. its phones,
+// which the Directory API leaves undecoded, into out
+func decodeUserField(v interface{}, out interface{}) bool {
+	if v == nil {
+		return false
+	}
+	b, err := json.Marshal(v)
+	return err == nil && json.Unmarshal(b, out) == nil
+}
+
+// primaryIndex returns the index of the primary value of n values, else the
+// first one, -1 when there is none
+func primaryIndex(n int, primary func(i int) bool) int {
+	for i := 0; i < n; i++ {
+		if primary(i) {
+			return i
+		}
+	}
+	if n == 0 {
+		return -1
+	}
+	return 0
+}
+
+// scimPhoneType returns the SCIM type of the phone number of a Google type
+func scimPhoneType(t string) string {
+	switch {
+	case strings.HasSuffix(t, "fax"):
+		return "fax"
+	case strings.HasSuffix(t, "pager"):
+		return "pager"
+	case strings.HasSuffix(t, "mobile"):
+		return "mobile"
+	case t == "home" || t == "work":
+		return t
+	default:
+		return "other"
+	}
+}
+
+// withExtendedAttributes sets the phone number, the title, the address and
+// the enterprise extension of the Google user gUser to u, and returns u. The
+// primary phone number, organization and address are synced, else the first
+// ones. The manager is the AWS user whose id managerID returns for the email
+// of the manager, none when it returns "".
+func withExtendedAttributes(u *aws.User, gUser *admin.User, managerID func(email string) string) *aws.User {
+	var e aws.EnterpriseUser
+	var phones []admin.UserPhone
+	if decodeUserField(gUser.Phones, &phones) {
+		if i := primaryIndex(len(phones), func(i int) bool { return phones[i].Primary }); i >= 0 {
+			u.PhoneNumbers = []aws.UserPhoneNumber{{Value: phones[i].Value, Type: scimPhoneType(phones[i].Type), Primary: true}}
+		}
+	}
+	var orgs []admin.UserOrganization
+	if decodeUserField(gUser.Organizations, &orgs) {
+		if i := primaryIndex(len(orgs), func(i int) bool { return orgs[i].Primary }); i >= 0 {
+			u.Title = orgs[i].Title
+			e.Department, e.CostCenter, e.Division = orgs[i].Department, orgs[i].CostCenter, orgs[i].Name
+		}
+	}
+	var ids []admin.UserExternalId
+	if decodeUserField(gUser.ExternalIds, &ids) {
+		for _, id := range ids {
+			if id.Type == "organization" {
+				e.EmployeeNumber = id.Value
+				break
+			}
+		}
+	}
+	var relations []admin.UserRelation
+	if decodeUserField(gUser.Relations, &relations) {
+		for _, r := range relations {
+			if r.Type == "manager" {
+				if id := managerID(r.Value); id != "" {
+					e.Manager = &aws.EnterpriseManager{Value: id}
+				}
+				break
+			}
+		}
+	}
+	if e != (aws.EnterpriseUser{}) {
+		u.SetEnterprise(&e)
+	}
+	var addresses []admin.UserAddress
+	if decodeUserField(gUser.Addresses, &addresses) {
+		if i := primaryIndex(len(addresses), func(i int) bool { return addresses[i].Primary }); i >= 0 {
+			a := addresses[i]
+			u.Addresses = []aws.UserAddress{{
+				Type:          "work",
+				Formatted:     a.Formatted,
+				StreetAddress: a.StreetAddress,
+				Locality:      a.Locality,
+				Region:        a.Region,
+				PostalCode:    a.PostalCode,
+				Country:       a.Country,
+				Primary:       true,
+			}}
+		}
+	}
+	return u
+}
+
+// copyExtendedAttributes sets the extended attributes of src to dst
+func copyExtendedAttributes(dst *aws.User, src *aws.User) {
+	dst.PhoneNumbers, dst.Title, dst.Addresses = src.PhoneNumbers, src.Title, src.Addresses
+	if src.Enterprise == nil {
+		dst.SetEnterprise(nil)
+		return
+	}
+	e := *src.Enterprise
+	dst.SetEnterprise(&e)
+}
+
+// awsUserID returns the id of the AWS user with email, "" when there is none
+func (s *syncGSuite) awsUserID(email string) string {
+	u, err := s.aws.FindUserByEmail(email)
+	if err != nil || u == nil {
+		return ""
+	}
+	return u.ID
+}
@@ -0,0 +1,118 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/awslabs/ssosync/internal/aws"
+	awsfake "github.com/awslabs/ssosync/internal/aws/fake"
+	"github.com/awslabs/ssosync/internal/config"
+	googlefake "github.com/awslabs/ssosync/internal/google/fake"
+	"github.com/stretchr/testify/assert"
+	admin "google.golang.org/api/admin/directory/v1"
+)
+
+// extendedUser returns a Google user with phones, organizations and
+// addresses, decoded from JSON like the users of the Directory API
+func extendedUser(t *testing.T, email string) *admin.User {
+	u := googlefake.User(email)
+	err := json.Unmarshal([]byte(`{
+		"phones": [
+			{"value": "+44 20 7946 0000", "type": "work"},
+			{"value": "+44 7700 900000", "type": "work_mobile", "primary": true}
+		],
+		"organizations": [{"name": "Research", "title": "Engineer", "department": "Platform", "costCenter": "CC-42", "primary": true}],
+		"addresses": [{"type": "work", "locality": "London", "postalCode": "EC1A 1BB", "country": "United Kingdom"}],
+		"externalIds": [{"value": "L-1", "type": "login_id"}, {"value": "E-1234", "type": "organization"}],
+		"relations": [{"value": "m@email.com", "type": "manager"}]
+	}`), u)
+	assert.NoError(t, err)
+	return u
+}
+
+func Test_withExtendedAttributes(t *testing.T) {
+	managerID := func(email string) string {
+		if email == "m@email.com" {
+			return "user-m"
+		}
+		return ""
+	}
+	u := (&userMapping{extended: true}).user(extendedUser(t, "a@email.com"), managerID)
+	assert.Equal(t, []aws.UserPhoneNumber{{Value: "+44 7700 900000", Type: "mobile", Primary: true}}, u.PhoneNumbers)
+	assert.Equal(t, "Engineer", u.Title)
+	assert.Equal(t, &aws.EnterpriseUser{
+		EmployeeNumber: "E-1234",
+		CostCenter:     "CC-42",
+		Division:       "Research",
+		Department:     "Platform",
+		Manager:        &aws.EnterpriseManager{Value: "user-m"},
+	}, u.Enterprise)
+	assert.Contains(t, u.Schemas, aws.EnterpriseUserSchema)
+	assert.Equal(t, []aws.UserAddress{{Type: "work", Locality: "London", PostalCode: "EC1A 1BB", Country: "United Kingdom", Primary: true}}, u.Addresses)
+
+	unknown := (&userMapping{extended: true}).user(extendedUser(t, "a@email.com"), func(string) string { return "" })
+	assert.Nil(t, unknown.Enterprise.Manager)
+
+	plain := (&userMapping{}).user(extendedUser(t, "a@email.com"), nil)
+	want := aws.NewUser("a", "a", "a@email.com", true)
+	want.ExternalID = "id-a@email.com"
+	assert.Equal(t, want, plain)
+}
+
+func Test_copyExtendedAttributes(t *testing.T) {
+	dst := aws.NewUser("a", "a", "a@email.com", true)
+	dst.Title = "Intern"
+	dst.SetEnterprise(&aws.EnterpriseUser{Department: "Sales"})
+	copyExtendedAttributes(dst, aws.NewUser("a", "a", "a@email.com", true))
+	assert.Empty(t, dst.Title)
+	assert.Nil(t, dst.Enterprise)
+	assert.NotContains(t, dst.Schemas, aws.EnterpriseUserSchema)
+
+	src := (&userMapping{extended: true}).user(extendedUser(t, "a@email.com"), func(string) string { return "user-m" })
+	copyExtendedAttributes(dst, src)
+	assert.Equal(t, extendedAttributesOf(src), extendedAttributesOf(dst))
+}
+
+func TestSyncGroupsUsersExtendedAttributes(t *testing.T) {
+	googleClient := googlefake.NewClient().
+		WithUsers(extendedUser(t, "a@email.com"), googlefake.User("m@email.com")).
+		WithGroup(googlefake.Group("aws-dev@email.com"), "a@email.com", "m@email.com")
+	awsClient := awsfake.NewClient().
+		WithUsers(syncedUser("a@email.com"), syncedUser("m@email.com")).
+		WithGroup(aws.NewGroup("aws-dev"), "a@email.com", "m@email.com")
+	cfg := config.New()
+	cfg.Yes = true
+
+	changes, err := newSyncGSuite(cfg, awsClient, googleClient, nil).getChanges(nil)
+	assert.NoError(t, err)
+	assert.Empty(t, changes.updateUsers)
+
+	cfg.SyncExtendedAttributes = true
+	assert.NoError(t, newSyncGSuite(cfg, awsClient, googleClient, nil).SyncGroupsUsers(nil))
+	u, err := awsClient.FindUserByEmail("a@email.com")
+	assert.NoError(t, err)
+	assert.Equal(t, "Engineer", u.Title)
+	assert.Equal(t, "+44 7700 900000", u.PhoneNumbers[0].Value)
+	m, err := awsClient.FindUserByEmail("m@email.com")
+	assert.NoError(t, err)
+	assert.Equal(t, &aws.EnterpriseManager{Value: m.ID}, u.Enterprise.Manager)
+	assert.Equal(t, "E-1234", u.Enterprise.EmployeeNumber)
+
+	changes, err = newSyncGSuite(cfg, awsClient, googleClient, nil).getChanges(nil)
+	assert.NoError(t, err)
+	assert.Empty(t, changes.updateUsers)
+}
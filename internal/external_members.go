@@ -0,0 +1,68 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/awslabs/ssosync/internal/config"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ErrExternalMembers is returned when Google groups have members who aren't
+// users of the Workspace and --external-members is fail
+var ErrExternalMembers = errors.New("google groups with external members")
+
+// externalMember is a member of a Google group without a user in the
+// Workspace, e.g. an address of another domain
+type externalMember struct {
+	email string
+	group string
+}
+
+func (m externalMember) String() string {
+	return fmt.Sprintf("%s (group %s)", m.email, m.group)
+}
+
+// handleExternalMembers applies the --external-members policy to the members
+// of the groups who aren't users of the Workspace: they are left out of the
+// groups, logged at debug level with skip or with a warning with warn, and
+// all of them are listed in the error with fail
+func (s *syncGSuite) handleExternalMembers(members []externalMember) error {
+	switch s.cfg.ExternalMembers {
+	case config.ExternalMembersFail:
+		if len(members) == 0 {
+			return nil
+		}
+		listed := make([]string, 0, len(members))
+		for _, m := range members {
+			listed = append(listed, m.String())
+		}
+		log.WithField("members", listed).Error("Groups with members who aren't users of Google Workspace, see --external-members")
+		return fmt.Errorf("%w: %s", ErrExternalMembers, strings.Join(listed, ", "))
+	case config.ExternalMembersWarn:
+		for _, m := range members {
+			log.WithFields(log.Fields{"email": m.email, "group": m.group}).Warn("Skipping group member who isn't a user of Google Workspace")
+		}
+	default:
+		for _, m := range members {
+			log.WithFields(log.Fields{"email": m.email, "group": m.group}).Debug("Ignoring Unknown User")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/awslabs/ssosync/internal/config"
+	googlefake "github.com/awslabs/ssosync/internal/google/fake"
+	"github.com/stretchr/testify/assert"
+	admin "google.golang.org/api/admin/directory/v1"
+)
+
+func Test_handleExternalMembers(t *testing.T) {
+	group := googlefake.Group("aws-dev@email.com")
+	googleClient := googlefake.NewClient().
+		WithUsers(googlefake.User("a@email.com")).
+		WithGroup(group, "a@email.com", "partner@other.com", "vendor@other.com")
+
+	for _, policy := range []string{config.ExternalMembersSkip, config.ExternalMembersWarn} {
+		cfg := config.New()
+		cfg.ExternalMembers = policy
+		_, groupsUsers, err := newSyncGSuite(cfg, nil, googleClient, nil).getGoogleGroupsAndUsers([]*admin.Group{group})
+		assert.NoError(t, err, policy)
+		if assert.Len(t, groupsUsers["aws-dev"], 1, policy) {
+			assert.Equal(t, "a@email.com", groupsUsers["aws-dev"][0].PrimaryEmail)
+		}
+	}
+
+	cfg := config.New()
+	cfg.ExternalMembers = config.ExternalMembersFail
+	_, _, err := newSyncGSuite(cfg, nil, googleClient, nil).getGoogleGroupsAndUsers([]*admin.Group{group})
+	assert.True(t, errors.Is(err, ErrExternalMembers))
+	assert.Contains(t, err.Error(), "partner@other.com (group aws-dev), vendor@other.com (group aws-dev)")
+}
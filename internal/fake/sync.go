@@ -0,0 +1,87 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package fake provides a SyncGSuite recording its calls, to test the code
+// starting the syncs without Google Workspace nor AWS SSO. The fakes of the
+// clients are in the fake packages of aws and google.
+package fake
+
+import (
+	"sync"
+
+	"github.com/awslabs/ssosync/internal"
+)
+
+// Call is a call of a SyncGSuite method, with its arguments
+type Call struct {
+	// Method is the name of the method, e.g. SyncGroupsUsers
+	Method string
+	// Query is the users query of SyncUsers
+	Query string
+	// Email is the email of the user of SyncUser
+	Email string
+	// Queries are the groups queries of the other methods
+	Queries []string
+}
+
+// SyncGSuite is an internal.SyncGSuite recording its calls instead of
+// syncing, every call returns Err
+type SyncGSuite struct {
+	// Err is returned by every call, e.g. to test the handling of failed syncs
+	Err error
+
+	mu    sync.Mutex
+	calls []Call
+}
+
+var _ internal.SyncGSuite = (*SyncGSuite)(nil)
+
+// NewSyncGSuite returns a SyncGSuite whose calls succeed
+func NewSyncGSuite() *SyncGSuite {
+	return &SyncGSuite{}
+}
+
+// Calls returns the calls made so far, in order
+func (s *SyncGSuite) Calls() []Call {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Call(nil), s.calls...)
+}
+
+func (s *SyncGSuite) record(c Call) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls = append(s.calls, c)
+	return s.Err
+}
+
+// SyncUsers implements internal.SyncGSuite
+func (s *SyncGSuite) SyncUsers(query string) error {
+	return s.record(Call{Method: "SyncUsers", Query: query})
+}
+
+// SyncGroups implements internal.SyncGSuite
+func (s *SyncGSuite) SyncGroups(queries []string) error {
+	return s.record(Call{Method: "SyncGroups", Queries: queries})
+}
+
+// SyncGroupsUsers implements internal.SyncGSuite
+func (s *SyncGSuite) SyncGroupsUsers(queries []string) error {
+	return s.record(Call{Method: "SyncGroupsUsers", Queries: queries})
+}
+
+// SyncUser implements internal.SyncGSuite
+func (s *SyncGSuite) SyncUser(email string, queries []string) error {
+	return s.record(Call{Method: "SyncUser", Email: email, Queries: queries})
+}
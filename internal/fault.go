@@ -0,0 +1,139 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/awslabs/ssosync/internal/config"
+	log "github.com/sirupsen/logrus"
+)
+
+// faultHeader marks the responses of injected faults
+const faultHeader = "X-Ssosync-Fault"
+
+// faultTransport injects faults in the requests to the providers, random
+// latency, errors and storms of 429s, to verify the retries, checkpoints and
+// thresholds behave under provider failures, e.g. in staging. The faults
+// are injected below the retries, like real ones.
+type faultTransport struct {
+	base http.RoundTripper
+	// latency is the maximum latency added to every request
+	latency time.Duration
+	// errorRate is the probability of a request failing with a 500
+	errorRate float64
+	// throttleRate is the probability of a request starting a storm of 429s
+	throttleRate float64
+	// stormDuration is how long every request is throttled during a storm
+	stormDuration time.Duration
+
+	mu         sync.Mutex
+	rand       *rand.Rand
+	now        func() time.Time
+	sleep      func(time.Duration)
+	stormUntil time.Time
+}
+
+// newFaultTransport returns base injecting the faults of the configuration,
+// base itself when there is none
+func newFaultTransport(base http.RoundTripper, cfg *config.Config) http.RoundTripper {
+	if cfg.FaultLatency <= 0 && cfg.FaultErrorRate <= 0 && cfg.FaultThrottleRate <= 0 {
+		return base
+	}
+	log.WithFields(log.Fields{
+		"latency":          cfg.FaultLatency,
+		"errorRate":        cfg.FaultErrorRate,
+		"throttleRate":     cfg.FaultThrottleRate,
+		"throttleDuration": cfg.FaultThrottleDuration,
+	}).Warn("Fault injection enabled, requests to the providers will be delayed and fail")
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &faultTransport{
+		base:          base,
+		latency:       cfg.FaultLatency,
+		errorRate:     cfg.FaultErrorRate,
+		throttleRate:  cfg.FaultThrottleRate,
+		stormDuration: cfg.FaultThrottleDuration,
+		rand:          rand.New(rand.NewSource(time.Now().UnixNano())),
+		now:           time.Now,
+		sleep:         time.Sleep,
+	}
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *faultTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	delay, status := t.fault()
+	if delay > 0 {
+		t.sleep(delay)
+	}
+	if status == 0 {
+		return t.base.RoundTrip(req)
+	}
+	log.WithFields(log.Fields{
+		"method": req.Method,
+		"host":   req.URL.Host,
+		"path":   req.URL.Path,
+		"status": status,
+	}).Warn("Injected fault")
+	if req.Body != nil {
+		req.Body.Close()
+	}
+	h := http.Header{}
+	h.Set(faultHeader, "injected")
+	if status == http.StatusTooManyRequests {
+		h.Set("Retry-After", "1")
+	}
+	return &http.Response{
+		Status:     fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode: status,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     h,
+		Body:       ioutil.NopCloser(strings.NewReader("fault injected by ssosync")),
+		Request:    req,
+	}, nil
+}
+
+// fault draws the latency and the status of the fault of a request, the
+// status is 0 when the request isn't failed
+func (t *faultTransport) fault() (time.Duration, int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var delay time.Duration
+	if t.latency > 0 {
+		delay = time.Duration(t.rand.Int63n(int64(t.latency)))
+	}
+	now := t.now()
+	switch {
+	case now.Before(t.stormUntil):
+		return delay, http.StatusTooManyRequests
+	case t.throttleRate > 0 && t.rand.Float64() < t.throttleRate:
+		t.stormUntil = now.Add(t.stormDuration)
+		log.WithField("duration", t.stormDuration).Warn("Injected storm of 429s")
+		return delay, http.StatusTooManyRequests
+	case t.errorRate > 0 && t.rand.Float64() < t.errorRate:
+		return delay, http.StatusInternalServerError
+	}
+	return delay, 0
+}
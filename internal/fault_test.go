@@ -0,0 +1,79 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/awslabs/ssosync/internal/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_faultTransport(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	// no fault configured
+	base := http.DefaultTransport
+	assert.Equal(t, base, newFaultTransport(base, config.New()))
+
+	now := time.Date(2021, 5, 1, 7, 0, 0, 0, time.UTC)
+	var slept []time.Duration
+	ft := &faultTransport{
+		base:          base,
+		latency:       time.Second,
+		stormDuration: 5 * time.Second,
+		rand:          rand.New(rand.NewSource(1)),
+		now:           func() time.Time { return now },
+		sleep:         func(d time.Duration) { slept = append(slept, d) },
+	}
+	c := &http.Client{Transport: ft}
+	get := func() *http.Response {
+		resp, err := c.Get(srv.URL)
+		assert.NoError(t, err)
+		resp.Body.Close()
+		return resp
+	}
+
+	// latency only
+	resp := get()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Len(t, slept, 1)
+	assert.True(t, slept[0] < time.Second)
+
+	// every request fails
+	ft.errorRate = 1
+	resp = get()
+	assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+	assert.Equal(t, "injected", resp.Header.Get(faultHeader))
+
+	// a storm of 429s, until it's over
+	ft.errorRate = 0
+	ft.throttleRate = 1
+	assert.Equal(t, http.StatusTooManyRequests, get().StatusCode)
+	ft.throttleRate = 0
+	now = now.Add(4 * time.Second)
+	resp = get()
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	assert.Equal(t, "1", resp.Header.Get("Retry-After"))
+	now = now.Add(time.Second)
+	assert.Equal(t, http.StatusOK, get().StatusCode)
+}
@@ -0,0 +1,152 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"time"
+
+	"github.com/awslabs/ssosync/internal/aws"
+	"github.com/awslabs/ssosync/internal/state"
+
+	log "github.com/sirupsen/logrus"
+	admin "google.golang.org/api/admin/directory/v1"
+)
+
+// reverts reports if change reverts previous, e.g. a user deleted after it
+// was added
+func reverts(change state.Change, previous state.Change) bool {
+	return (change.Op == state.OpAdd && previous.Op == state.OpDelete) ||
+		(change.Op == state.OpDelete && previous.Op == state.OpAdd)
+}
+
+// detectFlapping tracks in flaps the entities changed by consecutive runs.
+// An entity whose change was reverted by threshold consecutive runs is
+// flapping, it is suppressed until a run computes no change for it. The keys
+// of the suppressed changes are returned, with the entities suppressed by
+// this run.
+func detectFlapping(flaps map[string]*state.Flap, changes []state.Change, threshold int, now time.Time) (map[string]bool, []*state.Flap) {
+	suppressed := make(map[string]bool)
+	newlySuppressed := make([]*state.Flap, 0)
+	changed := make(map[string]struct{}, len(changes))
+	for _, c := range changes {
+		key := c.Key()
+		changed[key] = struct{}{}
+		f, ok := flaps[key]
+		if !ok {
+			flaps[key] = &state.Flap{Change: c, Since: now}
+			continue
+		}
+		if reverts(c, f.Change) {
+			f.Flips++
+		} else {
+			f.Flips = 0
+		}
+		f.Change = c
+		if !f.Suppressed && f.Flips >= threshold {
+			f.Suppressed = true
+			newlySuppressed = append(newlySuppressed, f)
+		}
+		if f.Suppressed {
+			suppressed[key] = true
+		}
+	}
+	// entities no longer changed are stable again
+	for key := range flaps {
+		if _, ok := changed[key]; !ok {
+			delete(flaps, key)
+		}
+	}
+	return suppressed, newlySuppressed
+}
+
+// suppressFlapping removes from changes the changes to flapping entities,
+// instead of churning the SCIM API and the users with provisioning emails
+func (s *syncGSuite) suppressFlapping(changes *changeSet) {
+	suppressed, newlySuppressed := detectFlapping(s.state.Flaps, changes.records(), s.cfg.FlapThreshold, time.Now())
+	for _, f := range newlySuppressed {
+		log.WithFields(log.Fields{
+			"kind":  f.Change.Kind,
+			"name":  f.Change.Name,
+			"group": f.Change.Group,
+			"flips": f.Flips,
+			"since": f.Since,
+		}).Error("ALERT: entity is flapping between add and delete, its changes are suppressed until it is stable")
+	}
+	if len(suppressed) == 0 {
+		return
+	}
+	log.WithField("count", len(suppressed)).Warn("Changes to flapping entities suppressed")
+	changes.without(suppressed)
+}
+
+// without removes the changes with the given keys from the change set. The
+// membership changes of the users whose changes are removed are removed too.
+func (c *changeSet) without(keys map[string]bool) {
+	removed := func(op, kind, name, group string) bool {
+		return keys[state.Change{Op: op, Kind: kind, Name: name, Group: group}.Key()]
+	}
+	users := make(map[string]bool)
+	filterUsers := func(list []*aws.User, op string) []*aws.User {
+		kept := make([]*aws.User, 0, len(list))
+		for _, u := range list {
+			if removed(op, state.KindUser, u.Username, "") {
+				users[u.Username] = true
+				continue
+			}
+			kept = append(kept, u)
+		}
+		return kept
+	}
+	filterGroups := func(list []*aws.Group, op string) []*aws.Group {
+		kept := make([]*aws.Group, 0, len(list))
+		for _, g := range list {
+			if !removed(op, state.KindGroup, g.DisplayName, "") {
+				kept = append(kept, g)
+			}
+		}
+		return kept
+	}
+	c.addUsers = filterUsers(c.addUsers, state.OpAdd)
+	c.updateUsers = filterUsers(c.updateUsers, state.OpUpdate)
+	c.deleteUsers = filterUsers(c.deleteUsers, state.OpDelete)
+	c.addGroups = filterGroups(c.addGroups, state.OpAdd)
+	c.deleteGroups = filterGroups(c.deleteGroups, state.OpDelete)
+	renames := make([]groupRename, 0, len(c.renameGroups))
+	for _, r := range c.renameGroups {
+		// the group keeps its name, its members are still synced
+		if !removed(state.OpUpdate, state.KindGroup, r.name, "") {
+			renames = append(renames, r)
+		}
+	}
+	c.renameGroups = renames
+	for group, members := range c.addMembers {
+		kept := make([]*admin.User, 0, len(members))
+		for _, u := range members {
+			if !users[u.PrimaryEmail] && !removed(state.OpAdd, state.KindMember, u.PrimaryEmail, group) {
+				kept = append(kept, u)
+			}
+		}
+		c.addMembers[group] = kept
+	}
+	for group, members := range c.removeMembers {
+		kept := make([]*aws.User, 0, len(members))
+		for _, u := range members {
+			if !users[u.Username] && !removed(state.OpDelete, state.KindMember, u.Username, group) {
+				kept = append(kept, u)
+			}
+		}
+		c.removeMembers[group] = kept
+	}
+}
@@ -0,0 +1,76 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"testing"
+	"time"
+
+	"github.com/awslabs/ssosync/internal/aws"
+	"github.com/awslabs/ssosync/internal/state"
+	"github.com/stretchr/testify/assert"
+	admin "google.golang.org/api/admin/directory/v1"
+)
+
+func Test_detectFlapping(t *testing.T) {
+	flaps := make(map[string]*state.Flap)
+	add := state.Change{Op: state.OpAdd, Kind: state.KindUser, Name: "user-1@email.com"}
+	del := state.Change{Op: state.OpDelete, Kind: state.KindUser, Name: "user-1@email.com"}
+	other := state.Change{Op: state.OpAdd, Kind: state.KindUser, Name: "user-2@email.com"}
+	now := time.Now()
+
+	// add, delete, add: suppressed on the third run
+	for i, changes := range [][]state.Change{{add, other}, {del}, {add}} {
+		suppressed, newly := detectFlapping(flaps, changes, 2, now)
+		if i < 2 {
+			assert.Empty(t, suppressed)
+			assert.Empty(t, newly)
+		} else {
+			assert.True(t, suppressed[add.Key()])
+			assert.Len(t, newly, 1)
+		}
+	}
+	// user-2 was stable on the second run
+	assert.NotContains(t, flaps, other.Key())
+
+	// still suppressed while a change is computed
+	suppressed, newly := detectFlapping(flaps, []state.Change{add}, 2, now)
+	assert.True(t, suppressed[add.Key()])
+	assert.Empty(t, newly)
+
+	// released once stable
+	suppressed, _ = detectFlapping(flaps, []state.Change{}, 2, now)
+	assert.Empty(t, suppressed)
+	assert.Empty(t, flaps)
+}
+
+func Test_changeSetWithout(t *testing.T) {
+	c := &changeSet{
+		addUsers:  []*aws.User{aws.NewUser("n", "l", "user-1@email.com", true), aws.NewUser("n", "l", "user-2@email.com", true)},
+		addGroups: []*aws.Group{aws.NewGroup("group-1")},
+		addMembers: map[string][]*admin.User{
+			"group-1": {{PrimaryEmail: "user-1@email.com"}, {PrimaryEmail: "user-2@email.com"}},
+		},
+	}
+	c.without(map[string]bool{
+		state.Change{Op: state.OpAdd, Kind: state.KindUser, Name: "user-1@email.com"}.Key(): true,
+	})
+	assert.Len(t, c.addUsers, 1)
+	assert.Equal(t, "user-2@email.com", c.addUsers[0].Username)
+	assert.Len(t, c.addGroups, 1)
+	// the memberships of the suppressed user are suppressed too
+	assert.Len(t, c.addMembers["group-1"], 1)
+	assert.Equal(t, "user-2@email.com", c.addMembers["group-1"][0].PrimaryEmail)
+}
@@ -17,41 +17,106 @@ package google
 
 import (
 	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
 
+	"github.com/awslabs/ssosync/internal/errclass"
+	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/google"
 	admin "google.golang.org/api/admin/directory/v1"
+	cloudidentity "google.golang.org/api/cloudidentity/v1"
+	"google.golang.org/api/googleapi"
 	"google.golang.org/api/option"
 )
 
 // Client is the Interface for the Client
 type Client interface {
 	GetUsers(string) ([]*admin.User, error)
+	ForEachUser(string, func(*admin.User) error) error
 	GetDeletedUsers() ([]*admin.User, error)
 	GetGroups(string) ([]*admin.Group, error)
+	ForEachGroup(string, func(*admin.Group) error) error
+	GetGroup(string) (*admin.Group, error)
+	GetUser(string) (*admin.User, error)
+	HasMember(string, string) (bool, error)
 	GetGroupMembers(*admin.Group) ([]*admin.Member, error)
+	GetUsersByEmail([]string) (map[string]*admin.User, error)
+	GetGroupsWithLabel(string) ([]string, error)
 }
 
 type client struct {
 	ctx     context.Context
 	service *admin.Service
+	// identity is the Cloud Identity API, reading the labels of the groups
+	identity *cloudidentity.Service
 	customerId string
-}
+	// pageSize is the number of results asked for in each page of a list
+	pageSize int64
+	// customSchemas are the custom schemas the users are read with
+	customSchemas []string
 
-// NewClient creates a new client for Google's Admin API
-func NewClient(ctx context.Context, adminEmail string, serviceAccountKey []byte, customerId string) (Client, error) {
-	config, err := google.JWTConfigFromJSON(serviceAccountKey, admin.AdminDirectoryGroupReadonlyScope,
-		admin.AdminDirectoryGroupMemberReadonlyScope,
-		admin.AdminDirectoryUserReadonlyScope)
+	// usersByEmail memoizes the users looked up by email during the run
+	usersMu      sync.Mutex
+	usersByEmail map[string][]*admin.User
+	// usersIndex are all the users, by primary email and alias, once listed
+	usersIndex map[string]*admin.User
+}
 
-	config.Subject = adminEmail
+// ReadScopes are the read-only scopes of the users and groups granted to
+// every token, the domain-wide delegation of the service account must
+// grant them
+var ReadScopes = []string{
+	admin.AdminDirectoryGroupReadonlyScope,
+	admin.AdminDirectoryGroupMemberReadonlyScope,
+	admin.AdminDirectoryUserReadonlyScope,
+}
 
+// NewTokenSource returns the source of the OAuth tokens of the service
+// account key impersonating adminEmail. A token is reused until it expires,
+// so the source can outlive a client, e.g. across the invocations of a warm
+// Lambda. If httpClient is not nil, the tokens are requested with it. The
+// tokens are granted the read-only scopes of the users and groups, and the
+// extra scopes, e.g. WatchScopes.
+func NewTokenSource(adminEmail string, serviceAccountKey []byte, httpClient *http.Client, scopes ...string) (oauth2.TokenSource, error) {
+	scopes = append(append([]string{}, ReadScopes...), scopes...)
+	config, err := google.JWTConfigFromJSON(serviceAccountKey, scopes...)
 	if err != nil {
 		return nil, err
 	}
 
-	ts := config.TokenSource(ctx)
+	config.Subject = adminEmail
+
+	// the tokens are refreshed after the context of the client is done
+	ctx := context.Background()
+	if httpClient != nil {
+		ctx = context.WithValue(ctx, oauth2.HTTPClient, httpClient)
+	}
+
+	return config.TokenSource(ctx), nil
+}
 
-	srv, err := admin.NewService(ctx, option.WithTokenSource(ts))
+// NewClient creates a new client for Google's Admin API authorized by the
+// tokens of tokens, see NewTokenSource. If httpClient is not nil, its
+// transport is used for the requests to the API. pageSize is the number of
+// results in each page of the lists, 0 or more than an API allows uses its
+// maximum. The users are read with the fields of the customSchemas, none
+// when it is empty.
+func NewClient(ctx context.Context, tokens oauth2.TokenSource, customerId string, httpClient *http.Client, pageSize int64, customSchemas []string) (Client, error) {
+	base := http.DefaultTransport
+	if httpClient != nil && httpClient.Transport != nil {
+		base = httpClient.Transport
+	}
+
+	opt := option.WithHTTPClient(&http.Client{
+		Transport: &oauth2.Transport{Source: tokens, Base: base},
+	})
+	srv, err := admin.NewService(ctx, opt)
+	if err != nil {
+		return nil, err
+	}
+	identity, err := cloudidentity.NewService(ctx, opt)
 	if err != nil {
 		return nil, err
 	}
@@ -59,30 +124,34 @@ func NewClient(ctx context.Context, adminEmail string, serviceAccountKey []byte,
 	return &client{
 		ctx:     ctx,
 		service: srv,
+		identity: identity,
 		customerId: customerId,
+		pageSize: pageSize,
+		customSchemas: customSchemas,
+		usersByEmail: make(map[string][]*admin.User),
 	}, nil
 }
 
 // GetDeletedUsers will get the deleted users from the Google's Admin API.
 func (c *client) GetDeletedUsers() ([]*admin.User, error) {
 	u := make([]*admin.User, 0)
-	err := c.service.Users.List().Customer(c.customerId).ShowDeleted("true").Pages(c.ctx, func(users *admin.Users) error {
+	err := c.service.Users.List().Customer(c.customerId).ShowDeleted("true").MaxResults(c.size(maxUsersPageSize)).Pages(c.ctx, func(users *admin.Users) error {
 		u = append(u, users.Users...)
 		return nil
 	})
 
-	return u, err
+	return u, classify(err)
 }
 
 // GetGroupMembers will get the members of the group specified
 func (c *client) GetGroupMembers(g *admin.Group) ([]*admin.Member, error) {
 	m := make([]*admin.Member, 0)
-	err := c.service.Members.List(g.Id).IncludeDerivedMembership(true).Pages(context.TODO(), func(members *admin.Members) error {
+	err := c.service.Members.List(g.Id).IncludeDerivedMembership(true).MaxResults(c.size(maxMembersPageSize)).Pages(context.TODO(), func(members *admin.Members) error {
 		m = append(m, members.Members...)
 		return nil
 	})
 
-	return m, err
+	return m, classify(err)
 }
 
 // GetUsers will get the users from Google's Admin API
@@ -99,23 +168,153 @@ func (c *client) GetGroupMembers(g *admin.Group) ([]*admin.Member, error) {
 //  orgName=Engineering orgTitle:Manager
 //  EmploymentData.projects:'GeneGnomes'
 func (c *client) GetUsers(query string) ([]*admin.User, error) {
+	// the same user is looked up for every group it is a member of
+	email, byEmail := emailQuery(query)
+	if byEmail {
+		c.usersMu.Lock()
+		u, ok := c.usersByEmail[email]
+		c.usersMu.Unlock()
+		if ok {
+			return u, nil
+		}
+	}
+
 	u := make([]*admin.User, 0)
-	var err error
+	err := c.ForEachUser(query, func(user *admin.User) error {
+		u = append(u, user)
+		return nil
+	})
+
+	if err == nil && byEmail {
+		c.usersMu.Lock()
+		c.usersByEmail[email] = u
+		c.usersMu.Unlock()
+	}
+
+	return u, err
+}
+
+// GetUser will get the user with the primary email or alias email from
+// Google's Admin API, using the Method: users.get, nil when there is none.
+// Unlike a users.list query, a single user is matched and the request isn't
+// charged to the quota of the lists. The users of the domains the customer
+// doesn't own, for which users.get is forbidden, are looked up with the query
+// "email:" instead, which doesn't find them unless the service account lacks
+// the permission to read the users.
+// References:
+// * https://developers.google.com/admin-sdk/directory/reference/rest/v1/users/get
+func (c *client) GetUser(email string) (*admin.User, error) {
+	key := strings.ToLower(email)
+	c.usersMu.Lock()
+	u, ok := c.usersByEmail[key]
+	c.usersMu.Unlock()
+	if !ok {
+		call := c.service.Users.Get(email)
+		if len(c.customSchemas) > 0 {
+			call = call.Projection("custom").CustomFieldMask(strings.Join(c.customSchemas, ","))
+		}
+		user, err := call.Context(c.ctx).Do()
+		var apiErr *googleapi.Error
+		switch {
+		case err == nil:
+			u = []*admin.User{user}
+		case errors.As(err, &apiErr) && apiErr.Code == http.StatusNotFound:
+			u = []*admin.User{}
+		case errors.As(err, &apiErr) && apiErr.Code == http.StatusForbidden && errclass.Of(classify(err)) != errclass.Quota:
+			// the query memoizes its users, and fails as well when users
+			// can't be read at all
+			return first(c.GetUsers("email:" + email))
+		default:
+			return nil, classify(err)
+		}
+		c.usersMu.Lock()
+		c.usersByEmail[key] = u
+		c.usersMu.Unlock()
+	}
+	return first(u, nil)
+}
+
+// first returns the first of users, nil when there is none
+func first(users []*admin.User, err error) (*admin.User, error) {
+	if err != nil || len(users) == 0 {
+		return nil, err
+	}
+	return users[0], nil
+}
 
+// ForEachUser calls fn with each user matching query, see GetUsers, reading
+// them a page at a time. It stops at the first error returned by fn.
+func (c *client) ForEachUser(query string, fn func(*admin.User) error) error {
+	call := c.service.Users.List().Customer(c.customerId).MaxResults(c.size(maxUsersPageSize))
 	if query != "" {
-		err = c.service.Users.List().Query(query).Customer(c.customerId).Pages(c.ctx, func(users *admin.Users) error {
-			u = append(u, users.Users...)
-			return nil
-		})
+		call = call.Query(query)
+	}
+	if len(c.customSchemas) > 0 {
+		call = call.Projection("custom").CustomFieldMask(strings.Join(c.customSchemas, ","))
+	}
+	return classify(call.Pages(c.ctx, func(users *admin.Users) error {
+		for _, u := range users.Users {
+			if err := fn(u); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+}
 
-	} else {
-		err = c.service.Users.List().Customer(c.customerId).Pages(c.ctx, func(users *admin.Users) error {
-			u = append(u, users.Users...)
+// GetUsersByEmail returns the users with the primary emails or aliases of
+// emails, by lowercased email, the unknown emails are left out. All the users
+// are listed once per run instead of a request per email.
+func (c *client) GetUsersByEmail(emails []string) (map[string]*admin.User, error) {
+	c.usersMu.Lock()
+	defer c.usersMu.Unlock()
+	if c.usersIndex == nil {
+		index := make(map[string]*admin.User)
+		err := c.ForEachUser("", func(u *admin.User) error {
+			index[strings.ToLower(u.PrimaryEmail)] = u
+			for _, a := range u.Aliases {
+				index[strings.ToLower(a)] = u
+			}
 			return nil
 		})
+		if err != nil {
+			return nil, err
+		}
+		c.usersIndex = index
+	}
+	found := make(map[string]*admin.User, len(emails))
+	for _, e := range emails {
+		e = strings.ToLower(e)
+		if u, ok := c.usersIndex[e]; ok {
+			found[e] = u
+		}
+	}
+	return found, nil
+}
+
+// The maximum number of results per page of users.list, groups.list and
+// members.list
+const (
+	maxUsersPageSize   = 500
+	maxGroupsPageSize  = 200
+	maxMembersPageSize = 200
+)
+
+// size returns the page size of a list allowing max results per page
+func (c *client) size(max int64) int64 {
+	if c.pageSize <= 0 || c.pageSize > max {
+		return max
 	}
+	return c.pageSize
+}
 
-	return u, err
+// emailQuery returns the email of a query looking up a single user by email,
+// e.g. "email:user@example.com"
+func emailQuery(query string) (string, bool) {
+	if !strings.HasPrefix(query, "email:") || strings.ContainsAny(query, "* ") {
+		return "", false
+	}
+	return strings.ToLower(strings.TrimPrefix(query, "email:")), true
 }
 
 // GetGroups will get the groups from Google's Admin API
@@ -133,19 +332,48 @@ func (c *client) GetUsers(query string) ([]*admin.User, error) {
 //  email:aws-*
 func (c *client) GetGroups(query string) ([]*admin.Group, error) {
 	g := make([]*admin.Group, 0)
-	var err error
+	err := c.ForEachGroup(query, func(group *admin.Group) error {
+		g = append(g, group)
+		return nil
+	})
+	return g, err
+}
 
+// ForEachGroup calls fn with each group matching query, see GetGroups,
+// reading them a page at a time. It stops at the first error returned by fn.
+func (c *client) ForEachGroup(query string, fn func(*admin.Group) error) error {
+	call := c.service.Groups.List().Customer(c.customerId).MaxResults(c.size(maxGroupsPageSize))
 	if query != "" {
-		err = c.service.Groups.List().Customer(c.customerId).Query(query).Pages(context.TODO(), func(groups *admin.Groups) error {
-			g = append(g, groups.Groups...)
-			return nil
-		})
-	} else {
-		err = c.service.Groups.List().Customer(c.customerId).Pages(context.TODO(), func(groups *admin.Groups) error {
-			g = append(g, groups.Groups...)
-			return nil
-		})
+		call = call.Query(query)
+	}
+	return classify(call.Pages(context.TODO(), func(groups *admin.Groups) error {
+		for _, g := range groups.Groups {
+			if err := fn(g); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+}
+
+// GetGroup will get a single group from Google's Admin API by email, alias
+// or id, using the Method: groups.get
+// References:
+// * https://developers.google.com/admin-sdk/directory/reference/rest/v1/groups/get
+func (c *client) GetGroup(key string) (*admin.Group, error) {
+	g, err := c.service.Groups.Get(key).Context(c.ctx).Do()
+	return g, classify(err)
+}
 
+// HasMember checks if the user with memberKey is a member of the group with
+// groupKey, directly or through a nested group, using the Method:
+// members.hasMember
+// References:
+// * https://developers.google.com/admin-sdk/directory/reference/rest/v1/members/hasMember
+func (c *client) HasMember(groupKey string, memberKey string) (bool, error) {
+	r, err := c.service.Members.HasMember(groupKey, memberKey).Context(c.ctx).Do()
+	if err != nil {
+		return false, classify(err)
 	}
-	return g, err
+	return r.IsMember, nil
 }
@@ -0,0 +1,224 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package google
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	admin "google.golang.org/api/admin/directory/v1"
+	"google.golang.org/api/option"
+)
+
+func TestGetUsersMemoizesEmailLookups(t *testing.T) {
+	calls := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		_, _ = w.Write([]byte(`{"users":[{"primaryEmail":"user-1@example.com"}]}`))
+	}))
+	defer ts.Close()
+
+	ctx := context.Background()
+	srv, err := admin.NewService(ctx, option.WithHTTPClient(ts.Client()), option.WithEndpoint(ts.URL))
+	assert.NoError(t, err)
+	c := &client{
+		ctx:          ctx,
+		service:      srv,
+		customerId:   "my_customer",
+		usersByEmail: make(map[string][]*admin.User),
+	}
+
+	for i := 0; i < 3; i++ {
+		u, err := c.GetUsers("email:user-1@example.com")
+		assert.NoError(t, err)
+		assert.Len(t, u, 1)
+	}
+	_, err = c.GetUsers("email:User-1@example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, calls)
+
+	// queries not looking up a single user are not memoized
+	_, err = c.GetUsers("email:user*")
+	assert.NoError(t, err)
+	_, err = c.GetUsers("email:user*")
+	assert.NoError(t, err)
+	assert.Equal(t, 3, calls)
+}
+
+func TestGetUser(t *testing.T) {
+	var paths []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		switch r.URL.Path {
+		case "/admin/directory/v1/users/user-1@example.com":
+			_, _ = w.Write([]byte(`{"primaryEmail":"user-1@example.com"}`))
+		case "/admin/directory/v1/users/external@other.com":
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte(`{"error":{"code":403,"message":"Not Authorized to access this resource/api"}}`))
+		case "/admin/directory/v1/users":
+			assert.Equal(t, "email:external@other.com", r.URL.Query().Get("query"))
+			_, _ = w.Write([]byte(`{"users":[]}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"error":{"code":404,"message":"Resource Not Found: userKey"}}`))
+		}
+	}))
+	defer ts.Close()
+
+	ctx := context.Background()
+	srv, err := admin.NewService(ctx, option.WithHTTPClient(ts.Client()), option.WithEndpoint(ts.URL))
+	assert.NoError(t, err)
+	c := &client{
+		ctx:          ctx,
+		service:      srv,
+		customerId:   "my_customer",
+		usersByEmail: make(map[string][]*admin.User),
+	}
+
+	u, err := c.GetUser("user-1@example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, "user-1@example.com", u.PrimaryEmail)
+	u, err = c.GetUser("unknown@example.com")
+	assert.NoError(t, err)
+	assert.Nil(t, u)
+	u, err = c.GetUser("external@other.com")
+	assert.NoError(t, err)
+	assert.Nil(t, u)
+	assert.Len(t, paths, 4)
+
+	// the lookups are memoized, whatever their result
+	for _, email := range []string{"User-1@example.com", "unknown@example.com", "external@other.com"} {
+		_, err = c.GetUser(email)
+		assert.NoError(t, err)
+	}
+	assert.Len(t, paths, 4)
+}
+
+func TestGetUsersByEmail(t *testing.T) {
+	calls := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		assert.Equal(t, "500", r.URL.Query().Get("maxResults"))
+		if r.URL.Query().Get("pageToken") == "" {
+			_, _ = w.Write([]byte(`{"users":[{"primaryEmail":"user-1@example.com","aliases":["alias@example.com"]}],"nextPageToken":"2"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"users":[{"primaryEmail":"User-2@example.com"}]}`))
+	}))
+	defer ts.Close()
+
+	ctx := context.Background()
+	srv, err := admin.NewService(ctx, option.WithHTTPClient(ts.Client()), option.WithEndpoint(ts.URL))
+	assert.NoError(t, err)
+	c := &client{
+		ctx:          ctx,
+		service:      srv,
+		customerId:   "my_customer",
+		usersByEmail: make(map[string][]*admin.User),
+	}
+
+	users, err := c.GetUsersByEmail([]string{"user-1@example.com", "user-2@example.com", "Alias@example.com", "unknown@example.com"})
+	assert.NoError(t, err)
+	assert.Len(t, users, 3)
+	assert.Equal(t, "user-1@example.com", users["alias@example.com"].PrimaryEmail)
+	assert.Equal(t, "User-2@example.com", users["user-2@example.com"].PrimaryEmail)
+	assert.Equal(t, 2, calls)
+
+	// the users are listed once
+	_, err = c.GetUsersByEmail([]string{"user-1@example.com"})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, calls)
+}
+
+func TestForEachGroupPages(t *testing.T) {
+	var pageSizes []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pageSizes = append(pageSizes, r.URL.Query().Get("maxResults"))
+		if r.URL.Query().Get("pageToken") == "" {
+			_, _ = w.Write([]byte(`{"groups":[{"email":"group-1@example.com"},{"email":"group-2@example.com"}],"nextPageToken":"2"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"groups":[{"email":"group-3@example.com"}]}`))
+	}))
+	defer ts.Close()
+
+	ctx := context.Background()
+	srv, err := admin.NewService(ctx, option.WithHTTPClient(ts.Client()), option.WithEndpoint(ts.URL))
+	assert.NoError(t, err)
+	c := &client{
+		ctx:          ctx,
+		service:      srv,
+		customerId:   "my_customer",
+		pageSize:     500,
+		usersByEmail: make(map[string][]*admin.User),
+	}
+
+	var emails []string
+	err = c.ForEachGroup("", func(g *admin.Group) error {
+		emails = append(emails, g.Email)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"group-1@example.com", "group-2@example.com", "group-3@example.com"}, emails)
+	// the page size is capped to the maximum of groups.list
+	assert.Equal(t, []string{"200", "200"}, pageSizes)
+
+	// an error of fn stops the listing without reading the next pages
+	pageSizes = nil
+	c.pageSize = 2
+	stop := errors.New("stop")
+	err = c.ForEachGroup("", func(g *admin.Group) error {
+		return stop
+	})
+	assert.True(t, errors.Is(err, stop))
+	assert.Equal(t, []string{"2"}, pageSizes)
+}
+
+func TestUsersCustomSchemas(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "custom", r.URL.Query().Get("projection"))
+		assert.Equal(t, "Employment,HR", r.URL.Query().Get("customFieldMask"))
+		if r.URL.Path == "/admin/directory/v1/users" {
+			_, _ = w.Write([]byte(`{"users":[{"primaryEmail":"user-1@example.com","customSchemas":{"Employment":{"syncToAWS":true}}}]}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"primaryEmail":"user-2@example.com","customSchemas":{"Employment":{"syncToAWS":false}}}`))
+	}))
+	defer ts.Close()
+
+	ctx := context.Background()
+	srv, err := admin.NewService(ctx, option.WithHTTPClient(ts.Client()), option.WithEndpoint(ts.URL))
+	assert.NoError(t, err)
+	c := &client{
+		ctx:           ctx,
+		service:       srv,
+		customerId:    "my_customer",
+		customSchemas: []string{"Employment", "HR"},
+		usersByEmail:  make(map[string][]*admin.User),
+	}
+
+	users, err := c.GetUsers("")
+	assert.NoError(t, err)
+	if assert.Len(t, users, 1) {
+		assert.Contains(t, users[0].CustomSchemas, "Employment")
+	}
+	u, err := c.GetUser("user-2@example.com")
+	assert.NoError(t, err)
+	assert.Contains(t, u.CustomSchemas, "Employment")
+}
@@ -0,0 +1,71 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package google
+
+import (
+	"errors"
+
+	"github.com/awslabs/ssosync/internal/errclass"
+	"google.golang.org/api/googleapi"
+)
+
+// quotaReasons are the reasons of the Admin SDK errors of exhausted quotas,
+// which are returned with the status 403 like the permission errors
+var quotaReasons = map[string]bool{
+	"rateLimitExceeded":     true,
+	"userRateLimitExceeded": true,
+	"quotaExceeded":         true,
+	"dailyLimitExceeded":    true,
+}
+
+// Error is an error of the Admin SDK API with its class
+type Error struct {
+	Err   error
+	Class errclass.Class
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the error of the API
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// ErrorClass implements errclass.Classifier
+func (e *Error) ErrorClass() errclass.Class {
+	return e.Class
+}
+
+// classify returns err with its class, nil when err is nil
+func classify(err error) error {
+	if err == nil {
+		return nil
+	}
+	var apiErr *googleapi.Error
+	if !errors.As(err, &apiErr) {
+		if c := errclass.Of(err); c != "" {
+			return &Error{Err: err, Class: c}
+		}
+		return err
+	}
+	for _, e := range apiErr.Errors {
+		if quotaReasons[e.Reason] {
+			return &Error{Err: err, Class: errclass.Quota}
+		}
+	}
+	return &Error{Err: err, Class: errclass.FromStatus(apiErr.Code)}
+}
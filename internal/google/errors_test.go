@@ -0,0 +1,50 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package google
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/awslabs/ssosync/internal/errclass"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/googleapi"
+)
+
+func TestClassify(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.NoError(classify(nil))
+
+	err := errors.New("invalid key")
+	assert.Equal(err, classify(err))
+
+	tests := []struct {
+		err  *googleapi.Error
+		want errclass.Class
+	}{
+		{&googleapi.Error{Code: 401}, errclass.Auth},
+		{&googleapi.Error{Code: 403, Errors: []googleapi.ErrorItem{{Reason: "forbidden"}}}, errclass.Auth},
+		{&googleapi.Error{Code: 403, Errors: []googleapi.ErrorItem{{Reason: "userRateLimitExceeded"}}}, errclass.Quota},
+		{&googleapi.Error{Code: 404}, errclass.Validation},
+		{&googleapi.Error{Code: 503}, errclass.Transient},
+	}
+	for _, tt := range tests {
+		err := classify(tt.err)
+		assert.Equal(tt.want, errclass.Of(err), "status %d", tt.err.Code)
+		var apiErr *googleapi.Error
+		assert.True(errors.As(err, &apiErr))
+	}
+}
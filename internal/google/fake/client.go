@@ -0,0 +1,235 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package fake provides an in-memory Google Workspace directory and builders
+// of its users and groups, to test the code using a google.Client without
+// the Admin SDK, or to compute changes offline from a snapshot.
+package fake
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/awslabs/ssosync/internal/google"
+	admin "google.golang.org/api/admin/directory/v1"
+)
+
+// Client is an in-memory google.Client. The "email:" and "name:" clauses of
+// the queries are evaluated, with a trailing * as a prefix match, the other
+// clauses are ignored.
+type Client struct {
+	Users        []*admin.User
+	DeletedUsers []*admin.User
+	Groups       []*admin.Group
+	// Members are the members of the groups, by group id
+	Members map[string][]*admin.Member
+	// Labels are the emails of the groups with a label, by label
+	Labels map[string][]string
+}
+
+var _ google.Client = (*Client)(nil)
+
+// NewClient returns an empty Client
+func NewClient() *Client {
+	return &Client{Members: make(map[string][]*admin.Member), Labels: make(map[string][]string)}
+}
+
+// User returns a user with email, its name derived from it
+func User(email string) *admin.User {
+	name := strings.SplitN(email, "@", 2)[0]
+	return &admin.User{
+		Id:           "id-" + email,
+		PrimaryEmail: email,
+		Etag:         "etag-" + email,
+		Name: &admin.UserName{
+			GivenName:  name,
+			FamilyName: name,
+			FullName:   name + " " + name,
+		},
+	}
+}
+
+// Group returns a group with email, its name derived from it
+func Group(email string) *admin.Group {
+	return &admin.Group{
+		Id:    "id-" + email,
+		Email: email,
+		Name:  strings.SplitN(email, "@", 2)[0],
+	}
+}
+
+// WithUsers adds users, e.g. built with User, and returns c
+func (c *Client) WithUsers(users ...*admin.User) *Client {
+	c.Users = append(c.Users, users...)
+	return c
+}
+
+// WithGroup adds the group, e.g. built with Group, with the users of emails
+// as members, and returns c
+func (c *Client) WithGroup(g *admin.Group, emails ...string) *Client {
+	c.Groups = append(c.Groups, g)
+	for _, email := range emails {
+		c.Members[g.Id] = append(c.Members[g.Id], &admin.Member{
+			Id:     "id-" + email,
+			Email:  email,
+			Type:   "USER",
+			Status: "ACTIVE",
+		})
+	}
+	return c
+}
+
+// WithLabel labels the groups of emails with label, and returns c
+func (c *Client) WithLabel(label string, emails ...string) *Client {
+	c.Labels[label] = append(c.Labels[label], emails...)
+	return c
+}
+
+// GetUsers implements google.Client
+func (c *Client) GetUsers(query string) ([]*admin.User, error) {
+	users := make([]*admin.User, 0)
+	for _, u := range c.Users {
+		name := ""
+		if u.Name != nil {
+			name = u.Name.FullName
+		}
+		if matches(query, u.PrimaryEmail, name) {
+			users = append(users, u)
+		}
+	}
+	return users, nil
+}
+
+// GetUser implements google.Client, email is matched against the primary
+// emails of the users
+func (c *Client) GetUser(email string) (*admin.User, error) {
+	for _, u := range c.Users {
+		if strings.EqualFold(u.PrimaryEmail, email) {
+			return u, nil
+		}
+	}
+	return nil, nil
+}
+
+// ForEachUser implements google.Client
+func (c *Client) ForEachUser(query string, fn func(*admin.User) error) error {
+	users, _ := c.GetUsers(query)
+	for _, u := range users {
+		if err := fn(u); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetUsersByEmail implements google.Client, the emails are matched against
+// the primary emails of the users
+func (c *Client) GetUsersByEmail(emails []string) (map[string]*admin.User, error) {
+	found := make(map[string]*admin.User, len(emails))
+	for _, e := range emails {
+		e = strings.ToLower(e)
+		for _, u := range c.Users {
+			if strings.ToLower(u.PrimaryEmail) == e {
+				found[e] = u
+			}
+		}
+	}
+	return found, nil
+}
+
+// GetDeletedUsers implements google.Client
+func (c *Client) GetDeletedUsers() ([]*admin.User, error) {
+	return append([]*admin.User{}, c.DeletedUsers...), nil
+}
+
+// GetGroups implements google.Client
+func (c *Client) GetGroups(query string) ([]*admin.Group, error) {
+	groups := make([]*admin.Group, 0)
+	for _, g := range c.Groups {
+		if matches(query, g.Email, g.Name) {
+			groups = append(groups, g)
+		}
+	}
+	return groups, nil
+}
+
+// ForEachGroup implements google.Client
+func (c *Client) ForEachGroup(query string, fn func(*admin.Group) error) error {
+	groups, _ := c.GetGroups(query)
+	for _, g := range groups {
+		if err := fn(g); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetGroup implements google.Client, key is the email or the id of the group
+func (c *Client) GetGroup(key string) (*admin.Group, error) {
+	for _, g := range c.Groups {
+		if strings.EqualFold(g.Email, key) || g.Id == key {
+			return g, nil
+		}
+	}
+	return nil, fmt.Errorf("group %s not found", key)
+}
+
+// HasMember implements google.Client
+func (c *Client) HasMember(groupKey string, memberKey string) (bool, error) {
+	g, err := c.GetGroup(groupKey)
+	if err != nil {
+		return false, err
+	}
+	for _, m := range c.Members[g.Id] {
+		if strings.EqualFold(m.Email, memberKey) || m.Id == memberKey {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// GetGroupMembers implements google.Client
+func (c *Client) GetGroupMembers(g *admin.Group) ([]*admin.Member, error) {
+	return append([]*admin.Member{}, c.Members[g.Id]...), nil
+}
+
+// GetGroupsWithLabel implements google.Client
+func (c *Client) GetGroupsWithLabel(label string) ([]string, error) {
+	return append([]string{}, c.Labels[label]...), nil
+}
+
+// matches evaluates the email and name clauses of query
+func matches(query string, email string, name string) bool {
+	for _, clause := range strings.Fields(query) {
+		var field, value string
+		switch {
+		case strings.HasPrefix(clause, "email:"):
+			field, value = email, clause[len("email:"):]
+		case strings.HasPrefix(clause, "name:"):
+			field, value = name, clause[len("name:"):]
+		default:
+			continue
+		}
+		field = strings.ToLower(field)
+		value = strings.ToLower(strings.Trim(value, `'"`))
+		if strings.HasSuffix(value, "*") {
+			if !strings.HasPrefix(field, strings.TrimSuffix(value, "*")) {
+				return false
+			}
+		} else if field != value {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,72 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package google
+
+import (
+	"errors"
+	"fmt"
+
+	cloudidentity "google.golang.org/api/cloudidentity/v1"
+)
+
+// LabelScopes are the extra scopes of the tokens of a Client reading the
+// groups by label, see NewTokenSource and GetGroupsWithLabel
+var LabelScopes = []string{cloudidentity.CloudIdentityGroupsReadonlyScope}
+
+// SecurityLabel is the label of the security groups
+const SecurityLabel = "cloudidentity.googleapis.com/groups.security"
+
+// maxSearchPageSize is the maximum page size of a search of the groups
+const maxSearchPageSize = 1000
+
+// GetGroupsWithLabel returns the emails of the groups with label, read from
+// the Cloud Identity API as the Directory API doesn't return the labels of
+// the groups. The tokens must be granted LabelScopes.
+// References:
+// * https://cloud.google.com/identity/docs/reference/rest/v1/groups/search
+func (c *client) GetGroupsWithLabel(label string) ([]string, error) {
+	customer, err := c.customerID()
+	if err != nil {
+		return nil, err
+	}
+	query := fmt.Sprintf("parent == 'customers/%s' && '%s' in labels", customer, label)
+	emails := make([]string, 0)
+	err = c.identity.Groups.Search().Query(query).PageSize(c.size(maxSearchPageSize)).Pages(c.ctx, func(r *cloudidentity.SearchGroupsResponse) error {
+		for _, g := range r.Groups {
+			if g.GroupKey != nil {
+				emails = append(emails, g.GroupKey.Id)
+			}
+		}
+		return nil
+	})
+	return emails, classify(err)
+}
+
+// customerID returns the id of the customer. The Cloud Identity API doesn't
+// know the my_customer alias of the Directory API, the id is then the one of
+// the customer of the users.
+func (c *client) customerID() (string, error) {
+	if c.customerId != "" && c.customerId != "my_customer" {
+		return c.customerId, nil
+	}
+	users, err := c.service.Users.List().Customer("my_customer").MaxResults(1).Context(c.ctx).Do()
+	if err != nil {
+		return "", classify(err)
+	}
+	if len(users.Users) == 0 {
+		return "", errors.New("no user to read the id of the customer from, set it with --google-customer-id")
+	}
+	return users.Users[0].CustomerId, nil
+}
@@ -0,0 +1,154 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package google
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// throttleMaxRetries is the number of retries of a rate limited request
+const throttleMaxRetries = 5
+
+// throttleBaseBackoff is the backoff after the first rate limited response
+var throttleBaseBackoff = time.Second
+
+// throttledTransport limits the rate of the requests to Google's APIs so the
+// per-user quota of the Admin SDK is not exhausted by concurrent requests,
+// and backs off when Google answers that a rate limit is exceeded. Backing
+// off delays every request, not only the rate limited one.
+type throttledTransport struct {
+	base     http.RoundTripper
+	interval time.Duration
+
+	mu   sync.Mutex
+	next time.Time
+}
+
+// NewThrottledTransport returns a transport sending at most
+// requestsPerSecond requests per second with base, 0 is unlimited
+func NewThrottledTransport(base http.RoundTripper, requestsPerSecond float64) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	t := &throttledTransport{base: base}
+	if requestsPerSecond > 0 {
+		t.interval = time.Duration(float64(time.Second) / requestsPerSecond)
+	}
+	return t
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *throttledTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		if err := t.wait(req); err != nil {
+			return nil, err
+		}
+		r := req
+		if attempt > 0 {
+			r = req.Clone(req.Context())
+			if req.GetBody != nil {
+				body, err := req.GetBody()
+				if err != nil {
+					return nil, err
+				}
+				r.Body = body
+			}
+		}
+		resp, err := t.base.RoundTrip(r)
+		if err != nil || !rateLimited(resp) || attempt == throttleMaxRetries {
+			return resp, err
+		}
+		if req.Body != nil && req.GetBody == nil {
+			// the body can't be sent again
+			return resp, nil
+		}
+		backoff := retryAfter(resp, throttleBaseBackoff<<uint(attempt))
+		log.WithFields(log.Fields{
+			"status":  resp.StatusCode,
+			"attempt": attempt + 1,
+			"backoff": backoff,
+		}).Warn("Google rate limit exceeded, backing off")
+		resp.Body.Close()
+		t.delay(backoff)
+	}
+}
+
+// wait blocks until the request can be sent without exceeding the rate
+func (t *throttledTransport) wait(req *http.Request) error {
+	t.mu.Lock()
+	now := time.Now()
+	at := t.next
+	if at.Before(now) {
+		at = now
+	}
+	t.next = at.Add(t.interval)
+	t.mu.Unlock()
+
+	d := time.Until(at)
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-req.Context().Done():
+		return req.Context().Err()
+	}
+}
+
+// delay postpones all the requests by d
+func (t *throttledTransport) delay(d time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if at := time.Now().Add(d); at.After(t.next) {
+		t.next = at
+	}
+}
+
+// rateLimited reports if resp is a rate limit error of Google's APIs, which
+// are either 429 Too Many Requests or 403 Forbidden with a rateLimitExceeded
+// or userRateLimitExceeded reason
+func rateLimited(resp *http.Response) bool {
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests:
+		return true
+	case http.StatusForbidden:
+		body, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+		if err != nil {
+			return false
+		}
+		return bytes.Contains(body, []byte("RateLimitExceeded")) || bytes.Contains(body, []byte("rateLimitExceeded"))
+	}
+	return false
+}
+
+// retryAfter returns the delay of the Retry-After header of resp, or def
+func retryAfter(resp *http.Response, def time.Duration) time.Duration {
+	if s, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && s > 0 {
+		return time.Duration(s) * time.Second
+	}
+	return def
+}
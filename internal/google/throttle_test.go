@@ -0,0 +1,74 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package google
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestThrottledTransportRetriesRateLimited(t *testing.T) {
+	throttleBaseBackoff = time.Millisecond
+	responses := []int{http.StatusTooManyRequests, http.StatusForbidden, http.StatusOK}
+	bodies := []string{"", `{"error":{"errors":[{"reason":"userRateLimitExceeded"}]}}`, "{}"}
+	calls := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(responses[calls])
+		_, _ = w.Write([]byte(bodies[calls]))
+		calls++
+	}))
+	defer ts.Close()
+
+	c := &http.Client{Transport: NewThrottledTransport(nil, 0)}
+	resp, err := c.Get(ts.URL)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, 3, calls)
+}
+
+func TestThrottledTransportForbidden(t *testing.T) {
+	calls := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = w.Write([]byte(`{"error":{"errors":[{"reason":"forbidden"}]}}`))
+		calls++
+	}))
+	defer ts.Close()
+
+	c := &http.Client{Transport: NewThrottledTransport(nil, 0)}
+	resp, err := c.Get(ts.URL)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	assert.Equal(t, 1, calls)
+}
+
+func TestThrottledTransportRate(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	c := &http.Client{Transport: NewThrottledTransport(nil, 100)}
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		resp, err := c.Get(ts.URL)
+		assert.NoError(t, err)
+		resp.Body.Close()
+	}
+	// the first request is sent right away, the next ones every 10ms
+	assert.True(t, time.Since(start) >= 40*time.Millisecond)
+}
@@ -0,0 +1,45 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package google
+
+import (
+	admin "google.golang.org/api/admin/directory/v1"
+)
+
+// UserStatus is the status of a Google user
+type UserStatus string
+
+const (
+	// UserActive is the status of the users who can sign in
+	UserActive UserStatus = "active"
+	// UserSuspended is the status of the users suspended by an admin
+	UserSuspended UserStatus = "suspended"
+	// UserArchived is the status of the archived users, former employees
+	// whose data is kept, who can't sign in either
+	UserArchived UserStatus = "archived"
+)
+
+// StatusOf returns the status of the user u, an archived user is archived
+// whether it is suspended or not
+func StatusOf(u *admin.User) UserStatus {
+	switch {
+	case u.Archived:
+		return UserArchived
+	case u.Suspended:
+		return UserSuspended
+	default:
+		return UserActive
+	}
+}
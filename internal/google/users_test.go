@@ -0,0 +1,31 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package google
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	admin "google.golang.org/api/admin/directory/v1"
+)
+
+func TestStatusOf(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal(UserActive, StatusOf(&admin.User{}))
+	assert.Equal(UserSuspended, StatusOf(&admin.User{Suspended: true}))
+	assert.Equal(UserArchived, StatusOf(&admin.User{Archived: true}))
+	assert.Equal(UserArchived, StatusOf(&admin.User{Archived: true, Suspended: true}))
+}
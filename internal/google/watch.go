@@ -0,0 +1,200 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package google
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+	admin "google.golang.org/api/admin/directory/v1"
+	reports "google.golang.org/api/admin/reports/v1"
+	"google.golang.org/api/option"
+)
+
+// WatchScopes are the extra scopes of the tokens of a Watcher, see
+// NewTokenSource, reading the audit of the admin activities
+var WatchScopes = []string{reports.AdminReportsAuditReadonlyScope}
+
+// MembershipEvents are the events of the admin activities changing the
+// members of a group, watched by Watch
+var MembershipEvents = []string{"ADD_GROUP_MEMBER", "REMOVE_GROUP_MEMBER"}
+
+// The headers of the push notifications
+const (
+	// ChannelTokenHeader holds the token the channel was registered with
+	ChannelTokenHeader = "X-Goog-Channel-Token"
+	// ResourceStateHeader holds the event notified, "sync" when the channel
+	// was just registered
+	ResourceStateHeader = "X-Goog-Resource-State"
+)
+
+// Channel is a channel of push notifications registered by Watch
+type Channel struct {
+	ID         string `json:"id"`
+	ResourceID string `json:"resourceId"`
+	// Resource is what is watched, e.g. "users" or "activities:ADD_GROUP_MEMBER"
+	Resource   string    `json:"resource"`
+	Expiration time.Time `json:"expiration"`
+}
+
+// Watcher registers channels of push notifications of the changes to the
+// users and to the members of the groups
+// References:
+// * https://developers.google.com/admin-sdk/directory/v1/guides/push
+// * https://developers.google.com/admin-sdk/reports/v1/guides/push
+type Watcher struct {
+	ctx        context.Context
+	directory  *admin.Service
+	reports    *reports.Service
+	customerId string
+}
+
+// NewWatcher creates a Watcher authorized by the tokens of tokens, which
+// must be granted WatchScopes. If httpClient is not nil, its transport is
+// used for the requests to the APIs.
+func NewWatcher(ctx context.Context, tokens oauth2.TokenSource, customerId string, httpClient *http.Client) (*Watcher, error) {
+	base := http.DefaultTransport
+	if httpClient != nil && httpClient.Transport != nil {
+		base = httpClient.Transport
+	}
+	opt := option.WithHTTPClient(&http.Client{
+		Transport: &oauth2.Transport{Source: tokens, Base: base},
+	})
+
+	directory, err := admin.NewService(ctx, opt)
+	if err != nil {
+		return nil, err
+	}
+	r, err := reports.NewService(ctx, opt)
+	if err != nil {
+		return nil, err
+	}
+	return &Watcher{ctx: ctx, directory: directory, reports: r, customerId: customerId}, nil
+}
+
+// Watch registers the channels delivering the notifications of the changes
+// to the users, and of the admin activities in MembershipEvents, to address
+// with token until ttl elapsed. The ids of the channels start with id.
+func (w *Watcher) Watch(id string, address string, token string, ttl time.Duration) ([]*Channel, error) {
+	expiration := time.Now().Add(ttl)
+	channels := make([]*Channel, 0, 1+len(MembershipEvents))
+
+	c, err := w.directory.Users.Watch(&admin.Channel{
+		Id:         id + "-users",
+		Type:       "web_hook",
+		Address:    address,
+		Token:      token,
+		Expiration: expiration.UnixNano() / int64(time.Millisecond),
+	}).Customer(w.customerId).Context(w.ctx).Do()
+	if err != nil {
+		return channels, classify(err)
+	}
+	channels = append(channels, &Channel{ID: c.Id, ResourceID: c.ResourceId, Resource: "users", Expiration: expirationTime(c.Expiration)})
+
+	for _, event := range MembershipEvents {
+		call := w.reports.Activities.Watch("all", "admin", &reports.Channel{
+			Id:         id + "-" + strings.ToLower(event),
+			Type:       "web_hook",
+			Address:    address,
+			Token:      token,
+			Expiration: expiration.UnixNano() / int64(time.Millisecond),
+		}).EventName(event)
+		// the audit is read with the id of the customer, not its alias
+		if w.customerId != "" && w.customerId != "my_customer" {
+			call = call.CustomerId(w.customerId)
+		}
+		c, err := call.Context(w.ctx).Do()
+		if err != nil {
+			return channels, classify(err)
+		}
+		channels = append(channels, &Channel{ID: c.Id, ResourceID: c.ResourceId, Resource: "activities:" + event, Expiration: expirationTime(c.Expiration)})
+	}
+	return channels, nil
+}
+
+// expirationTime converts the expiration of a channel, in milliseconds since
+// the epoch
+func expirationTime(ms int64) time.Time {
+	return time.Unix(0, ms*int64(time.Millisecond)).UTC()
+}
+
+// Notification is a push notification of a channel registered by Watch
+type Notification struct {
+	// Event is the event notified, e.g. "update" or "ADD_GROUP_MEMBER",
+	// "sync" when the channel was just registered
+	Event string
+	// Users are the emails of the users changed, or whose membership of a
+	// group changed
+	Users []string
+}
+
+// ParseNotification parses a push notification, its body is a user of the
+// directory or an admin activity
+func ParseNotification(header http.Header, body []byte) (*Notification, error) {
+	n := &Notification{Event: header.Get(ResourceStateHeader)}
+	if n.Event == "sync" {
+		return n, nil
+	}
+	var kind struct {
+		Kind string `json:"kind"`
+	}
+	if err := json.Unmarshal(body, &kind); err != nil {
+		return nil, fmt.Errorf("invalid notification: %w", err)
+	}
+	switch kind.Kind {
+	case "admin#directory#user":
+		var u admin.User
+		if err := json.Unmarshal(body, &u); err != nil {
+			return nil, fmt.Errorf("invalid notification: %w", err)
+		}
+		if u.PrimaryEmail != "" {
+			n.Users = append(n.Users, u.PrimaryEmail)
+		}
+	case "admin#reports#activity":
+		var a reports.Activity
+		if err := json.Unmarshal(body, &a); err != nil {
+			return nil, fmt.Errorf("invalid notification: %w", err)
+		}
+		for _, e := range a.Events {
+			n.Event = e.Name
+			if !isMembershipEvent(e.Name) {
+				continue
+			}
+			for _, p := range e.Parameters {
+				if p.Name == "USER_EMAIL" && p.Value != "" {
+					n.Users = append(n.Users, p.Value)
+				}
+			}
+		}
+	default:
+		return nil, fmt.Errorf("invalid notification: unexpected kind %q", kind.Kind)
+	}
+	return n, nil
+}
+
+// isMembershipEvent tells if event is one of MembershipEvents
+func isMembershipEvent(event string) bool {
+	for _, e := range MembershipEvents {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
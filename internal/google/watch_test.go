@@ -0,0 +1,47 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package google
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseNotification(t *testing.T) {
+	header := http.Header{}
+	header.Set(ResourceStateHeader, "update")
+	n, err := ParseNotification(header, []byte(`{"kind":"admin#directory#user","id":"1","primaryEmail":"user-1@example.com"}`))
+	assert.NoError(t, err)
+	assert.Equal(t, &Notification{Event: "update", Users: []string{"user-1@example.com"}}, n)
+
+	n, err = ParseNotification(http.Header{}, []byte(`{"kind":"admin#reports#activity","events":[{"type":"GROUP_SETTINGS","name":"ADD_GROUP_MEMBER","parameters":[{"name":"USER_EMAIL","value":"user-2@example.com"},{"name":"GROUP_EMAIL","value":"aws-dev@example.com"}]}]}`))
+	assert.NoError(t, err)
+	assert.Equal(t, &Notification{Event: "ADD_GROUP_MEMBER", Users: []string{"user-2@example.com"}}, n)
+
+	// the other admin activities have no users to sync
+	n, err = ParseNotification(http.Header{}, []byte(`{"kind":"admin#reports#activity","events":[{"name":"CHANGE_GROUP_NAME","parameters":[{"name":"USER_EMAIL","value":"user-2@example.com"}]}]}`))
+	assert.NoError(t, err)
+	assert.Empty(t, n.Users)
+
+	header.Set(ResourceStateHeader, "sync")
+	n, err = ParseNotification(header, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "sync", n.Event)
+
+	_, err = ParseNotification(http.Header{}, []byte(`{"kind":"admin#directory#group"}`))
+	assert.Error(t, err)
+}
@@ -0,0 +1,110 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	admin "google.golang.org/api/admin/directory/v1"
+)
+
+// ReadGroupNames reads a JSON object of the names of AWS groups by Google
+// group email, e.g. {"aws-dev@corp.com": "Developers"}. The emails are
+// lower cased, two groups can't have the same AWS name.
+func ReadGroupNames(r io.Reader) (map[string]string, error) {
+	var names map[string]string
+	if err := json.NewDecoder(r).Decode(&names); err != nil {
+		return nil, fmt.Errorf("invalid group names: %w", err)
+	}
+	emails := make([]string, 0, len(names))
+	for email := range names {
+		emails = append(emails, email)
+	}
+	sort.Strings(emails)
+	byEmail := make(map[string]string, len(names))
+	groups := make(map[string]string, len(names))
+	for _, email := range emails {
+		name := names[email]
+		if strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("invalid group names: group %s has no name", email)
+		}
+		if other, ok := groups[name]; ok {
+			return nil, fmt.Errorf("invalid group names: groups %s and %s are both named %q", other, email, name)
+		}
+		groups[name] = email
+		byEmail[strings.ToLower(email)] = name
+	}
+	return byEmail, nil
+}
+
+// readGroupNames reads the group names file once, when there is one
+func (s *syncGSuite) readGroupNames() error {
+	if s.cfg.GroupNamesFile == "" || s.groupNames != nil {
+		return nil
+	}
+	f, err := os.Open(s.cfg.GroupNamesFile)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	names, err := ReadGroupNames(f)
+	if err != nil {
+		return fmt.Errorf("%s: %w", s.cfg.GroupNamesFile, err)
+	}
+	s.groupNames = names
+	return nil
+}
+
+// withAWSGroupNames returns copies of the Google groups named as their AWS
+// groups, see awsGroupName, so every comparison with the AWS groups, e.g.
+// getGroupOperations, the renames and the members, matches the names
+// created by the previous runs. The groups themselves are left untouched,
+// they may be kept by a snapshot. A group of the group names file named as
+// another group is an error, as one would overwrite the members of the other.
+func (s *syncGSuite) withAWSGroupNames(groups []*admin.Group) ([]*admin.Group, error) {
+	if s.cfg.GroupNamePrefix == "" && s.cfg.GroupNameSuffix == "" && len(s.groupNames) == 0 {
+		return groups, nil
+	}
+	named := make([]*admin.Group, len(groups))
+	emails := make(map[string]string, len(groups))
+	mapped := make(map[string]bool, len(groups))
+	for i, g := range groups {
+		gg := *g
+		gg.Name = s.awsGroupName(g.Email, g.Name)
+		_, isMapped := s.groupNames[strings.ToLower(g.Email)]
+		if other, ok := emails[gg.Name]; ok && (isMapped || mapped[other]) {
+			return nil, fmt.Errorf("groups %s and %s are both named %q in AWS, fix the group names file", other, g.Email, gg.Name)
+		}
+		emails[gg.Name] = g.Email
+		mapped[g.Email] = isMapped
+		named[i] = &gg
+	}
+	return named, nil
+}
+
+// awsGroupName returns the name of the AWS group of the Google group with
+// email and name: the name of the group names file, else the Google name
+// with the prefix and the suffix of the configuration
+func (s *syncGSuite) awsGroupName(email string, name string) string {
+	if n, ok := s.groupNames[strings.ToLower(email)]; ok {
+		return n
+	}
+	return s.cfg.GroupNamePrefix + name + s.cfg.GroupNameSuffix
+}
@@ -0,0 +1,94 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/awslabs/ssosync/internal/aws"
+	awsfake "github.com/awslabs/ssosync/internal/aws/fake"
+	"github.com/awslabs/ssosync/internal/config"
+	googlefake "github.com/awslabs/ssosync/internal/google/fake"
+	"github.com/stretchr/testify/assert"
+	admin "google.golang.org/api/admin/directory/v1"
+)
+
+func TestReadGroupNames(t *testing.T) {
+	names, err := ReadGroupNames(strings.NewReader(`{"AWS-dev@corp.com": "Developers", "aws-ops@corp.com": "Operations"}`))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"aws-dev@corp.com": "Developers", "aws-ops@corp.com": "Operations"}, names)
+
+	for _, invalid := range []string{
+		`["aws-dev@corp.com"]`,
+		`{"aws-dev@corp.com": ""}`,
+		`{"aws-dev@corp.com": "Developers", "aws-eng@corp.com": "Developers"}`,
+	} {
+		_, err := ReadGroupNames(strings.NewReader(invalid))
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestSyncGroupsUsersGroupNamesFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "group-names.json")
+	if err := ioutil.WriteFile(path, []byte(`{"aws-dev@email.com": "Developers"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	googleClient := googlefake.NewClient().
+		WithUsers(googlefake.User("a@email.com"), googlefake.User("b@email.com")).
+		WithGroup(googlefake.Group("aws-dev@email.com"), "a@email.com").
+		WithGroup(googlefake.Group("aws-ops@email.com"), "b@email.com")
+	// the group existing in AWS, not created by ssosync
+	awsClient := awsfake.NewClient().
+		WithUsers(aws.NewUser("a", "a", "a@email.com", true)).
+		WithGroup(aws.NewGroup("Developers"))
+	cfg := config.New()
+	cfg.Yes = true
+	cfg.GroupNamesFile = path
+	cfg.GroupNamePrefix = "GW-"
+
+	before, _ := awsClient.FindGroupByDisplayName("Developers")
+	if err := newSyncGSuite(cfg, awsClient, googleClient, nil).SyncGroupsUsers(nil); err != nil {
+		t.Fatalf("SyncGroupsUsers() error = %v", err)
+	}
+
+	groups, _ := awsClient.GetGroups()
+	var got []string
+	for _, g := range groups {
+		got = append(got, g.DisplayName)
+	}
+	assert.ElementsMatch(t, []string{"Developers", "GW-aws-ops"}, got)
+	after, err := awsClient.FindGroupByDisplayName("Developers")
+	if assert.NoError(t, err) {
+		assert.Equal(t, before.ID, after.ID)
+		members, _ := awsClient.GetGroupMemberIDs(after)
+		assert.Len(t, members, 1)
+	}
+
+	changes, err := newSyncGSuite(cfg, awsClient, googleClient, nil).getChanges(nil)
+	assert.NoError(t, err)
+	assert.Empty(t, changes.records())
+}
+
+func Test_withAWSGroupNames(t *testing.T) {
+	s := newSyncGSuite(config.New(), nil, nil, nil)
+	s.groupNames = map[string]string{"aws-dev@corp.com": "aws-ops"}
+	groups := []*admin.Group{googlefake.Group("aws-dev@corp.com"), googlefake.Group("aws-ops@corp.com")}
+	_, err := s.withAWSGroupNames(groups)
+	assert.Error(t, err)
+	assert.Equal(t, "aws-dev", groups[0].Name)
+}
@@ -0,0 +1,113 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"github.com/awslabs/ssosync/internal/aws"
+	"github.com/awslabs/ssosync/internal/config"
+	"github.com/awslabs/ssosync/internal/matcher"
+	"github.com/awslabs/ssosync/internal/state"
+
+	log "github.com/sirupsen/logrus"
+	admin "google.golang.org/api/admin/directory/v1"
+)
+
+// groupPolicies tells which AWS groups are protected by the group policies,
+// by the email of their Google group or their name
+type groupPolicies struct {
+	policies []config.GroupPolicy
+	// emails are the emails of the Google groups by AWS group name
+	emails map[string]string
+}
+
+// newGroupPolicies returns the group policies of the AWS groups of
+// googleGroups, and of the other AWS groups by name
+func newGroupPolicies(policies []config.GroupPolicy, googleGroups []*admin.Group) *groupPolicies {
+	p := &groupPolicies{policies: policies, emails: make(map[string]string, len(googleGroups))}
+	for _, g := range googleGroups {
+		p.emails[g.Name] = g.Email
+	}
+	return p
+}
+
+// protected returns whether a policy matching the AWS group name, or the
+// email of its Google group, sets the protection
+func (p *groupPolicies) protected(name string, protection func(config.GroupPolicy) bool) bool {
+	for _, policy := range p.policies {
+		if !protection(policy) {
+			continue
+		}
+		entries := []string{policy.Match}
+		if matcher.Match(entries, name) || matcher.Match(entries, p.emails[name]) {
+			return true
+		}
+	}
+	return false
+}
+
+func neverDeleteGroup(p config.GroupPolicy) bool   { return p.NeverDeleteGroup }
+func neverDeleteMembers(p config.GroupPolicy) bool { return p.NeverDeleteMembers }
+
+// applyGroupPolicies removes from changes the automated removals the group
+// policies protect the AWS groups from: the deletions of the groups with
+// never_delete_group, the removals of the members of the groups with
+// never_delete_members and the deletions of their members, which would
+// remove them too. A group deleted from Google Workspace is only matched by
+// the name of its AWS group.
+func (s *syncGSuite) applyGroupPolicies(changes *changeSet, googleGroups []*admin.Group, awsGroupsUsers map[string][]*aws.User) {
+	if len(s.cfg.GroupPolicies) == 0 {
+		return
+	}
+	p := newGroupPolicies(s.cfg.GroupPolicies, googleGroups)
+
+	protected := make(map[string]bool)
+	protect := func(c state.Change) {
+		log.WithFields(log.Fields{
+			"kind":  c.Kind,
+			"name":  c.Name,
+			"group": c.Group,
+		}).Warn("Removal protected by group policy, skipping it")
+		protected[c.Key()] = true
+	}
+	for _, g := range changes.deleteGroups {
+		if p.protected(g.DisplayName, neverDeleteGroup) {
+			protect(state.Change{Op: state.OpDelete, Kind: state.KindGroup, Name: g.DisplayName})
+		}
+	}
+	for group, members := range changes.removeMembers {
+		if !p.protected(group, neverDeleteMembers) {
+			continue
+		}
+		for _, u := range members {
+			protect(state.Change{Op: state.OpDelete, Kind: state.KindMember, Name: u.Username, Group: group})
+		}
+	}
+	deleted := make(map[string]bool, len(changes.deleteUsers))
+	for _, u := range changes.deleteUsers {
+		deleted[u.Username] = true
+	}
+	for group, members := range awsGroupsUsers {
+		if len(deleted) == 0 || !p.protected(group, neverDeleteMembers) {
+			continue
+		}
+		for _, u := range members {
+			if deleted[u.Username] {
+				delete(deleted, u.Username)
+				protect(state.Change{Op: state.OpDelete, Kind: state.KindUser, Name: u.Username})
+			}
+		}
+	}
+	changes.without(protected)
+}
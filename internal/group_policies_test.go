@@ -0,0 +1,79 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/awslabs/ssosync/internal/aws"
+	awsfake "github.com/awslabs/ssosync/internal/aws/fake"
+	"github.com/awslabs/ssosync/internal/config"
+	googlefake "github.com/awslabs/ssosync/internal/google/fake"
+	"github.com/awslabs/ssosync/internal/state"
+)
+
+func Test_applyGroupPolicies(t *testing.T) {
+	googleClient := googlefake.NewClient().
+		WithUsers(googlefake.User("a@email.com"), googlefake.User("b@email.com")).
+		WithGroup(googlefake.Group("finance@email.com"), "a@email.com").
+		WithGroup(googlefake.Group("aws-dev@email.com"), "a@email.com")
+	awsClient := awsfake.NewClient().
+		WithUsers(
+			syncedUser("a@email.com"),
+			syncedUser("b@email.com"),
+			aws.NewUser("c", "c", "c@email.com", true)).
+		WithGroup(aws.NewGroup("finance"), "a@email.com", "c@email.com").
+		WithGroup(aws.NewGroup("aws-dev"), "a@email.com", "b@email.com").
+		WithGroup(aws.NewGroup("audit-2019")).
+		WithGroup(aws.NewGroup("aws-old"))
+
+	tests := []struct {
+		name     string
+		policies []config.GroupPolicy
+		want     []state.Change
+	}{
+		{"none", nil, []state.Change{
+			{Op: state.OpDelete, Kind: state.KindGroup, Name: "audit-2019"},
+			{Op: state.OpDelete, Kind: state.KindGroup, Name: "aws-old"},
+			{Op: state.OpDelete, Kind: state.KindMember, Name: "b@email.com", Group: "aws-dev"},
+			{Op: state.OpDelete, Kind: state.KindMember, Name: "c@email.com", Group: "finance"},
+			{Op: state.OpDelete, Kind: state.KindUser, Name: "b@email.com"},
+			{Op: state.OpDelete, Kind: state.KindUser, Name: "c@email.com"},
+		}},
+		{"protected", []config.GroupPolicy{
+			{Match: "finance@email.com", NeverDeleteMembers: true, NeverDeleteGroup: true},
+			{Match: "audit-*", NeverDeleteGroup: true},
+		}, []state.Change{
+			{Op: state.OpDelete, Kind: state.KindGroup, Name: "aws-old"},
+			{Op: state.OpDelete, Kind: state.KindMember, Name: "b@email.com", Group: "aws-dev"},
+			{Op: state.OpDelete, Kind: state.KindUser, Name: "b@email.com"},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.New()
+			cfg.MaxUserDeletions, cfg.MaxGroupDeletions = 0, 0
+			cfg.GroupPolicies = tt.policies
+			changes, err := newSyncGSuite(cfg, awsClient, googleClient, nil).getChanges(nil)
+			if err != nil {
+				t.Fatalf("getChanges() error = %v", err)
+			}
+			if got := changes.records(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("records() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,78 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/awslabs/ssosync/internal/aws"
+	log "github.com/sirupsen/logrus"
+)
+
+// userHash returns the hash of the attributes ssosync syncs to an AWS user.
+// The names are compared the way AWS SSO stores them, without surrounding
+// or repeated spaces, and user names case insensitively, so a difference
+// AWS SSO doesn't keep doesn't make the user look changed on every run.
+// The extended attributes, the language, the aliases, the user name and the
+// attributes of the templates of m are hashed too, when m syncs them.
+// Whether the user has an external id is hashed, not the id itself: the
+// users without one get the id of their Google user once, while the one set
+// by another tool is kept, see userMapping.update.
+func userHash(u *aws.User, m *userMapping) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%q %q %q %t %t",
+		strings.ToLower(u.Username),
+		strings.Join(strings.Fields(u.Name.GivenName), " "),
+		strings.Join(strings.Fields(u.Name.FamilyName), " "),
+		u.Active,
+		u.ExternalID != "")
+	if m.extended {
+		fmt.Fprintf(h, " %s", extendedAttributesOf(u))
+	}
+	if m.language {
+		fmt.Fprintf(h, " %q %q", u.PreferredLanguage, u.Locale)
+	}
+	if m.aliases {
+		fmt.Fprintf(h, " %q", aliasesOf(u))
+	}
+	if m.userName != nil {
+		fmt.Fprintf(h, " %q", strings.ToLower(u.SCIMUserName))
+	}
+	fmt.Fprint(h, m.hashed(u))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// withoutWrittenUsers removes the users to update whose attributes are the
+// ones ssosync wrote to AWS SSO in a previous run, while the AWS user is
+// still as it was then. AWS SSO may store attributes differently than they
+// were sent, which would otherwise update the users again on every run.
+func (s *syncGSuite) withoutWrittenUsers(users []*aws.User, awsUsers []*aws.User) []*aws.User {
+	current := make(map[string]*aws.User, len(awsUsers))
+	for _, u := range awsUsers {
+		current[aws.NormalizeName(u.Username)] = u
+	}
+	changed := make([]*aws.User, 0, len(users))
+	for _, u := range users {
+		if a, ok := current[aws.NormalizeName(u.Username)]; ok && s.state.UserWritten(u.Username, userHash(u, s.mapping), userHash(a, s.mapping)) {
+			log.WithField("user", u.Username).Debug("User attributes already written to AWS, skipping update")
+			continue
+		}
+		changed = append(changed, u)
+	}
+	return changed
+}
@@ -0,0 +1,94 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"testing"
+
+	"github.com/awslabs/ssosync/internal/aws"
+	awsfake "github.com/awslabs/ssosync/internal/aws/fake"
+	"github.com/awslabs/ssosync/internal/config"
+	googlefake "github.com/awslabs/ssosync/internal/google/fake"
+	"github.com/awslabs/ssosync/internal/state"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_userHash(t *testing.T) {
+	plain, extended := &userMapping{}, &userMapping{extended: true}
+	u := aws.NewUser("Ann Marie", "Smith", "ann@email.com", true)
+	assert.Equal(t, userHash(u, plain), userHash(aws.NewUser(" Ann  Marie", "Smith ", "Ann@Email.com", true), plain))
+	assert.NotEqual(t, userHash(u, plain), userHash(aws.NewUser("Ann", "Marie Smith", "ann@email.com", true), plain))
+	assert.NotEqual(t, userHash(u, plain), userHash(aws.NewUser("Ann Marie", "Smith", "ann@email.com", false), plain))
+
+	// a missing external id is backfilled, another one is kept
+	withID, otherID := *u, *u
+	withID.ExternalID, otherID.ExternalID = "id-1", "id-2"
+	assert.NotEqual(t, userHash(u, plain), userHash(&withID, plain))
+	assert.Equal(t, userHash(&withID, plain), userHash(&otherID, plain))
+
+	// the extended attributes only count when they are synced
+	phone := aws.NewUser("Ann Marie", "Smith", "ann@email.com", true)
+	phone.PhoneNumbers = []aws.UserPhoneNumber{{Value: "+44 20 7946 0000", Type: "work", Primary: true}}
+	assert.Equal(t, userHash(u, plain), userHash(phone, plain))
+	assert.NotEqual(t, userHash(u, extended), userHash(phone, extended))
+	assert.Equal(t, userHash(u, extended), userHash(aws.NewUser("Ann Marie", "Smith", "ann@email.com", true), extended))
+}
+
+func Test_withoutWrittenUsers(t *testing.T) {
+	update := aws.NewUser("Ann-Marie", "Smith", "ann@email.com", true)
+	// AWS SSO stored the name differently than it was sent
+	stored := aws.NewUser("Ann Marie", "Smith", "ann@email.com", true)
+	s := newSyncGSuite(config.New(), nil, nil, nil)
+
+	got := s.withoutWrittenUsers([]*aws.User{update}, []*aws.User{stored})
+	assert.Len(t, got, 1)
+
+	s.state.SetUserHashes("ann@email.com", userHash(update, &userMapping{}), userHash(stored, &userMapping{}))
+	got = s.withoutWrittenUsers([]*aws.User{update}, []*aws.User{stored})
+	assert.Empty(t, got)
+
+	// the AWS user was changed since it was written
+	changed := aws.NewUser("Ann", "Smith", "ann@email.com", true)
+	got = s.withoutWrittenUsers([]*aws.User{update}, []*aws.User{changed})
+	assert.Len(t, got, 1)
+}
+
+func TestSyncGroupsUsersUpdatesOnlyChangedUsers(t *testing.T) {
+	ann := googlefake.User("ann@email.com")
+	ann.Name.GivenName, ann.Name.FamilyName = "Ann", "Smith"
+	googleClient := googlefake.NewClient().
+		WithUsers(ann, googlefake.User("b@email.com")).
+		WithGroup(googlefake.Group("aws-dev@email.com"), "ann@email.com", "b@email.com")
+	b := aws.NewUser("b ", " b", "b@email.com", true)
+	b.ExternalID = "id-b@email.com"
+	awsClient := awsfake.NewClient().
+		WithUsers(syncedUser("ann@email.com"), b).
+		WithGroup(aws.NewGroup("aws-dev"), "ann@email.com", "b@email.com")
+	cfg := config.New()
+	cfg.Yes = true
+	st := state.New()
+
+	assert.NoError(t, newSyncGSuite(cfg, awsClient, googleClient, st).SyncGroupsUsers(nil))
+	// the names of Google are written to AWS, the spaces around the names of
+	// b are no reason to update them
+	u, _ := awsClient.FindUserByEmail("ann@email.com")
+	assert.Equal(t, "Ann", u.Name.GivenName)
+	assert.Equal(t, "Smith", u.Name.FamilyName)
+	assert.Equal(t, []state.Change{{Op: state.OpUpdate, Kind: state.KindUser, Name: "ann@email.com"}}, st.LastReport.Changes)
+	assert.NotEmpty(t, st.Users["ann@email.com"].Hash)
+
+	assert.NoError(t, newSyncGSuite(cfg, awsClient, googleClient, st).SyncGroupsUsers(nil))
+	assert.Empty(t, st.LastReport.Changes)
+}
@@ -0,0 +1,149 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"path"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/aws/aws-sdk-go/service/sns"
+	"github.com/aws/aws-sdk-go/service/sns/snsiface"
+	"github.com/awslabs/ssosync/internal/config"
+	"github.com/awslabs/ssosync/internal/state"
+	log "github.com/sirupsen/logrus"
+)
+
+// ErrPlanNotHeld is returned when no plan is held for an approval token
+var ErrPlanNotHeld = errors.New("no plan held for the approval token")
+
+// planHolder keeps the plans waiting for an approval until a run with their
+// approval token applies them
+type planHolder interface {
+	// Hold keeps the plan identified by token and notifies the approvers with
+	// subject and message
+	Hold(token string, p *Plan, subject string, message string) error
+	// Load returns the plan held for token, ErrPlanNotHeld when there is none
+	Load(token string) (*Plan, error)
+}
+
+// s3PlanHolder keeps the held plans in S3 and notifies the approvers with SNS
+type s3PlanHolder struct {
+	s3       s3iface.S3API
+	sns      snsiface.SNSAPI
+	bucket   string
+	prefix   string
+	topicARN string
+}
+
+// newPlanHolder creates the holder of the plans waiting for an approval,
+// nil when it isn't configured
+func newPlanHolder(cfg *config.Config) (planHolder, error) {
+	if cfg.ApprovalPlanURL == "" {
+		return nil, nil
+	}
+	if cfg.ApprovalSNSTopicARN == "" {
+		return nil, errors.New("an SNS topic is required to notify the approvers of held plans")
+	}
+	bucket, prefix, err := state.ParseS3URL(cfg.ApprovalPlanURL)
+	if err != nil {
+		return nil, err
+	}
+	sess, err := config.NewAWSSession(cfg.AWSProfile)
+	if err != nil {
+		log.WithError(err).Error("Error creating AWS session")
+		return nil, err
+	}
+	return &s3PlanHolder{
+		s3:       s3.New(sess),
+		sns:      sns.New(sess),
+		bucket:   bucket,
+		prefix:   prefix,
+		topicARN: cfg.ApprovalSNSTopicARN,
+	}, nil
+}
+
+// key returns the key of the object of the plan held for token
+func (h *s3PlanHolder) key(token string) string {
+	return path.Join(h.prefix, "plan-"+token+".json")
+}
+
+// Hold writes the plan to S3, then publishes the notification
+func (h *s3PlanHolder) Hold(token string, p *Plan, subject string, message string) error {
+	var b bytes.Buffer
+	if err := p.Write(&b); err != nil {
+		return err
+	}
+	_, err := h.s3.PutObject(&s3.PutObjectInput{
+		Bucket:      aws.String(h.bucket),
+		Key:         aws.String(h.key(token)),
+		Body:        bytes.NewReader(b.Bytes()),
+		ContentType: aws.String("application/json"),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = h.sns.Publish(&sns.PublishInput{
+		TopicArn: aws.String(h.topicARN),
+		Subject:  aws.String(subject),
+		Message:  aws.String(message),
+	})
+	return err
+}
+
+// Load reads the plan held for token from S3
+func (h *s3PlanHolder) Load(token string) (*Plan, error) {
+	out, err := h.s3.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(h.bucket),
+		Key:    aws.String(h.key(token)),
+	})
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == s3.ErrCodeNoSuchKey {
+		return nil, ErrPlanNotHeld
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer out.Body.Close()
+	return ReadPlan(out.Body)
+}
+
+// holdPlan holds the changes, identified by token, until they are approved,
+// the approvers are notified once
+func (s *syncGSuite) holdPlan(changes *changeSet, diff string, token string) error {
+	log := log.WithField("token", token)
+	_, err := s.holder.Load(token)
+	if err == nil {
+		log.Warn("Plan already held, waiting for its approval")
+		return nil
+	}
+	if !errors.Is(err, ErrPlanNotHeld) {
+		return err
+	}
+	p := newPlan(s.cfg.RunID, time.Now(), changes)
+	subject := fmt.Sprintf("ssosync: approve %d deletions (plan %s)", p.Summary.Delete, token)
+	message := fmt.Sprintf("ssosync run %s holds the plan below until it is approved. Invoke ssosync with the approval token %s, e.g. with the Lambda payload {\"approvalToken\": %q}, to apply it.\n\n%s",
+		s.cfg.RunID, token, token, diff)
+	if err := s.holder.Hold(token, p, subject, message); err != nil {
+		return err
+	}
+	log.Warn("Plan held, the approvers were notified")
+	return nil
+}
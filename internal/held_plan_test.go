@@ -0,0 +1,109 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/aws/aws-sdk-go/service/sns"
+	"github.com/aws/aws-sdk-go/service/sns/snsiface"
+	"github.com/awslabs/ssosync/internal/aws"
+	"github.com/awslabs/ssosync/internal/config"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeS3 keeps the objects in memory
+type fakeS3 struct {
+	s3iface.S3API
+	objects map[string][]byte
+}
+
+func (f *fakeS3) GetObject(in *s3.GetObjectInput) (*s3.GetObjectOutput, error) {
+	b, ok := f.objects[*in.Bucket+"/"+*in.Key]
+	if !ok {
+		return nil, awserr.New(s3.ErrCodeNoSuchKey, "not found", nil)
+	}
+	return &s3.GetObjectOutput{Body: ioutil.NopCloser(bytes.NewReader(b))}, nil
+}
+
+func (f *fakeS3) PutObject(in *s3.PutObjectInput) (*s3.PutObjectOutput, error) {
+	b, err := ioutil.ReadAll(in.Body)
+	if err != nil {
+		return nil, err
+	}
+	f.objects[*in.Bucket+"/"+*in.Key] = b
+	return &s3.PutObjectOutput{}, nil
+}
+
+// fakeSNS records the published messages
+type fakeSNS struct {
+	snsiface.SNSAPI
+	published []*sns.PublishInput
+}
+
+func (f *fakeSNS) Publish(in *sns.PublishInput) (*sns.PublishOutput, error) {
+	f.published = append(f.published, in)
+	return &sns.PublishOutput{}, nil
+}
+
+func TestHoldPlan(t *testing.T) {
+	changes := &changeSet{
+		deleteUsers: []*aws.User{
+			{Username: "a@example.com"},
+			{Username: "b@example.com"},
+			{Username: "c@example.com"},
+		},
+	}
+	_, token, err := planToken(changes)
+	assert.NoError(t, err)
+
+	cfg := config.New()
+	cfg.RunID = "run-1"
+	cfg.ApprovalDeletionThreshold = 2
+	objects := &fakeS3{objects: map[string][]byte{}}
+	topic := &fakeSNS{}
+	s := newSyncGSuite(cfg, nil, nil, nil)
+	s.holder = &s3PlanHolder{s3: objects, sns: topic, bucket: "bucket", prefix: "ssosync/plans", topicARN: "arn:aws:sns:eu-west-1:123456789012:approvals"}
+
+	// the plan is held and the approvers notified, once
+	_, err = s.approvePlan(changes)
+	assert.True(t, errors.Is(err, ErrPlanNotApproved))
+	_, err = s.approvePlan(changes)
+	assert.True(t, errors.Is(err, ErrPlanNotApproved))
+	assert.Len(t, topic.published, 1)
+	assert.Equal(t, "ssosync: approve 3 deletions (plan "+token+")", *topic.published[0].Subject)
+	assert.Contains(t, *topic.published[0].Message, "a@example.com")
+	assert.Contains(t, objects.objects, "bucket/ssosync/plans/plan-"+token+".json")
+
+	// the held plan is the plan of the changes
+	p, err := s.holder.Load(token)
+	assert.NoError(t, err)
+	assert.NoError(t, p.check(changes))
+	assert.Equal(t, 3, p.Summary.Delete)
+	_, err = s.holder.Load("other")
+	assert.True(t, errors.Is(err, ErrPlanNotHeld))
+
+	// the approval token approves it
+	cfg.ApprovalToken = token
+	approved, err := s.approvePlan(changes)
+	assert.NoError(t, err)
+	assert.True(t, approved)
+}
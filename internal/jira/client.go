@@ -0,0 +1,197 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package jira is a minimal client of the Jira REST API, to track the
+// approval of plans in issues
+package jira
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+)
+
+var (
+	// ErrIssueNotFound is returned when no issue matches a search
+	ErrIssueNotFound = errors.New("issue not found")
+)
+
+// Issue is a Jira issue
+type Issue struct {
+	Key    string
+	Status string
+}
+
+// Config is the configuration of the client
+type Config struct {
+	// URL is the base URL of Jira, e.g. https://corp.atlassian.net
+	URL   string
+	User  string
+	Token string
+}
+
+// Client represents an interface of methods used to communicate with Jira
+type Client interface {
+	// FindIssue returns the most recent issue of project with label
+	FindIssue(project string, label string) (*Issue, error)
+	// CreateIssue creates a task in project
+	CreateIssue(project string, summary string, description string, labels []string) (*Issue, error)
+}
+
+type client struct {
+	httpClient *http.Client
+	baseURL    *url.URL
+	user       string
+	token      string
+}
+
+// NewClient creates a new client to talk with the Jira REST API, it
+// authenticates with the user and its API token.
+func NewClient(c *http.Client, config *Config) (Client, error) {
+	u, err := url.Parse(config.URL)
+	if err != nil {
+		return nil, err
+	}
+	return &client{
+		httpClient: c,
+		baseURL:    u,
+		user:       config.User,
+		token:      config.Token,
+	}, nil
+}
+
+type searchResults struct {
+	Issues []struct {
+		Key    string `json:"key"`
+		Fields struct {
+			Status struct {
+				Name string `json:"name"`
+			} `json:"status"`
+		} `json:"fields"`
+	} `json:"issues"`
+}
+
+type createIssue struct {
+	Fields createIssueFields `json:"fields"`
+}
+
+type createIssueFields struct {
+	Project     key      `json:"project"`
+	Summary     string   `json:"summary"`
+	Description string   `json:"description"`
+	IssueType   name     `json:"issuetype"`
+	Labels      []string `json:"labels"`
+}
+
+type key struct {
+	Key string `json:"key"`
+}
+
+type name struct {
+	Name string `json:"name"`
+}
+
+// FindIssue implements Client
+func (c *client) FindIssue(project string, label string) (*Issue, error) {
+	u := *c.baseURL
+	u.Path = path.Join(u.Path, "/rest/api/2/search")
+	q := u.Query()
+	q.Set("jql", fmt.Sprintf("project = \"%s\" AND labels = \"%s\" ORDER BY created DESC", project, label))
+	q.Set("fields", "status")
+	q.Set("maxResults", "1")
+	u.RawQuery = q.Encode()
+
+	resp, err := c.send(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var r searchResults
+	if err := json.Unmarshal(resp, &r); err != nil {
+		return nil, err
+	}
+	if len(r.Issues) == 0 {
+		return nil, ErrIssueNotFound
+	}
+	return &Issue{Key: r.Issues[0].Key, Status: r.Issues[0].Fields.Status.Name}, nil
+}
+
+// CreateIssue implements Client
+func (c *client) CreateIssue(project string, summary string, description string, labels []string) (*Issue, error) {
+	u := *c.baseURL
+	u.Path = path.Join(u.Path, "/rest/api/2/issue")
+
+	resp, err := c.send(http.MethodPost, u.String(), &createIssue{
+		Fields: createIssueFields{
+			Project:     key{Key: project},
+			Summary:     summary,
+			Description: description,
+			IssueType:   name{Name: "Task"},
+			Labels:      labels,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var r key
+	if err := json.Unmarshal(resp, &r); err != nil {
+		return nil, err
+	}
+	return &Issue{Key: r.Key}, nil
+}
+
+// send sends a request with the JSON of body, if not nil, and returns the
+// body of the response
+func (c *client) send(method string, url string, body interface{}) ([]byte, error) {
+	var reader io.Reader
+	if body != nil {
+		d, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(d)
+	}
+
+	r, err := http.NewRequest(method, url, reader)
+	if err != nil {
+		return nil, err
+	}
+	r.SetBasicAuth(c.user, c.token)
+	r.Header.Set("Accept", "application/json")
+	if body != nil {
+		r.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.httpClient.Do(r)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	response, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < http.StatusOK || resp.StatusCode > http.StatusNoContent {
+		return nil, fmt.Errorf("jira returned status %d", resp.StatusCode)
+	}
+	return response, nil
+}
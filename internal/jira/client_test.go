@@ -0,0 +1,67 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jira
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClient(t *testing.T) {
+	var created createIssue
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, token, ok := r.BasicAuth()
+		assert.True(t, ok)
+		assert.Equal(t, "bot@corp.com", user)
+		assert.Equal(t, "secret", token)
+		switch r.URL.Path {
+		case "/jira/rest/api/2/search":
+			if r.URL.Query().Get("jql") == `project = "OPS" AND labels = "known" ORDER BY created DESC` {
+				_, _ = w.Write([]byte(`{"issues":[{"key":"OPS-1","fields":{"status":{"name":"Approved"}}}]}`))
+				return
+			}
+			_, _ = w.Write([]byte(`{"issues":[]}`))
+		case "/jira/rest/api/2/issue":
+			assert.Equal(t, http.MethodPost, r.Method)
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&created))
+			w.WriteHeader(http.StatusCreated)
+			_, _ = w.Write([]byte(`{"id":"10","key":"OPS-2"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	c, err := NewClient(srv.Client(), &Config{URL: srv.URL + "/jira", User: "bot@corp.com", Token: "secret"})
+	assert.NoError(t, err)
+
+	issue, err := c.FindIssue("OPS", "known")
+	assert.NoError(t, err)
+	assert.Equal(t, &Issue{Key: "OPS-1", Status: "Approved"}, issue)
+
+	_, err = c.FindIssue("OPS", "unknown")
+	assert.Equal(t, ErrIssueNotFound, err)
+
+	issue, err = c.CreateIssue("OPS", "summary", "description", []string{"ssosync"})
+	assert.NoError(t, err)
+	assert.Equal(t, "OPS-2", issue.Key)
+	assert.Equal(t, "OPS", created.Fields.Project.Key)
+	assert.Equal(t, "Task", created.Fields.IssueType.Name)
+	assert.Equal(t, []string{"ssosync"}, created.Fields.Labels)
+}
@@ -0,0 +1,51 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"github.com/awslabs/ssosync/internal/aws"
+	admin "google.golang.org/api/admin/directory/v1"
+)
+
+// googleLanguage is a language of a Google user, the Directory API tells
+// the preferred ones with their preference
+type googleLanguage struct {
+	LanguageCode string `json:"languageCode"`
+	Preference   string `json:"preference"`
+}
+
+// withLanguage sets the preferred language and the locale of u to the
+// preferred language of the Google user gUser, else its first language,
+// and returns u. The custom languages, free text, are left out.
+func withLanguage(u *aws.User, gUser *admin.User) *aws.User {
+	var languages []googleLanguage
+	if !decodeUserField(gUser.Languages, &languages) {
+		return u
+	}
+	code := ""
+	for _, l := range languages {
+		if l.LanguageCode == "" {
+			continue
+		}
+		if code == "" || l.Preference == "preferred" {
+			code = l.LanguageCode
+		}
+		if l.Preference == "preferred" {
+			break
+		}
+	}
+	u.PreferredLanguage, u.Locale = code, code
+	return u
+}
@@ -0,0 +1,84 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/awslabs/ssosync/internal/aws"
+	awsfake "github.com/awslabs/ssosync/internal/aws/fake"
+	"github.com/awslabs/ssosync/internal/config"
+	googlefake "github.com/awslabs/ssosync/internal/google/fake"
+	"github.com/stretchr/testify/assert"
+	admin "google.golang.org/api/admin/directory/v1"
+)
+
+// languageUser returns a Google user with languages, decoded from JSON like
+// the users of the Directory API
+func languageUser(t *testing.T, email string, languages string) *admin.User {
+	u := googlefake.User(email)
+	assert.NoError(t, json.Unmarshal([]byte(`{"languages": `+languages+`}`), u))
+	return u
+}
+
+func Test_withLanguage(t *testing.T) {
+	tests := []struct {
+		name      string
+		languages string
+		want      string
+	}{
+		{"preferred", `[{"languageCode": "en-GB", "preference": "not_preferred"}, {"languageCode": "fr", "preference": "preferred"}]`, "fr"},
+		{"first", `[{"customLanguage": "Klingon"}, {"languageCode": "de"}, {"languageCode": "en"}]`, "de"},
+		{"custom only", `[{"customLanguage": "Klingon"}]`, ""},
+		{"none", `null`, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := withLanguage(aws.NewUser("a", "a", "a@email.com", true), languageUser(t, "a@email.com", tt.languages))
+			assert.Equal(t, tt.want, u.PreferredLanguage)
+			assert.Equal(t, tt.want, u.Locale)
+		})
+	}
+}
+
+func TestSyncGroupsUsersLanguage(t *testing.T) {
+	gUser := languageUser(t, "a@email.com", `[{"languageCode": "en-GB", "preference": "preferred"}]`)
+	googleClient := googlefake.NewClient().
+		WithUsers(gUser).
+		WithGroup(googlefake.Group("aws-dev@email.com"), "a@email.com")
+	awsClient := awsfake.NewClient().
+		WithUsers(aws.NewUser("a", "a", "a@email.com", true)).
+		WithGroup(aws.NewGroup("aws-dev"), "a@email.com")
+	cfg := config.New()
+	cfg.Yes = true
+	cfg.SyncLanguage = true
+	cfg.UserAttributes = []config.UserAttribute{{Attribute: config.UserAttributeTimezone, Template: "Europe/London"}}
+
+	assert.NoError(t, newSyncGSuite(cfg, awsClient, googleClient, nil).SyncGroupsUsers(nil))
+	u, err := awsClient.FindUserByEmail("a@email.com")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"en-GB", "en-GB", "Europe/London"}, []string{u.PreferredLanguage, u.Locale, u.Timezone})
+
+	changes, err := newSyncGSuite(cfg, awsClient, googleClient, nil).getChanges(nil)
+	assert.NoError(t, err)
+	assert.Empty(t, changes.updateUsers)
+
+	// a change of language updates the user
+	assert.NoError(t, json.Unmarshal([]byte(`{"languages": [{"languageCode": "fr-FR", "preference": "preferred"}]}`), gUser))
+	changes, err = newSyncGSuite(cfg, awsClient, googleClient, nil).getChanges(nil)
+	assert.NoError(t, err)
+	assert.Len(t, changes.updateUsers, 1)
+}
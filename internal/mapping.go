@@ -0,0 +1,150 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/awslabs/ssosync/internal/aws"
+	"github.com/awslabs/ssosync/internal/config"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// MappingFormatText writes the mapping report for humans
+	MappingFormatText = "text"
+	// MappingFormatJSON writes the mapping report as JSON
+	MappingFormatJSON = "json"
+)
+
+// Mapping is an assignment of a permission set to an AWS SSO group in
+// accounts, e.g. as managed with Terraform
+type Mapping struct {
+	Group         string   `json:"group"`
+	PermissionSet string   `json:"permissionSet"`
+	Accounts      []string `json:"accounts"`
+}
+
+// MappingReport is the difference between the AWS SSO groups and the groups
+// of the mappings
+type MappingReport struct {
+	// DeadGroups are the AWS SSO groups no mapping refers to
+	DeadGroups []string `json:"deadGroups"`
+	// MissingGroups are the mappings whose group isn't in AWS SSO
+	MissingGroups []Mapping `json:"missingGroups"`
+}
+
+// ReadMappings reads a JSON array of mappings
+func ReadMappings(r io.Reader) ([]Mapping, error) {
+	var mappings []Mapping
+	if err := json.NewDecoder(r).Decode(&mappings); err != nil {
+		return nil, fmt.Errorf("invalid mappings: %w", err)
+	}
+	for i, m := range mappings {
+		if m.Group == "" {
+			return nil, fmt.Errorf("invalid mappings: mapping %d has no group", i)
+		}
+	}
+	return mappings, nil
+}
+
+// mappingReport returns the groups of AWS SSO without mapping and the
+// mappings without group, sorted by group
+func mappingReport(groups []*aws.Group, mappings []Mapping) *MappingReport {
+	existing := make(map[string]bool, len(groups))
+	for _, g := range groups {
+		existing[g.DisplayName] = true
+	}
+	mapped := make(map[string]bool, len(mappings))
+	r := &MappingReport{DeadGroups: []string{}, MissingGroups: []Mapping{}}
+	for _, m := range mappings {
+		mapped[m.Group] = true
+		if !existing[m.Group] {
+			r.MissingGroups = append(r.MissingGroups, m)
+		}
+	}
+	for _, g := range groups {
+		if !mapped[g.DisplayName] {
+			r.DeadGroups = append(r.DeadGroups, g.DisplayName)
+		}
+	}
+	sort.Strings(r.DeadGroups)
+	sort.SliceStable(r.MissingGroups, func(i, j int) bool {
+		return r.MissingGroups[i].Group < r.MissingGroups[j].Group
+	})
+	return r
+}
+
+// Problems tells whether the report found dead or missing groups
+func (r *MappingReport) Problems() bool {
+	return len(r.DeadGroups) > 0 || len(r.MissingGroups) > 0
+}
+
+// Write writes the report to w in format
+func (r *MappingReport) Write(w io.Writer, format string) error {
+	switch format {
+	case MappingFormatJSON:
+		e := json.NewEncoder(w)
+		e.SetIndent("", "  ")
+		return e.Encode(r)
+	case MappingFormatText:
+		if len(r.DeadGroups) > 0 {
+			fmt.Fprintln(w, "Dead groups, in AWS SSO but mapped to no permission set:")
+			for _, g := range r.DeadGroups {
+				fmt.Fprintf(w, "  %s\n", g)
+			}
+		}
+		if len(r.MissingGroups) > 0 {
+			fmt.Fprintln(w, "Missing groups, mapped to a permission set but not in AWS SSO:")
+			for _, m := range r.MissingGroups {
+				fmt.Fprintf(w, "  %s -> %s (%s)\n", m.Group, m.PermissionSet, strings.Join(m.Accounts, ", "))
+			}
+		}
+		_, err := fmt.Fprintf(w, "%d dead group(s), %d missing group(s)\n", len(r.DeadGroups), len(r.MissingGroups))
+		return err
+	default:
+		return fmt.Errorf("unknown mapping report format %q (%s|%s)", format, MappingFormatText, MappingFormatJSON)
+	}
+}
+
+// DoMappingReport compares the groups of AWS SSO with the groups of the
+// mappings. Only read access to the AWS SSO SCIM API is needed.
+func DoMappingReport(ctx context.Context, cfg *config.Config, mappings []Mapping) (*MappingReport, error) {
+	if cfg.RunID == "" {
+		cfg.RunID = newRunID()
+	}
+	log.WithField("runId", cfg.RunID).Info("Starting mapping report")
+	httpClient, _ := newHTTPClient(cfg, nil)
+	awsClient, err := newAWSClient(cfg, httpClient, true)
+	if err != nil {
+		return nil, err
+	}
+	groups, err := awsClient.GetGroups()
+	if err != nil {
+		log.Error("error getting aws groups")
+		return nil, err
+	}
+	r := mappingReport(groups, mappings)
+	log.WithFields(log.Fields{
+		"deadGroups":    len(r.DeadGroups),
+		"missingGroups": len(r.MissingGroups),
+	}).Info("Mapping report computed")
+	return r, nil
+}
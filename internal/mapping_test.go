@@ -0,0 +1,55 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/awslabs/ssosync/internal/aws"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMappingReport(t *testing.T) {
+	mappings, err := ReadMappings(strings.NewReader(`[
+		{"group": "AWS-dev", "permissionSet": "Developer", "accounts": ["111111111111"]},
+		{"group": "AWS-ops", "permissionSet": "Admin", "accounts": ["111111111111", "222222222222"]},
+		{"group": "AWS-dev", "permissionSet": "ReadOnly", "accounts": ["222222222222"]}
+	]`))
+	assert.NoError(t, err)
+	groups := []*aws.Group{{DisplayName: "AWS-old"}, {DisplayName: "AWS-dev"}, {DisplayName: "AWS-audit"}}
+
+	r := mappingReport(groups, mappings)
+	assert.True(t, r.Problems())
+	assert.Equal(t, []string{"AWS-audit", "AWS-old"}, r.DeadGroups)
+	assert.Equal(t, []Mapping{mappings[1]}, r.MissingGroups)
+
+	var out bytes.Buffer
+	assert.NoError(t, r.Write(&out, MappingFormatText))
+	assert.Equal(t, `Dead groups, in AWS SSO but mapped to no permission set:
+  AWS-audit
+  AWS-old
+Missing groups, mapped to a permission set but not in AWS SSO:
+  AWS-ops -> Admin (111111111111, 222222222222)
+2 dead group(s), 1 missing group(s)
+`, out.String())
+
+	r = mappingReport([]*aws.Group{{DisplayName: "AWS-dev"}}, mappings[:1])
+	assert.False(t, r.Problems())
+
+	_, err = ReadMappings(strings.NewReader(`[{"permissionSet": "Developer"}]`))
+	assert.Error(t, err)
+}
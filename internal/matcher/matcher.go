@@ -0,0 +1,92 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package matcher matches the emails of users and groups against the
+// entries of the ignore and include lists: exact emails, shell-style globs
+// or regular expressions
+package matcher
+
+import (
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// RegexPrefix marks the entries which are regular expressions matching the
+// whole email, e.g. "re:.*-bots@corp\.com"
+const RegexPrefix = "re:"
+
+// globChars are the characters making an entry a glob, e.g. "aws-*@corp.com"
+const globChars = "*?["
+
+// compiled are the match functions of the globs and regular expressions, by
+// entry, nil when the entry is invalid
+var compiled sync.Map
+
+// Match returns whether name is one of entries, or matches one of its globs
+// or regular expressions. An invalid entry, reported by Check, matches
+// nothing.
+func Match(entries []string, name string) bool {
+	for _, e := range entries {
+		if !IsPattern(e) {
+			if e == name {
+				return true
+			}
+			continue
+		}
+		match, ok := compiled.Load(e)
+		if !ok {
+			fn, _ := compile(e)
+			match, _ = compiled.LoadOrStore(e, fn)
+		}
+		if fn := match.(func(string) bool); fn != nil && fn(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsPattern returns whether entry is a glob or a regular expression, rather
+// than an email
+func IsPattern(entry string) bool {
+	return strings.HasPrefix(entry, RegexPrefix) || strings.ContainsAny(entry, globChars)
+}
+
+// Check returns an error when entry is an invalid glob or regular expression
+func Check(entry string) error {
+	_, err := compile(entry)
+	return err
+}
+
+// compile returns the function matching the names of entry
+func compile(entry string) (func(string) bool, error) {
+	if strings.HasPrefix(entry, RegexPrefix) {
+		re, err := regexp.Compile("^(?:" + strings.TrimPrefix(entry, RegexPrefix) + ")$")
+		if err != nil {
+			return nil, err
+		}
+		return re.MatchString, nil
+	}
+	if strings.ContainsAny(entry, globChars) {
+		if _, err := path.Match(entry, ""); err != nil {
+			return nil, err
+		}
+		return func(name string) bool {
+			ok, _ := path.Match(entry, name)
+			return ok
+		}, nil
+	}
+	return func(name string) bool { return name == entry }, nil
+}
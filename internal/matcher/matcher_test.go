@@ -0,0 +1,52 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package matcher
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatch(t *testing.T) {
+	entries := []string{"admin@corp.com", `re:.*-bots@corp\.com`, "aws-*@corp.com", "team-?@corp.com", "re:[invalid", "[invalid"}
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"admin@corp.com", true},
+		{"ci-bots@corp.com", true},
+		{"ci-bots@corp.com.evil", false},
+		{"aws-dev@corp.com", true},
+		{"aws-dev@corp.com.evil", false},
+		{"team-a@corp.com", true},
+		{"team-ab@corp.com", false},
+		{"user@corp.com", false},
+		{"[invalid", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, Match(entries, tt.name))
+		})
+	}
+}
+
+func TestCheck(t *testing.T) {
+	assert.NoError(t, Check("admin@corp.com"))
+	assert.NoError(t, Check("aws-*@corp.com"))
+	assert.NoError(t, Check(`re:.*-bots@corp\.com`))
+	assert.Error(t, Check("aws-[@corp.com"))
+	assert.Error(t, Check("re:aws-(.*"))
+}
@@ -0,0 +1,136 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/awslabs/ssosync/internal/config"
+	admin "google.golang.org/api/admin/directory/v1"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ErrMissingNames is returned when Google users have no given or family
+// name, which AWS SSO requires, and --missing-names is fail
+var ErrMissingNames = errors.New("google users without a given or family name")
+
+// namePlaceholder holds the fields of the template of the names missing
+type namePlaceholder struct {
+	// Email is the primary email of the user
+	Email string
+	// Local is the part of the email before the @
+	Local string
+}
+
+// missingName tells whether the user has no given or family name
+func missingName(u *admin.User) bool {
+	return u.Name == nil || strings.TrimSpace(u.Name.GivenName) == "" || strings.TrimSpace(u.Name.FamilyName) == ""
+}
+
+// handleMissingNames applies the --missing-names policy to the users without
+// a given or family name, before anything is sent to AWS SSO: all of them
+// are listed in the error with fail, they are left out of the users returned
+// with skip, and their names missing are filled from the template with
+// placeholder. The emails of the users left out are returned too.
+func (s *syncGSuite) handleMissingNames(users []*admin.User) ([]*admin.User, map[string]bool, error) {
+	offenders := make([]string, 0)
+	for _, u := range users {
+		if missingName(u) {
+			offenders = append(offenders, u.PrimaryEmail)
+		}
+	}
+	if len(offenders) == 0 {
+		return users, nil, nil
+	}
+	switch s.cfg.MissingNames {
+	case config.MissingNamesSkip:
+		skipped := make(map[string]bool, len(offenders))
+		for _, email := range offenders {
+			log.WithField("user", email).Warn("Skipping user without a given or family name")
+			skipped[email] = true
+		}
+		kept := make([]*admin.User, 0, len(users)-len(offenders))
+		for _, u := range users {
+			if !skipped[u.PrimaryEmail] {
+				kept = append(kept, u)
+			}
+		}
+		return kept, skipped, nil
+	case config.MissingNamesPlaceholder:
+		tmpl, err := template.New("placeholder").Parse(s.cfg.MissingNamePlaceholder)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, u := range users {
+			if !missingName(u) {
+				continue
+			}
+			if err := fillName(u, tmpl); err != nil {
+				return nil, nil, err
+			}
+			log.WithFields(log.Fields{
+				"user":       u.PrimaryEmail,
+				"givenName":  u.Name.GivenName,
+				"familyName": u.Name.FamilyName,
+			}).Warn("User without a given or family name, using the placeholder")
+		}
+		return users, nil, nil
+	default:
+		log.WithField("users", offenders).Error("Users without a given or family name, see --missing-names")
+		return nil, nil, fmt.Errorf("%w: %s", ErrMissingNames, strings.Join(offenders, ", "))
+	}
+}
+
+// fillName sets the given and family names missing of u from tmpl
+func fillName(u *admin.User, tmpl *template.Template) error {
+	var b bytes.Buffer
+	p := namePlaceholder{Email: u.PrimaryEmail, Local: strings.SplitN(u.PrimaryEmail, "@", 2)[0]}
+	if err := tmpl.Execute(&b, p); err != nil {
+		return err
+	}
+	if u.Name == nil {
+		u.Name = &admin.UserName{}
+	}
+	if strings.TrimSpace(u.Name.GivenName) == "" {
+		u.Name.GivenName = b.String()
+	}
+	if strings.TrimSpace(u.Name.FamilyName) == "" {
+		u.Name.FamilyName = b.String()
+	}
+	return nil
+}
+
+// withoutUsers returns the members of each group, without the users of
+// emails
+func withoutUsers(groupsUsers map[string][]*admin.User, emails map[string]bool) map[string][]*admin.User {
+	if len(emails) == 0 {
+		return groupsUsers
+	}
+	kept := make(map[string][]*admin.User, len(groupsUsers))
+	for group, users := range groupsUsers {
+		kept[group] = make([]*admin.User, 0, len(users))
+		for _, u := range users {
+			if !emails[u.PrimaryEmail] {
+				kept[group] = append(kept[group], u)
+			}
+		}
+	}
+	return kept
+}
@@ -0,0 +1,67 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/awslabs/ssosync/internal/config"
+	"github.com/stretchr/testify/assert"
+	admin "google.golang.org/api/admin/directory/v1"
+)
+
+func Test_handleMissingNames(t *testing.T) {
+	newUsers := func() []*admin.User {
+		return []*admin.User{
+			{PrimaryEmail: "user@email.com", Name: &admin.UserName{GivenName: "n", FamilyName: "l"}},
+			{PrimaryEmail: "billing@email.com", Name: &admin.UserName{GivenName: "Billing"}},
+			{PrimaryEmail: "noreply@email.com"},
+		}
+	}
+	cfg := config.New()
+	s := newSyncGSuite(cfg, nil, nil, nil)
+
+	_, _, err := s.handleMissingNames(newUsers())
+	assert.True(t, errors.Is(err, ErrMissingNames))
+	assert.Contains(t, err.Error(), "billing@email.com, noreply@email.com")
+
+	cfg.MissingNames = config.MissingNamesSkip
+	kept, skipped, err := s.handleMissingNames(newUsers())
+	assert.NoError(t, err)
+	assert.Len(t, kept, 1)
+	assert.Equal(t, map[string]bool{"billing@email.com": true, "noreply@email.com": true}, skipped)
+
+	cfg.MissingNames = config.MissingNamesPlaceholder
+	cfg.MissingNamePlaceholder = "{{.Local}}"
+	kept, skipped, err = s.handleMissingNames(newUsers())
+	assert.NoError(t, err)
+	assert.Empty(t, skipped)
+	assert.Equal(t, &admin.UserName{GivenName: "Billing", FamilyName: "billing"}, kept[1].Name)
+	assert.Equal(t, &admin.UserName{GivenName: "noreply", FamilyName: "noreply"}, kept[2].Name)
+}
+
+func Test_withoutUsers(t *testing.T) {
+	groupsUsers := map[string][]*admin.User{
+		"group-1": {{PrimaryEmail: "user@email.com"}, {PrimaryEmail: "noreply@email.com"}},
+		"group-2": {{PrimaryEmail: "noreply@email.com"}},
+	}
+	want := map[string][]*admin.User{
+		"group-1": {{PrimaryEmail: "user@email.com"}},
+		"group-2": {},
+	}
+	assert.Equal(t, want, withoutUsers(groupsUsers, map[string]bool{"noreply@email.com": true}))
+	assert.Equal(t, groupsUsers, withoutUsers(groupsUsers, nil))
+}
@@ -0,0 +1,92 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/awslabs/ssosync/internal/aws"
+	"github.com/awslabs/ssosync/internal/config"
+	"github.com/awslabs/ssosync/internal/errclass"
+	"github.com/awslabs/ssosync/internal/notify"
+	"github.com/awslabs/ssosync/internal/state"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/api/googleapi"
+)
+
+// notifyTimeout bounds the time spent sending the summary of a run
+const notifyTimeout = 30 * time.Second
+
+// newNotifiers creates the notifiers configured in cfg
+func newNotifiers(cfg *config.Config) []notify.Notifier {
+	httpClient := &http.Client{Timeout: notifyTimeout}
+	notifiers := make([]notify.Notifier, 0)
+	if cfg.TeamsWebhookURL != "" {
+		notifiers = append(notifiers, notify.NewTeams(httpClient, cfg.TeamsWebhookURL))
+	}
+	if cfg.PagerDutyRoutingKey != "" {
+		notifiers = append(notifiers, notify.NewPagerDuty(httpClient, cfg.PagerDutyRoutingKey))
+	}
+	return notifiers
+}
+
+// notifyRun sends the summary of the run to every notifier configured. The
+// report holds the changes of the run, it is nil when the run failed before
+// applying them. Failing to notify is logged but doesn't fail the run.
+func notifyRun(cfg *config.Config, report *state.Report, runErr error) {
+	notifiers := newNotifiers(cfg)
+	if len(notifiers) == 0 {
+		return
+	}
+	s := &notify.Summary{RunID: cfg.RunID, At: time.Now(), Err: runErr, Class: failureClass(runErr), ErrorClass: errclass.Of(runErr)}
+	if report != nil && report.RunID == cfg.RunID {
+		s.Changes = report.Changes
+		s.Usage = report.Usage
+	}
+	// the run may have been aborted by its context, the summary is sent anyway
+	ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+	defer cancel()
+	for _, n := range notifiers {
+		if err := n.Notify(ctx, s); err != nil {
+			log.WithError(err).Warn("Error sending the summary of the run")
+		}
+	}
+}
+
+// failureClass returns the class of the error which aborted a run, "" when
+// the run succeeded
+func failureClass(err error) string {
+	var awsErr *aws.ErrHttpNotOK
+	var googleErr *googleapi.Error
+	switch {
+	case err == nil:
+		return ""
+	case errors.Is(err, ErrDeletionThresholdExceeded):
+		return "deletion-threshold"
+	case errors.Is(err, ErrPlanNotApproved):
+		return "plan-approval"
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return "aborted"
+	case errors.As(err, &awsErr):
+		return "aws-scim"
+	case errors.As(err, &googleErr):
+		return "google"
+	default:
+		return "sync"
+	}
+}
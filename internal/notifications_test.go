@@ -0,0 +1,43 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/awslabs/ssosync/internal/aws"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/googleapi"
+)
+
+func TestFailureClass(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{nil, ""},
+		{fmt.Errorf("%w for users", ErrDeletionThresholdExceeded), "deletion-threshold"},
+		{fmt.Errorf("listing users: %w", context.Canceled), "aborted"},
+		{&aws.ErrHttpNotOK{StatusCode: 500}, "aws-scim"},
+		{&googleapi.Error{Code: 403}, "google"},
+		{errors.New("boom"), "sync"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, failureClass(tt.err), "%v", tt.err)
+	}
+}
@@ -0,0 +1,60 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package notify sends the summary of sync runs to chat and alerting services
+package notify
+
+import (
+	"context"
+	"time"
+
+	"github.com/awslabs/ssosync/internal/errclass"
+	"github.com/awslabs/ssosync/internal/state"
+)
+
+// Summary is the outcome of a sync run
+type Summary struct {
+	RunID string
+	At    time.Time
+	// Err is the error which aborted the run, nil when it succeeded
+	Err error
+	// Class is the class of Err, e.g. "google", failures of the same class
+	// are the same incident
+	Class string
+	// ErrorClass is the cause of Err when it is an error of a provider API,
+	// e.g. "quota", "" otherwise
+	ErrorClass errclass.Class
+	// Changes are the changes applied by the run
+	Changes []state.Change
+	// Usage are the resources used by the run, nil when it failed before
+	// applying the changes
+	Usage *state.Usage
+}
+
+// Count returns the number of changes of the run with the operation op on
+// entities of kind
+func (s *Summary) Count(op string, kind string) int {
+	n := 0
+	for _, c := range s.Changes {
+		if c.Op == op && c.Kind == kind {
+			n++
+		}
+	}
+	return n
+}
+
+// Notifier sends the summary of a run
+type Notifier interface {
+	Notify(ctx context.Context, s *Summary) error
+}
@@ -0,0 +1,102 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// pagerDutyEventsURL is the endpoint of the PagerDuty Events API v2
+const pagerDutyEventsURL = "https://events.pagerduty.com/v2/enqueue"
+
+// pagerDutyEvent is an event of the PagerDuty Events API v2, see
+// https://developer.pagerduty.com/docs/events-api-v2/trigger-events/
+type pagerDutyEvent struct {
+	RoutingKey  string           `json:"routing_key"`
+	EventAction string           `json:"event_action"`
+	DedupKey    string           `json:"dedup_key"`
+	Payload     pagerDutyPayload `json:"payload"`
+}
+
+type pagerDutyPayload struct {
+	Summary       string            `json:"summary"`
+	Source        string            `json:"source"`
+	Severity      string            `json:"severity"`
+	Component     string            `json:"component,omitempty"`
+	CustomDetails map[string]string `json:"custom_details,omitempty"`
+}
+
+type pagerDuty struct {
+	httpClient *http.Client
+	url        string
+	routingKey string
+}
+
+// NewPagerDuty creates a Notifier triggering a PagerDuty alert when a run
+// fails. Alerts are deduplicated by the class of the failure, so repeated
+// failures of the same class are a single incident.
+func NewPagerDuty(c *http.Client, routingKey string) Notifier {
+	return &pagerDuty{httpClient: c, url: pagerDutyEventsURL, routingKey: routingKey}
+}
+
+// Notify implements Notifier
+func (p *pagerDuty) Notify(ctx context.Context, s *Summary) error {
+	if s.Err == nil {
+		return nil
+	}
+	class := s.Class
+	if class == "" {
+		class = "sync"
+	}
+	body, err := json.Marshal(&pagerDutyEvent{
+		RoutingKey:  p.routingKey,
+		EventAction: "trigger",
+		DedupKey:    "ssosync-" + class,
+		Payload: pagerDutyPayload{
+			Summary:   fmt.Sprintf("ssosync run failed (%s): %s", class, s.Err),
+			Source:    "ssosync",
+			Severity:  "critical",
+			Component: class,
+			CustomDetails: map[string]string{
+				"runId":      s.RunID,
+				"error":      s.Err.Error(),
+				"errorClass": string(s.ErrorClass),
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	r, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	r.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.httpClient.Do(r)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < http.StatusOK || resp.StatusCode > http.StatusNoContent {
+		return fmt.Errorf("pagerduty returned status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/awslabs/ssosync/internal/errclass"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPagerDutyNotify(t *testing.T) {
+	var events []pagerDutyEvent
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var e pagerDutyEvent
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&e))
+		events = append(events, e)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer srv.Close()
+
+	p := NewPagerDuty(srv.Client(), "key").(*pagerDuty)
+	p.url = srv.URL
+
+	// successful runs don't alert
+	assert.NoError(t, p.Notify(context.Background(), &Summary{RunID: "run-1"}))
+	assert.Empty(t, events)
+
+	err := p.Notify(context.Background(), &Summary{RunID: "run-2", Err: errors.New("boom"), Class: "google", ErrorClass: errclass.Quota})
+	assert.NoError(t, err)
+	err = p.Notify(context.Background(), &Summary{RunID: "run-3", Err: errors.New("boom")})
+	assert.NoError(t, err)
+
+	assert.Len(t, events, 2)
+	assert.Equal(t, "key", events[0].RoutingKey)
+	assert.Equal(t, "trigger", events[0].EventAction)
+	assert.Equal(t, "ssosync-google", events[0].DedupKey)
+	assert.Equal(t, "run-2", events[0].Payload.CustomDetails["runId"])
+	assert.Equal(t, "quota", events[0].Payload.CustomDetails["errorClass"])
+	assert.Equal(t, "ssosync-sync", events[1].DedupKey)
+}
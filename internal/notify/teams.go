@@ -0,0 +1,131 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/awslabs/ssosync/internal/state"
+)
+
+const (
+	teamsColorSuccess = "2EB886"
+	teamsColorFailure = "D00000"
+)
+
+// teamsCard is a Microsoft Teams message card, see
+// https://docs.microsoft.com/en-us/outlook/actionable-messages/message-card-reference
+type teamsCard struct {
+	Type       string         `json:"@type"`
+	Context    string         `json:"@context"`
+	ThemeColor string         `json:"themeColor"`
+	Summary    string         `json:"summary"`
+	Title      string         `json:"title"`
+	Sections   []teamsSection `json:"sections"`
+}
+
+type teamsSection struct {
+	Facts []teamsFact `json:"facts"`
+	Text  string      `json:"text,omitempty"`
+}
+
+type teamsFact struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type teams struct {
+	httpClient *http.Client
+	webhookURL string
+}
+
+// NewTeams creates a Notifier posting the summary card of runs to a
+// Microsoft Teams incoming webhook
+func NewTeams(c *http.Client, webhookURL string) Notifier {
+	return &teams{httpClient: c, webhookURL: webhookURL}
+}
+
+// Notify implements Notifier
+func (t *teams) Notify(ctx context.Context, s *Summary) error {
+	body, err := json.Marshal(newTeamsCard(s))
+	if err != nil {
+		return err
+	}
+	r, err := http.NewRequestWithContext(ctx, http.MethodPost, t.webhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	r.Header.Set("Content-Type", "application/json")
+
+	resp, err := t.httpClient.Do(r)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < http.StatusOK || resp.StatusCode > http.StatusNoContent {
+		return fmt.Errorf("teams webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func newTeamsCard(s *Summary) *teamsCard {
+	title, color := "ssosync run succeeded", teamsColorSuccess
+	if s.Err != nil {
+		title, color = "ssosync run failed", teamsColorFailure
+	}
+	section := teamsSection{
+		Facts: []teamsFact{
+			{Name: "Run ID", Value: s.RunID},
+			{Name: "At", Value: s.At.UTC().Format(time.RFC3339)},
+			{Name: "Users added", Value: strconv.Itoa(s.Count(state.OpAdd, state.KindUser))},
+			{Name: "Users updated", Value: strconv.Itoa(s.Count(state.OpUpdate, state.KindUser))},
+			{Name: "Users deleted", Value: strconv.Itoa(s.Count(state.OpDelete, state.KindUser))},
+			{Name: "Groups added", Value: strconv.Itoa(s.Count(state.OpAdd, state.KindGroup))},
+			{Name: "Groups renamed", Value: strconv.Itoa(s.Count(state.OpUpdate, state.KindGroup))},
+			{Name: "Groups deleted", Value: strconv.Itoa(s.Count(state.OpDelete, state.KindGroup))},
+			{Name: "Members added", Value: strconv.Itoa(s.Count(state.OpAdd, state.KindMember))},
+			{Name: "Members removed", Value: strconv.Itoa(s.Count(state.OpDelete, state.KindMember))},
+		},
+	}
+	if s.Usage != nil {
+		section.Facts = append(section.Facts,
+			teamsFact{Name: "Requests", Value: strconv.FormatInt(s.Usage.Requests, 10)},
+			teamsFact{Name: "Retries", Value: strconv.FormatInt(s.Usage.Retries, 10)},
+			teamsFact{Name: "Throttle wait", Value: time.Duration(s.Usage.ThrottleWaitSeconds * float64(time.Second)).Round(time.Millisecond).String()},
+			teamsFact{Name: "Peak heap", Value: fmt.Sprintf("%.1f MiB", float64(s.Usage.PeakMemoryBytes)/(1<<20))},
+		)
+	}
+	if s.Err != nil {
+		section.Text = s.Err.Error()
+		if s.ErrorClass != "" {
+			section.Facts = append(section.Facts, teamsFact{Name: "Error class", Value: string(s.ErrorClass)})
+		}
+	}
+	return &teamsCard{
+		Type:       "MessageCard",
+		Context:    "http://schema.org/extensions",
+		ThemeColor: color,
+		Summary:    title,
+		Title:      title,
+		Sections:   []teamsSection{section},
+	}
+}
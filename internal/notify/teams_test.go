@@ -0,0 +1,81 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/awslabs/ssosync/internal/state"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTeamsNotify(t *testing.T) {
+	var card teamsCard
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&card))
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	s := &Summary{
+		RunID: "run-1",
+		At:    time.Date(2026, 10, 16, 7, 0, 0, 0, time.UTC),
+		Changes: []state.Change{
+			{Op: state.OpAdd, Kind: state.KindUser, Name: "a@example.com"},
+			{Op: state.OpAdd, Kind: state.KindMember, Name: "a@example.com", Group: "g"},
+			{Op: state.OpAdd, Kind: state.KindMember, Name: "b@example.com", Group: "g"},
+		},
+		Usage: &state.Usage{Requests: 42, Retries: 2, ThrottleWaitSeconds: 1.5, PeakMemoryBytes: 64 << 20},
+	}
+	err := NewTeams(srv.Client(), srv.URL).Notify(context.Background(), s)
+	assert.NoError(t, err)
+	assert.Equal(t, "ssosync run succeeded", card.Title)
+	assert.Equal(t, teamsColorSuccess, card.ThemeColor)
+	facts := map[string]string{}
+	for _, f := range card.Sections[0].Facts {
+		facts[f.Name] = f.Value
+	}
+	assert.Equal(t, "run-1", facts["Run ID"])
+	assert.Equal(t, "1", facts["Users added"])
+	assert.Equal(t, "2", facts["Members added"])
+	assert.Equal(t, "0", facts["Users deleted"])
+	assert.Equal(t, "42", facts["Requests"])
+	assert.Equal(t, "2", facts["Retries"])
+	assert.Equal(t, "1.5s", facts["Throttle wait"])
+	assert.Equal(t, "64.0 MiB", facts["Peak heap"])
+}
+
+func TestTeamsNotify_Failure(t *testing.T) {
+	var card teamsCard
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&card))
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	err := NewTeams(srv.Client(), srv.URL).Notify(context.Background(), &Summary{RunID: "run-1", Err: errors.New("boom")})
+	assert.Error(t, err)
+	assert.Equal(t, "ssosync run failed", card.Title)
+	assert.Equal(t, teamsColorFailure, card.ThemeColor)
+	assert.Equal(t, "boom", card.Sections[0].Text)
+}
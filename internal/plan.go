@@ -0,0 +1,181 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/awslabs/ssosync/internal/config"
+	"github.com/awslabs/ssosync/internal/state"
+	log "github.com/sirupsen/logrus"
+)
+
+// PlanFormatVersion is the version of the format of plans, it changes when
+// the format changes in a way that isn't backward compatible
+const PlanFormatVersion = "1"
+
+// ErrPlanStale is returned when applying a plan computed from a state of
+// Google Workspace or AWS SSO which changed since
+var ErrPlanStale = errors.New("Google Workspace or AWS SSO changed since the plan was computed")
+
+// Plan is the machine-readable plan of the changes a sync would make to AWS
+// SSO
+type Plan struct {
+	FormatVersion string    `json:"formatVersion"`
+	RunID         string    `json:"runId"`
+	CreatedAt     time.Time `json:"createdAt"`
+	// Fingerprint identifies the changes and the state of the Google users
+	// they were computed from
+	Fingerprint string         `json:"fingerprint"`
+	Summary     PlanSummary    `json:"summary"`
+	Changes     []state.Change `json:"changes"`
+	// SnapshotTakenAt is set when the plan was computed offline, from a
+	// snapshot taken then, such a plan may be stale and can't be applied
+	SnapshotTakenAt *time.Time `json:"snapshotTakenAt,omitempty"`
+}
+
+// PlanSummary counts the changes of a plan by operation
+type PlanSummary struct {
+	Add    int `json:"add"`
+	Update int `json:"update"`
+	Delete int `json:"delete"`
+}
+
+// newPlan returns the plan of changes
+func newPlan(runID string, now time.Time, changes *changeSet) *Plan {
+	p := &Plan{
+		FormatVersion: PlanFormatVersion,
+		RunID:         runID,
+		CreatedAt:     now.UTC(),
+		Fingerprint:   planFingerprint(changes),
+		Changes:       changes.records(),
+	}
+	for _, c := range p.Changes {
+		switch c.Op {
+		case state.OpAdd:
+			p.Summary.Add++
+		case state.OpUpdate:
+			p.Summary.Update++
+		case state.OpDelete:
+			p.Summary.Delete++
+		}
+	}
+	return p
+}
+
+// planFingerprint hashes the changes and the etags of the Google users in
+// scope, so a change to the plan or to one of the users is detected
+func planFingerprint(changes *changeSet) string {
+	h := sha256.New()
+	for _, c := range changes.records() {
+		fmt.Fprintln(h, formatChange(c))
+	}
+	users := make([]string, 0, len(changes.googleUsers))
+	for _, u := range changes.googleUsers {
+		users = append(users, u.PrimaryEmail+" "+u.Etag)
+	}
+	sort.Strings(users)
+	for _, u := range users {
+		fmt.Fprintln(h, u)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// ReadPlan reads a plan written by Write
+func ReadPlan(r io.Reader) (*Plan, error) {
+	var p Plan
+	if err := json.NewDecoder(r).Decode(&p); err != nil {
+		return nil, fmt.Errorf("invalid plan: %w", err)
+	}
+	if p.FormatVersion != PlanFormatVersion {
+		return nil, fmt.Errorf("unsupported plan format version %q, expected %q", p.FormatVersion, PlanFormatVersion)
+	}
+	if p.Fingerprint == "" {
+		return nil, errors.New("invalid plan: no fingerprint")
+	}
+	return &p, nil
+}
+
+// check returns ErrPlanStale when the changes computed now aren't the ones
+// of the plan
+func (p *Plan) check(changes *changeSet) error {
+	if fingerprint := planFingerprint(changes); fingerprint != p.Fingerprint {
+		log.WithFields(log.Fields{
+			"plan":    p.Fingerprint,
+			"current": fingerprint,
+		}).Error("The plan is stale, compute a new one")
+		return ErrPlanStale
+	}
+	return nil
+}
+
+// Drift tells whether AWS SSO differs from Google Workspace, i.e. the plan
+// has changes
+func (p *Plan) Drift() bool {
+	return len(p.Changes) > 0
+}
+
+// Write writes the plan as indented JSON to w
+func (p *Plan) Write(w io.Writer) error {
+	e := json.NewEncoder(w)
+	e.SetIndent("", "  ")
+	return e.Encode(p)
+}
+
+// DoPlan computes the changes a sync would apply, like DoDiff, and returns
+// them as a plan. Only read access is needed.
+func DoPlan(ctx context.Context, cfg *config.Config) (*Plan, error) {
+	if cfg.SyncMethod != config.DefaultSyncMethod {
+		return nil, fmt.Errorf("plan is only supported with the %q sync method", config.DefaultSyncMethod)
+	}
+	if cfg.RunID == "" {
+		cfg.RunID = newRunID()
+	}
+	log.WithField("runId", cfg.RunID).Info("Starting plan")
+	googleClient, awsClient, recorder, snap, err := readOnlyClients(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	_, st, err := loadState(cfg)
+	if err != nil {
+		return nil, err
+	}
+	changes, err := newSyncGSuite(cfg, awsClient, googleClient, st).getChanges(cfg.GroupMatch)
+	if err != nil {
+		log.WithError(err).Error("Error computing changes")
+		return nil, err
+	}
+	if err := saveSnapshot(cfg, recorder); err != nil {
+		return nil, err
+	}
+	p := newPlan(cfg.RunID, time.Now(), changes)
+	if snap != nil {
+		p.SnapshotTakenAt = &snap.TakenAt
+	}
+	log.WithFields(log.Fields{
+		"add":    p.Summary.Add,
+		"update": p.Summary.Update,
+		"delete": p.Summary.Delete,
+	}).Info("Plan computed")
+	return p, nil
+}
@@ -0,0 +1,103 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/awslabs/ssosync/internal/aws"
+	"github.com/stretchr/testify/assert"
+	admin "google.golang.org/api/admin/directory/v1"
+)
+
+func TestPlan(t *testing.T) {
+	now := time.Date(2026, 10, 16, 7, 0, 0, 0, time.UTC)
+
+	p := newPlan("run-1", now, &changeSet{})
+	assert.False(t, p.Drift())
+
+	p = newPlan("run-1", now, &changeSet{
+		addUsers:    []*aws.User{{Username: "a@example.com"}},
+		deleteUsers: []*aws.User{{Username: "b@example.com"}},
+		addMembers:  map[string][]*admin.User{"dev": {{PrimaryEmail: "a@example.com"}}},
+	})
+	assert.True(t, p.Drift())
+	assert.Equal(t, PlanSummary{Add: 2, Delete: 1}, p.Summary)
+
+	var b bytes.Buffer
+	assert.NoError(t, p.Write(&b))
+	assert.Equal(t, `{
+  "formatVersion": "1",
+  "runId": "run-1",
+  "createdAt": "2026-10-16T07:00:00Z",
+  "fingerprint": "45c4cc844c4e46c5f9eb739e6181f21e47c080b36ef923d5dc0052e210064a55",
+  "summary": {
+    "add": 2,
+    "update": 0,
+    "delete": 1
+  },
+  "changes": [
+    {
+      "op": "add",
+      "kind": "member",
+      "name": "a@example.com",
+      "group": "dev"
+    },
+    {
+      "op": "add",
+      "kind": "user",
+      "name": "a@example.com"
+    },
+    {
+      "op": "delete",
+      "kind": "user",
+      "name": "b@example.com"
+    }
+  ]
+}
+`, b.String())
+}
+
+func TestPlanApply(t *testing.T) {
+	now := time.Date(2026, 10, 16, 7, 0, 0, 0, time.UTC)
+	changes := &changeSet{
+		addUsers:    []*aws.User{{Username: "a@example.com"}},
+		googleUsers: []*admin.User{{PrimaryEmail: "a@example.com", Etag: "1"}},
+	}
+
+	var b bytes.Buffer
+	assert.NoError(t, newPlan("run-1", now, changes).Write(&b))
+	p, err := ReadPlan(&b)
+	assert.NoError(t, err)
+	assert.NoError(t, p.check(changes))
+
+	// a Google user changed
+	changes.googleUsers[0].Etag = "2"
+	assert.Equal(t, ErrPlanStale, p.check(changes))
+	changes.googleUsers[0].Etag = "1"
+
+	// the changes differ
+	changes.deleteUsers = []*aws.User{{Username: "b@example.com"}}
+	assert.Equal(t, ErrPlanStale, p.check(changes))
+
+	_, err = ReadPlan(bytes.NewBufferString(`{"formatVersion":"0","fingerprint":"x"}`))
+	assert.Error(t, err)
+	_, err = ReadPlan(bytes.NewBufferString(`{"formatVersion":"1"}`))
+	assert.Error(t, err)
+	_, err = ReadPlan(bytes.NewBufferString(`not json`))
+	assert.Error(t, err)
+}
@@ -0,0 +1,252 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/awslabs/ssosync/internal/aws"
+	"github.com/awslabs/ssosync/internal/config"
+	"github.com/awslabs/ssosync/internal/google"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/oauth2"
+	admin "google.golang.org/api/admin/directory/v1"
+)
+
+// errPreflightDone stops a list after its first result, a check only needs
+// the first page
+var errPreflightDone = errors.New("preflight check done")
+
+// PreflightCheck is a check of the readiness of ssosync to sync
+type PreflightCheck struct {
+	Name string
+	// Problem is why the check failed, empty when it passed
+	Problem string
+	// Fix is how to fix the problem
+	Fix string
+	// Skipped is true when the check wasn't run, as a check it depends on
+	// failed, Problem is then that check
+	Skipped bool
+}
+
+// PreflightReport is the readiness of ssosync to sync, with the checks in
+// the order they were run
+type PreflightReport struct {
+	Checks []PreflightCheck
+}
+
+// Ready returns true when every check passed
+func (r *PreflightReport) Ready() bool {
+	for _, c := range r.Checks {
+		if c.Problem != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// check runs the check name, fix being how to fix its error, and returns
+// whether it passed
+func (r *PreflightReport) check(name string, fix string, fn func() error) bool {
+	err := fn()
+	if errors.Is(err, errPreflightDone) {
+		err = nil
+	}
+	c := PreflightCheck{Name: name}
+	if err != nil {
+		c.Problem, c.Fix = err.Error(), fix
+	}
+	r.Checks = append(r.Checks, c)
+	return err == nil
+}
+
+// skip records the check name as not run, because the check failed failed
+func (r *PreflightReport) skip(name string, failed string) {
+	r.Checks = append(r.Checks, PreflightCheck{Name: name, Problem: failed + " failed", Skipped: true})
+}
+
+// Write writes the report for humans to w
+func (r *PreflightReport) Write(w io.Writer) error {
+	failed, skipped := 0, 0
+	for _, c := range r.Checks {
+		switch {
+		case c.Skipped:
+			skipped++
+			fmt.Fprintf(w, "skip  %s, %s\n", c.Name, c.Problem)
+		case c.Problem != "":
+			failed++
+			fmt.Fprintf(w, "FAIL  %s: %s\n", c.Name, c.Problem)
+			fmt.Fprintf(w, "      fix: %s\n", c.Fix)
+		default:
+			fmt.Fprintf(w, "ok    %s\n", c.Name)
+		}
+	}
+	if r.Ready() {
+		_, err := fmt.Fprintf(w, "Ready to sync, %d check(s) passed\n", len(r.Checks))
+		return err
+	}
+	_, err := fmt.Fprintf(w, "Not ready to sync, %d check(s) failed, %d skipped\n", failed, skipped)
+	return err
+}
+
+// checkConfig checks the settings of cfg are consistent, filter syntax
+// included
+func (r *PreflightReport) checkConfig(cfg *config.Config) {
+	problems := config.Lint(cfg)
+	for _, p := range problems {
+		r.Checks = append(r.Checks, PreflightCheck{Name: "configuration", Problem: p.Message, Fix: p.Fix})
+	}
+	if len(problems) == 0 {
+		r.Checks = append(r.Checks, PreflightCheck{Name: "configuration"})
+	}
+}
+
+// checkGoogle checks googleClient reads the users, the groups and their
+// members, and that the queries of cfg are valid. The queries aren't checked
+// when the users, or groups, can't be read at all, they would fail the same.
+func (r *PreflightReport) checkGoogle(cfg *config.Config, googleClient google.Client) {
+	usersRead := r.check("Google users", "check --google-customer-id, and that the admin of --google-admin can read the users",
+		func() error {
+			return googleClient.ForEachUser("", func(*admin.User) error { return errPreflightDone })
+		})
+	var group *admin.Group
+	groupsRead := r.check("Google groups", "check that the admin of --google-admin can read the groups",
+		func() error {
+			return googleClient.ForEachGroup("", func(g *admin.Group) error {
+				group = g
+				return errPreflightDone
+			})
+		})
+	if !groupsRead {
+		r.skip("Google group members", "Google groups")
+	} else if group != nil {
+		r.check("Google group members", "check that the admin of --google-admin can read the members of the groups",
+			func() error {
+				_, err := googleClient.GetGroupMembers(group)
+				return err
+			})
+	}
+	if cfg.UserMatch != "" {
+		name := fmt.Sprintf("Google user query %q", cfg.UserMatch)
+		if !usersRead {
+			r.skip(name, "Google users")
+		} else {
+			r.check(name, "fix --user-match, see https://developers.google.com/admin-sdk/directory/v1/guides/search-users",
+				func() error {
+					return googleClient.ForEachUser(cfg.UserMatch, func(*admin.User) error { return errPreflightDone })
+				})
+		}
+	}
+	for _, q := range cfg.GroupMatch {
+		q := q
+		name := fmt.Sprintf("Google group query %q", q)
+		if !groupsRead {
+			r.skip(name, "Google groups")
+			continue
+		}
+		r.check(name, "fix --group-match, see https://developers.google.com/admin-sdk/directory/v1/guides/search-groups",
+			func() error {
+				return googleClient.ForEachGroup(q, func(*admin.Group) error { return errPreflightDone })
+			})
+	}
+	for _, l := range cfg.GroupLabels {
+		l := l
+		r.check(fmt.Sprintf("Google group label %q", l),
+			fmt.Sprintf("grant the service account the domain-wide delegation of the scopes %s, or set --google-customer-id", strings.Join(google.LabelScopes, ",")),
+			func() error {
+				_, err := googleClient.GetGroupsWithLabel(l)
+				return err
+			})
+	}
+}
+
+// checkSCIM checks awsClient, created by newAWSClient, reads the users with
+// its access token, the check is name
+func (r *PreflightReport) checkSCIM(name string, fix string, newAWSClient func() (aws.Client, error)) {
+	var awsClient aws.Client
+	if !r.check(name+" endpoint", "check --endpoint, --access-token-secret and --scim-headers",
+		func() (err error) {
+			awsClient, err = newAWSClient()
+			return err
+		}) {
+		r.skip(name+" access token", name+" endpoint")
+		return
+	}
+	r.check(name+" access token", fix,
+		func() error {
+			return awsClient.ForEachUser(func(*aws.User) error { return errPreflightDone })
+		})
+}
+
+// DoPreflight checks ssosync is ready to sync with cfg, without changing
+// anything: the settings are consistent, the Google credentials impersonate
+// the admin with the scopes ssosync needs, the users, groups and members
+// can be read with the queries of cfg, and the SCIM endpoint accepts the
+// access tokens.
+func DoPreflight(ctx context.Context, cfg *config.Config) *PreflightReport {
+	if cfg.RunID == "" {
+		cfg.RunID = newRunID()
+	}
+	log.WithField("runId", cfg.RunID).Info("Starting preflight checks")
+	r := &PreflightReport{}
+	r.checkConfig(cfg)
+
+	httpClient, transport := newHTTPClient(cfg, nil)
+	var tokens oauth2.TokenSource
+	if !r.check("Google credentials", "set --google-credentials to the JSON key of the service account",
+		func() error {
+			creds, err := googleCredentials(cfg)
+			if err != nil {
+				return err
+			}
+			tokens, err = googleTokens(cfg.GoogleAdmin, creds, googleScopes(cfg)...)
+			return err
+		}) {
+		r.skip("Google admin impersonation", "Google credentials")
+	} else if !r.check("Google admin impersonation",
+		fmt.Sprintf("set --google-admin to the email of an admin, and grant the service account the domain-wide delegation of the scopes %s", strings.Join(append(append([]string{}, google.ReadScopes...), googleScopes(cfg)...), ",")),
+		func() error {
+			_, err := tokens.Token()
+			return err
+		}) {
+		r.skip("Google users, groups and queries", "Google admin impersonation")
+	} else {
+		googleTransport := google.NewThrottledTransport(transport, cfg.GoogleRequestsPerSecond)
+		googleClient, err := google.NewClient(ctx, tokens, cfg.GoogleCustomerId, &http.Client{Transport: googleTransport}, cfg.GooglePageSize, config.ReadSchemaNames(cfg))
+		if err != nil {
+			r.check("Google client", "check the Google credentials", func() error { return err })
+		} else {
+			r.checkGoogle(cfg, googleClient)
+		}
+	}
+
+	// the access token of the sync is checked read-only
+	syncCfg := *cfg
+	syncCfg.SCIMReadAccessToken, syncCfg.SCIMReadAWSProfile = "", ""
+	r.checkSCIM("SCIM", "set --access-token to a valid access token of the SCIM endpoint, they expire a year after they are created",
+		func() (aws.Client, error) { return newAWSClient(&syncCfg, httpClient, true) })
+	if cfg.SCIMReadAccessToken != "" || cfg.SCIMReadAWSProfile != "" {
+		r.checkSCIM("SCIM read", "set --read-access-token, or --read-aws-profile, to valid credentials of the SCIM endpoint",
+			func() (aws.Client, error) { return newAWSClient(cfg, httpClient, true) })
+	}
+
+	log.WithField("ready", r.Ready()).Info("Preflight checks done")
+	return r
+}
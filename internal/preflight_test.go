@@ -0,0 +1,98 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/awslabs/ssosync/internal/aws"
+	awsfake "github.com/awslabs/ssosync/internal/aws/fake"
+	"github.com/awslabs/ssosync/internal/config"
+	"github.com/awslabs/ssosync/internal/google"
+	googlefake "github.com/awslabs/ssosync/internal/google/fake"
+	"github.com/stretchr/testify/assert"
+	admin "google.golang.org/api/admin/directory/v1"
+)
+
+// groupsDeniedGoogleClient fails to list the groups, as when the scope of
+// the groups isn't granted
+type groupsDeniedGoogleClient struct {
+	google.Client
+}
+
+func (c *groupsDeniedGoogleClient) ForEachGroup(string, func(*admin.Group) error) error {
+	return errors.New("403 Not Authorized to access this resource/api")
+}
+
+func TestPreflightReport(t *testing.T) {
+	googleClient := googlefake.NewClient().
+		WithUsers(googlefake.User("a@email.com")).
+		WithGroup(googlefake.Group("aws-dev@email.com"), "a@email.com")
+	awsClient := awsfake.NewClient().WithUsers(aws.NewUser("a", "a", "a@email.com", true))
+	cfg := config.New()
+	cfg.GroupMatch = []string{"email:aws-*"}
+	cfg.GroupLabels = []string{google.SecurityLabel}
+
+	r := &PreflightReport{}
+	r.checkConfig(cfg)
+	r.checkGoogle(cfg, googleClient)
+	r.checkSCIM("SCIM", "set --access-token", func() (aws.Client, error) { return awsClient, nil })
+	assert.True(t, r.Ready())
+	var out bytes.Buffer
+	assert.NoError(t, r.Write(&out))
+	assert.Equal(t, `ok    configuration
+ok    Google users
+ok    Google groups
+ok    Google group members
+ok    Google group query "email:aws-*"
+ok    Google group label "cloudidentity.googleapis.com/groups.security"
+ok    SCIM endpoint
+ok    SCIM access token
+Ready to sync, 8 check(s) passed
+`, out.String())
+
+	r = &PreflightReport{}
+	r.checkGoogle(cfg, &groupsDeniedGoogleClient{googleClient})
+	r.checkSCIM("SCIM", "set --access-token", func() (aws.Client, error) { return nil, aws.ErrUserNotFound })
+	assert.False(t, r.Ready())
+	out.Reset()
+	assert.NoError(t, r.Write(&out))
+	assert.Equal(t, `ok    Google users
+FAIL  Google groups: 403 Not Authorized to access this resource/api
+      fix: check that the admin of --google-admin can read the groups
+skip  Google group members, Google groups failed
+skip  Google group query "email:aws-*", Google groups failed
+ok    Google group label "cloudidentity.googleapis.com/groups.security"
+FAIL  SCIM endpoint: user not found
+      fix: check --endpoint, --access-token-secret and --scim-headers
+skip  SCIM access token, SCIM endpoint failed
+Not ready to sync, 2 check(s) failed, 3 skipped
+`, out.String())
+}
+
+func TestPreflightReportConfig(t *testing.T) {
+	cfg := config.New()
+	cfg.IgnoreUsers = []string{"re:("}
+
+	r := &PreflightReport{}
+	r.checkConfig(cfg)
+	assert.False(t, r.Ready())
+	if assert.Len(t, r.Checks, 1) {
+		assert.Equal(t, "configuration", r.Checks[0].Name)
+		assert.NotEmpty(t, r.Checks[0].Fix)
+	}
+}
@@ -0,0 +1,92 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/pprof"
+	"runtime/trace"
+
+	"github.com/awslabs/ssosync/internal/config"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// profilePath returns the path of the file the profile is written to, in
+// the temporary directory by default as the working directory may be read
+// only, e.g. on Lambda
+func profilePath(cfg *config.Config) string {
+	if cfg.PprofFile != "" {
+		return cfg.PprofFile
+	}
+	return filepath.Join(os.TempDir(), fmt.Sprintf("ssosync.%s.pprof", cfg.Pprof))
+}
+
+// startProfile starts the --pprof profile of a run, the function returned
+// stops it and writes the profile. Nothing is profiled without --pprof.
+func startProfile(cfg *config.Config) (func() error, error) {
+	if cfg.Pprof == "" {
+		return func() error { return nil }, nil
+	}
+	path := profilePath(cfg)
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	log := log.WithFields(log.Fields{"profile": cfg.Pprof, "path": path})
+	stop := func() error { return nil }
+	switch cfg.Pprof {
+	case config.ProfileCPU:
+		err = pprof.StartCPUProfile(f)
+		stop = func() error {
+			pprof.StopCPUProfile()
+			return nil
+		}
+	case config.ProfileTrace:
+		err = trace.Start(f)
+		stop = func() error {
+			trace.Stop()
+			return nil
+		}
+	case config.ProfileMem:
+		stop = func() error {
+			// the statistics are only up to date after a collection
+			runtime.GC()
+			return pprof.Lookup("allocs").WriteTo(f, 0)
+		}
+	default:
+		err = fmt.Errorf("unknown profile %q", cfg.Pprof)
+	}
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	log.Info("Profiling the run")
+	return func() error {
+		err := stop()
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			log.WithError(err).Error("Error writing the profile")
+			return err
+		}
+		log.Info("Profile written")
+		return nil
+	}, nil
+}
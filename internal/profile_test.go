@@ -0,0 +1,50 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/awslabs/ssosync/internal/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_startProfile(t *testing.T) {
+	for _, profile := range []string{config.ProfileCPU, config.ProfileMem, config.ProfileTrace} {
+		t.Run(profile, func(t *testing.T) {
+			cfg := config.New()
+			cfg.Pprof = profile
+			cfg.PprofFile = filepath.Join(t.TempDir(), "ssosync.pprof")
+			stop, err := startProfile(cfg)
+			if !assert.NoError(t, err) {
+				return
+			}
+			_ = make([]byte, 1<<20)
+			assert.NoError(t, stop())
+			info, err := os.Stat(cfg.PprofFile)
+			if assert.NoError(t, err) {
+				assert.NotZero(t, info.Size())
+			}
+		})
+	}
+
+	cfg := config.New()
+	stop, err := startProfile(cfg)
+	assert.NoError(t, err)
+	assert.NoError(t, stop())
+	assert.Equal(t, filepath.Join(os.TempDir(), "ssosync.cpu.pprof"), profilePath(&config.Config{Pprof: config.ProfileCPU}))
+}
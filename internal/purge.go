@@ -0,0 +1,101 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/awslabs/ssosync/internal/aws"
+	"github.com/awslabs/ssosync/internal/config"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ErrPurgeNotConfirmed is returned when the purge of a group is not confirmed
+var ErrPurgeNotConfirmed = errors.New("purge not confirmed")
+
+// PurgeOptions are the options of the purge of a group
+type PurgeOptions struct {
+	// Name is the display name of the AWS group to purge
+	Name string
+	// Force allows purging a group not created by ssosync, without external id
+	Force bool
+	// Confirm is called with the group and its members before anything is
+	// changed, the purge is aborted when it returns false
+	Confirm func(group *aws.Group, members []*aws.User) bool
+}
+
+// DoPurgeGroup deletes a single AWS group managed by ssosync, after removing
+// its members. Every change is logged with the audit field set, and the
+// operator running the command.
+func DoPurgeGroup(cfg *config.Config, opts PurgeOptions) error {
+	if cfg.RunID == "" {
+		cfg.RunID = newRunID()
+	}
+	audit := log.WithFields(log.Fields{
+		"audit":    true,
+		"runId":    cfg.RunID,
+		"operator": os.Getenv("USER"),
+		"group":    opts.Name,
+	})
+	httpClient, _ := newHTTPClient(cfg, nil)
+	awsClient, err := newAWSClient(cfg, httpClient, false)
+	if err != nil {
+		return err
+	}
+	group, err := awsClient.FindGroupByDisplayName(opts.Name)
+	if err != nil {
+		log.WithField("group", opts.Name).WithError(err).Error("Error finding group in AWS")
+		return err
+	}
+	if !group.Managed() && !opts.Force {
+		return fmt.Errorf("group %q was not created by ssosync, it has no Google group id or ssosync marker as external id, use --force to purge it anyway", opts.Name)
+	}
+	users, err := awsClient.GetUsers()
+	if err != nil {
+		log.Error("error getting aws users")
+		return err
+	}
+	s := newSyncGSuite(cfg, awsClient, nil, nil)
+	groupsUsers, err := s.getAWSGroupsAndUsers([]*aws.Group{group}, users)
+	if err != nil {
+		return err
+	}
+	members := groupsUsers[group.DisplayName]
+	if opts.Confirm != nil && !opts.Confirm(group, members) {
+		audit.Warn("Purge of group not confirmed, nothing changed")
+		return ErrPurgeNotConfirmed
+	}
+	audit.WithFields(log.Fields{
+		"id":      group.ID,
+		"members": len(members),
+		"managed": group.Managed(),
+	}).Warn("Purging group")
+	for _, u := range members {
+		if err := awsClient.RemoveUserFromGroup(u, group); err != nil {
+			audit.WithField("user", u.Username).WithError(err).Error("Error removing user from group")
+			return err
+		}
+		audit.WithField("user", u.Username).Warn("User removed from group")
+	}
+	if err := awsClient.DeleteGroup(group); err != nil {
+		audit.WithError(err).Error("Error deleting group")
+		return err
+	}
+	audit.WithField("id", group.ID).Warn("Group deleted")
+	return nil
+}
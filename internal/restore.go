@@ -0,0 +1,151 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"sort"
+	"time"
+
+	"github.com/awslabs/ssosync/internal/aws"
+	"github.com/awslabs/ssosync/internal/config"
+	"github.com/awslabs/ssosync/internal/state"
+	admin "google.golang.org/api/admin/directory/v1"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// deletedUserKey returns the key of u in the deleted users of the state, its
+// normalized primary email, which unlike its user name never depends on
+// --user-name
+func deletedUserKey(u *aws.User) string {
+	if email := userAttribute(u, config.UserAttributeEmail); email != "" {
+		return aws.NormalizeName(email)
+	}
+	return aws.NormalizeName(u.Username)
+}
+
+// recordDeletion keeps the groups the deleted user was a member of in the
+// state, so they can be restored with the user within the restore window
+func (s *syncGSuite) recordDeletion(user *aws.User, changes *changeSet, now time.Time) {
+	key := deletedUserKey(user)
+	groups := make([]string, 0)
+	for group, users := range changes.removeMembers {
+		for _, u := range users {
+			if deletedUserKey(u) == key {
+				groups = append(groups, group)
+			}
+		}
+	}
+	sort.Strings(groups)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.state.DeletedUsers[key] = &state.DeletedUser{DeletedAt: now, Groups: groups}
+}
+
+// restoreDeletedUsers adds the users deleted by a previous run, and restored
+// in Google Workspace within the restore window, back to the groups they were
+// members of when they were deleted, rather than to the groups they are a
+// member of in Google Workspace only. Until the window ends, the restored
+// memberships aren't removed, so they can be restored in Google Workspace
+// too. The users deleted before the window are forgotten. The restores are
+// only recorded once the users are created, see markRestored, so diff and
+// plan leave the state as it is.
+func (s *syncGSuite) restoreDeletedUsers(changes *changeSet, now time.Time) {
+	for name, d := range s.state.DeletedUsers {
+		if now.Sub(d.DeletedAt) > s.cfg.RestoreWindow {
+			delete(s.state.DeletedUsers, name)
+		}
+	}
+	if len(s.state.DeletedUsers) == 0 {
+		return
+	}
+	synced := make(map[string]bool)
+	for _, g := range append(append([]*aws.Group{}, changes.addGroups...), changes.equalGroups...) {
+		synced[g.DisplayName] = true
+	}
+	googleUsers := make(map[string]*admin.User, len(changes.googleUsers))
+	for _, u := range changes.googleUsers {
+		googleUsers[aws.NormalizeName(u.PrimaryEmail)] = u
+	}
+	for _, u := range changes.addUsers {
+		key := deletedUserKey(u)
+		d, ok := s.state.DeletedUsers[key]
+		gUser := googleUsers[key]
+		if !ok || d.RestoredAt != nil || gUser == nil {
+			continue
+		}
+		for _, group := range d.Groups {
+			if synced[group] && !hasMember(changes.addMembers[group], key) {
+				changes.addMembers[group] = append(changes.addMembers[group], gUser)
+			}
+		}
+		log.WithFields(log.Fields{
+			"user":      u.Username,
+			"deletedAt": d.DeletedAt.Format(time.RFC3339),
+			"groups":    d.Groups,
+		}).Warn("Deleted user restored in Google Workspace, restoring its group memberships")
+	}
+	for group, users := range changes.removeMembers {
+		kept := make([]*aws.User, 0, len(users))
+		for _, u := range users {
+			d, ok := s.state.DeletedUsers[deletedUserKey(u)]
+			if ok && d.RestoredAt != nil && containsString(d.Groups, group) {
+				log.WithFields(log.Fields{
+					"user":  u.Username,
+					"group": group,
+				}).Info("Restored group membership kept until the end of the restore window")
+				continue
+			}
+			kept = append(kept, u)
+		}
+		changes.removeMembers[group] = kept
+	}
+}
+
+// markRestored records the restore of the deleted users created, all of
+// users but the failed ones, so their restored memberships are kept until the
+// end of the restore window
+func (s *syncGSuite) markRestored(users []*aws.User, failed map[string]bool, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, u := range users {
+		d, ok := s.state.DeletedUsers[deletedUserKey(u)]
+		if !ok || d.RestoredAt != nil || failed[u.Username] {
+			continue
+		}
+		restoredAt := now
+		d.RestoredAt = &restoredAt
+	}
+}
+
+// containsString tells whether list has s
+func containsString(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
+
+// hasMember tells whether users has the user with email
+func hasMember(users []*admin.User, email string) bool {
+	for _, u := range users {
+		if aws.NormalizeName(u.PrimaryEmail) == aws.NormalizeName(email) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,80 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"testing"
+	"time"
+
+	"github.com/awslabs/ssosync/internal/aws"
+	"github.com/awslabs/ssosync/internal/config"
+	"github.com/awslabs/ssosync/internal/state"
+	"github.com/stretchr/testify/assert"
+	admin "google.golang.org/api/admin/directory/v1"
+)
+
+func Test_restoreDeletedUsers(t *testing.T) {
+	cfg := config.New()
+	cfg.RestoreWindow = 480 * time.Hour
+	s := newSyncGSuite(cfg, nil, nil, nil)
+	deletedAt := time.Date(2026, 10, 1, 10, 0, 0, 0, time.UTC)
+	user := aws.NewUser("n", "l", "user-1@email.com", true)
+
+	// the deletion of the user is recorded with its groups
+	s.recordDeletion(user, &changeSet{
+		removeMembers: map[string][]*aws.User{
+			"group-2": {user},
+			"group-1": {user},
+			"group-3": {aws.NewUser("n", "l", "user-2@email.com", true)},
+		},
+	}, deletedAt)
+	assert.Equal(t, []string{"group-1", "group-2"}, s.state.DeletedUsers["user-1@email.com"].Groups)
+
+	// the user is restored in google, a member of group-1 only, with another
+	// user name in aws
+	googleUser := &admin.User{PrimaryEmail: "User-1@email.com"}
+	restored := aws.NewUser("n", "l", "user-1@email.com", true)
+	restored.Username = "user-1"
+	changes := &changeSet{
+		addUsers:    []*aws.User{restored},
+		equalGroups: []*aws.Group{aws.NewGroup("group-1"), aws.NewGroup("group-2")},
+		googleUsers: []*admin.User{googleUser},
+		addMembers: map[string][]*admin.User{
+			"group-1": {googleUser},
+		},
+	}
+	s.restoreDeletedUsers(changes, deletedAt.Add(72*time.Hour))
+	assert.Equal(t, []*admin.User{googleUser}, changes.addMembers["group-1"])
+	assert.Equal(t, []*admin.User{googleUser}, changes.addMembers["group-2"])
+	// the restore is only recorded once the user is created, not by diff
+	assert.Nil(t, s.state.DeletedUsers["user-1@email.com"].RestoredAt)
+	s.markRestored(changes.addUsers, map[string]bool{}, deletedAt.Add(72*time.Hour))
+	assert.NotNil(t, s.state.DeletedUsers["user-1@email.com"].RestoredAt)
+
+	// the restored membership isn't removed until the end of the window
+	changes = &changeSet{
+		addMembers: map[string][]*admin.User{},
+		removeMembers: map[string][]*aws.User{
+			"group-2": {restored},
+		},
+	}
+	s.restoreDeletedUsers(changes, deletedAt.Add(96*time.Hour))
+	assert.Empty(t, changes.removeMembers["group-2"])
+
+	changes.removeMembers["group-2"] = []*aws.User{restored}
+	s.restoreDeletedUsers(changes, deletedAt.Add(500*time.Hour))
+	assert.Len(t, changes.removeMembers["group-2"], 1)
+	assert.Equal(t, map[string]*state.DeletedUser{}, s.state.DeletedUsers)
+}
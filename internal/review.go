@@ -0,0 +1,164 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/awslabs/ssosync/internal/aws"
+	"github.com/awslabs/ssosync/internal/config"
+	log "github.com/sirupsen/logrus"
+	admin "google.golang.org/api/admin/directory/v1"
+)
+
+const (
+	// ReviewFormatCSV writes the access review as CSV, with a header
+	ReviewFormatCSV = "csv"
+	// ReviewFormatJSON writes the access review as a JSON array
+	ReviewFormatJSON = "json"
+)
+
+// reviewEntry is a row of the access review: a user member of an AWS SSO
+// group, and the Google Workspace group it derives from
+type reviewEntry struct {
+	AsOf        string `json:"asOf"`
+	AWSGroup    string `json:"awsGroup"`
+	AWSGroupID  string `json:"awsGroupId"`
+	UserName    string `json:"userName"`
+	UserID      string `json:"userId"`
+	Active      bool   `json:"active"`
+	GoogleGroup string `json:"googleGroup"`
+	// GoogleGroupID is the id of the Google group, the external id of the
+	// AWS groups created by ssosync
+	GoogleGroupID string `json:"googleGroupId"`
+	Managed       bool   `json:"managed"`
+}
+
+// reviewHeader is the header of the CSV access review, in the order of the
+// fields of reviewEntry
+var reviewHeader = []string{"as_of", "aws_group", "aws_group_id", "user_name", "user_id", "active", "google_group", "google_group_id", "managed"}
+
+// reviewEntries returns the entries of the access review, sorted by group
+// then user. The Google group of an AWS group is the one with its name, an
+// AWS group without Google group has an empty GoogleGroup.
+func reviewEntries(asOf time.Time, awsGroups []*aws.Group, awsGroupsUsers map[string][]*aws.User, googleGroups []*admin.Group) []reviewEntry {
+	byName := make(map[string]*admin.Group, len(googleGroups))
+	for _, g := range googleGroups {
+		byName[g.Name] = g
+	}
+	entries := make([]reviewEntry, 0)
+	for _, g := range awsGroups {
+		var googleEmail, googleID string
+		if gg, ok := byName[g.DisplayName]; ok {
+			googleEmail, googleID = gg.Email, gg.Id
+		}
+		for _, u := range awsGroupsUsers[g.DisplayName] {
+			entries = append(entries, reviewEntry{
+				AsOf:          asOf.UTC().Format(time.RFC3339),
+				AWSGroup:      g.DisplayName,
+				AWSGroupID:    g.ID,
+				UserName:      u.Username,
+				UserID:        u.ID,
+				Active:        u.Active,
+				GoogleGroup:   googleEmail,
+				GoogleGroupID: googleID,
+				Managed:       g.Managed(),
+			})
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].AWSGroup != entries[j].AWSGroup {
+			return entries[i].AWSGroup < entries[j].AWSGroup
+		}
+		return entries[i].UserName < entries[j].UserName
+	})
+	return entries
+}
+
+// writeReview writes the entries to w in format
+func writeReview(w io.Writer, format string, entries []reviewEntry) error {
+	switch format {
+	case ReviewFormatJSON:
+		e := json.NewEncoder(w)
+		e.SetIndent("", "  ")
+		return e.Encode(entries)
+	case ReviewFormatCSV:
+		cw := csv.NewWriter(w)
+		if err := cw.Write(reviewHeader); err != nil {
+			return err
+		}
+		for _, e := range entries {
+			err := cw.Write([]string{
+				e.AsOf, e.AWSGroup, e.AWSGroupID, e.UserName, e.UserID,
+				fmt.Sprint(e.Active), e.GoogleGroup, e.GoogleGroupID, fmt.Sprint(e.Managed),
+			})
+			if err != nil {
+				return err
+			}
+		}
+		cw.Flush()
+		return cw.Error()
+	default:
+		return fmt.Errorf("unknown access review format %q (%s|%s)", format, ReviewFormatCSV, ReviewFormatJSON)
+	}
+}
+
+// DoReviewExport writes the access review of AWS SSO to w in format: every
+// member of every AWS SSO group, with the Google Workspace group it derives
+// from, as of now. Only read access is needed.
+func DoReviewExport(ctx context.Context, cfg *config.Config, format string, w io.Writer) error {
+	if format != ReviewFormatCSV && format != ReviewFormatJSON {
+		return fmt.Errorf("unknown access review format %q (%s|%s)", format, ReviewFormatCSV, ReviewFormatJSON)
+	}
+	if cfg.RunID == "" {
+		cfg.RunID = newRunID()
+	}
+	log.WithField("runId", cfg.RunID).Info("Starting access review export")
+	googleClient, awsClient, err := newClients(ctx, cfg, true, nil)
+	if err != nil {
+		return err
+	}
+	s := newSyncGSuite(cfg, awsClient, googleClient, nil)
+
+	asOf := time.Now()
+	awsGroups, err := s.aws.GetGroups()
+	if err != nil {
+		log.Error("error getting aws groups")
+		return err
+	}
+	awsUsers, err := s.aws.GetUsers()
+	if err != nil {
+		log.Error("error getting aws users")
+		return err
+	}
+	awsGroupsUsers, err := s.getAWSGroupsAndUsers(awsGroups, awsUsers)
+	if err != nil {
+		return err
+	}
+	googleGroups, err := s.getGoogleGroups(cfg.GroupMatch)
+	if err != nil {
+		return err
+	}
+
+	entries := reviewEntries(asOf, awsGroups, awsGroupsUsers, googleGroups)
+	log.WithField("entries", len(entries)).Info("Access review exported")
+	return writeReview(w, format, entries)
+}
@@ -0,0 +1,57 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/awslabs/ssosync/internal/aws"
+	"github.com/stretchr/testify/assert"
+	admin "google.golang.org/api/admin/directory/v1"
+)
+
+func TestReviewExport(t *testing.T) {
+	asOf := time.Date(2026, 10, 16, 7, 0, 0, 0, time.UTC)
+	awsGroups := []*aws.Group{
+		{ID: "g2", DisplayName: "ops", ExternalID: "0279ka6510ez4vx"},
+		{ID: "g1", DisplayName: "dev"},
+	}
+	awsGroupsUsers := map[string][]*aws.User{
+		"ops": {{ID: "u2", Username: "b@example.com", Active: true}, {ID: "u1", Username: "a@example.com", Active: true}},
+		"dev": {{ID: "u1", Username: "a@example.com", Active: true}},
+	}
+	googleGroups := []*admin.Group{{Id: "0279ka6510ez4vx", Name: "ops", Email: "ops@example.com"}}
+
+	entries := reviewEntries(asOf, awsGroups, awsGroupsUsers, googleGroups)
+
+	var b bytes.Buffer
+	assert.NoError(t, writeReview(&b, ReviewFormatCSV, entries))
+	assert.Equal(t, `as_of,aws_group,aws_group_id,user_name,user_id,active,google_group,google_group_id,managed
+2026-10-16T07:00:00Z,dev,g1,a@example.com,u1,true,,,false
+2026-10-16T07:00:00Z,ops,g2,a@example.com,u1,true,ops@example.com,0279ka6510ez4vx,true
+2026-10-16T07:00:00Z,ops,g2,b@example.com,u2,true,ops@example.com,0279ka6510ez4vx,true
+`, b.String())
+
+	b.Reset()
+	assert.NoError(t, writeReview(&b, ReviewFormatJSON, entries))
+	var decoded []reviewEntry
+	assert.NoError(t, json.Unmarshal(b.Bytes(), &decoded))
+	assert.Equal(t, entries, decoded)
+
+	assert.Error(t, writeReview(&b, "xml", entries))
+}
@@ -0,0 +1,219 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schedule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule returns the times at which something must run
+type Schedule interface {
+	// Next returns the first time of the schedule after t
+	Next(t time.Time) time.Time
+}
+
+// Parse parses a schedule, which is one of:
+//   - a cron expression, "minute hour day-of-month month day-of-week",
+//     optionally followed by a time zone, e.g. "0 7 * * 1-5 Europe/London"
+//   - "every <days> HH:MM [time zone]", where days are "day", "weekday",
+//     "weekend" or days of the week, e.g. "every weekday 07:00 Europe/London"
+//     or "every Mon,Thu 07:00"
+//   - "every <duration>", e.g. "every 1h30m"
+//
+// The time zone is an IANA name, UTC when omitted.
+func Parse(spec string) (Schedule, error) {
+	fields := strings.Fields(spec)
+	if len(fields) > 0 && strings.EqualFold(fields[0], "every") {
+		return parseEvery(spec, fields[1:])
+	}
+	return parseCron(spec, fields)
+}
+
+// interval runs every d
+type interval struct {
+	d time.Duration
+}
+
+// Next implements Schedule
+func (i interval) Next(t time.Time) time.Time {
+	return t.Add(i.d)
+}
+
+// cron runs at the times matching all its fields, in loc
+type cron struct {
+	minutes, hours, doms, months, dows map[int]bool
+	// domAny and dowAny are set when the field is "*", as in cron a day
+	// matches either field when both are restricted
+	domAny, dowAny bool
+	loc            *time.Location
+}
+
+// Next implements Schedule
+func (c *cron) Next(t time.Time) time.Time {
+	t = t.In(c.loc)
+	next := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), 0, 0, c.loc).Add(time.Minute)
+	// a schedule matches at least once in 5 years, e.g. February 29th
+	limit := next.AddDate(5, 0, 0)
+	for next.Before(limit) {
+		if !c.months[int(next.Month())] || !c.dayMatches(next) {
+			next = time.Date(next.Year(), next.Month(), next.Day()+1, 0, 0, 0, 0, c.loc)
+			continue
+		}
+		if !c.hours[next.Hour()] {
+			next = time.Date(next.Year(), next.Month(), next.Day(), next.Hour()+1, 0, 0, 0, c.loc)
+			continue
+		}
+		if !c.minutes[next.Minute()] {
+			next = next.Add(time.Minute)
+			continue
+		}
+		return next
+	}
+	return time.Time{}
+}
+
+func (c *cron) dayMatches(t time.Time) bool {
+	dom := c.doms[t.Day()]
+	dow := c.dows[int(t.Weekday())]
+	switch {
+	case c.domAny && c.dowAny:
+		return true
+	case c.domAny:
+		return dow
+	case c.dowAny:
+		return dom
+	default:
+		return dom || dow
+	}
+}
+
+func parseCron(spec string, fields []string) (Schedule, error) {
+	loc := time.UTC
+	if len(fields) == 6 {
+		l, err := time.LoadLocation(fields[5])
+		if err != nil {
+			return nil, fmt.Errorf("invalid time zone in schedule %q: %w", spec, err)
+		}
+		loc = l
+		fields = fields[:5]
+	}
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("invalid schedule %q, expected a cron expression or \"every ...\"", spec)
+	}
+	c := &cron{loc: loc, domAny: fields[2] == "*", dowAny: fields[4] == "*"}
+	var err error
+	if c.minutes, err = parseCronField(fields[0], 0, 59); err == nil {
+		if c.hours, err = parseCronField(fields[1], 0, 23); err == nil {
+			if c.doms, err = parseCronField(fields[2], 1, 31); err == nil {
+				if c.months, err = parseCronField(fields[3], 1, 12); err == nil {
+					c.dows, err = parseCronField(fields[4], 0, 7)
+				}
+			}
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid schedule %q: %w", spec, err)
+	}
+	// 7 is Sunday too
+	if c.dows[7] {
+		c.dows[0] = true
+	}
+	return c, nil
+}
+
+// parseCronField parses a cron field: "*", "5", "1-5", "*/15", "1-10/2" or a
+// list of them
+func parseCronField(field string, min int, max int) (map[int]bool, error) {
+	values := make(map[int]bool)
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			s, err := strconv.Atoi(part[i+1:])
+			if err != nil || s < 1 {
+				return nil, fmt.Errorf("invalid step in %q", part)
+			}
+			step = s
+			part = part[:i]
+		}
+		first, last := min, max
+		if part != "*" {
+			bounds := strings.SplitN(part, "-", 2)
+			var err error
+			if first, err = strconv.Atoi(bounds[0]); err != nil {
+				return nil, fmt.Errorf("invalid value %q", part)
+			}
+			last = first
+			if len(bounds) == 2 {
+				if last, err = strconv.Atoi(bounds[1]); err != nil {
+					return nil, fmt.Errorf("invalid value %q", part)
+				}
+			}
+		}
+		if first < min || last > max || first > last {
+			return nil, fmt.Errorf("value %q out of range %d-%d", part, min, max)
+		}
+		for v := first; v <= last; v += step {
+			values[v] = true
+		}
+	}
+	return values, nil
+}
+
+// parseEvery parses the fields of a schedule following "every"
+func parseEvery(spec string, fields []string) (Schedule, error) {
+	if len(fields) == 1 {
+		d, err := time.ParseDuration(fields[0])
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid schedule %q, expected \"every <duration>\" or \"every <days> HH:MM [time zone]\"", spec)
+		}
+		return interval{d: d}, nil
+	}
+	if len(fields) != 2 && len(fields) != 3 {
+		return nil, fmt.Errorf("invalid schedule %q, expected \"every <days> HH:MM [time zone]\"", spec)
+	}
+	var dows string
+	switch strings.ToLower(fields[0]) {
+	case "day":
+		dows = "*"
+	case "weekday":
+		dows = "1-5"
+	case "weekend":
+		dows = "0,6"
+	default:
+		days, err := ParseDays(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid schedule %q: %w", spec, err)
+		}
+		list := make([]string, 0, 7)
+		for d, ok := range days {
+			if ok {
+				list = append(list, strconv.Itoa(d))
+			}
+		}
+		dows = strings.Join(list, ",")
+	}
+	m, err := ParseClock(fields[1])
+	if err != nil {
+		return nil, fmt.Errorf("invalid schedule %q: %w", spec, err)
+	}
+	cronFields := []string{strconv.Itoa(m % 60), strconv.Itoa(m / 60), "*", "*", dows}
+	if len(fields) == 3 {
+		cronFields = append(cronFields, fields[2])
+	}
+	return parseCron(spec, cronFields)
+}
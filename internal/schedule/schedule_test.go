@@ -0,0 +1,72 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScheduleNext(t *testing.T) {
+	tests := []struct {
+		spec  string
+		after string
+		want  string
+	}{
+		// 2026-10-16 is a Friday
+		{"every weekday 07:00 Europe/London", "2026-10-16T07:00:00+01:00", "2026-10-19T07:00:00+01:00"},
+		{"every weekday 07:00 Europe/London", "2026-10-16T05:00:00Z", "2026-10-16T07:00:00+01:00"},
+		// the clocks go back on 2026-10-25 in London
+		{"every day 07:00 Europe/London", "2026-10-25T00:00:00Z", "2026-10-25T07:00:00Z"},
+		{"every weekend 12:30", "2026-10-16T00:00:00Z", "2026-10-17T12:30:00Z"},
+		{"every Mon,Thu 07:00", "2026-10-16T00:00:00Z", "2026-10-19T07:00:00Z"},
+		{"every 1h30m", "2026-10-16T00:00:00Z", "2026-10-16T01:30:00Z"},
+		{"*/15 * * * *", "2026-10-16T10:07:13Z", "2026-10-16T10:15:00Z"},
+		{"0 7 * * 1-5 America/New_York", "2026-10-16T12:00:00Z", "2026-10-19T07:00:00-04:00"},
+		{"0 0 29 2 *", "2026-10-16T00:00:00Z", "2028-02-29T00:00:00Z"},
+		{"0 0 1 * 0", "2026-10-16T00:00:00Z", "2026-10-18T00:00:00Z"},
+	}
+	for _, tt := range tests {
+		s, err := Parse(tt.spec)
+		if err != nil {
+			t.Fatalf("Parse(%q) error = %v", tt.spec, err)
+		}
+		after, _ := time.Parse(time.RFC3339, tt.after)
+		want, _ := time.Parse(time.RFC3339, tt.want)
+		if got := s.Next(after); !got.Equal(want) {
+			t.Errorf("Parse(%q).Next(%s) = %s, want %s", tt.spec, tt.after, got, tt.want)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, spec := range []string{
+		"",
+		"every",
+		"every -1h",
+		"every weekday",
+		"every weekday 25:00",
+		"every someday 07:00",
+		"every day 07:00 Mars/Olympus",
+		"0 7 * *",
+		"60 * * * *",
+		"*/0 * * * *",
+		"0 7 * * 1-5 Mars/Olympus",
+	} {
+		if _, err := Parse(spec); err == nil {
+			t.Errorf("Parse(%q) expected an error", spec)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package schedule parses and evaluates time windows and schedules
+package schedule
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// Window is a recurring time range on some days of the week, e.g.
+// "Mon-Fri 09:00-18:00 Europe/London", or a range of dates, e.g.
+// "2026-12-20..2027-01-03 Europe/London"
+type Window struct {
+	spec string
+	loc  *time.Location
+
+	// days of the week of a recurring window
+	days [7]bool
+	// start and end of a recurring window, in minutes since midnight
+	start, end int
+
+	// from and to are the first and the day after the last day of a range
+	// of dates
+	from, to time.Time
+}
+
+// ParseWindow parses a window: "[days] HH:MM-HH:MM [time zone]" or
+// "YYYY-MM-DD..YYYY-MM-DD [time zone]". Days are a day of the week, a range
+// such as "Mon-Fri" or a list such as "Sat,Sun", every day when omitted. A
+// time range ending before it starts crosses midnight. The time zone is an
+// IANA name, UTC when omitted. Dates are inclusive.
+func ParseWindow(spec string) (*Window, error) {
+	w := &Window{spec: spec, loc: time.UTC}
+	fields := strings.Fields(spec)
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("empty window")
+	}
+	// the time zone is the last field when it isn't a time or date range
+	if last := fields[len(fields)-1]; len(fields) > 1 && !strings.ContainsAny(last[:1], "0123456789") {
+		loc, err := time.LoadLocation(last)
+		if err != nil {
+			return nil, fmt.Errorf("invalid time zone in window %q: %w", spec, err)
+		}
+		w.loc = loc
+		fields = fields[:len(fields)-1]
+	}
+	if len(fields) == 1 && strings.Contains(fields[0], "..") {
+		if err := w.parseDates(fields[0]); err != nil {
+			return nil, fmt.Errorf("invalid window %q: %w", spec, err)
+		}
+		return w, nil
+	}
+	var err error
+	switch len(fields) {
+	case 1:
+		for d := range w.days {
+			w.days[d] = true
+		}
+		err = w.parseTimes(fields[0])
+	case 2:
+		if w.days, err = ParseDays(fields[0]); err == nil {
+			err = w.parseTimes(fields[1])
+		}
+	default:
+		err = fmt.Errorf("expected [days] HH:MM-HH:MM [time zone] or YYYY-MM-DD..YYYY-MM-DD [time zone]")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid window %q: %w", spec, err)
+	}
+	return w, nil
+}
+
+// ParseDays parses days of the week: "Mon", "Mon-Fri" or "Sat,Sun"
+func ParseDays(s string) ([7]bool, error) {
+	var days [7]bool
+	for _, part := range strings.Split(strings.ToLower(s), ",") {
+		bounds := strings.SplitN(part, "-", 2)
+		first, ok := weekdays[bounds[0]]
+		if !ok {
+			return days, fmt.Errorf("invalid day %q", bounds[0])
+		}
+		last := first
+		if len(bounds) == 2 {
+			if last, ok = weekdays[bounds[1]]; !ok {
+				return days, fmt.Errorf("invalid day %q", bounds[1])
+			}
+		}
+		for d := first; ; d = (d + 1) % 7 {
+			days[d] = true
+			if d == last {
+				break
+			}
+		}
+	}
+	return days, nil
+}
+
+// ParseClock parses a time of the day, HH:MM, into minutes since midnight
+func ParseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+func (w *Window) parseTimes(s string) error {
+	bounds := strings.SplitN(s, "-", 2)
+	if len(bounds) != 2 {
+		return fmt.Errorf("invalid time range %q, expected HH:MM-HH:MM", s)
+	}
+	var err error
+	if w.start, err = ParseClock(bounds[0]); err != nil {
+		return err
+	}
+	if w.end, err = ParseClock(bounds[1]); err != nil {
+		return err
+	}
+	if w.start == w.end {
+		return fmt.Errorf("empty time range %q", s)
+	}
+	return nil
+}
+
+func (w *Window) parseDates(s string) error {
+	bounds := strings.SplitN(s, "..", 2)
+	from, err := time.ParseInLocation("2006-01-02", bounds[0], w.loc)
+	if err != nil {
+		return fmt.Errorf("invalid date %q, expected YYYY-MM-DD", bounds[0])
+	}
+	to, err := time.ParseInLocation("2006-01-02", bounds[1], w.loc)
+	if err != nil {
+		return fmt.Errorf("invalid date %q, expected YYYY-MM-DD", bounds[1])
+	}
+	if to.Before(from) {
+		return fmt.Errorf("the range of dates %q ends before it starts", s)
+	}
+	w.from, w.to = from, to.AddDate(0, 0, 1)
+	return nil
+}
+
+// Contains reports if t is in the window
+func (w *Window) Contains(t time.Time) bool {
+	t = t.In(w.loc)
+	if !w.from.IsZero() {
+		return !t.Before(w.from) && t.Before(w.to)
+	}
+	m := t.Hour()*60 + t.Minute()
+	day := t.Weekday()
+	if w.start < w.end {
+		return w.days[day] && m >= w.start && m < w.end
+	}
+	// the window crosses midnight, its end belongs to the previous day
+	return (w.days[day] && m >= w.start) || (w.days[(day+6)%7] && m < w.end)
+}
+
+// String returns the specification of the window
+func (w *Window) String() string {
+	return w.spec
+}
@@ -0,0 +1,79 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWindowContains(t *testing.T) {
+	// 2026-10-16 is a Friday
+	at := func(s string) time.Time {
+		v, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+	tests := []struct {
+		spec string
+		t    string
+		want bool
+	}{
+		{"Mon-Fri 09:00-18:00", "2026-10-16T09:00:00Z", true},
+		{"Mon-Fri 09:00-18:00", "2026-10-16T18:00:00Z", false},
+		{"Mon-Fri 09:00-18:00", "2026-10-17T10:00:00Z", false},
+		{"Mon-Fri 09:00-18:00 Europe/London", "2026-10-16T08:30:00Z", true},
+		{"Sat,Sun 00:00-23:59", "2026-10-18T12:00:00Z", true},
+		{"Fri-Mon 10:00-11:00", "2026-10-19T10:30:00Z", true},
+		{"Fri-Mon 10:00-11:00", "2026-10-20T10:30:00Z", false},
+		{"22:00-06:00", "2026-10-16T23:00:00Z", true},
+		{"22:00-06:00", "2026-10-16T05:59:00Z", true},
+		{"22:00-06:00", "2026-10-16T06:00:00Z", false},
+		{"Fri 22:00-06:00", "2026-10-17T05:00:00Z", true},
+		{"Fri 22:00-06:00", "2026-10-16T05:00:00Z", false},
+		{"2026-12-20..2027-01-03", "2027-01-03T23:59:00Z", true},
+		{"2026-12-20..2027-01-03", "2027-01-04T00:00:00Z", false},
+		{"2026-12-20..2027-01-03 America/New_York", "2027-01-04T03:00:00Z", true},
+	}
+	for _, tt := range tests {
+		w, err := ParseWindow(tt.spec)
+		if err != nil {
+			t.Fatalf("ParseWindow(%q) error = %v", tt.spec, err)
+		}
+		if got := w.Contains(at(tt.t)); got != tt.want {
+			t.Errorf("ParseWindow(%q).Contains(%s) = %v, want %v", tt.spec, tt.t, got, tt.want)
+		}
+	}
+}
+
+func TestParseWindowErrors(t *testing.T) {
+	for _, spec := range []string{
+		"",
+		"Mon-Fri",
+		"Mon-Fri 09:00",
+		"Funday 09:00-18:00",
+		"09:00-09:00",
+		"25:00-26:00",
+		"09:00-18:00 Mars/Olympus",
+		"2027-01-03..2026-12-20",
+		"Mon-Fri 09:00-18:00 UTC extra",
+	} {
+		if _, err := ParseWindow(spec); err == nil {
+			t.Errorf("ParseWindow(%q) expected an error", spec)
+		}
+	}
+}
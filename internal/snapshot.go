@@ -0,0 +1,404 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/awslabs/ssosync/internal/aws"
+	awsfake "github.com/awslabs/ssosync/internal/aws/fake"
+	"github.com/awslabs/ssosync/internal/config"
+	"github.com/awslabs/ssosync/internal/google"
+	googlefake "github.com/awslabs/ssosync/internal/google/fake"
+	admin "google.golang.org/api/admin/directory/v1"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// snapshotFormatVersion is the version of the format of snapshots
+const snapshotFormatVersion = "1"
+
+// snapshot is a copy of what plan or diff read from Google Workspace and AWS
+// SSO, so they can run again offline, from this copy
+type snapshot struct {
+	FormatVersion string         `json:"formatVersion"`
+	RunID         string         `json:"runId"`
+	TakenAt       time.Time      `json:"takenAt"`
+	Google        googleSnapshot `json:"google"`
+	AWS           awsSnapshot    `json:"aws"`
+}
+
+type googleSnapshot struct {
+	Users  []*admin.User  `json:"users"`
+	Groups []*admin.Group `json:"groups"`
+	// Members are the members of the groups, by group id
+	Members map[string][]*admin.Member `json:"members"`
+	// Labels are the emails of the groups with a label, by label
+	Labels map[string][]string `json:"labels,omitempty"`
+}
+
+type awsSnapshot struct {
+	Users  []*aws.User  `json:"users"`
+	Groups []*aws.Group `json:"groups"`
+	// Members are the user names of the members of the groups, by group
+	// display name
+	Members map[string][]string `json:"members"`
+	// UserNames are the user names of the users with --user-name, by user
+	// id, see userNamesOf
+	UserNames map[string]string `json:"userNames,omitempty"`
+}
+
+// snapshotRecorder records the responses of the clients it wraps
+type snapshotRecorder struct {
+	mu           sync.Mutex
+	googleUsers  map[string]*admin.User
+	googleGroups map[string]*admin.Group
+	googleMember map[string][]*admin.Member
+	googleLabels map[string][]string
+	awsUsers     []*aws.User
+	awsGroups    []*aws.Group
+	// awsMembers are the ids of the members of the groups, by group id
+	awsMembers map[string]map[string]bool
+}
+
+func newSnapshotRecorder() *snapshotRecorder {
+	return &snapshotRecorder{
+		googleUsers:  make(map[string]*admin.User),
+		googleGroups: make(map[string]*admin.Group),
+		googleMember: make(map[string][]*admin.Member),
+		googleLabels: make(map[string][]string),
+		awsMembers:   make(map[string]map[string]bool),
+	}
+}
+
+func (r *snapshotRecorder) addGoogleUsers(users ...*admin.User) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, u := range users {
+		r.googleUsers[u.PrimaryEmail] = u
+	}
+}
+
+func (r *snapshotRecorder) addGoogleGroups(groups ...*admin.Group) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, g := range groups {
+		r.googleGroups[g.Id] = g
+	}
+}
+
+func (r *snapshotRecorder) addAWSMembers(groupID string, userIDs ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.awsMembers[groupID] == nil {
+		r.awsMembers[groupID] = make(map[string]bool)
+	}
+	for _, id := range userIDs {
+		r.awsMembers[groupID][id] = true
+	}
+}
+
+// snapshot returns what was recorded
+func (r *snapshotRecorder) snapshot(runID string, now time.Time) *snapshot {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s := &snapshot{
+		FormatVersion: snapshotFormatVersion,
+		RunID:         runID,
+		TakenAt:       now.UTC(),
+		Google: googleSnapshot{
+			Users:   make([]*admin.User, 0, len(r.googleUsers)),
+			Groups:  make([]*admin.Group, 0, len(r.googleGroups)),
+			Members: r.googleMember,
+			Labels:  r.googleLabels,
+		},
+		AWS: awsSnapshot{
+			Users:     r.awsUsers,
+			Groups:    r.awsGroups,
+			Members:   make(map[string][]string),
+			UserNames: userNamesOf(r.awsUsers),
+		},
+	}
+	for _, u := range r.googleUsers {
+		s.Google.Users = append(s.Google.Users, u)
+	}
+	sort.Slice(s.Google.Users, func(i, j int) bool { return s.Google.Users[i].PrimaryEmail < s.Google.Users[j].PrimaryEmail })
+	for _, g := range r.googleGroups {
+		s.Google.Groups = append(s.Google.Groups, g)
+	}
+	sort.Slice(s.Google.Groups, func(i, j int) bool { return s.Google.Groups[i].Email < s.Google.Groups[j].Email })
+	names := make(map[string]string, len(r.awsUsers))
+	for _, u := range r.awsUsers {
+		names[u.ID] = u.Username
+	}
+	for _, g := range r.awsGroups {
+		members := make([]string, 0, len(r.awsMembers[g.ID]))
+		for id := range r.awsMembers[g.ID] {
+			if name, ok := names[id]; ok {
+				members = append(members, name)
+			}
+		}
+		sort.Strings(members)
+		s.AWS.Members[g.DisplayName] = members
+	}
+	return s
+}
+
+// recordingGoogleClient records the users, groups and members read
+type recordingGoogleClient struct {
+	google.Client
+	r *snapshotRecorder
+}
+
+func (c *recordingGoogleClient) GetUsers(query string) ([]*admin.User, error) {
+	users, err := c.Client.GetUsers(query)
+	if err == nil {
+		c.r.addGoogleUsers(users...)
+	}
+	return users, err
+}
+
+func (c *recordingGoogleClient) ForEachUser(query string, fn func(*admin.User) error) error {
+	return c.Client.ForEachUser(query, func(u *admin.User) error {
+		c.r.addGoogleUsers(u)
+		return fn(u)
+	})
+}
+
+func (c *recordingGoogleClient) GetUser(email string) (*admin.User, error) {
+	u, err := c.Client.GetUser(email)
+	if u != nil {
+		c.r.addGoogleUsers(u)
+	}
+	return u, err
+}
+
+func (c *recordingGoogleClient) GetUsersByEmail(emails []string) (map[string]*admin.User, error) {
+	users, err := c.Client.GetUsersByEmail(emails)
+	for _, u := range users {
+		c.r.addGoogleUsers(u)
+	}
+	return users, err
+}
+
+func (c *recordingGoogleClient) GetGroups(query string) ([]*admin.Group, error) {
+	groups, err := c.Client.GetGroups(query)
+	if err == nil {
+		c.r.addGoogleGroups(groups...)
+	}
+	return groups, err
+}
+
+func (c *recordingGoogleClient) GetGroup(key string) (*admin.Group, error) {
+	g, err := c.Client.GetGroup(key)
+	if err == nil {
+		c.r.addGoogleGroups(g)
+	}
+	return g, err
+}
+
+func (c *recordingGoogleClient) GetGroupMembers(g *admin.Group) ([]*admin.Member, error) {
+	members, err := c.Client.GetGroupMembers(g)
+	if err == nil {
+		c.r.mu.Lock()
+		c.r.googleMember[g.Id] = members
+		c.r.mu.Unlock()
+	}
+	return members, err
+}
+
+func (c *recordingGoogleClient) GetGroupsWithLabel(label string) ([]string, error) {
+	emails, err := c.Client.GetGroupsWithLabel(label)
+	if err == nil {
+		c.r.mu.Lock()
+		c.r.googleLabels[label] = emails
+		c.r.mu.Unlock()
+	}
+	return emails, err
+}
+
+// recordingAWSClient records the users, groups and memberships read
+type recordingAWSClient struct {
+	aws.Client
+	r *snapshotRecorder
+}
+
+func (c *recordingAWSClient) GetUsers() ([]*aws.User, error) {
+	users, err := c.Client.GetUsers()
+	if err == nil {
+		c.r.mu.Lock()
+		c.r.awsUsers = users
+		c.r.mu.Unlock()
+	}
+	return users, err
+}
+
+func (c *recordingAWSClient) GetGroups() ([]*aws.Group, error) {
+	groups, err := c.Client.GetGroups()
+	if err == nil {
+		c.r.mu.Lock()
+		c.r.awsGroups = groups
+		c.r.mu.Unlock()
+	}
+	return groups, err
+}
+
+func (c *recordingAWSClient) GetGroupMemberIDs(g *aws.Group) ([]string, error) {
+	ids, err := c.Client.GetGroupMemberIDs(g)
+	if err == nil {
+		c.r.addAWSMembers(g.ID, ids...)
+	}
+	return ids, err
+}
+
+func (c *recordingAWSClient) IsUserInGroup(u *aws.User, g *aws.Group) (bool, error) {
+	member, err := c.Client.IsUserInGroup(u, g)
+	if err == nil && member {
+		c.r.addAWSMembers(g.ID, u.ID)
+	}
+	return member, err
+}
+
+// writeSnapshot writes s to path, replacing the previous snapshot only once
+// the new one is complete
+func writeSnapshot(path string, s *snapshot) error {
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return replaceFile(path, b)
+}
+
+// replaceFile writes b to path, replacing the previous file only once the
+// new one is complete
+func replaceFile(path string, b []byte) error {
+	f, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+"-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// readSnapshot reads the snapshot written to path by writeSnapshot
+func readSnapshot(path string) (*snapshot, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var s snapshot
+	if err := json.Unmarshal(b, &s); err != nil {
+		return nil, fmt.Errorf("invalid snapshot: %w", err)
+	}
+	if s.FormatVersion != snapshotFormatVersion {
+		return nil, fmt.Errorf("unsupported snapshot format version %q, expected %q", s.FormatVersion, snapshotFormatVersion)
+	}
+	return &s, nil
+}
+
+// clients returns in-memory clients holding the data of the snapshot
+func (s *snapshot) clients() (google.Client, aws.Client, error) {
+	g := googlefake.NewClient().WithUsers(s.Google.Users...)
+	g.Groups = s.Google.Groups
+	for id, members := range s.Google.Members {
+		g.Members[id] = members
+	}
+	for label, emails := range s.Google.Labels {
+		g.Labels[label] = emails
+	}
+	a := awsfake.NewClient()
+	withUserNames(s.AWS.Users, s.AWS.UserNames)
+	for _, u := range s.AWS.Users {
+		if _, err := a.CreateUser(u); err != nil {
+			return nil, nil, fmt.Errorf("invalid snapshot, user %s: %w", u.Username, err)
+		}
+	}
+	for _, group := range s.AWS.Groups {
+		created, err := a.CreateGroup(group)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid snapshot, group %s: %w", group.DisplayName, err)
+		}
+		for _, name := range s.AWS.Members[group.DisplayName] {
+			u, err := a.FindUserByEmail(name)
+			if err == nil {
+				err = a.AddUserToGroup(u, created)
+			}
+			if err != nil {
+				return nil, nil, fmt.Errorf("invalid snapshot, member %s of %s: %w", name, group.DisplayName, err)
+			}
+		}
+	}
+	return g, a, nil
+}
+
+// logStale warns that the changes are computed from the snapshot
+func (s *snapshot) logStale(now time.Time) {
+	log.WithFields(log.Fields{
+		"takenAt": s.TakenAt.Format(time.RFC3339),
+		"age":     now.Sub(s.TakenAt).Round(time.Second).String(),
+		"runId":   s.RunID,
+	}).Warn("OFFLINE: changes computed from the snapshot, Google Workspace and AWS SSO may have changed since")
+}
+
+// readOnlyClients returns the clients plan and diff compute the changes
+// with. With --offline, they hold the data of the snapshot, which is
+// returned. Otherwise they read from the providers, what they read being
+// recorded by the recorder returned when --snapshot-file is set.
+func readOnlyClients(ctx context.Context, cfg *config.Config) (google.Client, aws.Client, *snapshotRecorder, *snapshot, error) {
+	if cfg.Offline {
+		s, err := readSnapshot(cfg.SnapshotFile)
+		if err != nil {
+			log.WithError(err).Error("Error reading the snapshot")
+			return nil, nil, nil, nil, err
+		}
+		s.logStale(time.Now())
+		googleClient, awsClient, err := s.clients()
+		return googleClient, awsClient, nil, s, err
+	}
+	googleClient, awsClient, err := newClients(ctx, cfg, true, nil)
+	if err != nil || cfg.SnapshotFile == "" {
+		return googleClient, awsClient, nil, nil, err
+	}
+	r := newSnapshotRecorder()
+	return &recordingGoogleClient{Client: googleClient, r: r}, &recordingAWSClient{Client: awsClient, r: r}, r, nil, nil
+}
+
+// saveSnapshot writes what r recorded to the snapshot file, r may be nil
+func saveSnapshot(cfg *config.Config, r *snapshotRecorder) error {
+	if r == nil {
+		return nil
+	}
+	if err := writeSnapshot(cfg.SnapshotFile, r.snapshot(cfg.RunID, time.Now())); err != nil {
+		log.WithError(err).Error("Error writing the snapshot")
+		return err
+	}
+	log.WithField("file", cfg.SnapshotFile).Info("Snapshot written, plan and diff can run from it with --offline")
+	return nil
+}
@@ -0,0 +1,56 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/awslabs/ssosync/internal/aws"
+	awsfake "github.com/awslabs/ssosync/internal/aws/fake"
+	"github.com/awslabs/ssosync/internal/config"
+	googlefake "github.com/awslabs/ssosync/internal/google/fake"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSnapshot(t *testing.T) {
+	googleClient := googlefake.NewClient().
+		WithUsers(googlefake.User("a@email.com"), googlefake.User("b@email.com")).
+		WithGroup(googlefake.Group("aws-dev@email.com"), "a@email.com", "b@email.com")
+	awsClient := awsfake.NewClient().
+		WithUsers(aws.NewUser("a", "a", "a@email.com", true), aws.NewUser("c", "c", "c@email.com", true)).
+		WithGroup(aws.NewGroup("aws-dev"), "a@email.com", "c@email.com").
+		WithGroup(aws.NewGroup("aws-old"))
+	cfg := config.New()
+	r := newSnapshotRecorder()
+	live, err := newSyncGSuite(cfg, &recordingAWSClient{Client: awsClient, r: r}, &recordingGoogleClient{Client: googleClient, r: r}, nil).getChanges(nil)
+	assert.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "snapshot.json")
+	takenAt := time.Date(2026, 10, 16, 10, 0, 0, 0, time.UTC)
+	assert.NoError(t, writeSnapshot(path, r.snapshot("run-1", takenAt)))
+	s, err := readSnapshot(path)
+	assert.NoError(t, err)
+	assert.Equal(t, takenAt, s.TakenAt)
+	assert.Equal(t, map[string][]string{"aws-dev": {"a@email.com", "c@email.com"}, "aws-old": {}}, s.AWS.Members)
+
+	offlineGoogle, offlineAWS, err := s.clients()
+	assert.NoError(t, err)
+	offline, err := newSyncGSuite(cfg, offlineAWS, offlineGoogle, nil).getChanges(nil)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, live.records())
+	assert.Equal(t, live.records(), offline.records())
+}
@@ -0,0 +1,99 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package state
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+)
+
+type s3Store struct {
+	svc    s3iface.S3API
+	bucket string
+	key    string
+}
+
+// NewS3Store returns a Store that keeps the state in a JSON object in S3,
+// e.g. for the Lambda function which has no persistent file system
+func NewS3Store(svc s3iface.S3API, bucket string, key string) Store {
+	return &s3Store{svc: svc, bucket: bucket, key: key}
+}
+
+// ParseS3URL returns the bucket and key of a s3://bucket/key URL
+func ParseS3URL(s string) (string, string, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return "", "", err
+	}
+	key := strings.TrimPrefix(u.Path, "/")
+	if u.Scheme != "s3" || u.Host == "" || key == "" {
+		return "", "", fmt.Errorf("invalid S3 URL %q, expected s3://bucket/key", s)
+	}
+	return u.Host, key, nil
+}
+
+// IsS3URL reports if s is a s3:// URL
+func IsS3URL(s string) bool {
+	return strings.HasPrefix(s, "s3://")
+}
+
+// Load reads the state from the object, an empty State is returned if the
+// object doesn't exist yet
+func (s *s3Store) Load() (*State, error) {
+	out, err := s.svc.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(s.key),
+	})
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == s3.ErrCodeNoSuchKey {
+		return New(), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer out.Body.Close()
+
+	b, err := ioutil.ReadAll(out.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	return decode(b)
+}
+
+// Save writes the state to the object, S3 writes are atomic
+func (s *s3Store) Save(st *State) error {
+	b, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	_, err = s.svc.PutObject(&s3.PutObjectInput{
+		Bucket:      aws.String(s.bucket),
+		Key:         aws.String(s.key),
+		Body:        bytes.NewReader(b),
+		ContentType: aws.String("application/json"),
+	})
+
+	return err
+}
@@ -0,0 +1,78 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package state
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeS3 keeps the objects in memory
+type fakeS3 struct {
+	s3iface.S3API
+	objects map[string][]byte
+}
+
+func (f *fakeS3) GetObject(in *s3.GetObjectInput) (*s3.GetObjectOutput, error) {
+	b, ok := f.objects[*in.Bucket+"/"+*in.Key]
+	if !ok {
+		return nil, awserr.New(s3.ErrCodeNoSuchKey, "not found", nil)
+	}
+	return &s3.GetObjectOutput{Body: ioutil.NopCloser(bytes.NewReader(b))}, nil
+}
+
+func (f *fakeS3) PutObject(in *s3.PutObjectInput) (*s3.PutObjectOutput, error) {
+	b, err := ioutil.ReadAll(in.Body)
+	if err != nil {
+		return nil, err
+	}
+	f.objects[*in.Bucket+"/"+*in.Key] = b
+	return &s3.PutObjectOutput{}, nil
+}
+
+func TestS3Store(t *testing.T) {
+	store := NewS3Store(&fakeS3{objects: make(map[string][]byte)}, "bucket", "ssosync/state.json")
+
+	s, err := store.Load()
+	assert.NoError(t, err)
+	assert.Empty(t, s.Users)
+
+	s.RunID = "run-1"
+	s.SetUser("user-1@email.com", "etag-1", "id-1")
+	assert.NoError(t, store.Save(s))
+
+	s, err = store.Load()
+	assert.NoError(t, err)
+	assert.Equal(t, "run-1", s.RunID)
+	assert.True(t, s.UserUnchanged("user-1@email.com", "etag-1"))
+}
+
+func TestParseS3URL(t *testing.T) {
+	bucket, key, err := ParseS3URL("s3://bucket/ssosync/state.json")
+	assert.NoError(t, err)
+	assert.Equal(t, "bucket", bucket)
+	assert.Equal(t, "ssosync/state.json", key)
+
+	_, _, err = ParseS3URL("s3://bucket")
+	assert.Error(t, err)
+	_, _, err = ParseS3URL("/tmp/state.json")
+	assert.Error(t, err)
+}
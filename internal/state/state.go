@@ -0,0 +1,289 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package state persists what ssosync learned in a run for the next runs
+package state
+
+import (
+	"sort"
+	"time"
+)
+
+// State is the data kept between sync runs
+type State struct {
+	// RunID is the id of the last successful run
+	RunID string `json:"runId"`
+	// UpdatedAt is when the state was last saved
+	UpdatedAt time.Time `json:"updatedAt"`
+	// Users holds the last synced version of the Google users by primary email
+	Users map[string]*User `json:"users"`
+	// PendingDeletions holds the entities in quarantine by kind and name
+	PendingDeletions map[string]*Quarantined `json:"pendingDeletions"`
+	// Checkpoint is the progress of a run that didn't complete, if any
+	Checkpoint *Checkpoint `json:"checkpoint,omitempty"`
+	// LastReport is the outcome of the last successful run
+	LastReport *Report `json:"lastReport,omitempty"`
+	// Flaps tracks the entities changed by consecutive runs, by change key
+	Flaps map[string]*Flap `json:"flaps"`
+	// Deferred holds the destructive changes deferred by a blackout window,
+	// by change key
+	Deferred map[string]*Deferred `json:"deferred"`
+	// DeletedUsers holds the users deleted within the restore window, by
+	// normalized primary email
+	DeletedUsers map[string]*DeletedUser `json:"deletedUsers"`
+}
+
+// DeletedUser is a user deleted from AWS SSO, with the groups it was a
+// member of
+type DeletedUser struct {
+	// DeletedAt is when the user was deleted
+	DeletedAt time.Time `json:"deletedAt"`
+	// Groups are the display names of the groups the user was a member of
+	Groups []string `json:"groups"`
+	// RestoredAt is when the user was restored, nil until it is
+	RestoredAt *time.Time `json:"restoredAt,omitempty"`
+}
+
+// Deferred is a destructive change deferred until no blackout window is open
+type Deferred struct {
+	// Change is the deferred change
+	Change Change `json:"change"`
+	// Since is when the change was first deferred
+	Since time.Time `json:"since"`
+}
+
+// Flap tracks an entity changed by consecutive runs
+type Flap struct {
+	// Change is the last change computed for the entity
+	Change Change `json:"change"`
+	// Flips is the number of consecutive runs which reverted the change of
+	// the previous run
+	Flips int `json:"flips"`
+	// Suppressed is set once the entity is flapping, its changes are no
+	// longer applied
+	Suppressed bool `json:"suppressed"`
+	// Since is when the entity was first changed
+	Since time.Time `json:"since"`
+}
+
+// Report is the outcome of a run, the changes it applied to AWS SSO
+type Report struct {
+	// RunID is the id of the run
+	RunID string `json:"runId"`
+	// At is when the run completed
+	At time.Time `json:"at"`
+	// Changes are the changes applied by the run
+	Changes []Change `json:"changes"`
+	// SCIMCache are the statistics of the cache of the SCIM responses
+	SCIMCache *CacheStats `json:"scimCache,omitempty"`
+	// Usage are the resources used by the run
+	Usage *Usage `json:"usage,omitempty"`
+	// OversizedAttributes are the attributes of users over the limits of
+	// AWS SSO, truncated or whose users were skipped
+	OversizedAttributes []OversizedAttribute `json:"oversizedAttributes,omitempty"`
+}
+
+// OversizedAttribute is an attribute of a user over the limit of AWS SSO
+type OversizedAttribute struct {
+	// User is the email of the user
+	User string `json:"user"`
+	// Attribute is the SCIM attribute, e.g. "givenName"
+	Attribute string `json:"attribute"`
+	// Length and Limit are the numbers of characters of the attribute and
+	// allowed by AWS SSO
+	Length int `json:"length"`
+	Limit  int `json:"limit"`
+	// Action is "truncated" or "skipped"
+	Action string `json:"action"`
+}
+
+// HasChanges tells whether the run applied changes, r may be nil
+func (r *Report) HasChanges() bool {
+	return r != nil && len(r.Changes) > 0
+}
+
+// Usage are the resources used by a run, for capacity planning
+type Usage struct {
+	// Requests is the number of requests sent to Google and AWS, retries
+	// included
+	Requests int64 `json:"requests"`
+	// Retries is the number of requests which were retries
+	Retries int64 `json:"retries"`
+	// ThrottleWaitSeconds is the time the requests waited on rate limits
+	// and between retries, summed over the concurrent requests
+	ThrottleWaitSeconds float64 `json:"throttleWaitSeconds"`
+	// PeakMemoryBytes is the peak of the heap in use by the run, sampled
+	// while it runs, a short spike between two samples may be missed
+	PeakMemoryBytes uint64 `json:"peakMemoryBytes"`
+}
+
+// CacheStats are the hits and misses of the lookups of a cache
+type CacheStats struct {
+	Hits   int `json:"hits"`
+	Misses int `json:"misses"`
+}
+
+const (
+	// OpAdd is the operation of a change adding an entity
+	OpAdd = "add"
+	// OpUpdate is the operation of a change updating an entity
+	OpUpdate = "update"
+	// OpDelete is the operation of a change deleting an entity
+	OpDelete = "delete"
+	// KindMember is the kind of the changes to group memberships
+	KindMember = "member"
+)
+
+// Change is a change applied to AWS SSO
+type Change struct {
+	// Op is the operation, "add", "update" or "delete"
+	Op string `json:"op"`
+	// Kind is the kind of entity, "user", "group" or "member"
+	Kind string `json:"kind"`
+	// Name is the user name or group display name
+	Name string `json:"name"`
+	// Group is the group display name of a membership change
+	Group string `json:"group,omitempty"`
+	// From is the previous display name of a renamed group
+	From string `json:"from,omitempty"`
+}
+
+// Key identifies the entity changed
+func (c Change) Key() string {
+	return c.Kind + ":" + c.Name + ":" + c.Group
+}
+
+// Checkpoint is saved after each batch of membership changes, so the run
+// after an interrupted one logs how far it went. The changes are recomputed
+// by every run, the ones already applied are no longer needed.
+type Checkpoint struct {
+	// RunID is the id of the run that saved the checkpoint
+	RunID string `json:"runId"`
+	// Batches is the number of batches applied
+	Batches int `json:"batches"`
+	// Operations is the number of membership changes applied
+	Operations int `json:"operations"`
+	// UpdatedAt is when the checkpoint was saved
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// User is the last synced version of a Google user
+type User struct {
+	// Etag is the etag of the Google user
+	Etag string `json:"etag"`
+	// AWSID is the id of the user in AWS SSO
+	AWSID string `json:"awsId,omitempty"`
+	// Hash is the hash of the attributes ssosync last wrote to the AWS user
+	Hash string `json:"hash,omitempty"`
+	// AWSHash is the hash of the AWS user once they were written
+	AWSHash string `json:"awsHash,omitempty"`
+}
+
+const (
+	// KindUser is the kind of quarantined users
+	KindUser = "user"
+	// KindGroup is the kind of quarantined groups
+	KindGroup = "group"
+)
+
+// Quarantined is an entity whose deletion is delayed by a grace period
+type Quarantined struct {
+	// Kind is the kind of entity, "user" or "group"
+	Kind string `json:"kind"`
+	// Name is the user name or group display name
+	Name string `json:"name"`
+	// Since is when the entity was first found to be deleted
+	Since time.Time `json:"since"`
+}
+
+// New returns an empty State
+func New() *State {
+	return &State{
+		Users:            make(map[string]*User),
+		PendingDeletions: make(map[string]*Quarantined),
+		Flaps:            make(map[string]*Flap),
+		Deferred:         make(map[string]*Deferred),
+		DeletedUsers:     make(map[string]*DeletedUser),
+	}
+}
+
+// UserUnchanged reports whether the Google user with the given email and
+// etag is the same as when it was last synced
+func (s *State) UserUnchanged(email string, etag string) bool {
+	u, ok := s.Users[email]
+	return ok && etag != "" && u.Etag == etag
+}
+
+// SetUser records the synced version of a Google user
+func (s *State) SetUser(email string, etag string, awsID string) {
+	u, ok := s.Users[email]
+	if !ok {
+		u = &User{}
+		s.Users[email] = u
+	}
+	u.Etag = etag
+	if awsID != "" {
+		u.AWSID = awsID
+	}
+}
+
+// SetUserHashes records that the attributes with the given hash were
+// written to the AWS user of email, which then had the hash awsHash
+func (s *State) SetUserHashes(email string, hash string, awsHash string) {
+	u, ok := s.Users[email]
+	if !ok {
+		u = &User{}
+		s.Users[email] = u
+	}
+	u.Hash, u.AWSHash = hash, awsHash
+}
+
+// UserWritten reports whether the attributes with the given hash were
+// written to the AWS user of email, which still has the hash awsHash
+func (s *State) UserWritten(email string, hash string, awsHash string) bool {
+	u, ok := s.Users[email]
+	return ok && u.Hash != "" && u.Hash == hash && u.AWSHash == awsHash
+}
+
+// Quarantine puts the entity in quarantine at the given time, if it isn't
+// already, and returns its quarantine entry
+func (s *State) Quarantine(kind string, name string, now time.Time) *Quarantined {
+	k := kind + ":" + name
+	if q, ok := s.PendingDeletions[k]; ok {
+		return q
+	}
+	q := &Quarantined{Kind: kind, Name: name, Since: now}
+	s.PendingDeletions[k] = q
+	return q
+}
+
+// Release removes the entity from quarantine
+func (s *State) Release(kind string, name string) {
+	delete(s.PendingDeletions, kind+":"+name)
+}
+
+// Pending returns the entities in quarantine, oldest first
+func (s *State) Pending() []*Quarantined {
+	q := make([]*Quarantined, 0, len(s.PendingDeletions))
+	for _, e := range s.PendingDeletions {
+		q = append(q, e)
+	}
+	sort.Slice(q, func(i, j int) bool {
+		if !q[i].Since.Equal(q[j].Since) {
+			return q[i].Since.Before(q[j].Since)
+		}
+		return q[i].Kind+q[i].Name < q[j].Kind+q[j].Name
+	})
+	return q
+}
@@ -0,0 +1,100 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package state
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// Store loads and saves the State
+type Store interface {
+	Load() (*State, error)
+	Save(*State) error
+}
+
+type fileStore struct {
+	path string
+}
+
+// NewFileStore returns a Store that keeps the state in a local JSON file
+func NewFileStore(path string) Store {
+	return &fileStore{path: path}
+}
+
+// Load reads the state from the file, an empty State is returned if the
+// file doesn't exist yet
+func (f *fileStore) Load() (*State, error) {
+	b, err := ioutil.ReadFile(f.path)
+	if os.IsNotExist(err) {
+		return New(), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return decode(b)
+}
+
+// Save writes the state to a temporary file and renames it, so the file is
+// never left partially written
+func (f *fileStore) Save(s *State) error {
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(f.path), filepath.Base(f.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), f.path)
+}
+
+func decode(b []byte) (*State, error) {
+	s := New()
+	if err := json.Unmarshal(b, s); err != nil {
+		return nil, err
+	}
+	if s.Users == nil {
+		s.Users = make(map[string]*User)
+	}
+	if s.PendingDeletions == nil {
+		s.PendingDeletions = make(map[string]*Quarantined)
+	}
+	if s.Flaps == nil {
+		s.Flaps = make(map[string]*Flap)
+	}
+	if s.Deferred == nil {
+		s.Deferred = make(map[string]*Deferred)
+	}
+	if s.DeletedUsers == nil {
+		s.DeletedUsers = make(map[string]*DeletedUser)
+	}
+
+	return s, nil
+}
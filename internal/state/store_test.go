@@ -0,0 +1,71 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package state
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ssosync")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	store := NewFileStore(filepath.Join(dir, "state.json"))
+
+	s, err := store.Load()
+	assert.NoError(t, err)
+	assert.Empty(t, s.Users)
+
+	s.SetUser("user-1@email.com", "etag-1", "id-1")
+	s.RunID = "run1"
+	assert.NoError(t, store.Save(s))
+
+	s, err = store.Load()
+	assert.NoError(t, err)
+	assert.Equal(t, "run1", s.RunID)
+	assert.True(t, s.UserUnchanged("user-1@email.com", "etag-1"))
+	assert.False(t, s.UserUnchanged("user-1@email.com", "etag-2"))
+	assert.False(t, s.UserUnchanged("user-2@email.com", "etag-1"))
+
+	s.SetUser("user-1@email.com", "etag-2", "")
+	assert.Equal(t, "id-1", s.Users["user-1@email.com"].AWSID)
+}
+
+func TestQuarantine(t *testing.T) {
+	s := New()
+	now := time.Now()
+
+	q := s.Quarantine(KindUser, "user-1@email.com", now)
+	assert.Equal(t, now, q.Since)
+	s.Quarantine(KindGroup, "group-1", now.Add(-time.Hour))
+
+	q = s.Quarantine(KindUser, "user-1@email.com", now.Add(time.Hour))
+	assert.Equal(t, now, q.Since)
+
+	pending := s.Pending()
+	assert.Len(t, pending, 2)
+	assert.Equal(t, "group-1", pending[0].Name)
+	assert.Equal(t, "user-1@email.com", pending[1].Name)
+
+	s.Release(KindGroup, "group-1")
+	assert.Len(t, s.Pending(), 1)
+}
@@ -17,13 +17,30 @@ package internal
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"text/tabwriter"
+	"time"
 
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
 	"github.com/awslabs/ssosync/internal/aws"
 	"github.com/awslabs/ssosync/internal/config"
 	"github.com/awslabs/ssosync/internal/google"
+	"github.com/awslabs/ssosync/internal/jira"
+	"github.com/awslabs/ssosync/internal/matcher"
+	"github.com/awslabs/ssosync/internal/state"
 	"github.com/hashicorp/go-retryablehttp"
 
 	log "github.com/sirupsen/logrus"
@@ -34,11 +51,20 @@ import (
 // assignment to the `log` variable
 type Fields = log.Fields
 
+// ErrDeletionThresholdExceeded is returned when a run would delete more users
+// or groups than the deletion limits
+var ErrDeletionThresholdExceeded = errors.New("deletion threshold exceeded")
+
+// ErrCapExceeded is returned when Google Workspace returns more users or
+// groups than the caps, e.g. because of a query matching the whole directory
+var ErrCapExceeded = errors.New("too many google users or groups")
+
 // SyncGSuite is the interface for synchronizing users/groups
 type SyncGSuite interface {
 	SyncUsers(string) error
-	SyncGroups(string) error
-	SyncGroupsUsers(string) error
+	SyncGroups([]string) error
+	SyncGroupsUsers([]string) error
+	SyncUser(string, []string) error
 }
 
 // SyncGSuite is an object type that will synchronize real users and groups
@@ -46,17 +72,66 @@ type syncGSuite struct {
 	aws    aws.Client
 	google google.Client
 	cfg    *config.Config
+	state  *state.State
+	// store saves the state at checkpoints, it may be nil
+	store state.Store
+	// jira tracks the approval of destructive plans, it may be nil
+	jira jira.Client
+	// membersNotSupported is set once the SCIM endpoint didn't return the
+	// members of a group
+	membersNotSupported bool
+	// memberGroupsNotSupported is set once the SCIM endpoint didn't filter
+	// the groups by member
+	memberGroupsNotSupported bool
+	// bulkNotSupported is set once the SCIM endpoint didn't support bulk
+	// operations
+	bulkNotSupported bool
+	// holder keeps the destructive plans waiting for an approval, it may be nil
+	holder planHolder
+	// plan is the reviewed plan to apply, nil when the changes computed are
+	// applied
+	plan *Plan
+	// mu guards state while the SCIM requests run concurrently
+	mu sync.Mutex
+	// usage meters the requests of the clients, it may be nil
+	usage *usage
+	// awsCache is the AWS client diffing against the AWS cache, it may be nil
+	awsCache *cachedAWSClient
+	// groupNames are the names of the AWS groups by Google group email, read
+	// from the group names file, see readGroupNames
+	groupNames map[string]string
+	// mapping derives the AWS users from the Google users
+	mapping *userMapping
+	// oversized are the attributes over the limits of AWS SSO handled by
+	// the --oversized-attributes policy, by user and attribute
+	oversized map[string]state.OversizedAttribute
+	// untouched are the emails of the archived users whose AWS users are
+	// left untouched with --archived-users ignore, see keepUntouched
+	untouched map[string]bool
+	// ctx is the context of the run, no more user is created once it's done
+	ctx context.Context
 
 	users map[string]*aws.User
 }
 
-// New will create a new SyncGSuite object
-func New(cfg *config.Config, a aws.Client, g google.Client) SyncGSuite {
+// New will create a new SyncGSuite object, st is the state of the
+// previous runs and is updated while syncing, it may be nil
+func New(cfg *config.Config, a aws.Client, g google.Client, st *state.State) SyncGSuite {
+	return newSyncGSuite(cfg, a, g, st)
+}
+
+func newSyncGSuite(cfg *config.Config, a aws.Client, g google.Client, st *state.State) *syncGSuite {
+	if st == nil {
+		st = state.New()
+	}
 	return &syncGSuite{
-		aws:    a,
-		google: g,
-		cfg:    cfg,
-		users:  make(map[string]*aws.User),
+		aws:     a,
+		google:  g,
+		cfg:     cfg,
+		state:   st,
+		mapping: newUserMapping(cfg),
+		ctx:     context.Background(),
+		users:   make(map[string]*aws.User),
 	}
 }
 
@@ -116,89 +191,178 @@ func (s *syncGSuite) SyncUsers(query string) error {
 		}).Info("User deleted successfully in AWS")
 	}
 	log.Debug("get active google users")
-	googleUsers, err := s.google.GetUsers(query)
+	count := 0
+	// the users are streamed, each is checked against the ones before it
+	checkUserName := s.userNameCheck()
+	err = s.google.ForEachUser(query, func(u *admin.User) error {
+		count++
+		return s.syncActiveUser(u, checkUserName)
+	})
 	if err != nil {
-		log.WithField("query", query).Warn("Error getting active Google users")
+		log.WithField("query", query).Warn("Error syncing active Google users")
 		return err
 	}
-	log.WithField("count", len(googleUsers)).Info("Active Google users retrieved")
-	for _, u := range googleUsers {
-		if s.ignoreUser(u.PrimaryEmail) {
-			log.WithField("email", u.PrimaryEmail).Debug("Ignoring user based on configuration")
-			continue
+	log.WithField("count", count).Info("Active Google users synced")
+	return nil
+}
+
+// syncActiveUser creates or updates the AWS user of the active Google user u.
+// The users are streamed a page at a time, so the users of big directories
+// aren't all held in memory, checkUserName checks u against the users before
+// it, see userNameCheck.
+func (s *syncGSuite) syncActiveUser(u *admin.User, checkUserName func(*admin.User) error) error {
+	if s.ignoreUser(u.PrimaryEmail) || !s.includeUser(u.PrimaryEmail) {
+		log.WithField("email", u.PrimaryEmail).Debug("Ignoring user based on configuration")
+		return nil
+	}
+	switch s.outOfScope(u) {
+	case "":
+	case suspension, archival:
+		return s.deleteSuspendedUser(u)
+	default:
+		log.WithField("email", u.PrimaryEmail).Debug("Ignoring user based on configuration")
+		return nil
+	}
+	if err := checkUserName(u); err != nil {
+		return err
+	}
+	ll := log.WithFields(log.Fields{
+		"email": u.PrimaryEmail,
+	})
+	if s.cfg.SkipUnchangedUsers && s.state.UserUnchanged(u.PrimaryEmail, u.Etag) && s.state.Users[u.PrimaryEmail].AWSID != "" {
+		ll.Debug("User unchanged since last sync, skipping")
+		s.users[aws.NormalizeName(u.PrimaryEmail)] = &aws.User{
+			ID:       s.state.Users[u.PrimaryEmail].AWSID,
+			Username: u.PrimaryEmail,
 		}
-		ll := log.WithFields(log.Fields{
-			"email": u.PrimaryEmail,
-		})
-		ll.Debug("finding user")
-		uu, _ := s.aws.FindUserByEmail(u.PrimaryEmail)
-		if uu != nil {
-			s.users[uu.Username] = uu
-			// Update the user when suspended state is changed
-			if uu.Active == u.Suspended {
-				log.WithFields(log.Fields{
-					"email":    u.PrimaryEmail,
-					"username": uu.Username,
-					"id":       uu.ID,
-				}).Info("Mismatch active/suspended, updating user")
-				// create new user object and update the user
-				_, err := s.aws.UpdateUser(aws.UpdateUser(
-					uu.ID,
-					u.Name.GivenName,
-					u.Name.FamilyName,
-					u.PrimaryEmail,
-					!u.Suspended))
-				if err != nil {
-					log.WithFields(log.Fields{
-						"email":    u.PrimaryEmail,
-						"username": uu.Username,
-						"id":       uu.ID,
-					}).Warn("Error updating user")
-					return err
-				}
+		return nil
+	}
+	ll.Debug("finding user")
+	uu, _ := s.aws.FindUserByEmail(u.PrimaryEmail)
+	if uu != nil {
+		s.users[aws.NormalizeName(uu.Username)] = uu
+		// Update the user when suspended state is changed
+		if uu.Active != (google.StatusOf(u) == google.UserActive) {
+			log.WithFields(log.Fields{
+				"email":    u.PrimaryEmail,
+				"username": uu.Username,
+				"id":       uu.ID,
+			}).Info("Mismatch active/suspended, updating user")
+			// the user keeps the attributes ssosync doesn't sync
+			update := *uu
+			s.mapping.update(&update, s.mapping.user(u, s.awsUserID))
+			_, err := s.aws.UpdateUser(&update)
+			if err != nil {
 				log.WithFields(log.Fields{
 					"email":    u.PrimaryEmail,
 					"username": uu.Username,
 					"id":       uu.ID,
-				}).Info("User updated successfully")
+				}).Warn("Error updating user")
+				return err
 			}
-			continue
+			log.WithFields(log.Fields{
+				"email":    u.PrimaryEmail,
+				"username": uu.Username,
+				"id":       uu.ID,
+			}).Info("User updated successfully")
+		}
+		s.state.SetUser(u.PrimaryEmail, u.Etag, uu.ID)
+		return nil
+	}
+	renamed, err := s.findRenamedUser(u)
+	if err != nil {
+		ll.Warn("Error finding the user by its aliases")
+		return err
+	}
+	if renamed != nil {
+		ll.WithField("from", renamed.Username).Info("User email changed, renaming user")
+		// the user keeps the attributes ssosync doesn't sync
+		update := *renamed
+		s.mapping.update(&update, s.mapping.user(u, s.awsUserID))
+		uu, err := s.aws.UpdateUser(&update)
+		if err != nil {
+			ll.WithField("from", renamed.Username).Warn("Error renaming user")
+			return err
 		}
-		ll.Info("creating user")
+		ll.WithField("id", uu.ID).Info("User renamed successfully in AWS")
+		s.users[aws.NormalizeName(uu.Username)] = uu
+		s.state.SetUser(u.PrimaryEmail, u.Etag, uu.ID)
+		return nil
+	}
+	ll.Info("creating user")
+	log.WithFields(log.Fields{
+		"email":      u.PrimaryEmail,
+		"givenName":  u.Name.GivenName,
+		"familyName": u.Name.FamilyName,
+		"suspended":  u.Suspended,
+	}).Info("Creating user in AWS")
+	uu, err = s.aws.CreateUser(s.mapping.user(u, s.awsUserID))
+	if err != nil {
 		log.WithFields(log.Fields{
 			"email":      u.PrimaryEmail,
 			"givenName":  u.Name.GivenName,
 			"familyName": u.Name.FamilyName,
 			"suspended":  u.Suspended,
-		}).Info("Creating user in AWS")
-		uu, err := s.aws.CreateUser(aws.NewUser(
-			u.Name.GivenName,
-			u.Name.FamilyName,
-			u.PrimaryEmail,
-			!u.Suspended))
+		}).Warn("Error creating user")
+		return err
+	}
+	log.WithFields(log.Fields{
+		"email":    uu.Username,
+		"username": uu.Username,
+		"id":       uu.ID,
+	}).Info("User created successfully in AWS")
+	s.users[aws.NormalizeName(uu.Username)] = uu
+	s.state.SetUser(u.PrimaryEmail, u.Etag, uu.ID)
+	return nil
+}
+
+// findRenamedUser returns the AWS user of the Google user u named after one
+// of its aliases, the previous email of u, nil when there is none. A user
+// with the external id of another Google user isn't one.
+func (s *syncGSuite) findRenamedUser(u *admin.User) (*aws.User, error) {
+	for _, alias := range googleAliases(u) {
+		uu, err := s.aws.FindUserByEmail(alias)
+		if errors.Is(err, aws.ErrUserNotFound) {
+			continue
+		}
 		if err != nil {
-			log.WithFields(log.Fields{
-				"email":      u.PrimaryEmail,
-				"givenName":  u.Name.GivenName,
-				"familyName": u.Name.FamilyName,
-				"suspended":  u.Suspended,
-			}).Warn("Error creating user")
-			return err
+			return nil, err
 		}
-		log.WithFields(log.Fields{
-			"email":    uu.Username,
-			"username": uu.Username,
-			"id":       uu.ID,
-		}).Info("User created successfully in AWS")
-		s.users[uu.Username] = uu
+		if uu.ExternalID == "" || uu.ExternalID == u.Id {
+			return uu, nil
+		}
+	}
+	return nil, nil
+}
+
+// deleteSuspendedUser deletes the AWS user of the suspended Google user u,
+// suspended users are treated as deleted with --skip-suspended-users, and
+// archived users with --archived-users delete
+func (s *syncGSuite) deleteSuspendedUser(u *admin.User) error {
+	ll := log.WithField("email", u.PrimaryEmail)
+	uu, err := s.aws.FindUserByEmail(u.PrimaryEmail)
+	if err == aws.ErrUserNotFound {
+		ll.Debug("Suspended user not in AWS, skipping it")
+		return nil
+	}
+	if err != nil {
+		ll.Warn("Error finding suspended user in AWS")
+		return err
 	}
+	ll = ll.WithFields(log.Fields{"username": uu.Username, "id": uu.ID})
+	ll.Info("Deleting suspended user in AWS")
+	if err := s.aws.DeleteUser(uu); err != nil {
+		ll.Warn("Error deleting user")
+		return err
+	}
+	ll.Info("User deleted successfully in AWS")
 	return nil
 }
 
 // SyncGroups will sync groups from Google -> AWS SSO
 // References:
 // * https://developers.google.com/admin-sdk/directory/v1/guides/search-groups
-// query possible values:
+// queries possible values, the groups matching any of them are synced:
 // ” --> empty or not defined
 //
 //	name='contact'
@@ -207,14 +371,16 @@ func (s *syncGSuite) SyncUsers(query string) error {
 //	name:contact* email:contact*
 //	name:Admin* email:aws-*
 //	email:aws-*
-func (s *syncGSuite) SyncGroups(query string) error {
-	log.WithField("query", query).Debug("get google groups")
-	googleGroups, err := s.google.GetGroups(query)
+func (s *syncGSuite) SyncGroups(queries []string) error {
+	log.WithField("queries", queries).Debug("get google groups")
+	googleGroups, err := s.getGroupsMatching(queries)
 	if err != nil {
-		log.WithField("query", query).Warn("Error getting Google groups")
 		return err
 	}
 	log.WithField("count", len(googleGroups)).Info("Google groups retrieved")
+	if err := s.readGroupNames(); err != nil {
+		return err
+	}
 	correlatedGroups := make(map[string]*aws.Group)
 	for _, g := range googleGroups {
 		if s.ignoreGroup(g.Email) || !s.includeGroup(g.Email) {
@@ -226,18 +392,22 @@ func (s *syncGSuite) SyncGroups(query string) error {
 		})
 		log.Debug("Check group")
 		var group *aws.Group
-		gg, err := s.aws.FindGroupByDisplayName(g.Email)
+		name := s.awsGroupName(g.Email, g.Email)
+		gg, err := s.aws.FindGroupByDisplayName(name)
 		if err != nil && err != aws.ErrGroupNotFound {
 			log.WithField("group", g.Email).Warn("Error finding group in AWS")
 			return err
 		}
 		if gg != nil {
 			log.Debug("Found group")
+			if !gg.ManagedFor(g.Id) {
+				log.Warn("Group was not created by ssosync, it has neither the id of its Google group nor the ssosync marker as external id")
+			}
 			correlatedGroups[gg.DisplayName] = gg
 			group = gg
 		} else {
 			log.Info("Creating group in AWS")
-			newGroup, err := s.aws.CreateGroup(aws.NewGroup(g.Email))
+			newGroup, err := s.aws.CreateGroup(aws.NewManagedGroup(name, g.Id))
 			if err != nil {
 				log.WithField("group", g.Email).Warn("Error creating group in AWS")
 				return err
@@ -261,21 +431,28 @@ func (s *syncGSuite) SyncGroups(query string) error {
 		memberList := make(map[string]*admin.Member)
 		log.Info("Start group user sync")
 		for _, m := range groupMembers {
-			if _, ok := s.users[m.Email]; ok {
-				memberList[m.Email] = m
+			if _, ok := s.users[aws.NormalizeName(m.Email)]; ok {
+				memberList[aws.NormalizeName(m.Email)] = m
 			}
 		}
+		memberIDs, err := s.awsGroupMemberIDs(group)
+		if err != nil {
+			return err
+		}
 		for _, u := range s.users {
 			log.WithField("user", u.Username).Debug("Checking user is in group already")
-			b, err := s.aws.IsUserInGroup(u, group)
-			if err != nil {
-				log.WithFields(Fields{
-					"user":  u.Username,
-					"group": group.DisplayName,
-				}).Warn("Error checking user membership in AWS group")
-				return err
+			b := memberIDs[u.ID]
+			if memberIDs == nil {
+				b, err = s.aws.IsUserInGroup(u, group)
+				if err != nil {
+					log.WithFields(Fields{
+						"user":  u.Username,
+						"group": group.DisplayName,
+					}).Warn("Error checking user membership in AWS group")
+					return err
+				}
 			}
-			if _, ok := memberList[u.Username]; ok {
+			if _, ok := memberList[aws.NormalizeName(u.Username)]; ok {
 				if !b {
 					log.WithFields(Fields{
 						"user":  u.Username,
@@ -340,73 +517,34 @@ func (s *syncGSuite) SyncGroups(query string) error {
 //  4. add groups in aws and add its members, these were added in google
 //  5. validate equals aws an google groups members
 //  6. delete groups in aws, these were deleted in google
-func (s *syncGSuite) SyncGroupsUsers(query string) error {
-	log.WithField("query", query).Info("get google groups")
-	googleGroups, err := s.google.GetGroups(query)
+func (s *syncGSuite) SyncGroupsUsers(queries []string) error {
+	changes, err := s.getChanges(queries)
 	if err != nil {
-		log.WithField("query", query).Warn("Error getting Google groups")
 		return err
 	}
-	log.WithField("count", len(googleGroups)).Info("Google groups retrieved")
-	filteredGoogleGroups := []*admin.Group{}
-	for _, g := range googleGroups {
-		if s.ignoreGroup(g.Email) {
-			log.WithField("group", g.Email).Debug("ignoring group")
-			continue
+	if s.plan != nil {
+		if err := s.plan.check(changes); err != nil {
+			return err
 		}
-		filteredGoogleGroups = append(filteredGoogleGroups, g)
-	}
-	googleGroups = filteredGoogleGroups
-	log.Debug("preparing list of google users and then google groups and their members")
-	googleUsers, googleGroupsUsers, err := s.getGoogleGroupsAndUsers(googleGroups)
-	if err != nil {
-		log.Warn("Error getting Google groups and users")
-		return err
+		log.WithField("runId", s.plan.RunID).Info("Changes match the plan, applying it")
 	}
-	log.WithFields(log.Fields{
-		"googleUsers":  len(googleUsers),
-		"googleGroups": len(googleGroupsUsers),
-	}).Info("Google users and groups retrieved")
-	log.Info("get existing aws groups")
-	awsGroups, err := s.aws.GetGroups()
+	approved, err := s.approvePlan(changes)
 	if err != nil {
-		log.Error("error getting aws groups")
 		return err
 	}
-	log.WithField("count", len(awsGroups)).Info("AWS groups retrieved")
-	log.Info("get existing aws users")
-	awsUsers, err := s.aws.GetUsers()
-	if err != nil {
-		log.Error("error getting aws users")
-		return err
+	if !approved {
+		if err := checkDeletionLimits(s.cfg, changes); err != nil {
+			return err
+		}
 	}
-	log.WithField("count", len(awsUsers)).Info("AWS users retrieved")
-	log.Debug("preparing list of aws groups and their members")
-	awsGroupsUsers, err := s.getAWSGroupsAndUsers(awsGroups, awsUsers)
-	if err != nil {
-		log.Warn("Error getting AWS groups and users")
+	if err := s.confirmDestructiveChanges(changes); err != nil {
 		return err
 	}
-	log.WithField("count", len(awsGroupsUsers)).Info("AWS groups and users retrieved")
-	// create list of changes by operations
-	addAWSUsers, delAWSUsers, updateAWSUsers, _ := getUserOperations(awsUsers, googleUsers)
-	addAWSGroups, delAWSGroups, equalAWSGroups := getGroupOperations(awsGroups, googleGroups)
-	log.WithFields(log.Fields{
-		"addAWSUsers":    len(addAWSUsers),
-		"delAWSUsers":    len(delAWSUsers),
-		"updateAWSUsers": len(updateAWSUsers),
-		"addAWSGroups":   len(addAWSGroups),
-		"delAWSGroups":   len(delAWSGroups),
-		"equalAWSGroups": len(equalAWSGroups),
-	}).Info("Changes to be applied")
 	log.Info("syncing changes")
 	// delete aws users (deleted in google)
 	log.Debug("deleting aws users deleted in google")
-	if !checkUserDeletionThreshold(delAWSUsers) {
-		log.Error("Deletion threshold exceeded for users")
-		return errors.New("deletion threshold exceeded for users")
-	}
-	for _, awsUser := range delAWSUsers {
+	err = forEach(len(changes.deleteUsers), s.cfg.SCIMConcurrency, func(i int) error {
+		awsUser := changes.deleteUsers[i]
 		log := log.WithFields(log.Fields{"user": awsUser.Username})
 		log.Debug("finding user")
 		awsUserFull, err := s.aws.FindUserByEmail(awsUser.Username)
@@ -419,140 +557,137 @@ func (s *syncGSuite) SyncGroupsUsers(query string) error {
 			log.Error("error deleting user")
 			return err
 		}
+		s.release(state.KindUser, awsUser.Username)
+		if s.cfg.RestoreWindow > 0 {
+			s.recordDeletion(awsUserFull, changes, time.Now())
+		}
 		log.Info("User deleted successfully in AWS")
+		return nil
+	})
+	if err != nil {
+		return err
 	}
 	// update aws users (updated in google)
 	log.Debug("updating aws users updated in google")
-	for _, awsUser := range updateAWSUsers {
+	err = forEach(len(changes.updateUsers), s.cfg.SCIMConcurrency, func(i int) error {
+		awsUser := changes.updateUsers[i]
 		log := log.WithFields(log.Fields{"user": awsUser.Username})
 		log.Debug("finding user")
-		awsUserFull, err := s.aws.FindUserByEmail(awsUser.Username)
+		var awsUserFull *aws.User
+		var err error
+		if awsUser.ID != "" {
+			// the email of the user changed, see getUserOperations
+			awsUserFull, err = s.aws.FindUserByID(awsUser.ID)
+		} else {
+			awsUserFull, err = s.aws.FindUserByEmail(awsUser.Username)
+		}
 		if err != nil {
 			log.Warn("Error finding user in AWS")
 			return err
 		}
+		// the user keeps the attributes ssosync doesn't sync
+		update := *awsUserFull
+		s.mapping.update(&update, awsUser)
 		log.Warn("updating user")
-		_, err = s.aws.UpdateUser(awsUserFull)
+		updated, err := s.aws.UpdateUser(&update)
 		if err != nil {
 			log.Error("error updating user")
 			return err
 		}
+		s.mu.Lock()
+		s.state.SetUserHashes(awsUser.Username, userHash(awsUser, s.mapping), userHash(updated, s.mapping))
+		s.mu.Unlock()
 		log.Info("User updated successfully in AWS")
+		return nil
+	})
+	if err != nil {
+		return err
 	}
-	// add aws users (added in google)
+	// add aws users (added in google), the memberships of the users which
+	// couldn't be created are skipped and the error returned at the end
 	log.Debug("creating aws users added in google")
-	for _, awsUser := range addAWSUsers {
-		log := log.WithFields(log.Fields{"user": awsUser.Username})
-		log.Info("creating user")
-		_, err := s.aws.CreateUser(awsUser)
-		if err != nil {
-			errHttp := new(aws.ErrHttpNotOK)
-			if errors.As(err, &errHttp) && errHttp.StatusCode == 409 {
-				log.WithField("user", awsUser.Username).Warn("user already exists")
-				continue
-			}
-			log.Error("error creating user")
+	failedUsers, createErr := s.createUsers(s.ctx, changes.addUsers)
+	if s.cfg.RestoreWindow > 0 {
+		s.markRestored(changes.addUsers, failedUsers, time.Now())
+	}
+	changes.addMembers = withoutMembers(changes.addMembers, failedUsers)
+	// rename aws groups (renamed in google), instead of deleting and creating
+	// them again, which would lose the permission sets assigned to them
+	log.Debug("renaming aws groups renamed in google")
+	err = forEach(len(changes.renameGroups), s.cfg.SCIMConcurrency, func(i int) error {
+		r := changes.renameGroups[i]
+		log := log.WithFields(log.Fields{"group": r.group.DisplayName, "name": r.name})
+		log.Warn("renaming group")
+		if err := s.aws.RenameGroup(r.group, r.name); err != nil {
+			log.Error("renaming group")
 			return err
 		}
-		log.Info("User created successfully in AWS")
+		log.Info("Group renamed successfully in AWS")
+		return nil
+	})
+	if err != nil {
+		return err
 	}
 	// add aws groups (added in google)
 	log.Debug("creating aws groups added in google")
-	for _, awsGroup := range addAWSGroups {
+	groups := make([]*aws.Group, len(changes.addGroups), len(changes.addGroups)+len(changes.equalGroups))
+	err = forEach(len(changes.addGroups), s.cfg.SCIMConcurrency, func(i int) error {
+		awsGroup := changes.addGroups[i]
 		log := log.WithFields(log.Fields{"group": awsGroup.DisplayName})
 		log.Info("creating group")
-		_, err := s.aws.CreateGroup(awsGroup)
+		newGroup, err := s.aws.CreateGroup(awsGroup)
 		if err != nil {
 			log.Error("creating group")
 			return err
 		}
 		log.Info("Group created successfully in AWS")
-		// add members of the new group
-		for _, googleUser := range googleGroupsUsers[awsGroup.DisplayName] {
-			// equivalent aws user of google user on the fly
-			log.Debug("finding user")
-			awsUserFull, err := s.aws.FindUserByEmail(googleUser.PrimaryEmail)
-			if err != nil {
-				log.WithField("email", googleUser.PrimaryEmail).Warn("Error finding user in AWS")
-				return err
-			}
-			log.WithField("user", awsUserFull.Username).Info("adding user to group")
-			err = s.aws.AddUserToGroup(awsUserFull, awsGroup)
-			if err != nil {
-				log.WithFields(Fields{
-					"user":  awsUserFull.Username,
-					"group": awsGroup.DisplayName,
-				}).Warn("Error adding user to group in AWS")
-				return err
-			}
-			log.WithFields(Fields{
-				"user":  awsUserFull.Username,
-				"group": awsGroup.DisplayName,
-			}).Info("User added to group successfully in AWS")
-		}
+		groups[i] = newGroup
+		return nil
+	})
+	if err != nil {
+		return err
 	}
-	// list of users to to be removed in aws groups
-	deleteUsersFromGroup, _ := getGroupUsersOperations(googleGroupsUsers, awsGroupsUsers)
-	// validate groups members are equal in aws and google
-	log.Debug("validating groups members, equals in aws and google")
-	for _, awsGroup := range equalAWSGroups {
-		// add members of the new group
-		log := log.WithFields(log.Fields{"group": awsGroup.DisplayName})
-		for _, googleUser := range googleGroupsUsers[awsGroup.DisplayName] {
-			log.WithField("user", googleUser.PrimaryEmail).Debug("finding user")
-			awsUserFull, err := s.aws.FindUserByEmail(googleUser.PrimaryEmail)
-			if err != nil {
-				log.WithField("email", googleUser.PrimaryEmail).Warn("Error finding user in AWS")
-				return err
-			}
-			log.WithField("user", awsUserFull.Username).Debug("checking user is in group already")
-			b, err := s.aws.IsUserInGroup(awsUserFull, awsGroup)
-			if err != nil {
-				log.WithFields(Fields{
-					"user":  awsUserFull.Username,
-					"group": awsGroup.DisplayName,
-				}).Warn("Error checking user membership in AWS group")
+	groups = append(groups, changes.equalGroups...)
+	// add and remove members so aws and google groups are equal, in batches
+	log.Debug("syncing groups members, equals in aws and google")
+	ops := getMemberOperations(groups, changes.addMembers, changes.removeMembers)
+	batches := batchMemberOperations(ops, s.cfg.MembershipBatchSize)
+	applied := 0
+	for i, batch := range batches {
+		appliedOps := make([]bool, len(batch))
+		err := forEach(len(batch), s.cfg.SCIMConcurrency, func(j int) error {
+			if err := s.applyMemberOperation(batch[j]); err != nil {
 				return err
 			}
-			if !b {
-				log.WithField("user", awsUserFull.Username).Info("adding user to group")
-				err := s.aws.AddUserToGroup(awsUserFull, awsGroup)
-				if err != nil {
-					log.WithFields(Fields{
-						"user":  awsUserFull.Username,
-						"group": awsGroup.DisplayName,
-					}).Warn("Error adding user to group in AWS")
-					return err
-				}
-				log.WithFields(Fields{
-					"user":  awsUserFull.Username,
-					"group": awsGroup.DisplayName,
-				}).Info("User added to group successfully in AWS")
-			}
+			appliedOps[j] = true
+			return nil
+		})
+		logMemberOperations(batch, appliedOps)
+		if err != nil {
+			return err
 		}
-		for _, awsUser := range deleteUsersFromGroup[awsGroup.DisplayName] {
-			log.WithField("user", awsUser.Username).Warn("removing user from group")
-			err := s.aws.RemoveUserFromGroup(awsUser, awsGroup)
-			if err != nil {
-				log.WithFields(Fields{
-					"user":  awsUser.Username,
-					"group": awsGroup.DisplayName,
-				}).Warn("Error removing user from group in AWS")
-				return err
-			}
-			log.WithFields(Fields{
-				"user":  awsUser.Username,
-				"group": awsGroup.DisplayName,
-			}).Info("User removed from group successfully in AWS")
+		applied += len(batch)
+		s.state.Checkpoint = &state.Checkpoint{
+			RunID:      s.cfg.RunID,
+			Batches:    i + 1,
+			Operations: applied,
+			UpdatedAt:  time.Now(),
 		}
+		if err := s.saveCheckpoint(); err != nil {
+			return err
+		}
+		log.WithFields(log.Fields{
+			"batch":      i + 1,
+			"batches":    len(batches),
+			"operations": applied,
+			"total":      len(ops),
+		}).Info("Batch of group membership changes applied")
 	}
+	s.state.Checkpoint = nil
 	// delete aws groups (deleted in google)
 	log.Debug("delete aws groups deleted in google")
-	if !checkGroupDeletionThreshold(delAWSGroups) {
-		log.Error("Deletion threshold exceeded for groups")
-		return errors.New("deletion threshold exceeded for groups")
-	}
-	for _, awsGroup := range delAWSGroups {
+	err = forEach(len(changes.deleteGroups), s.cfg.SCIMConcurrency, func(i int) error {
+		awsGroup := changes.deleteGroups[i]
 		log := log.WithFields(log.Fields{"group": awsGroup.DisplayName})
 		log.Debug("finding group")
 		awsGroupFull, err := s.aws.FindGroupByDisplayName(awsGroup.DisplayName)
@@ -566,93 +701,979 @@ func (s *syncGSuite) SyncGroupsUsers(query string) error {
 			log.Error("deleting group")
 			return err
 		}
+		s.release(state.KindGroup, awsGroup.DisplayName)
 		log.Info("Group deleted successfully in AWS")
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if createErr != nil {
+		return createErr
+	}
+	for _, u := range changes.googleUsers {
+		s.state.SetUser(u.PrimaryEmail, u.Etag, "")
+	}
+	s.state.LastReport = &state.Report{
+		RunID:               s.cfg.RunID,
+		At:                  time.Now(),
+		Changes:             changes.records(),
+		SCIMCache:           s.scimCacheStats(),
+		Usage:               s.usage.report(),
+		OversizedAttributes: s.oversizedReport(),
+	}
+	for _, q := range s.state.Pending() {
+		log.WithFields(log.Fields{
+			"kind":        q.Kind,
+			"name":        q.Name,
+			"since":       q.Since.Format(time.RFC3339),
+			"deleteAfter": q.Since.Add(s.cfg.DeletionGracePeriod).Format(time.RFC3339),
+		}).Warn("Pending deletion")
 	}
 	log.Info("sync completed")
 	return nil
 }
 
-// getGoogleGroupsAndUsers return a list of google users members of googleGroups
-// and a map of google groups and its users' list
-func (s *syncGSuite) getGoogleGroupsAndUsers(googleGroups []*admin.Group) ([]*admin.User, map[string][]*admin.User, error) {
-	log.WithField("count", len(googleGroups)).Info("Getting Google groups and users")
-	gUsers := make([]*admin.User, 0)
-	gGroupsUsers := make(map[string][]*admin.User)
-	gUniqUsers := make(map[string]*admin.User)
-	for _, g := range googleGroups {
-		log := log.WithFields(log.Fields{"group": g.Name})
-		if s.ignoreGroup(g.Email) {
-			log.Debug("ignoring group")
-			continue
-		}
-		log.Debug("get group members from google")
-		groupMembers, err := s.google.GetGroupMembers(g)
-		if err != nil {
-			log.WithField("group", g.Email).Warn("Error getting group members from Google")
-			return nil, nil, err
+// scimCacheStats logs and returns the hits and misses of the cache of the
+// AWS SSO SCIM responses, nil when the client doesn't cache them
+func (s *syncGSuite) scimCacheStats() *state.CacheStats {
+	r, ok := s.aws.(aws.CacheStatsReporter)
+	if !ok {
+		return nil
+	}
+	stats := r.CacheStats()
+	log.WithFields(log.Fields{
+		"hits":   stats.Hits,
+		"misses": stats.Misses,
+	}).Info("SCIM response cache statistics")
+	return &state.CacheStats{Hits: stats.Hits, Misses: stats.Misses}
+}
+
+// applyGracePeriod puts the users and groups to delete in quarantine and
+// returns the ones that have been in quarantine for longer than the deletion
+// grace period. Entities in quarantine which are no longer to be deleted,
+// e.g. because they were restored in Google, are released.
+func (s *syncGSuite) applyGracePeriod(users []*aws.User, groups []*aws.Group, now time.Time) (dueUsers []*aws.User, dueGroups []*aws.Group) {
+	pending := map[string]map[string]struct{}{
+		state.KindUser:  {},
+		state.KindGroup: {},
+	}
+	for _, u := range users {
+		pending[state.KindUser][u.Username] = struct{}{}
+		q := s.state.Quarantine(state.KindUser, u.Username, now)
+		if now.Sub(q.Since) >= s.cfg.DeletionGracePeriod {
+			dueUsers = append(dueUsers, u)
 		}
-		log.WithField("count", len(groupMembers)).Info("Group members retrieved from Google")
-		log.Debug("get users")
-		membersUsers := make([]*admin.User, 0)
-		for _, m := range groupMembers {
-			if s.ignoreUser(m.Email) {
-				log.WithField("id", m.Email).Debug("ignoring user")
-				continue
-			}
-			if m.Type == "GROUP" {
-				log.WithField("id", m.Email).Debug("ignoring group address")
-				continue
-			}
-			log.WithField("id", m.Email).Debug("get user")
-			q := fmt.Sprintf("email:%s", m.Email)
-			u, err := s.google.GetUsers(q) // TODO: implement GetUser(m.Email)
-			if err != nil {
-				log.WithField("email", m.Email).Warn("Error getting user from Google")
-				return nil, nil, err
-			}
-			if len(u) == 0 {
-				log.WithField("email", m.Email).Debug("Ignoring Unknown User")
-				continue
-			}
-			log.WithFields(Fields{
-				"email":      u[0].PrimaryEmail,
-				"givenName":  u[0].Name.GivenName,
-				"familyName": u[0].Name.FamilyName,
-			}).Info("User retrieved from Google")
-			membersUsers = append(membersUsers, u[0])
-			_, ok := gUniqUsers[m.Email]
-			if !ok {
-				gUniqUsers[m.Email] = u[0]
-			}
+	}
+	for _, g := range groups {
+		pending[state.KindGroup][g.DisplayName] = struct{}{}
+		q := s.state.Quarantine(state.KindGroup, g.DisplayName, now)
+		if now.Sub(q.Since) >= s.cfg.DeletionGracePeriod {
+			dueGroups = append(dueGroups, g)
 		}
-		gGroupsUsers[g.Name] = membersUsers
-		log.WithFields(Fields{
-			"group": g.Name,
-			"count": len(membersUsers),
-		}).Info("Group members added to map")
 	}
-	for _, user := range gUniqUsers {
-		gUsers = append(gUsers, user)
+	for _, q := range s.state.Pending() {
+		if _, ok := pending[q.Kind][q.Name]; !ok {
+			log.WithFields(log.Fields{
+				"kind": q.Kind,
+				"name": q.Name,
+			}).Info("Entity no longer to be deleted, releasing it from quarantine")
+			s.state.Release(q.Kind, q.Name)
+		}
 	}
 	log.WithFields(log.Fields{
-		"uniqueUsers": len(gUniqUsers),
-		"totalUsers":  len(gUsers),
-	}).Info("Google users retrieved")
-	return gUsers, gGroupsUsers, nil
+		"users":     len(users),
+		"groups":    len(groups),
+		"dueUsers":  len(dueUsers),
+		"dueGroups": len(dueGroups),
+	}).Info("Deletion grace period applied")
+	return dueUsers, dueGroups
 }
 
-// getAWSGroupsAndUsers return a list of google users members of googleGroups
-// and a map of google groups and its users' list
-func (s *syncGSuite) getAWSGroupsAndUsers(awsGroups []*aws.Group, awsUsers []*aws.User) (map[string][]*aws.User, error) {
-	log.WithFields(log.Fields{
-		"groups": len(awsGroups),
-		"users":  len(awsUsers),
-	}).Info("Getting AWS groups and users")
-	awsGroupsUsers := make(map[string][]*aws.User)
+// getChanges reads the Google groups matching queries, their members and the
+// AWS users and groups, and returns the changes SyncGroupsUsers applies to
+// make AWS SSO equal to Google Workspace. It doesn't write anything. The users
+// in scope and the members of the groups of both sides are held in memory,
+// only the users outside the groups are streamed, see withAllUsers.
+func (s *syncGSuite) getChanges(queries []string) (*changeSet, error) {
+	googleGroups, err := s.getGoogleGroups(queries)
+	if err != nil {
+		return nil, err
+	}
+	log.WithField("count", len(googleGroups)).Info("Google groups retrieved")
+	filteredGoogleGroups := []*admin.Group{}
+	for _, g := range googleGroups {
+		if s.ignoreGroup(g.Email) {
+			log.WithField("group", g.Email).Debug("ignoring group")
+			continue
+		}
+		filteredGoogleGroups = append(filteredGoogleGroups, g)
+	}
+	googleGroups = filteredGoogleGroups
+	log.Debug("preparing list of google users and then google groups and their members")
+	googleUsers, googleGroupsUsers, err := s.getGoogleGroupsAndUsers(googleGroups)
+	if err != nil {
+		log.Warn("Error getting Google groups and users")
+		return nil, err
+	}
+	log.WithFields(log.Fields{
+		"googleUsers":  len(googleUsers),
+		"googleGroups": len(googleGroupsUsers),
+	}).Info("Google users and groups retrieved")
+	if s.cfg.AllUsers && len(s.cfg.Groups) == 0 {
+		log.WithField("query", s.cfg.UserMatch).Info("get all google users")
+		googleUsers, err = s.withAllUsers(googleUsers)
+		if err != nil {
+			log.WithField("query", s.cfg.UserMatch).Warn("Error getting Google users")
+			return nil, err
+		}
+		log.WithField("count", len(googleUsers)).Info("Google users to provision, members of groups or not")
+	}
+	// pre-flight check of the names, AWS SSO rejects users without one
+	googleUsers, skipped, err := s.handleMissingNames(googleUsers)
+	if err != nil {
+		return nil, err
+	}
+	googleGroupsUsers = withoutUsers(googleGroupsUsers, skipped)
+	for _, users := range googleGroupsUsers {
+		// the members may be other copies of the users
+		if _, _, err := s.handleMissingNames(users); err != nil {
+			return nil, err
+		}
+	}
+	// and of their lengths, AWS SSO rejects the attributes over its limits
+	googleUsers, skipped, err = s.handleOversizedAttributes(googleUsers)
+	if err != nil {
+		return nil, err
+	}
+	googleGroupsUsers = withoutUsers(googleGroupsUsers, skipped)
+	for _, users := range googleGroupsUsers {
+		if _, _, err := s.handleOversizedAttributes(users); err != nil {
+			return nil, err
+		}
+	}
+	if s.cfg.MaxGroupMembers > 0 {
+		googleGroups, googleGroupsUsers, err = capGroupMembers(googleGroups, googleGroupsUsers, s.cfg.MaxGroupMembers, s.cfg.GroupOverflow)
+		if err != nil {
+			return nil, err
+		}
+	}
+	// before anything is read from AWS SSO, let alone written
+	if err := checkCap("users", len(googleUsers), s.cfg.MaxUsers); err != nil {
+		return nil, err
+	}
+	if err := checkCap("groups", len(googleGroups), s.cfg.MaxGroups); err != nil {
+		return nil, err
+	}
+	if err := s.checkUserNames(googleUsers); err != nil {
+		return nil, err
+	}
+	log.Info("get existing aws groups")
+	awsGroups, err := s.aws.GetGroups()
+	if err != nil {
+		log.Error("error getting aws groups")
+		return nil, err
+	}
+	log.WithField("count", len(awsGroups)).Info("AWS groups retrieved")
+	awsGroups, renames := getGroupRenames(awsGroups, googleGroups)
+	if len(s.cfg.Groups) > 0 {
+		awsGroups = scopeAWSGroups(awsGroups, googleGroups)
+		log.WithField("count", len(awsGroups)).Info("AWS groups in scope")
+	}
+	log.Info("get existing aws users")
+	awsUsers, err := s.aws.GetUsers()
+	if err != nil {
+		log.Error("error getting aws users")
+		return nil, err
+	}
+	log.WithField("count", len(awsUsers)).Info("AWS users retrieved")
+	log.Debug("preparing list of aws groups and their members")
+	awsGroupsUsers, err := s.getAWSGroupsAndUsers(awsGroups, awsUsers)
+	if err != nil {
+		log.Warn("Error getting AWS groups and users")
+		return nil, err
+	}
+	log.WithField("count", len(awsGroupsUsers)).Info("AWS groups and users retrieved")
+	// create list of changes by operations
+	changes := &changeSet{googleUsers: googleUsers, awsUsers: len(awsUsers), awsGroups: len(awsGroups)}
+	changes.addUsers, changes.deleteUsers, changes.updateUsers, _ = getUserOperations(awsUsers, googleUsers, s.mapping)
+	changes.updateUsers = s.withoutWrittenUsers(changes.updateUsers, awsUsers)
+	changes.userRenames = userRenames(changes.updateUsers, awsUsers)
+	awsGroupsUsers = withRenamedMembers(awsGroupsUsers, changes.userRenames)
+	if s.cfg.SkipUnchangedUsers {
+		changes.updateUsers = s.withoutUnchangedUsers(changes.updateUsers, googleUsers)
+	}
+	changes.addGroups, changes.deleteGroups, changes.equalGroups = getGroupOperations(awsGroups, googleGroups)
+	changes.renameGroups = renames
+	if err := s.verifyCachedChanges(changes); err != nil {
+		return nil, err
+	}
+	// list of users to to be removed in aws groups
+	changes.removeMembers, _ = getGroupUsersOperations(googleGroupsUsers, awsGroupsUsers)
+	changes.addMembers = getGroupMembersToAdd(googleGroupsUsers, awsGroupsUsers)
+	// before the grace period, the protected removals are never quarantined
+	s.applyGroupPolicies(changes, googleGroups, awsGroupsUsers)
+	s.withoutUntouchedUsers(changes)
+	if len(s.cfg.Groups) > 0 {
+		// users which are not members of the groups in scope are out of scope
+		log.WithField("count", len(changes.deleteUsers)).Info("Partial sync, users not in the groups in scope are not deleted")
+		changes.deleteUsers = nil
+	} else if s.cfg.DeletionGracePeriod > 0 {
+		changes.deleteUsers, changes.deleteGroups = s.applyGracePeriod(changes.deleteUsers, changes.deleteGroups, time.Now())
+	}
+	if s.cfg.RestoreWindow > 0 {
+		s.restoreDeletedUsers(changes, time.Now())
+	}
+	warnUnmanagedGroups(awsGroups, changes)
+	s.flagAnomalies(changes.records())
+	if s.cfg.FlapThreshold > 0 {
+		s.suppressFlapping(changes)
+	}
+	if len(s.cfg.BlackoutWindows) > 0 {
+		if err := s.deferDestructiveChanges(changes, time.Now()); err != nil {
+			return nil, err
+		}
+	}
+	log.WithFields(log.Fields{
+		"addAWSUsers":     len(changes.addUsers),
+		"delAWSUsers":     len(changes.deleteUsers),
+		"updateAWSUsers":  len(changes.updateUsers),
+		"addAWSGroups":    len(changes.addGroups),
+		"delAWSGroups":    len(changes.deleteGroups),
+		"renameAWSGroups": len(changes.renameGroups),
+		"equalAWSGroups":  len(changes.equalGroups),
+	}).Info("Changes to be applied")
+	return changes, nil
+}
+
+// memberOperation adds or removes a user to or from an AWS group
+type memberOperation struct {
+	group *aws.Group
+	// email of the user
+	email string
+	// remove is the AWS user to remove, nil when the user is to be added
+	remove *aws.User
+}
+
+// getMemberOperations returns the membership changes of groups sorted by
+// user then group, so repeated runs compute the same sequence of operations.
+// The batches are applied in this order, the operations of a batch
+// concurrently, and they are logged in this order once their batch is
+// applied, see logMemberOperations.
+func getMemberOperations(groups []*aws.Group, addMembers map[string][]*admin.User, removeMembers map[string][]*aws.User) []memberOperation {
+	ops := make([]memberOperation, 0)
+	for _, g := range groups {
+		for _, u := range addMembers[g.DisplayName] {
+			ops = append(ops, memberOperation{group: g, email: u.PrimaryEmail})
+		}
+		for _, u := range removeMembers[g.DisplayName] {
+			ops = append(ops, memberOperation{group: g, email: u.Username, remove: u})
+		}
+	}
+	sort.SliceStable(ops, func(i, j int) bool {
+		if ops[i].email != ops[j].email {
+			return ops[i].email < ops[j].email
+		}
+		return ops[i].group.DisplayName < ops[j].group.DisplayName
+	})
+	return ops
+}
+
+// batchMemberOperations splits ops in batches of at most size operations
+func batchMemberOperations(ops []memberOperation, size int) [][]memberOperation {
+	if size <= 0 {
+		size = len(ops)
+	}
+	batches := make([][]memberOperation, 0)
+	for i := 0; i < len(ops); i += size {
+		end := i + size
+		if end > len(ops) {
+			end = len(ops)
+		}
+		batches = append(batches, ops[i:end])
+	}
+	return batches
+}
+
+// applyMemberOperation adds or removes a user to or from a group in AWS
+func (s *syncGSuite) applyMemberOperation(op memberOperation) error {
+	log := log.WithFields(log.Fields{
+		"user":  op.email,
+		"group": op.group.DisplayName,
+	})
+	if op.remove != nil {
+		log.Debug("removing user from group")
+		if err := s.aws.RemoveUserFromGroup(op.remove, op.group); err != nil {
+			log.Warn("Error removing user from group in AWS")
+			return err
+		}
+		return nil
+	}
+	// equivalent aws user of google user on the fly
+	log.Debug("finding user")
+	awsUserFull, err := s.aws.FindUserByEmail(op.email)
+	if err != nil {
+		log.Warn("Error finding user in AWS")
+		return err
+	}
+	log.Debug("adding user to group")
+	if err := s.aws.AddUserToGroup(awsUserFull, op.group); err != nil {
+		log.Warn("Error adding user to group in AWS")
+		return err
+	}
+	return nil
+}
+
+// logMemberOperations logs the operations of a batch applied concurrently in
+// their order, see getMemberOperations, so the audit logs of repeated runs can
+// be compared
+func logMemberOperations(batch []memberOperation, applied []bool) {
+	for i, op := range batch {
+		if !applied[i] {
+			continue
+		}
+		log := log.WithFields(log.Fields{
+			"user":  op.email,
+			"group": op.group.DisplayName,
+		})
+		if op.remove != nil {
+			log.Warn("User removed from group successfully in AWS")
+		} else {
+			log.Info("User added to group successfully in AWS")
+		}
+	}
+}
+
+// createUsers creates users, with at most SCIMConcurrency requests in
+// flight. Users which already exist are skipped. The names of the users
+// which couldn't be created are returned, with the first error. Once ctx is
+// done, the users left aren't created and fail with its error.
+func (s *syncGSuite) createUsers(ctx context.Context, users []*aws.User) (map[string]bool, error) {
+	if s.cfg.SCIMBulkSize > 0 && !s.bulkNotSupported && len(users) > 0 {
+		if failed, supported, err := s.createUsersInBulk(ctx, users); supported {
+			return failed, err
+		}
+	}
+	var mu sync.Mutex
+	failed := make(map[string]bool)
+	var firstErr error
+	// a user which can't be created doesn't stop the others
+	_ = forEach(len(users), s.cfg.SCIMConcurrency, func(i int) error {
+		awsUser := users[i]
+		log := log.WithFields(log.Fields{"user": awsUser.Username})
+		err := ctx.Err()
+		if err == nil {
+			log.Info("creating user")
+			_, err = s.aws.CreateUser(awsUser)
+		}
+		if err != nil {
+			errHttp := new(aws.ErrHttpNotOK)
+			if errors.As(err, &errHttp) && errHttp.StatusCode == 409 {
+				log.WithField("user", awsUser.Username).Warn("user already exists")
+				return nil
+			}
+			log.WithError(err).Error("error creating user, its group memberships are skipped")
+			mu.Lock()
+			failed[awsUser.Username] = true
+			if firstErr == nil {
+				firstErr = err
+			}
+			mu.Unlock()
+			return nil
+		}
+		log.Info("User created successfully in AWS")
+		return nil
+	})
+	return failed, firstErr
+}
+
+// createUsersInBulk creates users with requests to the SCIM /Bulk endpoint
+// of at most SCIMBulkSize users, like createUsers. supported is false when
+// the endpoint doesn't support bulk operations, nothing is created then.
+func (s *syncGSuite) createUsersInBulk(ctx context.Context, users []*aws.User) (failed map[string]bool, supported bool, err error) {
+	failed = make(map[string]bool)
+	fail := func(u *aws.User, opErr error) {
+		failed[u.Username] = true
+		if err == nil {
+			err = opErr
+		}
+	}
+	for start := 0; start < len(users); start += s.cfg.SCIMBulkSize {
+		end := start + s.cfg.SCIMBulkSize
+		if end > len(users) {
+			end = len(users)
+		}
+		batch := users[start:end]
+		log := log.WithFields(log.Fields{"users": len(batch), "created": start})
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			log.WithError(ctxErr).Error("run cancelled, the users left aren't created and their group memberships are skipped")
+			for _, u := range batch {
+				fail(u, ctxErr)
+			}
+			continue
+		}
+		log.Info("creating users in bulk")
+		results, bulkErr := s.aws.CreateUsers(batch)
+		if errors.Is(bulkErr, aws.ErrBulkNotSupported) && start == 0 {
+			log.Info("SCIM endpoint doesn't support bulk operations, creating the users one by one")
+			s.bulkNotSupported = true
+			return nil, false, nil
+		}
+		if bulkErr != nil {
+			log.WithError(bulkErr).Error("error creating users in bulk, their group memberships are skipped")
+			for _, u := range batch {
+				fail(u, bulkErr)
+			}
+			continue
+		}
+		for i, r := range results {
+			log := log.WithField("user", batch[i].Username)
+			errHttp := new(aws.ErrHttpNotOK)
+			switch {
+			case r.Err == nil:
+				log.Info("User created successfully in AWS")
+			case errors.As(r.Err, &errHttp) && errHttp.StatusCode == 409:
+				log.Warn("user already exists")
+			default:
+				log.WithError(r.Err).Error("error creating user, its group memberships are skipped")
+				fail(batch[i], r.Err)
+			}
+		}
+	}
+	return failed, true, err
+}
+
+// forEach calls fn with the indexes 0 to n-1, with at most concurrency calls
+// running at once. No call is started once one failed, and the error of the
+// lowest index is returned.
+func forEach(n int, concurrency int, fn func(i int) error) error {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	errs := make([]error, n)
+	var failed int32
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < concurrency && w < n; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				if atomic.LoadInt32(&failed) != 0 {
+					continue
+				}
+				if errs[i] = fn(i); errs[i] != nil {
+					atomic.StoreInt32(&failed, 1)
+				}
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// release removes an entity deleted from the pending deletions of the state
+func (s *syncGSuite) release(kind string, name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.state.Release(kind, name)
+}
+
+// withoutMembers returns the members to add to each group, without the
+// users of names, compared like aws.NormalizeName
+func withoutMembers(members map[string][]*admin.User, names map[string]bool) map[string][]*admin.User {
+	if len(names) == 0 {
+		return members
+	}
+	normalized := make(map[string]bool, len(names))
+	for name := range names {
+		normalized[aws.NormalizeName(name)] = true
+	}
+	kept := make(map[string][]*admin.User, len(members))
+	for group, users := range members {
+		for _, u := range users {
+			if !normalized[aws.NormalizeName(u.PrimaryEmail)] {
+				kept[group] = append(kept[group], u)
+			}
+		}
+	}
+	return kept
+}
+
+// saveCheckpoint saves the state, with its checkpoint, when a state store
+// is configured
+func (s *syncGSuite) saveCheckpoint() error {
+	if s.store == nil {
+		return nil
+	}
+	if err := s.store.Save(s.state); err != nil {
+		log.WithError(err).Error("Error saving checkpoint")
+		return err
+	}
+	return nil
+}
+
+// withAllUsers returns users and the Google users matching the user match
+// not in users, by primary email. The users are streamed a page at a time
+// and only the ones not ignored nor already in users are kept, instead of
+// holding the full list and its filtered copy.
+func (s *syncGSuite) withAllUsers(users []*admin.User) ([]*admin.User, error) {
+	seen := make(map[string]struct{}, len(users))
+	for _, u := range users {
+		seen[u.PrimaryEmail] = struct{}{}
+	}
+	err := s.google.ForEachUser(s.cfg.UserMatch, func(u *admin.User) error {
+		if _, ok := seen[u.PrimaryEmail]; ok || s.ignoreUser(u.PrimaryEmail) {
+			return nil
+		}
+		if reason := s.outOfScope(u); reason != "" {
+			s.keepUntouched(u, reason)
+			return nil
+		}
+		seen[u.PrimaryEmail] = struct{}{}
+		users = append(users, u)
+		return nil
+	})
+	return users, err
+}
+
+// capGroupMembers enforces a maximum number of members per group. Groups over
+// the cap make it fail, are truncated to the first members sorted by email, or
+// are split into overflow groups named "<name>-2", "<name>-3"... depending on
+// the overflow strategy. The overflow groups have the email of their group,
+// for the group policies, and the ids "<id>-2", "<id>-3"... so their AWS
+// groups have external ids of their own.
+func capGroupMembers(groups []*admin.Group, groupsUsers map[string][]*admin.User, max int, overflow string) ([]*admin.Group, map[string][]*admin.User, error) {
+	switch overflow {
+	case config.GroupOverflowFail, config.GroupOverflowTruncate, config.GroupOverflowSplit:
+	default:
+		return nil, nil, fmt.Errorf("unknown group overflow strategy %q, expected one of fail|truncate|split", overflow)
+	}
+	cappedGroups := make([]*admin.Group, 0, len(groups))
+	cappedUsers := make(map[string][]*admin.User, len(groupsUsers))
+	for _, g := range groups {
+		members := groupsUsers[g.Name]
+		cappedGroups = append(cappedGroups, g)
+		if len(members) <= max {
+			cappedUsers[g.Name] = members
+			continue
+		}
+		log := log.WithFields(log.Fields{
+			"group":   g.Name,
+			"members": len(members),
+			"max":     max,
+		})
+		if overflow == config.GroupOverflowFail {
+			log.Error("Group exceeds the maximum number of members")
+			return nil, nil, fmt.Errorf("group %q has %d members, more than the maximum of %d", g.Name, len(members), max)
+		}
+		sorted := make([]*admin.User, len(members))
+		copy(sorted, members)
+		sort.Slice(sorted, func(i, j int) bool {
+			return sorted[i].PrimaryEmail < sorted[j].PrimaryEmail
+		})
+		cappedUsers[g.Name] = sorted[:max]
+		if overflow == config.GroupOverflowTruncate {
+			log.Warn("Group exceeds the maximum number of members, truncating it")
+			continue
+		}
+		log.Warn("Group exceeds the maximum number of members, splitting it")
+		for i, n := max, 2; i < len(sorted); i, n = i+max, n+1 {
+			end := i + max
+			if end > len(sorted) {
+				end = len(sorted)
+			}
+			name := fmt.Sprintf("%s-%d", g.Name, n)
+			cappedGroups = append(cappedGroups, &admin.Group{Id: fmt.Sprintf("%s-%d", g.Id, n), Name: name, Email: g.Email})
+			cappedUsers[name] = sorted[i:end]
+		}
+	}
+	return cappedGroups, cappedUsers, nil
+}
+
+// warnUnmanagedGroups warns about the groups about to be modified which
+// weren't created by ssosync, see aws.Group.Managed
+func warnUnmanagedGroups(awsGroups []*aws.Group, changes *changeSet) {
+	deleted := make(map[string]struct{}, len(changes.deleteGroups))
+	for _, g := range changes.deleteGroups {
+		deleted[g.DisplayName] = struct{}{}
+	}
+	for _, g := range awsGroups {
+		if g.Managed() {
+			continue
+		}
+		_, isDeleted := deleted[g.DisplayName]
+		if isDeleted || len(changes.addMembers[g.DisplayName]) > 0 || len(changes.removeMembers[g.DisplayName]) > 0 {
+			log.WithFields(log.Fields{
+				"group":   g.DisplayName,
+				"deleted": isDeleted,
+			}).Warn("Group about to be modified was not created by ssosync, it has no Google group id or ssosync marker as external id")
+		}
+	}
+}
+
+// getGoogleGroups returns the Google groups matching query, or the groups
+// the sync is restricted to, named as their AWS groups
+func (s *syncGSuite) getGoogleGroups(queries []string) ([]*admin.Group, error) {
+	if err := s.readGroupNames(); err != nil {
+		return nil, err
+	}
+	if len(s.cfg.Groups) > 0 {
+		log.WithField("groups", s.cfg.Groups).Info("get google groups in scope")
+		googleGroups := make([]*admin.Group, 0, len(s.cfg.Groups))
+		for _, email := range s.cfg.Groups {
+			g, err := s.google.GetGroup(email)
+			if err != nil {
+				log.WithField("group", email).Warn("Error getting Google group")
+				return nil, err
+			}
+			googleGroups = append(googleGroups, g)
+		}
+		return s.withAWSGroupNames(googleGroups)
+	}
+	log.WithField("queries", queries).Info("get google groups")
+	googleGroups, err := s.getGroupsMatching(queries)
+	if err != nil {
+		return nil, err
+	}
+	return s.withAWSGroupNames(googleGroups)
+}
+
+// getGroupsMatching returns the Google groups matching any of queries, each
+// group once, in the order of the queries; no query returns all the groups.
+// The groups are then restricted to the ones with --group-labels.
+func (s *syncGSuite) getGroupsMatching(queries []string) ([]*admin.Group, error) {
+	if len(queries) == 0 {
+		queries = []string{""}
+	}
+	groups := make([]*admin.Group, 0)
+	seen := make(map[string]bool)
+	for _, query := range queries {
+		matching, err := s.google.GetGroups(query)
+		if err != nil {
+			log.WithField("query", query).Warn("Error getting Google groups")
+			return nil, err
+		}
+		for _, g := range matching {
+			key := strings.ToLower(g.Email)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			groups = append(groups, g)
+		}
+	}
+	return s.withGroupLabels(groups)
+}
+
+// withGroupLabels returns the groups with any of --group-labels, all the
+// groups when there is none
+func (s *syncGSuite) withGroupLabels(groups []*admin.Group) ([]*admin.Group, error) {
+	if len(s.cfg.GroupLabels) == 0 {
+		return groups, nil
+	}
+	labeled := make(map[string]bool)
+	for _, label := range s.cfg.GroupLabels {
+		emails, err := s.google.GetGroupsWithLabel(label)
+		if err != nil {
+			log.WithField("label", label).Warn("Error getting the Google groups with label")
+			return nil, err
+		}
+		for _, email := range emails {
+			labeled[strings.ToLower(email)] = true
+		}
+	}
+	scoped := make([]*admin.Group, 0, len(groups))
+	for _, g := range groups {
+		if !labeled[strings.ToLower(g.Email)] {
+			log.WithField("group", g.Email).Debug("Group has none of the labels, skipping")
+			continue
+		}
+		scoped = append(scoped, g)
+	}
+	log.WithFields(log.Fields{
+		"labels": s.cfg.GroupLabels,
+		"groups": len(scoped),
+	}).Info("Google groups restricted to the labels")
+	return scoped, nil
+}
+
+// scopeAWSGroups returns the AWS groups with the name of one of googleGroups
+func scopeAWSGroups(awsGroups []*aws.Group, googleGroups []*admin.Group) []*aws.Group {
+	names := make(map[string]struct{}, len(googleGroups))
+	for _, g := range googleGroups {
+		names[aws.NormalizeName(g.Name)] = struct{}{}
+	}
+	scoped := make([]*aws.Group, 0, len(googleGroups))
+	for _, g := range awsGroups {
+		if _, ok := names[aws.NormalizeName(g.DisplayName)]; ok {
+			scoped = append(scoped, g)
+		}
+	}
+	return scoped
+}
+
+// withoutUnchangedUsers removes from users the ones whose Google etag didn't
+// change since the last sync
+func (s *syncGSuite) withoutUnchangedUsers(users []*aws.User, googleUsers []*admin.User) []*aws.User {
+	etags := make(map[string]string)
+	for _, u := range googleUsers {
+		etags[u.PrimaryEmail] = u.Etag
+	}
+	changed := make([]*aws.User, 0, len(users))
+	for _, u := range users {
+		if s.state.UserUnchanged(u.Username, etags[u.Username]) {
+			log.WithField("user", u.Username).Debug("User unchanged since last sync, skipping update")
+			continue
+		}
+		changed = append(changed, u)
+	}
+	return changed
+}
+
+// getGoogleGroupsMembers fetches the members of groups, with at most
+// GoogleConcurrency requests in flight. The members are returned in the
+// order of groups.
+func (s *syncGSuite) getGoogleGroupsMembers(groups []*admin.Group) ([][]*admin.Member, error) {
+	concurrency := s.cfg.GoogleConcurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	members := make([][]*admin.Member, len(groups))
+	errs := make([]error, len(groups))
+	var failed int32
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				// don't send more requests once one failed
+				if atomic.LoadInt32(&failed) != 0 {
+					continue
+				}
+				log := log.WithField("group", groups[i].Name)
+				log.Debug("get group members from google")
+				members[i], errs[i] = s.google.GetGroupMembers(groups[i])
+				if errs[i] != nil {
+					atomic.StoreInt32(&failed, 1)
+					log.WithField("group", groups[i].Email).Warn("Error getting group members from Google")
+					continue
+				}
+				log.WithField("count", len(members[i])).Info("Group members retrieved from Google")
+			}
+		}()
+	}
+	for i := range groups {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return members, nil
+}
+
+// getGoogleMembersUsers returns the users of the members of groups, by
+// lowercased email, the unknown users are left out. With the
+// google_users_list feature they come from a single list of the Google
+// users, otherwise each user is looked up once, with at most
+// GoogleConcurrency lookups in flight.
+func (s *syncGSuite) getGoogleMembersUsers(groupsMembers [][]*admin.Member) (map[string]*admin.User, error) {
+	emails := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, members := range groupsMembers {
+		for _, m := range members {
+			if m.Type != "GROUP" && !s.ignoreUser(m.Email) && !seen[strings.ToLower(m.Email)] {
+				seen[strings.ToLower(m.Email)] = true
+				emails = append(emails, m.Email)
+			}
+		}
+	}
+	if s.cfg.Enabled(config.FeatureGoogleUsersList) {
+		users, err := s.google.GetUsersByEmail(emails)
+		if err != nil {
+			log.Warn("Error listing users from Google")
+			return nil, err
+		}
+		log.WithField("count", len(users)).Info("Group members users listed from Google")
+		return users, nil
+	}
+	found := make([]*admin.User, len(emails))
+	err := forEach(len(emails), s.cfg.GoogleConcurrency, func(i int) error {
+		log.WithField("id", emails[i]).Debug("get user")
+		u, err := s.google.GetUser(emails[i])
+		if err != nil {
+			log.WithField("email", emails[i]).Warn("Error getting user from Google")
+			return err
+		}
+		found[i] = u
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	users := make(map[string]*admin.User, len(emails))
+	for i, u := range found {
+		if u != nil {
+			users[strings.ToLower(emails[i])] = u
+		}
+	}
+	log.WithField("count", len(users)).Info("Group members users retrieved from Google")
+	return users, nil
+}
+
+// getGoogleGroupsAndUsers return a list of google users members of googleGroups
+// and a map of google groups and its users' list
+func (s *syncGSuite) getGoogleGroupsAndUsers(googleGroups []*admin.Group) ([]*admin.User, map[string][]*admin.User, error) {
+	log.WithField("count", len(googleGroups)).Info("Getting Google groups and users")
+	gUsers := make([]*admin.User, 0)
+	gGroupsUsers := make(map[string][]*admin.User)
+	gUniqUsers := make(map[string]*admin.User)
+	external := make([]externalMember, 0)
+	groups := make([]*admin.Group, 0, len(googleGroups))
+	for _, g := range googleGroups {
+		if s.ignoreGroup(g.Email) {
+			log.WithField("group", g.Name).Debug("ignoring group")
+			continue
+		}
+		groups = append(groups, g)
+	}
+	groupsMembers, err := s.getGoogleGroupsMembers(groups)
+	if err != nil {
+		return nil, nil, err
+	}
+	usersByEmail, err := s.getGoogleMembersUsers(groupsMembers)
+	if err != nil {
+		return nil, nil, err
+	}
+	for i, g := range groups {
+		log := log.WithFields(log.Fields{"group": g.Name})
+		groupMembers := groupsMembers[i]
+		log.Debug("get users")
+		membersUsers := make([]*admin.User, 0)
+		for _, m := range groupMembers {
+			if s.ignoreUser(m.Email) {
+				log.WithField("id", m.Email).Debug("ignoring user")
+				continue
+			}
+			if m.Type == "GROUP" {
+				log.WithField("id", m.Email).Debug("ignoring group address")
+				continue
+			}
+			u, ok := usersByEmail[strings.ToLower(m.Email)]
+			if !ok {
+				external = append(external, externalMember{email: m.Email, group: g.Name})
+				continue
+			}
+			if reason := s.outOfScope(u); reason != "" {
+				log.WithFields(Fields{"id": m.Email, "reason": reason}).Debug("ignoring user out of scope")
+				s.keepUntouched(u, reason)
+				continue
+			}
+			log.WithFields(Fields{
+				"email":      u.PrimaryEmail,
+				"givenName":  u.Name.GivenName,
+				"familyName": u.Name.FamilyName,
+			}).Info("User retrieved from Google")
+			membersUsers = append(membersUsers, u)
+			if _, ok := gUniqUsers[m.Email]; !ok {
+				gUniqUsers[m.Email] = u
+			}
+		}
+		gGroupsUsers[g.Name] = membersUsers
+		log.WithFields(Fields{
+			"group": g.Name,
+			"count": len(membersUsers),
+		}).Info("Group members added to map")
+	}
+	if err := s.handleExternalMembers(external); err != nil {
+		return nil, nil, err
+	}
+	for _, user := range gUniqUsers {
+		gUsers = append(gUsers, user)
+	}
+	log.WithFields(log.Fields{
+		"uniqueUsers": len(gUniqUsers),
+		"totalUsers":  len(gUsers),
+	}).Info("Google users retrieved")
+	return gUsers, gGroupsUsers, nil
+}
+
+// getGroupMembersToAdd returns the google users of each group that aren't
+// members of the aws group with the same name yet, by the name of the aws
+// group when it exists
+func getGroupMembersToAdd(gGroupsUsers map[string][]*admin.User, awsGroupsUsers map[string][]*aws.User) (add map[string][]*admin.User) {
+	add = make(map[string][]*admin.User)
+	awsNames := make(map[string]string, len(awsGroupsUsers))
+	for awsGroupName := range awsGroupsUsers {
+		awsNames[aws.NormalizeName(awsGroupName)] = awsGroupName
+	}
+	for gGroupName, gGroupUsers := range gGroupsUsers {
+		if name, ok := awsNames[aws.NormalizeName(gGroupName)]; ok {
+			gGroupName = name
+		}
+		members := make(map[string]struct{})
+		for _, awsUser := range awsGroupsUsers[gGroupName] {
+			members[aws.NormalizeName(awsUser.Username)] = struct{}{}
+		}
+		for _, gUser := range gGroupUsers {
+			if _, found := members[aws.NormalizeName(gUser.PrimaryEmail)]; !found {
+				log.WithFields(log.Fields{
+					"user":  gUser.PrimaryEmail,
+					"group": gGroupName,
+				}).Info("User found in Google group but not in AWS group, will be added to AWS group")
+				add[gGroupName] = append(add[gGroupName], gUser)
+			}
+		}
+	}
+	return add
+}
+
+// getAWSGroupsAndUsers return a list of google users members of googleGroups
+// and a map of google groups and its users' list
+func (s *syncGSuite) getAWSGroupsAndUsers(awsGroups []*aws.Group, awsUsers []*aws.User) (map[string][]*aws.User, error) {
+	log.WithFields(log.Fields{
+		"groups": len(awsGroups),
+		"users":  len(awsUsers),
+	}).Info("Getting AWS groups and users")
+	awsGroupsUsers := make(map[string][]*aws.User)
+	awsUsersByID := make(map[string]*aws.User, len(awsUsers))
+	for _, user := range awsUsers {
+		awsUsersByID[user.ID] = user
+	}
 	for _, awsGroup := range awsGroups {
 		users := make([]*aws.User, 0)
 		log := log.WithFields(log.Fields{"group": awsGroup.DisplayName})
 		log.Debug("get group members from aws")
+		memberIDs, err := s.awsGroupMemberIDs(awsGroup)
+		if err != nil {
+			return nil, err
+		}
+		if memberIDs != nil {
+			for id := range memberIDs {
+				if user, ok := awsUsersByID[id]; ok {
+					users = append(users, user)
+				}
+			}
+			sort.Slice(users, func(i, j int) bool { return users[i].Username < users[j].Username })
+			awsGroupsUsers[awsGroup.DisplayName] = users
+			log.WithField("count", len(users)).Info("Group members added to map")
+			continue
+		}
 		// NOTE: AWS has not implemented yet some method to get the groups members https://docs.aws.amazon.com/singlesignon/latest/developerguide/listgroups.html
 		// so, we need to check each user in each group which are too many unnecessary API calls
 		for _, user := range awsUsers {
@@ -677,33 +1698,155 @@ func (s *syncGSuite) getAWSGroupsAndUsers(awsGroups []*aws.Group, awsUsers []*aw
 	return awsGroupsUsers, nil
 }
 
-// getGroupOperations returns the groups of AWS that must be added, deleted and are equals
+// awsGroupMemberIDs returns the ids of the members of the AWS group, read
+// with a single request, or nil when the SCIM endpoint doesn't return them
+// and the membership of each user must be checked
+func (s *syncGSuite) awsGroupMemberIDs(g *aws.Group) (map[string]bool, error) {
+	if !s.cfg.Enabled(config.FeatureSCIMGroupMembers) || s.membersNotSupported {
+		return nil, nil
+	}
+	ids, err := s.aws.GetGroupMemberIDs(g)
+	if errors.Is(err, aws.ErrMembersNotSupported) {
+		log.Info("SCIM endpoint doesn't return group members, checking the membership of each user")
+		s.membersNotSupported = true
+		return nil, nil
+	}
+	if err != nil {
+		log.WithField("group", g.DisplayName).Warn("Error getting group members from AWS")
+		return nil, err
+	}
+	members := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		members[id] = true
+	}
+	return members, nil
+}
+
+// groupRename renames an AWS group after its Google group
+type groupRename struct {
+	// group is the AWS group, with its current name
+	group *aws.Group
+	name  string
+}
+
+// getGroupRenames returns awsGroups with the names of their Google groups,
+// the ones with the id of their external id, and the renames to apply. A
+// renamed Google group is matched to its AWS group instead of being deleted
+// and created again. A group isn't renamed when another AWS group already has
+// the new name.
+func getGroupRenames(awsGroups []*aws.Group, googleGroups []*admin.Group) ([]*aws.Group, []groupRename) {
+	byID := groupsByExternalID(googleGroups)
+	// the names are matched like by getGroupOperations
+	names := make(map[string]*aws.Group, len(awsGroups))
+	for _, g := range awsGroups {
+		names[aws.NormalizeName(g.DisplayName)] = g
+	}
+	groups := make([]*aws.Group, 0, len(awsGroups))
+	renames := make([]groupRename, 0)
+	for _, g := range awsGroups {
+		gGroup := googleGroupOf(byID, g)
+		if gGroup == nil || gGroup.Name == g.DisplayName {
+			groups = append(groups, g)
+			continue
+		}
+		log := log.WithFields(log.Fields{"group": g.DisplayName, "name": gGroup.Name})
+		if other, taken := names[aws.NormalizeName(gGroup.Name)]; taken && other != g {
+			log.Warn("Group renamed in Google, but an AWS group already has its new name, it will not be renamed")
+			groups = append(groups, g)
+			continue
+		}
+		log.Info("Group renamed in Google, will be renamed in AWS")
+		names[aws.NormalizeName(gGroup.Name)] = g
+		renames = append(renames, groupRename{group: g, name: gGroup.Name})
+		renamed := *g
+		renamed.DisplayName = gGroup.Name
+		groups = append(groups, &renamed)
+	}
+	return groups, renames
+}
+
+// groupsByExternalID returns the Google groups by the external ids of their
+// AWS groups: their id, set by ssosync, and their lowercased email, set by
+// other provisioners. An email shared by several groups, e.g. by the overflow
+// groups of capGroupMembers, is ambiguous and left out.
+func groupsByExternalID(googleGroups []*admin.Group) map[string]*admin.Group {
+	byID := make(map[string]*admin.Group, 2*len(googleGroups))
+	emails := make(map[string]int, len(googleGroups))
+	for _, g := range googleGroups {
+		emails[strings.ToLower(g.Email)]++
+	}
+	for _, g := range googleGroups {
+		if email := strings.ToLower(g.Email); email != "" && emails[email] == 1 {
+			byID[email] = g
+		}
+	}
+	for _, g := range googleGroups {
+		if g.Id != "" {
+			byID[g.Id] = g
+		}
+	}
+	return byID
+}
+
+// googleGroupOf returns the Google group of byID, see groupsByExternalID, with
+// the external id of the AWS group g, nil when g has none or there is none
+func googleGroupOf(byID map[string]*admin.Group, g *aws.Group) *admin.Group {
+	if g.ExternalID == "" {
+		return nil
+	}
+	if gGroup, found := byID[g.ExternalID]; found {
+		return gGroup
+	}
+	return byID[strings.ToLower(g.ExternalID)]
+}
+
+// getGroupOperations returns the groups of AWS that must be added, deleted and are equals.
+// The AWS groups are matched by their external id first, so a group renamed
+// in Google is never deleted and created again, losing its permission sets,
+// and by their name second. A group isn't matched by its external id when
+// another AWS group has the name of its Google group, as in getGroupRenames.
 func getGroupOperations(awsGroups []*aws.Group, googleGroups []*admin.Group) (add []*aws.Group, delete []*aws.Group, equals []*aws.Group) {
 	log.WithFields(log.Fields{
 		"awsGroups":    len(awsGroups),
 		"googleGroups": len(googleGroups),
 	}).Info("Getting group operations")
 	awsMap := make(map[string]*aws.Group)
-	googleMap := make(map[string]struct{})
 	for _, awsGroup := range awsGroups {
-		awsMap[awsGroup.DisplayName] = awsGroup
+		awsMap[aws.NormalizeName(awsGroup.DisplayName)] = awsGroup
 	}
-	for _, gGroup := range googleGroups {
-		googleMap[gGroup.Name] = struct{}{}
+	byExternalID := groupsByExternalID(googleGroups)
+	byGoogleGroup := make(map[*admin.Group]*aws.Group)
+	byAWSGroup := make(map[*aws.Group]*admin.Group)
+	for _, awsGroup := range awsGroups {
+		gGroup := googleGroupOf(byExternalID, awsGroup)
+		if gGroup == nil || byGoogleGroup[gGroup] != nil {
+			continue
+		}
+		if other, taken := awsMap[aws.NormalizeName(gGroup.Name)]; taken && other != awsGroup {
+			continue
+		}
+		byGoogleGroup[gGroup] = awsGroup
+		byAWSGroup[awsGroup] = gGroup
 	}
+	matched := make(map[*aws.Group]bool)
 	// AWS Groups found and not found in google
 	for _, gGroup := range googleGroups {
-		if _, found := awsMap[gGroup.Name]; found {
+		if awsGroup, found := byGoogleGroup[gGroup]; found {
+			log.WithFields(log.Fields{"group": gGroup.Name, "externalId": awsGroup.ExternalID}).Debug("Group found in AWS and Google by its external id")
+			matched[awsGroup] = true
+			equals = append(equals, awsGroup)
+		} else if awsGroup, found := awsMap[aws.NormalizeName(gGroup.Name)]; found && byAWSGroup[awsGroup] == nil {
 			log.WithField("group", gGroup.Name).Debug("Group found in AWS and Google")
-			equals = append(equals, awsMap[gGroup.Name])
+			matched[awsGroup] = true
+			equals = append(equals, awsGroup)
 		} else {
 			log.WithField("group", gGroup.Name).Info("Group not found in AWS, will be added")
-			add = append(add, aws.NewGroup(gGroup.Name))
+			add = append(add, aws.NewManagedGroup(gGroup.Name, gGroup.Id))
 		}
 	}
 	// Google Groups founds and not in aws
 	for _, awsGroup := range awsGroups {
-		if _, found := googleMap[awsGroup.DisplayName]; !found {
+		if !matched[awsGroup] {
 			log.WithField("group", awsGroup.DisplayName).Info("Group not found in Google, will be deleted from AWS")
 			delete = append(delete, aws.NewGroup(awsGroup.DisplayName))
 		}
@@ -716,34 +1859,50 @@ func getGroupOperations(awsGroups []*aws.Group, googleGroups []*admin.Group) (ad
 	return add, delete, equals
 }
 
-// getUserOperations returns the users of AWS that must be added, deleted, updated and are equals
-func getUserOperations(awsUsers []*aws.User, googleUsers []*admin.User) (add []*aws.User, delete []*aws.User, update []*aws.User, equals []*aws.User) {
+// getUserOperations returns the users of AWS that must be added, deleted, updated and are equals,
+// the AWS users of the Google users are derived with m
+func getUserOperations(awsUsers []*aws.User, googleUsers []*admin.User, m *userMapping) (add []*aws.User, delete []*aws.User, update []*aws.User, equals []*aws.User) {
 	log.WithFields(log.Fields{
 		"awsUsers":    len(awsUsers),
 		"googleUsers": len(googleUsers),
 	}).Info("Getting user operations")
-	awsMap := make(map[string]*aws.User)
-	googleMap := make(map[string]struct{})
+	awsMap := make(map[string]*aws.User, len(awsUsers))
+	awsByExternalID := make(map[string]*aws.User, len(awsUsers))
+	matched := make(map[*aws.User]bool, len(awsUsers))
 	for _, awsUser := range awsUsers {
-		awsMap[awsUser.Username] = awsUser
+		awsMap[aws.NormalizeName(awsUser.Username)] = awsUser
+		if awsUser.ExternalID != "" {
+			awsByExternalID[awsUser.ExternalID] = awsUser
+		}
 	}
-	for _, gUser := range googleUsers {
-		googleMap[gUser.PrimaryEmail] = struct{}{}
+	managerID := func(email string) string {
+		if m, found := awsMap[aws.NormalizeName(email)]; found {
+			return m.ID
+		}
+		return ""
 	}
 	// AWS Users found and not found in google
 	for _, gUser := range googleUsers {
-		if awsUser, found := awsMap[gUser.PrimaryEmail]; found {
+		if awsUser, found := matchAWSUser(gUser, awsMap, awsByExternalID); found {
 			log.WithField("user", gUser.PrimaryEmail).Debug("User found in AWS and Google")
-			if awsUser.Active == gUser.Suspended ||
-				awsUser.Name.GivenName != gUser.Name.GivenName ||
-				awsUser.Name.FamilyName != gUser.Name.FamilyName {
+			matched[awsUser] = true
+			user := m.user(gUser, managerID)
+			if aws.NormalizeName(awsUser.Username) != aws.NormalizeName(user.Username) {
+				log.WithFields(log.Fields{
+					"user": gUser.PrimaryEmail,
+					"from": awsUser.Username,
+				}).Info("User email changed, will be updated in AWS")
+				// the user is found by its id, not its new email
+				user.ID = awsUser.ID
+			}
+			if userHash(awsUser, m) != userHash(user, m) {
 				log.WithFields(log.Fields{
 					"user":       gUser.PrimaryEmail,
 					"givenName":  gUser.Name.GivenName,
 					"familyName": gUser.Name.FamilyName,
 					"suspended":  gUser.Suspended,
 				}).Info("User attributes mismatch, will be updated in AWS")
-				update = append(update, aws.NewUser(gUser.Name.GivenName, gUser.Name.FamilyName, gUser.PrimaryEmail, !gUser.Suspended))
+				update = append(update, user)
 			} else {
 				log.WithField("user", gUser.PrimaryEmail).Debug("User attributes match in AWS and Google")
 				equals = append(equals, awsUser)
@@ -755,12 +1914,12 @@ func getUserOperations(awsUsers []*aws.User, googleUsers []*admin.User) (add []*
 				"familyName": gUser.Name.FamilyName,
 				"suspended":  gUser.Suspended,
 			}).Info("User not found in AWS, will be added")
-			add = append(add, aws.NewUser(gUser.Name.GivenName, gUser.Name.FamilyName, gUser.PrimaryEmail, !gUser.Suspended))
+			add = append(add, m.user(gUser, managerID))
 		}
 	}
 	// Google Users founds and not in aws
 	for _, awsUser := range awsUsers {
-		if _, found := googleMap[awsUser.Username]; !found {
+		if !matched[awsUser] {
 			log.WithFields(log.Fields{
 				"user":       awsUser.Username,
 				"givenName":  awsUser.Name.GivenName,
@@ -779,6 +1938,73 @@ func getUserOperations(awsUsers []*aws.User, googleUsers []*admin.User) (add []*
 	return add, delete, update, equals
 }
 
+// matchAWSUser returns the AWS user of the Google user gUser: the one whose
+// external id is the id of gUser, unless another AWS user has the email of
+// gUser, else the one with its email, else the one with one of its aliases,
+// without the external id of another Google user. This way a user whose
+// email changed is still matched, by the external id set when it was
+// created, or by its previous email, which Google Workspace keeps as an
+// alias, when it has no external id.
+func matchAWSUser(gUser *admin.User, awsMap map[string]*aws.User, awsByExternalID map[string]*aws.User) (*aws.User, bool) {
+	byEmail, foundByEmail := awsMap[aws.NormalizeName(gUser.PrimaryEmail)]
+	if byID, found := awsByExternalID[gUser.Id]; found && gUser.Id != "" {
+		if !foundByEmail || byEmail == byID {
+			return byID, true
+		}
+	}
+	if foundByEmail {
+		return byEmail, true
+	}
+	for _, alias := range googleAliases(gUser) {
+		if byAlias, found := awsMap[aws.NormalizeName(alias)]; found && (byAlias.ExternalID == "" || byAlias.ExternalID == gUser.Id) {
+			return byAlias, true
+		}
+	}
+	return nil, false
+}
+
+// userRenames returns the old user names of the users to update whose email
+// changed, by their new user names, see getUserOperations
+func userRenames(update []*aws.User, awsUsers []*aws.User) map[string]string {
+	byID := make(map[string]*aws.User, len(awsUsers))
+	for _, u := range awsUsers {
+		byID[u.ID] = u
+	}
+	renames := make(map[string]string)
+	for _, u := range update {
+		if old, ok := byID[u.ID]; ok && u.ID != "" && aws.NormalizeName(old.Username) != aws.NormalizeName(u.Username) {
+			renames[u.Username] = old.Username
+		}
+	}
+	return renames
+}
+
+// withRenamedMembers returns the members of each AWS group, the users whose
+// email changed with their new user names, so they are neither removed nor
+// added again
+func withRenamedMembers(awsGroupsUsers map[string][]*aws.User, renames map[string]string) map[string][]*aws.User {
+	if len(renames) == 0 {
+		return awsGroupsUsers
+	}
+	newNames := make(map[string]string, len(renames))
+	for name, old := range renames {
+		newNames[aws.NormalizeName(old)] = name
+	}
+	renamed := make(map[string][]*aws.User, len(awsGroupsUsers))
+	for group, users := range awsGroupsUsers {
+		renamed[group] = make([]*aws.User, 0, len(users))
+		for _, u := range users {
+			if name, ok := newNames[aws.NormalizeName(u.Username)]; ok {
+				c := *u
+				c.Username = name
+				u = &c
+			}
+			renamed[group] = append(renamed[group], u)
+		}
+	}
+	return renamed
+}
+
 // groupUsersOperations returns the groups and its users of AWS that must be delete from these groups and what are equals
 func getGroupUsersOperations(gGroupsUsers map[string][]*admin.User, awsGroupsUsers map[string][]*aws.User) (delete map[string][]*aws.User, equals map[string][]*aws.User) {
 	log.WithFields(log.Fields{
@@ -789,17 +2015,18 @@ func getGroupUsersOperations(gGroupsUsers map[string][]*admin.User, awsGroupsUse
 	// get user in google groups that are in aws groups and
 	// users in aws groups that aren't in google groups
 	for gGroupName, gGroupUsers := range gGroupsUsers {
-		mbG[gGroupName] = make(map[string]struct{})
+		members := make(map[string]struct{}, len(gGroupUsers))
 		for _, gUser := range gGroupUsers {
-			mbG[gGroupName][gUser.PrimaryEmail] = struct{}{}
+			members[aws.NormalizeName(gUser.PrimaryEmail)] = struct{}{}
 		}
+		mbG[aws.NormalizeName(gGroupName)] = members
 	}
 	delete = make(map[string][]*aws.User)
 	equals = make(map[string][]*aws.User)
 	for awsGroupName, awsGroupUsers := range awsGroupsUsers {
 		for _, awsUser := range awsGroupUsers {
 			// users that exist in aws groups but doesn't in google groups
-			if _, found := mbG[awsGroupName][awsUser.Username]; found {
+			if _, found := mbG[aws.NormalizeName(awsGroupName)][aws.NormalizeName(awsUser.Username)]; found {
 				log.WithFields(log.Fields{
 					"user":  awsUser.Username,
 					"group": awsGroupName,
@@ -822,115 +2049,553 @@ func getGroupUsersOperations(gGroupsUsers map[string][]*admin.User, awsGroupsUse
 }
 
 // DoSync will create a logger and run the sync with the paths
-// given to do the sync.
-func DoSync(ctx context.Context, cfg *config.Config) error {
-	log.Info("Starting synchronization process")
-	log.Info("Syncing AWS users and groups from Google Workspace SAML Application")
-	creds := []byte(cfg.GoogleCredentials)
-	if !cfg.IsLambda {
-		b, err := ioutil.ReadFile(cfg.GoogleCredentials)
-		if err != nil {
-			log.WithError(err).Error("Error reading Google credentials file")
-			return err
-		}
-		creds = b
+// given to do the sync. The report of the changes applied is nil with the
+// users_groups sync method.
+func DoSync(ctx context.Context, cfg *config.Config) (*state.Report, error) {
+	return doSync(ctx, cfg, nil)
+}
+
+// DoApply runs a sync applying the plan p, it fails with ErrPlanStale
+// without changing anything when the changes to apply now aren't the ones
+// of the plan.
+func DoApply(ctx context.Context, cfg *config.Config, p *Plan) (*state.Report, error) {
+	if cfg.SyncMethod != config.DefaultSyncMethod {
+		return nil, fmt.Errorf("apply is only supported with the %q sync method", config.DefaultSyncMethod)
 	}
-	// create a http client with retry and backoff capabilities
-	retryClient := retryablehttp.NewClient()
-	// https://github.com/hashicorp/go-retryablehttp/issues/6
-	if cfg.Debug {
-		retryClient.Logger = log.StandardLogger()
-	} else {
-		retryClient.Logger = nil
+	if p.SnapshotTakenAt != nil {
+		return nil, errors.New("the plan was computed offline, from a snapshot, compute it again online to apply it")
 	}
-	httpClient := retryClient.StandardClient()
-	googleClient, err := google.NewClient(ctx, cfg.GoogleAdmin, creds, cfg.GoogleCustomerId)
+	return doSync(ctx, cfg, p)
+}
+
+// doSync runs the sync, applying the plan p when it isn't nil
+func doSync(ctx context.Context, cfg *config.Config, p *Plan) (report *state.Report, err error) {
+	if len(cfg.Groups) > 0 && cfg.SyncMethod != config.DefaultSyncMethod {
+		return nil, fmt.Errorf("syncing some groups only is only supported with the %q sync method", config.DefaultSyncMethod)
+	}
+	if cfg.RunID == "" {
+		cfg.RunID = newRunID()
+	}
+	defer func() {
+		notifyRun(cfg, report, err)
+	}()
+	stopProfile, err := startProfile(cfg)
 	if err != nil {
-		log.WithError(err).Error("Error creating Google client")
-		return err
+		return report, err
 	}
-	log.Info("Google client created successfully")
-	awsClient, err := aws.NewClient(
-		httpClient,
-		&aws.Config{
-			Endpoint: cfg.SCIMEndpoint,
-			Token:    cfg.SCIMAccessToken,
-		})
+	defer stopProfile()
+	log.WithField("runId", cfg.RunID).Info("Starting synchronization process")
+	log.Info("Syncing AWS users and groups from Google Workspace SAML Application")
+	meter := &usage{}
+	sampling, stopSampling := context.WithCancel(ctx)
+	defer stopSampling()
+	go meter.sampleMemory(sampling, memorySampleInterval)
+	googleClient, awsClient, err := newClients(ctx, cfg, false, meter)
 	if err != nil {
-		log.WithError(err).Error("Error creating AWS client")
-		return err
+		return report, err
+	}
+	var awsCache *cachedAWSClient
+	if cfg.AWSCacheFile != "" && cfg.SyncMethod == config.DefaultSyncMethod {
+		awsCache = newCachedAWSClient(awsClient, cfg.AWSCacheFile, cfg.AWSCacheTTL, time.Now())
+		awsClient = awsCache
+	}
+	store, st, err := loadState(cfg)
+	if err != nil {
+		return report, err
+	}
+	if st.Checkpoint != nil {
+		log.WithFields(log.Fields{
+			"runId":      st.Checkpoint.RunID,
+			"batches":    st.Checkpoint.Batches,
+			"operations": st.Checkpoint.Operations,
+		}).Warn("Previous run was interrupted after its last checkpoint, the changes it didn't apply are recomputed")
+	}
+	c := newSyncGSuite(cfg, awsClient, googleClient, st)
+	c.ctx = ctx
+	c.store = store
+	c.plan = p
+	c.usage = meter
+	c.awsCache = awsCache
+	if c.jira, err = newJiraClient(cfg); err != nil {
+		return report, err
+	}
+	if c.holder, err = newPlanHolder(cfg); err != nil {
+		return report, err
+	}
+	if p == nil && c.holder != nil && cfg.ApprovalToken != "" {
+		// the approved plan is applied only if nothing changed since it was held
+		held, err := c.holder.Load(cfg.ApprovalToken)
+		if err != nil && !errors.Is(err, ErrPlanNotHeld) {
+			return report, err
+		}
+		if err == nil {
+			log.WithField("token", cfg.ApprovalToken).Info("Applying the held plan")
+			c.plan = held
+		}
 	}
-	log.Info("AWS client created successfully")
-	c := New(cfg, awsClient, googleClient)
 	log.WithField("sync_method", cfg.SyncMethod).Info("Starting synchronization")
 	if cfg.SyncMethod == config.DefaultSyncMethod {
 		log.Info("Using default synchronization method")
 		err = c.SyncGroupsUsers(cfg.GroupMatch)
+		report = st.LastReport
+		if awsCache != nil {
+			awsCache.save(cfg, err, time.Now())
+		}
 		if err != nil {
 			log.WithError(err).Error("Error synchronizing groups and users")
-			return err
+			return report, err
 		}
 	} else {
 		log.Info("Using alternative synchronization method")
 		err = c.SyncUsers(cfg.UserMatch)
 		if err != nil {
 			log.WithError(err).Error("Error synchronizing users")
-			return err
+			return report, err
 		}
 		err = c.SyncGroups(cfg.GroupMatch)
 		if err != nil {
 			log.WithError(err).Error("Error synchronizing groups")
-			return err
+			return report, err
+		}
+	}
+	if store != nil {
+		st.RunID = cfg.RunID
+		st.UpdatedAt = time.Now()
+		if err := store.Save(st); err != nil {
+			log.WithError(err).Error("Error saving state")
+			return report, err
 		}
 	}
 	log.Info("Synchronization completed successfully")
+	return report, nil
+}
+
+// DoDiff computes the changes a sync would apply, including the group
+// memberships, writes them to w and tells whether there are any. The AWS
+// client used can't write to AWS SSO, so only read access is needed.
+func DoDiff(ctx context.Context, cfg *config.Config, w io.Writer) (bool, error) {
+	if cfg.SyncMethod != config.DefaultSyncMethod {
+		return false, fmt.Errorf("diff is only supported with the %q sync method", config.DefaultSyncMethod)
+	}
+	if cfg.RunID == "" {
+		cfg.RunID = newRunID()
+	}
+	log.WithField("runId", cfg.RunID).Info("Starting read-only diff")
+	googleClient, awsClient, recorder, snap, err := readOnlyClients(ctx, cfg)
+	if err != nil {
+		return false, err
+	}
+	_, st, err := loadState(cfg)
+	if err != nil {
+		return false, err
+	}
+	changes, err := newSyncGSuite(cfg, awsClient, googleClient, st).getChanges(cfg.GroupMatch)
+	if err != nil {
+		log.WithError(err).Error("Error computing changes")
+		return false, err
+	}
+	if err := saveSnapshot(cfg, recorder); err != nil {
+		return false, err
+	}
+	if snap != nil {
+		if _, err := fmt.Fprintf(w, "OFFLINE: computed from the snapshot taken at %s, it may be stale\n\n", snap.TakenAt.Format(time.RFC3339)); err != nil {
+			return false, err
+		}
+	}
+	if err := changes.write(w); err != nil {
+		return false, err
+	}
+	return len(changes.records()) > 0, nil
+}
+
+// WritePendingDeletions writes the users and groups in quarantine, waiting
+// for the deletion grace period to be over, to w
+func WritePendingDeletions(cfg *config.Config, w io.Writer) error {
+	if cfg.StateFile == "" {
+		return errors.New("pending deletions are kept in the state, a state file is required")
+	}
+	_, st, err := loadState(cfg)
+	if err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "KIND\tNAME\tQUARANTINED SINCE\tDELETION AFTER")
+	for _, q := range st.Pending() {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", q.Kind, q.Name, q.Since.Format(time.RFC3339), q.Since.Add(cfg.DeletionGracePeriod).Format(time.RFC3339))
+	}
+	return tw.Flush()
+}
+
+// newClients creates the Google and AWS clients from the configuration, if
+// readOnly is true the AWS client refuses any request that writes. Their
+// requests are metered by u, which may be nil.
+func newClients(ctx context.Context, cfg *config.Config, readOnly bool, u *usage) (google.Client, aws.Client, error) {
+	creds, err := googleCredentials(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	httpClient, transport := newHTTPClient(cfg, u)
+	awsClient, err := newAWSClient(cfg, httpClient, readOnly)
+	if err != nil {
+		return nil, nil, err
+	}
+	tokens, err := googleTokens(cfg.GoogleAdmin, creds, googleScopes(cfg)...)
+	if err != nil {
+		log.WithError(err).Error("Error creating Google client")
+		return nil, nil, err
+	}
+	googleTransport := u.callTransport(google.NewThrottledTransport(transport, cfg.GoogleRequestsPerSecond))
+	googleClient, err := google.NewClient(ctx, tokens, cfg.GoogleCustomerId, &http.Client{Transport: googleTransport}, cfg.GooglePageSize, config.ReadSchemaNames(cfg))
+	if err != nil {
+		log.WithError(err).Error("Error creating Google client")
+		return nil, nil, err
+	}
+	log.Info("Google client created successfully")
+	return googleClient, awsClient, nil
+}
+
+// googleScopes returns the extra scopes of the Google tokens, the ones
+// reading the labels of the groups with --group-labels
+func googleScopes(cfg *config.Config) []string {
+	if len(cfg.GroupLabels) > 0 {
+		return google.LabelScopes
+	}
 	return nil
 }
 
-func (s *syncGSuite) ignoreUser(name string) bool {
-	for _, u := range s.cfg.IgnoreUsers {
-		if u == name {
-			return true
+// googleCredentials returns the service account key of Google Workspace,
+// read from the file --google-credentials names unless run by Lambda, which
+// reads the key itself from Secrets Manager
+func googleCredentials(cfg *config.Config) ([]byte, error) {
+	if cfg.IsLambda {
+		return []byte(cfg.GoogleCredentials), nil
+	}
+	b, err := ioutil.ReadFile(cfg.GoogleCredentials)
+	if err != nil {
+		log.WithError(err).Error("Error reading Google credentials file")
+		return nil, err
+	}
+	return b, nil
+}
+
+// newHTTPClient returns the http client of the SCIM requests, with retry and
+// backoff capabilities and limited to --scim-rps, and the transport
+// identifying ssosync and every request it sends. Both send the requests
+// with the connections shared by the runs, metered by u, which may be nil.
+func newHTTPClient(cfg *config.Config, u *usage) (*http.Client, http.RoundTripper) {
+	retryClient := retryablehttp.NewClient()
+	// https://github.com/hashicorp/go-retryablehttp/issues/6
+	if cfg.Debug {
+		retryClient.Logger = log.StandardLogger()
+	} else {
+		retryClient.Logger = nil
+	}
+	// the requests to AWS SSO have their own pool of connections
+	var base http.RoundTripper = sharedTransport()
+	if endpoint, err := url.Parse(cfg.SCIMEndpoint); err == nil && endpoint.Host != "" {
+		base = &hostTransport{host: endpoint.Host, own: sharedSCIMTransport(newSCIMTransportOptions(cfg)), base: base}
+	}
+	// identify ssosync and every request it sends to the providers
+	transport := newRequestIDTransport(u.requestTransport(newFaultTransport(base, cfg)), cfg.Version, cfg.RunID)
+	retryClient.HTTPClient.Transport = aws.NewThrottledTransport(transport, cfg.SCIMRequestsPerSecond)
+	// each attempt has its own timeout, a slow request is retried
+	retryClient.HTTPClient.Timeout = cfg.SCIMRequestTimeout
+	httpClient := retryClient.StandardClient()
+	httpClient.Transport = u.callTransport(httpClient.Transport)
+	return httpClient, transport
+}
+
+// newAWSClient creates the AWS SSO SCIM client sending its requests with
+// httpClient, if readOnly is true it refuses any request that writes. In dry
+// run, the writes are logged instead of sent.
+func newAWSClient(cfg *config.Config, httpClient *http.Client, readOnly bool) (aws.Client, error) {
+	// a malformed endpoint would only fail with 404s in the middle of a sync
+	region := cfg.SCIMSigV4Region
+	if region == "" {
+		region = os.Getenv("AWS_REGION")
+	}
+	if err := aws.ValidateEndpoint(cfg.SCIMEndpoint, region); err != nil {
+		log.WithError(err).Error("Invalid SCIM endpoint")
+		return nil, err
+	}
+	token, profile := scimCredentials(cfg, readOnly)
+	// the token of the secret stays out of cfg, which is shared and logged
+	if token == "" && cfg.SCIMAccessTokenSecret != "" {
+		var err error
+		token, err = readSecret(cfg, cfg.SCIMAccessTokenSecret)
+		if err != nil {
+			log.WithError(err).WithField("secret", cfg.SCIMAccessTokenSecret).Error("Error reading the SCIM access token secret")
+			return nil, err
+		}
+	}
+	var scimClient aws.HttpClient = httpClient
+	if cfg.SCIMSigV4 {
+		sess, err := config.NewAWSSession(profile)
+		if err != nil {
+			log.WithError(err).Error("Error creating AWS session")
+			return nil, err
+		}
+		region := cfg.SCIMSigV4Region
+		if region == "" && sess.Config.Region != nil {
+			region = *sess.Config.Region
+		}
+		log.WithFields(log.Fields{
+			"service": cfg.SCIMSigV4Service,
+			"region":  region,
+		}).Info("Signing SCIM requests with SigV4")
+		scimClient = aws.NewSigV4Client(httpClient, sess.Config.Credentials, cfg.SCIMSigV4Service, region)
+	}
+	if readOnly {
+		scimClient = aws.NewReadOnlyClient(scimClient)
+	}
+	headers, err := parseHeaders(cfg.SCIMHeaders)
+	if err != nil {
+		log.WithError(err).Error("Error parsing SCIM headers")
+		return nil, err
+	}
+	awsClient, err := aws.NewClient(
+		scimClient,
+		&aws.Config{
+			Endpoint:   cfg.SCIMEndpoint,
+			Token:      token,
+			Headers:    headers,
+			PageSize:   cfg.SCIMPageSize,
+			PatchUsers: cfg.SCIMPatchUsers,
+			// the attributes set by other tools are never removed
+			ManagedPaths: newUserMapping(cfg).patchPaths(),
+		})
+	if err != nil {
+		log.WithError(err).Error("Error creating AWS client")
+		return nil, err
+	}
+	log.Info("AWS client created successfully")
+	if cfg.UserName != "" && cfg.UserName != config.UserNameEmail {
+		// innermost, the other clients find the users by email
+		log.WithField("userName", cfg.UserName).Info("AWS SSO users not named after their email")
+		awsClient = aws.NewUserNameClient(awsClient)
+	}
+	awsClient = aws.NewMembershipCacheClient(awsClient)
+	if cfg.DryRun {
+		log.Warn("Dry run, changes to AWS SSO are logged but not applied")
+		awsClient = aws.NewDryRunClient(awsClient)
+	}
+	// outermost, so every write invalidates the cached lookups it affects
+	return aws.NewResponseCacheClient(awsClient), nil
+}
+
+// readSecret returns the value of the Secrets Manager secret with name, read
+// with the AWS profile of cfg
+func readSecret(cfg *config.Config, name string) (string, error) {
+	sess, err := config.NewAWSSession(cfg.AWSProfile)
+	if err != nil {
+		return "", err
+	}
+	return config.NewSecrets(secretsmanager.New(sess)).Get(name)
+}
+
+// scimCredentials returns the SCIM access token and the AWS profile signing
+// the SCIM requests, the read ones replace the privileged ones when readOnly
+func scimCredentials(cfg *config.Config, readOnly bool) (token string, profile string) {
+	token, profile = cfg.SCIMAccessToken, cfg.AWSProfile
+	if !readOnly {
+		return token, profile
+	}
+	if cfg.SCIMReadAccessToken != "" {
+		token = cfg.SCIMReadAccessToken
+	}
+	if cfg.SCIMReadAWSProfile != "" {
+		profile = cfg.SCIMReadAWSProfile
+	}
+	return token, profile
+}
+
+// loadState loads the state of the previous runs from the configured state
+// file, the returned store is nil when there is no state file or in dry run
+func loadState(cfg *config.Config) (state.Store, *state.State, error) {
+	if cfg.StateFile == "" {
+		if cfg.SkipUnchangedUsers {
+			log.Warn("Skipping unchanged users requires a state file, all users will be checked")
+			cfg.SkipUnchangedUsers = false
 		}
+		if cfg.FlapThreshold > 0 {
+			log.Warn("Detecting flapping entities requires a state file, it is disabled")
+			cfg.FlapThreshold = 0
+		}
+		if cfg.DeletionGracePeriod > 0 {
+			return nil, nil, errors.New("the deletion grace period requires a state file")
+		}
+		if cfg.RestoreWindow > 0 {
+			return nil, nil, errors.New("the restore window requires a state file")
+		}
+		return nil, state.New(), nil
+	}
+	store, err := newStateStore(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	st, err := store.Load()
+	if err != nil {
+		log.WithError(err).Error("Error loading state")
+		return nil, nil, err
+	}
+	log.WithField("runId", st.RunID).Info("State of previous run loaded")
+	if cfg.DryRun {
+		log.Info("Dry run, the state won't be saved")
+		return nil, st, nil
 	}
+	return store, st, nil
+}
 
-	return false
+// newStateStore returns the store of the state file, which is a local file
+// or an object in S3 when it is a s3://bucket/key URL
+func newStateStore(cfg *config.Config) (state.Store, error) {
+	if !state.IsS3URL(cfg.StateFile) {
+		return state.NewFileStore(cfg.StateFile), nil
+	}
+	bucket, key, err := state.ParseS3URL(cfg.StateFile)
+	if err != nil {
+		return nil, err
+	}
+	sess, err := config.NewAWSSession(cfg.AWSProfile)
+	if err != nil {
+		log.WithError(err).Error("Error creating AWS session")
+		return nil, err
+	}
+	return state.NewS3Store(s3.New(sess), bucket, key), nil
 }
 
-func (s *syncGSuite) ignoreGroup(name string) bool {
-	for _, g := range s.cfg.IgnoreGroups {
-		if g == name {
-			return true
+// newRunID returns a random identifier for a sync run
+func newRunID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
+
+// parseHeaders converts a list of "Name=Value" entries into a map of headers.
+// The Authorization header is rejected: it would be sent as is when there is
+// no access token, e.g. with SigV4, whose signature it must hold.
+func parseHeaders(entries []string) (map[string]string, error) {
+	headers := make(map[string]string)
+	for _, e := range entries {
+		kv := strings.SplitN(e, "=", 2)
+		if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" {
+			return nil, fmt.Errorf("invalid header %q, expected Name=Value", e)
 		}
+		if http.CanonicalHeaderKey(strings.TrimSpace(kv[0])) == "Authorization" {
+			return nil, fmt.Errorf("invalid header %q, the Authorization header can't be set, use --access-token", kv[0])
+		}
+		headers[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
 	}
+	return headers, nil
+}
 
-	return false
+func (s *syncGSuite) ignoreUser(name string) bool {
+	return matcher.Match(s.cfg.IgnoreUsers, name) || !s.allowedDomain(name)
 }
 
-func (s *syncGSuite) includeGroup(name string) bool {
-	for _, g := range s.cfg.IncludeGroups {
-		if g == name {
+// allowedDomain tells if the email is in one of the allowed domains, every
+// email is when there are none. External collaborators placed into groups
+// are left out this way.
+func (s *syncGSuite) allowedDomain(email string) bool {
+	if len(s.cfg.AllowedDomains) == 0 {
+		return true
+	}
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return false
+	}
+	for _, d := range s.cfg.AllowedDomains {
+		if strings.EqualFold(email[at+1:], d) {
 			return true
 		}
 	}
+	return false
+}
+
+// ignoreOrgUnit tells if the user is out of the organizational units in
+// scope: in one of the ignored units, or in none of the included ones when
+// there are
+func (s *syncGSuite) ignoreOrgUnit(u *admin.User) bool {
+	if inOrgUnits(s.cfg.IgnoreOrgUnits, u.OrgUnitPath) {
+		return true
+	}
+	return len(s.cfg.IncludeOrgUnits) > 0 && !inOrgUnits(s.cfg.IncludeOrgUnits, u.OrgUnitPath)
+}
 
+// inOrgUnits tells if the organizational unit path is one of units or one
+// of their sub-units, e.g. "/Contractors/EMEA" is in "/Contractors". Paths
+// are compared without case, like the Admin SDK does.
+func inOrgUnits(units []string, path string) bool {
+	for _, unit := range units {
+		unit = strings.TrimSuffix(unit, "/")
+		if unit == "" || strings.EqualFold(path, unit) ||
+			len(path) > len(unit) && path[len(unit)] == '/' && strings.EqualFold(path[:len(unit)], unit) {
+			return true
+		}
+	}
 	return false
 }
 
-func checkUserDeletionThreshold(users []*aws.User) bool {
-    const deletionThreshold = 2
-    if len(users) > deletionThreshold {
-        log.Warnf("Attempting to delete %d users, which exceeds the threshold of %d", len(users), deletionThreshold)
-        return false
-    }
-    return true
+func (s *syncGSuite) ignoreGroup(name string) bool {
+	return matcher.Match(s.cfg.IgnoreGroups, name)
+}
+
+func (s *syncGSuite) includeGroup(name string) bool {
+	return matcher.Match(s.cfg.IncludeGroups, name)
+}
+
+// includeUser tells if the user is in IncludeUsers, every user is when it
+// is empty
+func (s *syncGSuite) includeUser(name string) bool {
+	return len(s.cfg.IncludeUsers) == 0 || matcher.Match(s.cfg.IncludeUsers, name)
+}
+
+// checkCap fails with ErrCapExceeded when count Google users or groups, of
+// kind, are over max, 0 is unlimited
+func checkCap(kind string, count int, max int) error {
+	if max <= 0 || count <= max {
+		return nil
+	}
+	log.WithFields(log.Fields{"kind": kind, "count": count, "max": max}).Error("Too many Google Workspace objects, check the filters")
+	return fmt.Errorf("%w: %d %s in scope, over the cap of %d", ErrCapExceeded, count, kind, max)
+}
+
+// checkDeletionLimits fails with ErrDeletionThresholdExceeded when changes
+// delete more users or groups than the configured limits, by count or by
+// percentage of the existing ones, unless forced
+func checkDeletionLimits(cfg *config.Config, changes *changeSet) error {
+	if err := checkDeletionLimit(cfg, "users", len(changes.deleteUsers), changes.awsUsers, cfg.MaxUserDeletions); err != nil {
+		return err
+	}
+	return checkDeletionLimit(cfg, "groups", len(changes.deleteGroups), changes.awsGroups, cfg.MaxGroupDeletions)
 }
 
-func checkGroupDeletionThreshold(groups []*aws.Group) bool {
-    const deletionThreshold = 2
-    if len(groups) > deletionThreshold {
-        log.Warnf("Attempting to delete %d groups, which exceeds the threshold of %d", len(groups), deletionThreshold)
-        return false
-    }
-    return true
+// checkDeletionLimit checks the deletions of existing entities of a kind
+// against max and the maximum percentage of the configuration
+func checkDeletionLimit(cfg *config.Config, kind string, deletions int, existing int, max int) error {
+	if deletions == 0 {
+		return nil
+	}
+	log := log.WithFields(log.Fields{
+		"kind":      kind,
+		"deletions": deletions,
+		"existing":  existing,
+	})
+	var exceeded string
+	if max > 0 && deletions > max {
+		exceeded = fmt.Sprintf("%d %s to delete, over the limit of %d", deletions, kind, max)
+	} else if percent := 100 * float64(deletions) / float64(existing); cfg.MaxDeletionPercent > 0 && percent > cfg.MaxDeletionPercent {
+		exceeded = fmt.Sprintf("%.1f%% of the %s to delete, over the limit of %v%%", percent, kind, cfg.MaxDeletionPercent)
+	}
+	if exceeded == "" {
+		return nil
+	}
+	if cfg.Force {
+		log.Warnf("Forced: %s", exceeded)
+		return nil
+	}
+	log.Errorf("Deletion threshold exceeded: %s, use --force to apply them", exceeded)
+	return fmt.Errorf("%w: %s", ErrDeletionThresholdExceeded, exceeded)
 }
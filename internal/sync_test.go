@@ -16,12 +16,28 @@
 package internal
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/awslabs/ssosync/internal/aws"
+	awsfake "github.com/awslabs/ssosync/internal/aws/fake"
+	"github.com/awslabs/ssosync/internal/config"
+	"github.com/awslabs/ssosync/internal/google"
+	googlefake "github.com/awslabs/ssosync/internal/google/fake"
+	"github.com/awslabs/ssosync/internal/state"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
 	admin "google.golang.org/api/admin/directory/v1"
 )
 
@@ -34,6 +50,15 @@ func toJSON(stc interface{}) []byte {
 	return JSON
 }
 
+// syncedUser returns the AWS user ssosync writes for googlefake.User(email),
+// with the id of the Google user as external id
+func syncedUser(email string) *aws.User {
+	name := strings.SplitN(email, "@", 2)[0]
+	u := aws.NewUser(name, name, email, true)
+	u.ExternalID = "id-" + email
+	return u
+}
+
 func Test_getGroupOperations(t *testing.T) {
 	type args struct {
 		awsGroups    []*aws.Group
@@ -118,6 +143,79 @@ func Test_getGroupOperations(t *testing.T) {
 				aws.NewGroup("Group-2"),
 			},
 		},
+		{
+			name: "groups differing by case only",
+			args: args{
+				awsGroups: []*aws.Group{
+					aws.NewGroup("group-1"),
+				},
+				googleGroups: []*admin.Group{
+					{Name: " Group-1"},
+				},
+			},
+			wantAdd:    nil,
+			wantDelete: nil,
+			wantEquals: []*aws.Group{
+				aws.NewGroup("group-1"),
+			},
+		},
+		{
+			name: "groups matched by external id",
+			args: args{
+				awsGroups: []*aws.Group{
+					aws.NewManagedGroup("Group-1", "id-1"),
+					aws.NewManagedGroup("Group-2", "group-2@example.com"),
+				},
+				googleGroups: []*admin.Group{
+					{Id: "id-1", Name: "Group-One"},
+					{Id: "id-2", Email: "Group-2@example.com", Name: "Group-Two"},
+				},
+			},
+			wantAdd:    nil,
+			wantDelete: nil,
+			wantEquals: []*aws.Group{
+				aws.NewManagedGroup("Group-1", "id-1"),
+				aws.NewManagedGroup("Group-2", "group-2@example.com"),
+			},
+		},
+		{
+			name: "group not matched by external id when its name is taken",
+			args: args{
+				awsGroups: []*aws.Group{
+					aws.NewManagedGroup("Group-1", "id-1"),
+					aws.NewGroup("Group-One"),
+				},
+				googleGroups: []*admin.Group{
+					{Id: "id-1", Name: "Group-One"},
+				},
+			},
+			wantAdd: nil,
+			wantDelete: []*aws.Group{
+				aws.NewGroup("Group-1"),
+			},
+			wantEquals: []*aws.Group{
+				aws.NewGroup("Group-One"),
+			},
+		},
+		{
+			name: "group not matched by external id when its name is taken with another case",
+			args: args{
+				awsGroups: []*aws.Group{
+					aws.NewManagedGroup("Old", "id-1"),
+					aws.NewGroup("new"),
+				},
+				googleGroups: []*admin.Group{
+					{Id: "id-1", Name: "New"},
+				},
+			},
+			wantAdd: nil,
+			wantDelete: []*aws.Group{
+				aws.NewGroup("Old"),
+			},
+			wantEquals: []*aws.Group{
+				aws.NewGroup("new"),
+			},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -274,10 +372,41 @@ func Test_getUserOperations(t *testing.T) {
 				aws.NewUser("name-2", "lastname-2", "user-2@email.com", true),
 			},
 		},
+		{
+			name: "emails differing by case only",
+			args: args{
+				awsUsers: []*aws.User{
+					aws.NewUser("name-1", "lastname-1", "User-1@Email.com", true),
+					aws.NewUser("name-2", "lastname-2", "user-2@email.com", true),
+				},
+				googleUsers: []*admin.User{
+					{Name: &admin.UserName{
+						GivenName:  "name-1",
+						FamilyName: "lastname-1",
+					},
+						PrimaryEmail: "user-1@email.com",
+					},
+					{Name: &admin.UserName{
+						GivenName:  "new-name-2",
+						FamilyName: "lastname-2",
+					},
+						PrimaryEmail: "USER-2@email.com",
+					},
+				},
+			},
+			wantAdd:    nil,
+			wantDelete: nil,
+			wantUpdate: []*aws.User{
+				aws.NewUser("new-name-2", "lastname-2", "USER-2@email.com", true),
+			},
+			wantEquals: []*aws.User{
+				aws.NewUser("name-1", "lastname-1", "User-1@Email.com", true),
+			},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			gotAdd, gotDelete, gotUpdate, gotEquals := getUserOperations(tt.args.awsUsers, tt.args.googleUsers)
+			gotAdd, gotDelete, gotUpdate, gotEquals := getUserOperations(tt.args.awsUsers, tt.args.googleUsers, &userMapping{})
 			if !reflect.DeepEqual(gotAdd, tt.wantAdd) {
 				t.Errorf("getUserOperations() gotAdd = %s, want %s", toJSON(gotAdd), toJSON(tt.wantAdd))
 			}
@@ -338,6 +467,33 @@ func Test_getGroupUsersOperations(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "names and emails differing by case only",
+			args: args{
+				gGroupsUsers: map[string][]*admin.User{
+					"Group-1": {
+						{
+							Name: &admin.UserName{
+								GivenName:  "name-1",
+								FamilyName: "lastname-1",
+							},
+							PrimaryEmail: "User-1@email.com",
+						},
+					},
+				},
+				awsGroupsUsers: map[string][]*aws.User{
+					"group-1": {
+						aws.NewUser("name-1", "lastname-1", "user-1@Email.com", true),
+					},
+				},
+			},
+			wantDelete: map[string][]*aws.User{},
+			wantEquals: map[string][]*aws.User{
+				"group-1": {
+					aws.NewUser("name-1", "lastname-1", "user-1@Email.com", true),
+				},
+			},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -351,3 +507,1312 @@ func Test_getGroupUsersOperations(t *testing.T) {
 		})
 	}
 }
+
+func Test_parseHeaders(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []string
+		want    map[string]string
+		wantErr bool
+	}{
+		{
+			name:    "no headers",
+			entries: nil,
+			want:    map[string]string{},
+		},
+		{
+			name:    "headers with spaces and equal signs in values",
+			entries: []string{"X-Waf-Token=secret", " X-Trace = a=b "},
+			want: map[string]string{
+				"X-Waf-Token": "secret",
+				"X-Trace":     "a=b",
+			},
+		},
+		{
+			name:    "missing value",
+			entries: []string{"X-Waf-Token"},
+			wantErr: true,
+		},
+		{
+			name:    "missing name",
+			entries: []string{"=secret"},
+			wantErr: true,
+		},
+		{
+			name:    "authorization",
+			entries: []string{"authorization=Bearer secret"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseHeaders(tt.entries)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseHeaders() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseHeaders() = %s, want %s", toJSON(got), toJSON(tt.want))
+			}
+		})
+	}
+}
+
+func Test_getGroupMembersToAdd(t *testing.T) {
+	gUser := func(email string) *admin.User {
+		return &admin.User{PrimaryEmail: email, Name: &admin.UserName{}}
+	}
+	tests := []struct {
+		name           string
+		gGroupsUsers   map[string][]*admin.User
+		awsGroupsUsers map[string][]*aws.User
+		want           map[string][]*admin.User
+	}{
+		{
+			name: "new group",
+			gGroupsUsers: map[string][]*admin.User{
+				"group-1": {gUser("user-1@email.com"), gUser("user-2@email.com")},
+			},
+			awsGroupsUsers: map[string][]*aws.User{},
+			want: map[string][]*admin.User{
+				"group-1": {gUser("user-1@email.com"), gUser("user-2@email.com")},
+			},
+		},
+		{
+			name: "one member missing in aws and one member to be removed",
+			gGroupsUsers: map[string][]*admin.User{
+				"group-1": {gUser("user-1@email.com"), gUser("user-2@email.com")},
+			},
+			awsGroupsUsers: map[string][]*aws.User{
+				"group-1": {
+					aws.NewUser("name-1", "lastname-1", "user-1@email.com", true),
+					aws.NewUser("name-3", "lastname-3", "user-3@email.com", true),
+				},
+			},
+			want: map[string][]*admin.User{
+				"group-1": {gUser("user-2@email.com")},
+			},
+		},
+		{
+			name: "equal groups",
+			gGroupsUsers: map[string][]*admin.User{
+				"group-1": {gUser("user-1@email.com")},
+			},
+			awsGroupsUsers: map[string][]*aws.User{
+				"group-1": {aws.NewUser("name-1", "lastname-1", "user-1@email.com", true)},
+			},
+			want: map[string][]*admin.User{},
+		},
+		{
+			name: "names and emails differing by case only",
+			gGroupsUsers: map[string][]*admin.User{
+				"Group-1": {gUser("User-1@email.com"), gUser("user-2@email.com")},
+			},
+			awsGroupsUsers: map[string][]*aws.User{
+				"group-1": {aws.NewUser("name-1", "lastname-1", "user-1@Email.com", true)},
+			},
+			want: map[string][]*admin.User{
+				"group-1": {gUser("user-2@email.com")},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := getGroupMembersToAdd(tt.gGroupsUsers, tt.awsGroupsUsers)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("getGroupMembersToAdd() = %s, want %s", toJSON(got), toJSON(tt.want))
+			}
+		})
+	}
+}
+
+func Test_capGroupMembers(t *testing.T) {
+	gUser := func(email string) *admin.User {
+		return &admin.User{PrimaryEmail: email}
+	}
+	groups := []*admin.Group{{Id: "id-1", Name: "group-1", Email: "group-1@email.com"}}
+	groupsUsers := map[string][]*admin.User{
+		"group-1": {gUser("user-3@email.com"), gUser("user-1@email.com"), gUser("user-4@email.com"), gUser("user-2@email.com"), gUser("user-5@email.com")},
+	}
+	tests := []struct {
+		name       string
+		max        int
+		overflow   string
+		wantGroups []*admin.Group
+		wantUsers  map[string][]*admin.User
+		wantErr    bool
+	}{
+		{
+			name:       "under the cap",
+			max:        5,
+			overflow:   "fail",
+			wantGroups: groups,
+			wantUsers:  groupsUsers,
+		},
+		{
+			name:     "fail",
+			max:      2,
+			overflow: "fail",
+			wantErr:  true,
+		},
+		{
+			name:       "truncate",
+			max:        2,
+			overflow:   "truncate",
+			wantGroups: groups,
+			wantUsers: map[string][]*admin.User{
+				"group-1": {gUser("user-1@email.com"), gUser("user-2@email.com")},
+			},
+		},
+		{
+			name:     "split",
+			max:      2,
+			overflow: "split",
+			wantGroups: []*admin.Group{
+				{Id: "id-1", Name: "group-1", Email: "group-1@email.com"},
+				{Id: "id-1-2", Name: "group-1-2", Email: "group-1@email.com"},
+				{Id: "id-1-3", Name: "group-1-3", Email: "group-1@email.com"},
+			},
+			wantUsers: map[string][]*admin.User{
+				"group-1":   {gUser("user-1@email.com"), gUser("user-2@email.com")},
+				"group-1-2": {gUser("user-3@email.com"), gUser("user-4@email.com")},
+				"group-1-3": {gUser("user-5@email.com")},
+			},
+		},
+		{
+			name:     "unknown strategy",
+			max:      2,
+			overflow: "drop",
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotGroups, gotUsers, err := capGroupMembers(groups, groupsUsers, tt.max, tt.overflow)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("capGroupMembers() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(gotGroups, tt.wantGroups) {
+				t.Errorf("capGroupMembers() groups = %s, want %s", toJSON(gotGroups), toJSON(tt.wantGroups))
+			}
+			if !reflect.DeepEqual(gotUsers, tt.wantUsers) {
+				t.Errorf("capGroupMembers() users = %s, want %s", toJSON(gotUsers), toJSON(tt.wantUsers))
+			}
+		})
+	}
+}
+
+func TestSyncGroupsUsersSplitGroup(t *testing.T) {
+	group := googlefake.Group("aws-dev@email.com")
+	group.Id = "0279ka6510ez4vx"
+	googleClient := googlefake.NewClient().
+		WithUsers(googlefake.User("a@email.com"), googlefake.User("b@email.com"), googlefake.User("c@email.com")).
+		WithGroup(group, "a@email.com", "b@email.com", "c@email.com")
+	awsClient := awsfake.NewClient()
+	cfg := config.New()
+	cfg.Yes = true
+	cfg.MaxGroupMembers = 2
+	cfg.GroupOverflow = config.GroupOverflowSplit
+
+	if err := newSyncGSuite(cfg, awsClient, googleClient, nil).SyncGroupsUsers(nil); err != nil {
+		t.Fatalf("SyncGroupsUsers() error = %v", err)
+	}
+	overflow, err := awsClient.FindGroupByDisplayName("aws-dev-2")
+	if err != nil {
+		t.Fatalf("FindGroupByDisplayName() error = %v", err)
+	}
+	assert.Equal(t, "0279ka6510ez4vx-2", overflow.ExternalID)
+	assert.True(t, overflow.Managed())
+
+	// the groups and their overflow group are matched again by the next run
+	changes, err := newSyncGSuite(cfg, awsClient, googleClient, nil).getChanges(nil)
+	if err != nil {
+		t.Fatalf("getChanges() error = %v", err)
+	}
+	assert.Empty(t, changes.records())
+}
+
+func Test_logMemberOperations(t *testing.T) {
+	hook := logtest.NewGlobal()
+	defer hook.Reset()
+	g := aws.NewGroup("group-1")
+	batch := []memberOperation{
+		{group: g, email: "a@email.com"},
+		{group: g, email: "b@email.com", remove: aws.NewUser("b", "b", "b@email.com", true)},
+		{group: g, email: "c@email.com"},
+	}
+
+	// logged in the order of the batch, whatever the order they were applied
+	// in, without b which failed
+	logMemberOperations(batch, []bool{true, false, true})
+	var users []interface{}
+	for _, e := range hook.AllEntries() {
+		users = append(users, e.Data["user"])
+	}
+	assert.Equal(t, []interface{}{"a@email.com", "c@email.com"}, users)
+}
+
+func Test_getMemberOperations(t *testing.T) {
+	g1 := aws.NewGroup("group-1")
+	g2 := aws.NewGroup("group-2")
+	u1 := aws.NewUser("name-1", "lastname-1", "user-1@email.com", true)
+	addMembers := map[string][]*admin.User{
+		"group-1": {{PrimaryEmail: "user-3@email.com"}, {PrimaryEmail: "user-2@email.com"}},
+		"group-2": {{PrimaryEmail: "user-2@email.com"}},
+	}
+	removeMembers := map[string][]*aws.User{
+		"group-2": {u1},
+	}
+	want := []memberOperation{
+		{group: g2, email: "user-1@email.com", remove: u1},
+		{group: g1, email: "user-2@email.com"},
+		{group: g2, email: "user-2@email.com"},
+		{group: g1, email: "user-3@email.com"},
+	}
+	// the order of the groups must not change the order of the operations
+	for _, groups := range [][]*aws.Group{{g1, g2}, {g2, g1}} {
+		got := getMemberOperations(groups, addMembers, removeMembers)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("getMemberOperations() = %+v, want %+v", got, want)
+		}
+	}
+}
+
+func Test_batchMemberOperations(t *testing.T) {
+	ops := make([]memberOperation, 5)
+	tests := []struct {
+		name string
+		size int
+		want []int
+	}{
+		{name: "exact batches", size: 5, want: []int{5}},
+		{name: "last batch smaller", size: 2, want: []int{2, 2, 1}},
+		{name: "no batching", size: 0, want: []int{5}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := []int{}
+			for _, b := range batchMemberOperations(ops, tt.size) {
+				got = append(got, len(b))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("batchMemberOperations() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_scopeAWSGroups(t *testing.T) {
+	awsGroups := []*aws.Group{aws.NewGroup("group-1"), aws.NewGroup("group-2"), aws.NewGroup("group-3")}
+	googleGroups := []*admin.Group{{Name: "group-3"}, {Name: "group-1"}, {Name: "group-4"}}
+	want := []*aws.Group{aws.NewGroup("group-1"), aws.NewGroup("group-3")}
+	if got := scopeAWSGroups(awsGroups, googleGroups); !reflect.DeepEqual(got, want) {
+		t.Errorf("scopeAWSGroups() = %s, want %s", toJSON(got), toJSON(want))
+	}
+}
+
+func Test_getGroupsMatching(t *testing.T) {
+	googleClient := googlefake.NewClient().
+		WithGroup(googlefake.Group("aws-dev@email.com")).
+		WithGroup(googlefake.Group("cloud-ops@email.com")).
+		WithGroup(googlefake.Group("AWS-cloud@email.com")).
+		WithGroup(googlefake.Group("staff@email.com"))
+	s := newSyncGSuite(config.New(), nil, googleClient, nil)
+	tests := []struct {
+		queries []string
+		want    []string
+	}{
+		{nil, []string{"aws-dev@email.com", "cloud-ops@email.com", "AWS-cloud@email.com", "staff@email.com"}},
+		{[]string{"email:aws-*"}, []string{"aws-dev@email.com", "AWS-cloud@email.com"}},
+		{[]string{"email:aws-*", "name:cloud-*", "email:AWS-cloud*"}, []string{"aws-dev@email.com", "AWS-cloud@email.com", "cloud-ops@email.com"}},
+	}
+	for _, tt := range tests {
+		groups, err := s.getGroupsMatching(tt.queries)
+		if err != nil {
+			t.Fatalf("getGroupsMatching(%v) error = %v", tt.queries, err)
+		}
+		var got []string
+		for _, g := range groups {
+			got = append(got, g.Email)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("getGroupsMatching(%v) = %v, want %v", tt.queries, got, tt.want)
+		}
+	}
+}
+
+func Test_withGroupLabels(t *testing.T) {
+	googleClient := googlefake.NewClient().
+		WithGroup(googlefake.Group("aws-dev@email.com")).
+		WithGroup(googlefake.Group("aws-ops@email.com")).
+		WithGroup(googlefake.Group("staff@email.com")).
+		WithLabel(google.SecurityLabel, "AWS-Dev@email.com", "staff@email.com").
+		WithLabel("aws-sync", "aws-ops@email.com")
+	tests := []struct {
+		labels []string
+		want   []string
+	}{
+		{nil, []string{"aws-dev@email.com", "aws-ops@email.com"}},
+		{[]string{google.SecurityLabel}, []string{"aws-dev@email.com"}},
+		{[]string{google.SecurityLabel, "aws-sync"}, []string{"aws-dev@email.com", "aws-ops@email.com"}},
+		{[]string{"unknown"}, nil},
+	}
+	for _, tt := range tests {
+		cfg := config.New()
+		cfg.GroupLabels = tt.labels
+		groups, err := newSyncGSuite(cfg, nil, googleClient, nil).getGroupsMatching([]string{"email:aws-*"})
+		if err != nil {
+			t.Fatalf("getGroupsMatching() with labels %v error = %v", tt.labels, err)
+		}
+		var got []string
+		for _, g := range groups {
+			got = append(got, g.Email)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("getGroupsMatching() with labels %v = %v, want %v", tt.labels, got, tt.want)
+		}
+	}
+}
+
+func Test_withAllUsers(t *testing.T) {
+	a := []*admin.User{{PrimaryEmail: "user-1@email.com"}, {PrimaryEmail: "user-2@email.com"}}
+	googleClient := googlefake.NewClient().WithUsers(
+		&admin.User{PrimaryEmail: "user-2@email.com"},
+		&admin.User{PrimaryEmail: "user-3@email.com"},
+		&admin.User{PrimaryEmail: "ignored@email.com"})
+	cfg := config.New()
+	cfg.IgnoreUsers = []string{"ignored@email.com"}
+	s := newSyncGSuite(cfg, nil, googleClient, nil)
+	want := []*admin.User{{PrimaryEmail: "user-1@email.com"}, {PrimaryEmail: "user-2@email.com"}, {PrimaryEmail: "user-3@email.com"}}
+	got, err := s.withAllUsers(a)
+	if err != nil {
+		t.Fatalf("withAllUsers() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("withAllUsers() = %s, want %s", toJSON(got), toJSON(want))
+	}
+}
+
+// createUserClient fails to create some users
+type createUserClient struct {
+	aws.Client
+	mu      sync.Mutex
+	created []string
+	// bulk supports bulk operations, batches are their sizes
+	bulk    bool
+	batches []int
+}
+
+func (c *createUserClient) CreateUsers(users []*aws.User) ([]aws.BulkResult, error) {
+	if !c.bulk {
+		return nil, aws.ErrBulkNotSupported
+	}
+	c.batches = append(c.batches, len(users))
+	results := make([]aws.BulkResult, len(users))
+	for i, u := range users {
+		created, err := c.CreateUser(u)
+		results[i] = aws.BulkResult{User: created, Err: err}
+	}
+	return results, nil
+}
+
+func (c *createUserClient) CreateUser(u *aws.User) (*aws.User, error) {
+	switch u.Username {
+	case "exists@email.com":
+		return nil, &aws.ErrHttpNotOK{StatusCode: 409}
+	case "fails@email.com":
+		return nil, &aws.ErrHttpNotOK{StatusCode: 500}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.created = append(c.created, u.Username)
+	return u, nil
+}
+
+func Test_createUsers(t *testing.T) {
+	c := &createUserClient{}
+	s := newSyncGSuite(config.New(), c, nil, nil)
+	users := []*aws.User{
+		{Username: "user-1@email.com"},
+		{Username: "exists@email.com"},
+		{Username: "fails@email.com"},
+		{Username: "user-2@email.com"},
+	}
+	failed, err := s.createUsers(context.Background(), users)
+	if err == nil {
+		t.Errorf("createUsers() expected an error")
+	}
+	if want := map[string]bool{"fails@email.com": true}; !reflect.DeepEqual(failed, want) {
+		t.Errorf("createUsers() failed = %v, want %v", failed, want)
+	}
+	sort.Strings(c.created)
+	if want := []string{"user-1@email.com", "user-2@email.com"}; !reflect.DeepEqual(c.created, want) {
+		t.Errorf("createUsers() created = %v, want %v", c.created, want)
+	}
+}
+
+func Test_createUsersInBulk(t *testing.T) {
+	for _, bulk := range []bool{true, false} {
+		c := &createUserClient{bulk: bulk}
+		cfg := config.New()
+		cfg.SCIMBulkSize = 2
+		s := newSyncGSuite(cfg, c, nil, nil)
+		users := []*aws.User{
+			{Username: "user-1@email.com"},
+			{Username: "exists@email.com"},
+			{Username: "fails@email.com"},
+			{Username: "user-2@email.com"},
+			{Username: "user-3@email.com"},
+		}
+		failed, err := s.createUsers(context.Background(), users)
+		assert.Error(t, err)
+		assert.Equal(t, map[string]bool{"fails@email.com": true}, failed)
+		sort.Strings(c.created)
+		assert.Equal(t, []string{"user-1@email.com", "user-2@email.com", "user-3@email.com"}, c.created)
+		if bulk {
+			assert.Equal(t, []int{2, 2, 1}, c.batches)
+		} else {
+			// the users are created one by one
+			assert.Empty(t, c.batches)
+			assert.True(t, s.bulkNotSupported)
+		}
+	}
+}
+
+func Test_createUsersCancelled(t *testing.T) {
+	for _, bulk := range []bool{true, false} {
+		c := &createUserClient{bulk: bulk}
+		cfg := config.New()
+		cfg.SCIMBulkSize = 2
+		s := newSyncGSuite(cfg, c, nil, nil)
+		users := []*aws.User{{Username: "user-1@email.com"}, {Username: "user-2@email.com"}}
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		failed, err := s.createUsers(ctx, users)
+		assert.Equal(t, context.Canceled, err)
+		assert.Equal(t, map[string]bool{"user-1@email.com": true, "user-2@email.com": true}, failed)
+		assert.Empty(t, c.created)
+	}
+}
+
+func Test_forEach(t *testing.T) {
+	var running, maxRunning int32
+	var calls int32
+	err := forEach(20, 3, func(i int) error {
+		n := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			m := atomic.LoadInt32(&maxRunning)
+			if n <= m || atomic.CompareAndSwapInt32(&maxRunning, m, n) {
+				break
+			}
+		}
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(time.Millisecond)
+		return nil
+	})
+	if err != nil {
+		t.Errorf("forEach() error = %v", err)
+	}
+	if calls != 20 {
+		t.Errorf("forEach() calls = %d, want 20", calls)
+	}
+	if maxRunning > 3 {
+		t.Errorf("forEach() ran %d calls at once, want at most 3", maxRunning)
+	}
+
+	errFailed := errors.New("failed")
+	calls = 0
+	err = forEach(20, 1, func(i int) error {
+		atomic.AddInt32(&calls, 1)
+		if i == 4 {
+			return errFailed
+		}
+		return nil
+	})
+	if err != errFailed {
+		t.Errorf("forEach() error = %v, want %v", err, errFailed)
+	}
+	if calls != 5 {
+		t.Errorf("forEach() calls = %d, want 5", calls)
+	}
+}
+
+func Test_withoutMembers(t *testing.T) {
+	members := map[string][]*admin.User{
+		"group-1": {{PrimaryEmail: "user-1@email.com"}, {PrimaryEmail: "fails@email.com"}},
+		"group-2": {{PrimaryEmail: "fails@email.com"}},
+	}
+	want := map[string][]*admin.User{
+		"group-1": {{PrimaryEmail: "user-1@email.com"}},
+	}
+	if got := withoutMembers(members, map[string]bool{"fails@email.com": true}); !reflect.DeepEqual(got, want) {
+		t.Errorf("withoutMembers() = %s, want %s", toJSON(got), toJSON(want))
+	}
+	// the AWS user names and the Google emails may differ in case
+	if got := withoutMembers(members, map[string]bool{"Fails@Email.com": true}); !reflect.DeepEqual(got, want) {
+		t.Errorf("withoutMembers() = %s, want %s", toJSON(got), toJSON(want))
+	}
+	if got := withoutMembers(members, nil); !reflect.DeepEqual(got, members) {
+		t.Errorf("withoutMembers() = %s, want %s", toJSON(got), toJSON(members))
+	}
+}
+
+func Test_scimCredentials(t *testing.T) {
+	tests := []struct {
+		name        string
+		cfg         *config.Config
+		readOnly    bool
+		wantToken   string
+		wantProfile string
+	}{
+		{"no read credentials", &config.Config{SCIMAccessToken: "write", AWSProfile: "admin"}, true, "write", "admin"},
+		{"read credentials", &config.Config{SCIMAccessToken: "write", AWSProfile: "admin", SCIMReadAccessToken: "read", SCIMReadAWSProfile: "readonly"}, true, "read", "readonly"},
+		{"writes", &config.Config{SCIMAccessToken: "write", AWSProfile: "admin", SCIMReadAccessToken: "read", SCIMReadAWSProfile: "readonly"}, false, "write", "admin"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, profile := scimCredentials(tt.cfg, tt.readOnly)
+			if token != tt.wantToken || profile != tt.wantProfile {
+				t.Errorf("scimCredentials() = %q, %q, want %q, %q", token, profile, tt.wantToken, tt.wantProfile)
+			}
+		})
+	}
+}
+
+func Test_checkDeletionLimits(t *testing.T) {
+	users := func(n int) []*aws.User {
+		users := make([]*aws.User, n)
+		for i := range users {
+			users[i] = &aws.User{Username: fmt.Sprintf("user-%d@email.com", i)}
+		}
+		return users
+	}
+	tests := []struct {
+		name    string
+		cfg     *config.Config
+		changes *changeSet
+		wantErr bool
+	}{
+		{"no deletions", config.New(), &changeSet{awsUsers: 10}, false},
+		{"under the count", config.New(), &changeSet{deleteUsers: users(2), awsUsers: 10}, false},
+		{"over the count", config.New(), &changeSet{deleteUsers: users(3), awsUsers: 10}, true},
+		{"over the group count", config.New(), &changeSet{deleteGroups: []*aws.Group{{}, {}, {}}, awsGroups: 10}, true},
+		{"unlimited", &config.Config{}, &changeSet{deleteUsers: users(3), awsUsers: 3}, false},
+		{"under the percentage", &config.Config{MaxDeletionPercent: 30}, &changeSet{deleteUsers: users(3), awsUsers: 10}, false},
+		{"over the percentage", &config.Config{MaxDeletionPercent: 25}, &changeSet{deleteUsers: users(3), awsUsers: 10}, true},
+		{"forced", &config.Config{MaxUserDeletions: 2, Force: true}, &changeSet{deleteUsers: users(3), awsUsers: 10}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkDeletionLimits(tt.cfg, tt.changes)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("checkDeletionLimits() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrDeletionThresholdExceeded) {
+				t.Errorf("checkDeletionLimits() error = %v, want %v", err, ErrDeletionThresholdExceeded)
+			}
+		})
+	}
+}
+
+func TestSyncGroupsUsersCaps(t *testing.T) {
+	googleClient := googlefake.NewClient().
+		WithUsers(googlefake.User("a@email.com"), googlefake.User("b@email.com"), googlefake.User("c@email.com")).
+		WithGroup(googlefake.Group("aws-dev@email.com"), "a@email.com", "b@email.com").
+		WithGroup(googlefake.Group("aws-ops@email.com"), "b@email.com", "c@email.com")
+	tests := []struct {
+		name      string
+		maxUsers  int
+		maxGroups int
+		wantErr   bool
+	}{
+		{"unlimited", 0, 0, false},
+		{"at the caps", 3, 2, false},
+		{"too many users", 2, 0, true},
+		{"too many groups", 0, 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			awsClient := awsfake.NewClient()
+			cfg := config.New()
+			cfg.Yes = true
+			cfg.MaxUsers, cfg.MaxGroups = tt.maxUsers, tt.maxGroups
+			err := newSyncGSuite(cfg, awsClient, googleClient, nil).SyncGroupsUsers(nil)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SyncGroupsUsers() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrCapExceeded) {
+				t.Errorf("SyncGroupsUsers() error = %v, want %v", err, ErrCapExceeded)
+			}
+			// nothing is created when a cap is exceeded
+			users, _ := awsClient.GetUsers()
+			if tt.wantErr && len(users) != 0 {
+				t.Errorf("SyncGroupsUsers() created %d users over a cap", len(users))
+			}
+		})
+	}
+}
+
+func TestSyncGroupsUsers(t *testing.T) {
+	googleClient := googlefake.NewClient().
+		WithUsers(googlefake.User("a@email.com"), googlefake.User("b@email.com")).
+		WithGroup(googlefake.Group("aws-dev@email.com"), "a@email.com", "b@email.com")
+	awsClient := awsfake.NewClient().
+		WithUsers(aws.NewUser("a", "a", "a@email.com", true), aws.NewUser("c", "c", "c@email.com", true)).
+		WithGroup(aws.NewGroup("aws-dev"), "c@email.com").
+		WithGroup(aws.NewGroup("aws-old"))
+	cfg := config.New()
+	cfg.Yes = true
+	s := newSyncGSuite(cfg, awsClient, googleClient, nil)
+
+	if err := s.SyncGroupsUsers(nil); err != nil {
+		t.Fatalf("SyncGroupsUsers() error = %v", err)
+	}
+
+	users, _ := awsClient.GetUsers()
+	var got []string
+	for _, u := range users {
+		got = append(got, u.Username)
+	}
+	if want := []string{"a@email.com", "b@email.com"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("users = %v, want %v", got, want)
+	}
+	dev, _ := awsClient.FindGroupByDisplayName("aws-dev")
+	groups, _ := awsClient.GetGroups()
+	if len(groups) != 1 || dev == nil || groups[0].ID != dev.ID {
+		t.Fatalf("groups = %s, want the existing aws-dev only", toJSON(groups))
+	}
+	members, _ := awsClient.GetGroupMembers(groups[0])
+	got = nil
+	for _, u := range members {
+		got = append(got, u.Username)
+	}
+	if want := []string{"a@email.com", "b@email.com"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("members = %v, want %v", got, want)
+	}
+}
+
+func TestSyncGroupsUsersIgnoresCase(t *testing.T) {
+	googleClient := googlefake.NewClient().
+		WithUsers(googlefake.User("a@email.com")).
+		WithGroup(googlefake.Group("aws-dev@email.com"), "a@email.com")
+	awsClient := awsfake.NewClient().
+		WithUsers(aws.NewUser("a", "a", "A@Email.com", true)).
+		WithGroup(aws.NewGroup("AWS-Dev"), "A@Email.com")
+	user, _ := awsClient.FindUserByEmail("A@Email.com")
+	group, _ := awsClient.FindGroupByDisplayName("AWS-Dev")
+	cfg := config.New()
+	cfg.Yes = true
+	s := newSyncGSuite(cfg, awsClient, googleClient, nil)
+
+	if err := s.SyncGroupsUsers(nil); err != nil {
+		t.Fatalf("SyncGroupsUsers() error = %v", err)
+	}
+
+	users, _ := awsClient.GetUsers()
+	if len(users) != 1 || users[0].ID != user.ID {
+		t.Errorf("users = %s, want the existing A@Email.com only", toJSON(users))
+	}
+	groups, _ := awsClient.GetGroups()
+	if len(groups) != 1 || groups[0].ID != group.ID {
+		t.Fatalf("groups = %s, want the existing AWS-Dev only", toJSON(groups))
+	}
+	members, _ := awsClient.GetGroupMembers(groups[0])
+	if len(members) != 1 || members[0].ID != user.ID {
+		t.Errorf("members = %s, want A@Email.com", toJSON(members))
+	}
+}
+
+// lookupCountingGoogleClient counts the users looked up and the lookups in
+// flight at once
+type lookupCountingGoogleClient struct {
+	google.Client
+	lookups, inFlight, maxInFlight int32
+}
+
+func (c *lookupCountingGoogleClient) GetUser(email string) (*admin.User, error) {
+	atomic.AddInt32(&c.lookups, 1)
+	n := atomic.AddInt32(&c.inFlight, 1)
+	defer atomic.AddInt32(&c.inFlight, -1)
+	for {
+		max := atomic.LoadInt32(&c.maxInFlight)
+		if n <= max || atomic.CompareAndSwapInt32(&c.maxInFlight, max, n) {
+			break
+		}
+	}
+	time.Sleep(10 * time.Millisecond)
+	return c.Client.GetUser(email)
+}
+
+func Test_getGoogleMembersUsers(t *testing.T) {
+	googleClient := &lookupCountingGoogleClient{Client: googlefake.NewClient().
+		WithUsers(googlefake.User("a@email.com"), googlefake.User("b@email.com"), googlefake.User("c@email.com")).
+		WithGroup(googlefake.Group("aws-dev@email.com"), "a@email.com", "b@email.com").
+		WithGroup(googlefake.Group("aws-ops@email.com"), "A@email.com", "c@email.com", "unknown@email.com")}
+	cfg := config.New()
+	cfg.GoogleConcurrency = 2
+	s := newSyncGSuite(cfg, nil, googleClient, nil)
+
+	groups, _ := googleClient.GetGroups("")
+	members, err := s.getGoogleGroupsMembers(groups)
+	if err != nil {
+		t.Fatalf("getGoogleGroupsMembers() error = %v", err)
+	}
+	users, err := s.getGoogleMembersUsers(members)
+	if err != nil {
+		t.Fatalf("getGoogleMembersUsers() error = %v", err)
+	}
+	var got []string
+	for email := range users {
+		got = append(got, email)
+	}
+	sort.Strings(got)
+	if want := []string{"a@email.com", "b@email.com", "c@email.com"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("getGoogleMembersUsers() = %v, want %v", got, want)
+	}
+	// every member is looked up once, concurrently
+	if googleClient.lookups != 4 {
+		t.Errorf("lookups = %d, want 4", googleClient.lookups)
+	}
+	if googleClient.maxInFlight != 2 {
+		t.Errorf("lookups in flight = %d, want 2", googleClient.maxInFlight)
+	}
+}
+
+func TestSyncGroupsUsersSetsGroupExternalID(t *testing.T) {
+	group := googlefake.Group("aws-dev@email.com")
+	group.Id = "0279ka6510ez4vx"
+	googleClient := googlefake.NewClient().
+		WithUsers(googlefake.User("a@email.com")).
+		WithGroup(group, "a@email.com")
+	awsClient := awsfake.NewClient()
+	cfg := config.New()
+	cfg.Yes = true
+
+	if err := newSyncGSuite(cfg, awsClient, googleClient, nil).SyncGroupsUsers(nil); err != nil {
+		t.Fatalf("SyncGroupsUsers() error = %v", err)
+	}
+	g, err := awsClient.FindGroupByDisplayName("aws-dev")
+	if err != nil {
+		t.Fatalf("FindGroupByDisplayName() error = %v", err)
+	}
+	if g.ExternalID != "0279ka6510ez4vx" || !g.Managed() {
+		t.Errorf("externalId = %q, want the id of the Google group", g.ExternalID)
+	}
+}
+
+func TestSkipSuspendedUsers(t *testing.T) {
+	suspended := googlefake.User("s@email.com")
+	suspended.Suspended = true
+	for _, method := range []string{config.DefaultSyncMethod, config.SyncMethodUsersGroups} {
+		googleClient := googlefake.NewClient().
+			WithUsers(googlefake.User("a@email.com"), suspended).
+			WithGroup(googlefake.Group("aws-dev@email.com"), "a@email.com", "s@email.com")
+		awsClient := awsfake.NewClient().
+			WithUsers(aws.NewUser("a", "a", "a@email.com", true), aws.NewUser("s", "s", "s@email.com", false)).
+			WithGroup(aws.NewGroup("aws-dev"), "a@email.com", "s@email.com")
+		cfg := config.New()
+		cfg.Yes = true
+		cfg.SkipSuspendedUsers = true
+		s := newSyncGSuite(cfg, awsClient, googleClient, nil)
+
+		var err error
+		if method == config.DefaultSyncMethod {
+			err = s.SyncGroupsUsers(nil)
+		} else {
+			err = s.SyncUsers("")
+		}
+		if err != nil {
+			t.Fatalf("%s: sync error = %v", method, err)
+		}
+		if _, err := awsClient.FindUserByEmail("s@email.com"); err != aws.ErrUserNotFound {
+			t.Errorf("%s: suspended user not deleted, error = %v", method, err)
+		}
+		if _, err := awsClient.FindUserByEmail("a@email.com"); err != nil {
+			t.Errorf("%s: active user error = %v", method, err)
+		}
+	}
+}
+
+func TestSyncUsersSuspensionKeepsAttributes(t *testing.T) {
+	suspended := googlefake.User("s@email.com")
+	suspended.Suspended = true
+	googleClient := googlefake.NewClient().WithUsers(suspended)
+	awsUser := aws.NewUser("s", "s", "s@email.com", true)
+	awsUser.Timezone = "Europe/London"
+	awsClient := awsfake.NewClient().WithUsers(awsUser)
+	cfg := config.New()
+	cfg.SyncMethod = config.SyncMethodUsersGroups
+
+	// the user is deactivated, the timezone isn't synced and is kept
+	if err := newSyncGSuite(cfg, awsClient, googleClient, nil).SyncUsers(""); err != nil {
+		t.Fatalf("SyncUsers() error = %v", err)
+	}
+	got, _ := awsClient.FindUserByEmail("s@email.com")
+	assert.False(t, got.Active)
+	assert.Equal(t, "Europe/London", got.Timezone)
+}
+
+func Test_userMappingPatchPaths(t *testing.T) {
+	cfg := config.New()
+	cfg.SyncLanguage = true
+	cfg.UserAttributes = []config.UserAttribute{
+		{Attribute: config.UserAttributeTimezone, Template: "Europe/London"},
+		{Attribute: config.UserAttributeCostCenter, Template: "R&D"},
+		{Attribute: config.UserAttributeGivenName, Template: "{{.Local}}"},
+	}
+	assert.Equal(t, []string{
+		"userName", "name", "displayName", "emails", "externalId", "active",
+		"preferredLanguage", "locale",
+		"timezone", aws.EnterpriseUserSchema + ":costCenter",
+	}, newUserMapping(cfg).patchPaths())
+}
+
+func TestSyncUsersIncludeUsers(t *testing.T) {
+	googleClient := googlefake.NewClient().WithUsers(
+		googlefake.User("a@email.com"),
+		googlefake.User("b@email.com"),
+		googlefake.User("ops-1@email.com"),
+		googlefake.User("ops-2@email.com"))
+	awsClient := awsfake.NewClient()
+	cfg := config.New()
+	cfg.SyncMethod = config.SyncMethodUsersGroups
+	cfg.IncludeUsers = []string{"a@email.com", "ops-*@email.com"}
+	cfg.IgnoreUsers = []string{"ops-2@email.com"}
+
+	if err := newSyncGSuite(cfg, awsClient, googleClient, nil).SyncUsers(""); err != nil {
+		t.Fatalf("SyncUsers() error = %v", err)
+	}
+	users, _ := awsClient.GetUsers()
+	var got []string
+	for _, u := range users {
+		got = append(got, u.Username)
+	}
+	sort.Strings(got)
+	if want := []string{"a@email.com", "ops-1@email.com"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("SyncUsers() users = %v, want %v", got, want)
+	}
+}
+
+func TestSyncGroupsUsersRenamesGroups(t *testing.T) {
+	group := googlefake.Group("aws-dev@email.com")
+	googleClient := googlefake.NewClient().
+		WithUsers(googlefake.User("a@email.com"), googlefake.User("b@email.com")).
+		WithGroup(group, "a@email.com", "b@email.com")
+	awsClient := awsfake.NewClient()
+	cfg := config.New()
+	cfg.Yes = true
+	if err := newSyncGSuite(cfg, awsClient, googleClient, nil).SyncGroupsUsers(nil); err != nil {
+		t.Fatalf("SyncGroupsUsers() error = %v", err)
+	}
+	before, _ := awsClient.FindGroupByDisplayName("aws-dev")
+
+	group.Name = "aws-developers"
+	s := newSyncGSuite(cfg, awsClient, googleClient, nil)
+	changes, err := s.getChanges(nil)
+	if err != nil {
+		t.Fatalf("getChanges() error = %v", err)
+	}
+	want := []state.Change{{Op: state.OpUpdate, Kind: state.KindGroup, Name: "aws-developers", From: "aws-dev"}}
+	if got := changes.records(); !reflect.DeepEqual(got, want) {
+		t.Errorf("records() = %v, want %v", got, want)
+	}
+	if err := s.SyncGroupsUsers(nil); err != nil {
+		t.Fatalf("SyncGroupsUsers() error = %v", err)
+	}
+	after, err := awsClient.FindGroupByDisplayName("aws-developers")
+	if err != nil {
+		t.Fatalf("FindGroupByDisplayName() error = %v", err)
+	}
+	if after.ID != before.ID {
+		t.Errorf("renamed group id = %s, want %s", after.ID, before.ID)
+	}
+	if ids, _ := awsClient.GetGroupMemberIDs(after); len(ids) != 2 {
+		t.Errorf("renamed group members = %v, want 2", ids)
+	}
+}
+
+func TestSyncGroupsUsersGroupNameAffixes(t *testing.T) {
+	group := googlefake.Group("aws-dev@email.com")
+	googleClient := googlefake.NewClient().
+		WithUsers(googlefake.User("a@email.com")).
+		WithGroup(group, "a@email.com")
+	awsClient := awsfake.NewClient()
+	cfg := config.New()
+	cfg.Yes = true
+	if err := newSyncGSuite(cfg, awsClient, googleClient, nil).SyncGroupsUsers(nil); err != nil {
+		t.Fatalf("SyncGroupsUsers() error = %v", err)
+	}
+	before, _ := awsClient.FindGroupByDisplayName("aws-dev")
+
+	// the group created without the affixes is renamed in place
+	cfg.GroupNamePrefix, cfg.GroupNameSuffix = "GW-", "-prod"
+	if err := newSyncGSuite(cfg, awsClient, googleClient, nil).SyncGroupsUsers(nil); err != nil {
+		t.Fatalf("SyncGroupsUsers() error = %v", err)
+	}
+	after, err := awsClient.FindGroupByDisplayName("GW-aws-dev-prod")
+	if err != nil {
+		t.Fatalf("FindGroupByDisplayName() error = %v", err)
+	}
+	if after.ID != before.ID {
+		t.Errorf("renamed group id = %s, want %s", after.ID, before.ID)
+	}
+	if group.Name != "aws-dev" {
+		t.Errorf("Google group name = %s, want it untouched", group.Name)
+	}
+
+	// and matched by the next runs
+	changes, err := newSyncGSuite(cfg, awsClient, googleClient, nil).getChanges(nil)
+	if err != nil {
+		t.Fatalf("getChanges() error = %v", err)
+	}
+	if got := changes.records(); len(got) != 0 {
+		t.Errorf("records() = %v, want none", got)
+	}
+}
+
+func Test_getGroupRenames(t *testing.T) {
+	dev := aws.NewManagedGroup("aws-dev", "id-dev")
+	ops := aws.NewManagedGroup("aws-ops", "id-ops")
+	unmanaged := aws.NewGroup("aws-qa")
+	sec := aws.NewManagedGroup("aws-sec", "aws-sec@example.com")
+	infra := aws.NewManagedGroup("aws-infra", "id-infra")
+	googleGroups := []*admin.Group{
+		{Id: "id-dev", Name: "aws-developers"},
+		{Id: "id-ops", Name: "aws-qa"},
+		{Id: "id-sec", Email: "AWS-Sec@example.com", Name: "aws-security"},
+		{Id: "id-infra", Name: "AWS-QA"},
+	}
+
+	groups, renames := getGroupRenames([]*aws.Group{dev, ops, unmanaged, sec, infra}, googleGroups)
+	var names []string
+	for _, g := range groups {
+		names = append(names, g.DisplayName)
+	}
+	// aws-ops and aws-infra aren't renamed to the name of another group,
+	// without case
+	if want := []string{"aws-developers", "aws-ops", "aws-qa", "aws-security", "aws-infra"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("getGroupRenames() groups = %v, want %v", names, want)
+	}
+	// aws-sec has the email of its Google group as external id
+	if want := []groupRename{{group: dev, name: "aws-developers"}, {group: sec, name: "aws-security"}}; !reflect.DeepEqual(renames, want) {
+		t.Errorf("getGroupRenames() renames = %v, want %v", renames, want)
+	}
+	if dev.DisplayName != "aws-dev" {
+		t.Errorf("getGroupRenames() modified the group, name = %s", dev.DisplayName)
+	}
+}
+
+func Test_getGoogleGroupsAndUsers(t *testing.T) {
+	group := googlefake.Group("aws-dev@email.com")
+	googleClient := googlefake.NewClient().
+		WithUsers(googlefake.User("a@email.com"), googlefake.User("b@email.com")).
+		WithGroup(group, "a@email.com", "B@email.com", "external@other.com")
+	for _, features := range [][]string{nil, {string(config.FeatureGoogleUsersList)}} {
+		cfg := config.New()
+		cfg.Features = features
+		s := newSyncGSuite(cfg, nil, googleClient, nil)
+
+		_, groupsUsers, err := s.getGoogleGroupsAndUsers([]*admin.Group{group})
+		if err != nil {
+			t.Fatalf("getGoogleGroupsAndUsers() features %v error = %v", features, err)
+		}
+		var got []string
+		for _, u := range groupsUsers["aws-dev"] {
+			got = append(got, u.PrimaryEmail)
+		}
+		if want := []string{"a@email.com", "b@email.com"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("getGoogleGroupsAndUsers() features %v members = %v, want %v", features, got, want)
+		}
+	}
+}
+
+func Test_allowedDomain(t *testing.T) {
+	tests := []struct {
+		domains []string
+		email   string
+		want    bool
+	}{
+		{nil, "guest@other.com", true},
+		{[]string{"corp.com", "corp.co.uk"}, "user@corp.com", true},
+		{[]string{"corp.com", "corp.co.uk"}, "user@CORP.co.uk", true},
+		{[]string{"corp.com"}, "guest@other.com", false},
+		{[]string{"corp.com"}, "user@eng.corp.com", false},
+		{[]string{"corp.com"}, "corp.com", false},
+	}
+	for _, tt := range tests {
+		cfg := config.New()
+		cfg.AllowedDomains = tt.domains
+		s := newSyncGSuite(cfg, nil, nil, nil)
+		if got := s.allowedDomain(tt.email); got != tt.want {
+			t.Errorf("allowedDomain(%q) with %v = %v, want %v", tt.email, tt.domains, got, tt.want)
+		}
+		if got := s.ignoreUser(tt.email); got == tt.want {
+			t.Errorf("ignoreUser(%q) with %v = %v, want %v", tt.email, tt.domains, got, !tt.want)
+		}
+	}
+}
+
+func Test_getGoogleGroupsAndUsersOrgUnits(t *testing.T) {
+	group := googlefake.Group("aws-dev@email.com")
+	inUnit := func(email string, unit string) *admin.User {
+		u := googlefake.User(email)
+		u.OrgUnitPath = unit
+		return u
+	}
+	googleClient := googlefake.NewClient().
+		WithUsers(
+			inUnit("a@email.com", "/Employees"),
+			inUnit("b@email.com", "/Employees/Interns"),
+			inUnit("c@email.com", "/Contractors"),
+			inUnit("d@email.com", "/EmployeesArchive")).
+		WithGroup(group, "a@email.com", "b@email.com", "c@email.com", "d@email.com")
+	tests := []struct {
+		name    string
+		include []string
+		ignore  []string
+		want    []string
+	}{
+		{"all", nil, nil, []string{"a@email.com", "b@email.com", "c@email.com", "d@email.com"}},
+		{"include", []string{"/employees"}, nil, []string{"a@email.com", "b@email.com"}},
+		{"ignore", nil, []string{"/Contractors", "/Employees/Interns/"}, []string{"a@email.com", "d@email.com"}},
+		{"include and ignore", []string{"/Employees"}, []string{"/Employees/Interns"}, []string{"a@email.com"}},
+		{"root", []string{"/"}, nil, []string{"a@email.com", "b@email.com", "c@email.com", "d@email.com"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.New()
+			cfg.IncludeOrgUnits, cfg.IgnoreOrgUnits = tt.include, tt.ignore
+			s := newSyncGSuite(cfg, nil, googleClient, nil)
+
+			_, groupsUsers, err := s.getGoogleGroupsAndUsers([]*admin.Group{group})
+			if err != nil {
+				t.Fatalf("getGoogleGroupsAndUsers() error = %v", err)
+			}
+			var got []string
+			for _, u := range groupsUsers["aws-dev"] {
+				got = append(got, u.PrimaryEmail)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("getGoogleGroupsAndUsers() members = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// membershipCountingAWSClient counts the membership checks, and may not
+// filter the groups by member
+type membershipCountingAWSClient struct {
+	aws.Client
+	noMemberGroups bool
+	checks         int
+}
+
+func (c *membershipCountingAWSClient) GetMemberGroupIDs(u *aws.User) ([]string, error) {
+	if c.noMemberGroups {
+		return nil, aws.ErrMembersNotSupported
+	}
+	return c.Client.GetMemberGroupIDs(u)
+}
+
+func (c *membershipCountingAWSClient) IsUserInGroup(u *aws.User, g *aws.Group) (bool, error) {
+	c.checks++
+	return c.Client.IsUserInGroup(u, g)
+}
+
+func TestSyncUserMemberGroups(t *testing.T) {
+	tests := []struct {
+		name           string
+		noMemberGroups bool
+		wantChecks     int
+	}{
+		{name: "groups filtered by member", wantChecks: 0},
+		{name: "membership of each group", noMemberGroups: true, wantChecks: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			googleClient := googlefake.NewClient().
+				WithUsers(googlefake.User("a@email.com"), googlefake.User("b@email.com")).
+				WithGroup(googlefake.Group("aws-dev@email.com"), "a@email.com").
+				WithGroup(googlefake.Group("aws-ops@email.com"), "b@email.com").
+				WithGroup(googlefake.Group("aws-qa@email.com"), "b@email.com")
+			fake := awsfake.NewClient()
+			cfg := config.New()
+			cfg.Yes = true
+			if err := newSyncGSuite(cfg, fake, googleClient, nil).SyncGroupsUsers(nil); err != nil {
+				t.Fatalf("SyncGroupsUsers() error = %v", err)
+			}
+
+			// a moves from aws-dev to aws-ops
+			googleClient.Members["id-aws-dev@email.com"] = nil
+			googleClient.Members["id-aws-ops@email.com"] = append(googleClient.Members["id-aws-ops@email.com"], &admin.Member{Email: "a@email.com", Type: "USER"})
+			awsClient := &membershipCountingAWSClient{Client: fake, noMemberGroups: tt.noMemberGroups}
+			if err := newSyncGSuite(cfg, awsClient, googleClient, nil).SyncUser("a@email.com", nil); err != nil {
+				t.Fatalf("SyncUser() error = %v", err)
+			}
+			if awsClient.checks != tt.wantChecks {
+				t.Errorf("IsUserInGroup() calls = %d, want %d", awsClient.checks, tt.wantChecks)
+			}
+			user, _ := fake.FindUserByEmail("a@email.com")
+			got, _ := fake.GetMemberGroupIDs(user)
+			ops, _ := fake.FindGroupByDisplayName("aws-ops")
+			if want := []string{ops.ID}; !reflect.DeepEqual(got, want) {
+				t.Errorf("groups of a@email.com = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestSyncUserKeepsAttributes(t *testing.T) {
+	googleClient := googlefake.NewClient().WithUsers(googlefake.User("a@email.com"))
+	awsUser := aws.NewUser("old", "old", "a@email.com", true)
+	awsUser.Timezone = "Europe/London"
+	awsClient := awsfake.NewClient().WithUsers(awsUser)
+	cfg := config.New()
+
+	// the email is matched without case, the name is updated, the timezone
+	// isn't synced and is kept
+	if err := newSyncGSuite(cfg, awsClient, googleClient, nil).SyncUser("A@email.com", nil); err != nil {
+		t.Fatalf("SyncUser() error = %v", err)
+	}
+	got, _ := awsClient.FindUserByEmail("a@email.com")
+	assert.Equal(t, "a", got.Name.GivenName)
+	assert.Equal(t, "Europe/London", got.Timezone)
+}
+
+func TestSyncGroupsUsersEmailChange(t *testing.T) {
+	renamed := googlefake.User("new@email.com")
+	renamed.Id = "id-1"
+	googleClient := googlefake.NewClient().
+		WithUsers(renamed, googlefake.User("b@email.com"), googlefake.User("c@email.com")).
+		WithGroup(googlefake.Group("aws-dev@email.com"), "new@email.com", "b@email.com", "c@email.com")
+	old := aws.NewUser("new", "new", "old@email.com", true)
+	old.ExternalID = "id-1"
+	awsClient := awsfake.NewClient().
+		WithUsers(old, aws.NewUser("b", "b", "b@email.com", true)).
+		WithGroup(aws.NewGroup("aws-dev"), "old@email.com", "b@email.com")
+	before, err := awsClient.FindUserByEmail("old@email.com")
+	assert.NoError(t, err)
+	cfg := config.New()
+	cfg.Yes = true
+
+	changes, err := newSyncGSuite(cfg, awsClient, googleClient, nil).getChanges(nil)
+	assert.NoError(t, err)
+	assert.Len(t, changes.addUsers, 1)
+	assert.Empty(t, changes.deleteUsers)
+	assert.Len(t, changes.addMembers["aws-dev"], 1)
+	assert.Empty(t, changes.removeMembers["aws-dev"])
+	var diff bytes.Buffer
+	assert.NoError(t, changes.write(&diff))
+	assert.Contains(t, diff.String(), "~ user   new@email.com (renamed from old@email.com)")
+
+	assert.NoError(t, newSyncGSuite(cfg, awsClient, googleClient, nil).SyncGroupsUsers(nil))
+	after, err := awsClient.FindUserByEmail("new@email.com")
+	assert.NoError(t, err)
+	assert.Equal(t, before.ID, after.ID)
+	assert.Equal(t, "new@email.com", after.Emails[0].Value)
+	group, err := awsClient.FindGroupByDisplayName("aws-dev")
+	assert.NoError(t, err)
+	members, err := awsClient.GetGroupMemberIDs(group)
+	assert.NoError(t, err)
+	assert.Contains(t, members, after.ID)
+	// the users created have the id of their Google user as external id
+	created, err := awsClient.FindUserByEmail("c@email.com")
+	assert.NoError(t, err)
+	assert.Equal(t, "id-c@email.com", created.ExternalID)
+
+	changes, err = newSyncGSuite(cfg, awsClient, googleClient, nil).getChanges(nil)
+	assert.NoError(t, err)
+	assert.Empty(t, changes.updateUsers)
+}
+
+func TestSyncGroupsUsersEmailChangeAlias(t *testing.T) {
+	renamed := googlefake.User("new@email.com")
+	renamed.Aliases = []string{"old@email.com"}
+	other := googlefake.User("b@email.com")
+	other.Aliases = []string{"other@email.com"}
+	googleClient := googlefake.NewClient().
+		WithUsers(renamed, other).
+		WithGroup(googlefake.Group("aws-dev@email.com"), "new@email.com", "b@email.com")
+	// created before the external ids were set
+	old := aws.NewUser("new", "new", "old@email.com", true)
+	// the user of another Google user, which isn't b@email.com
+	taken := aws.NewUser("other", "other", "other@email.com", true)
+	taken.ExternalID = "id-other"
+	awsClient := awsfake.NewClient().
+		WithUsers(old, taken).
+		WithGroup(aws.NewGroup("aws-dev"), "old@email.com")
+	before, err := awsClient.FindUserByEmail("old@email.com")
+	assert.NoError(t, err)
+	cfg := config.New()
+	cfg.Yes = true
+
+	changes, err := newSyncGSuite(cfg, awsClient, googleClient, nil).getChanges(nil)
+	assert.NoError(t, err)
+	assert.Len(t, changes.addUsers, 1)
+	assert.Equal(t, "b@email.com", changes.addUsers[0].Username)
+	assert.Len(t, changes.deleteUsers, 1)
+	assert.Equal(t, "other@email.com", changes.deleteUsers[0].Username)
+	assert.Empty(t, changes.removeMembers["aws-dev"])
+	var diff bytes.Buffer
+	assert.NoError(t, changes.write(&diff))
+	assert.Contains(t, diff.String(), "~ user   new@email.com (renamed from old@email.com)")
+
+	assert.NoError(t, newSyncGSuite(cfg, awsClient, googleClient, nil).SyncGroupsUsers(nil))
+	after, err := awsClient.FindUserByEmail("new@email.com")
+	assert.NoError(t, err)
+	assert.Equal(t, before.ID, after.ID)
+	assert.Equal(t, "id-new@email.com", after.ExternalID)
+}
+
+func TestSyncUsersEmailChangeAlias(t *testing.T) {
+	renamed := googlefake.User("new@email.com")
+	renamed.Aliases = []string{"old@email.com"}
+	googleClient := googlefake.NewClient().WithUsers(renamed)
+	awsClient := awsfake.NewClient().WithUsers(aws.NewUser("new", "new", "old@email.com", true))
+	before, err := awsClient.FindUserByEmail("old@email.com")
+	assert.NoError(t, err)
+	cfg := config.New()
+	cfg.SyncMethod = config.SyncMethodUsersGroups
+
+	assert.NoError(t, newSyncGSuite(cfg, awsClient, googleClient, nil).SyncUsers(""))
+	users, err := awsClient.GetUsers()
+	assert.NoError(t, err)
+	assert.Len(t, users, 1)
+	assert.Equal(t, before.ID, users[0].ID)
+	assert.Equal(t, "new@email.com", users[0].Username)
+}
+
+func TestSyncGroupsUsersBackfillsExternalID(t *testing.T) {
+	googleClient := googlefake.NewClient().
+		WithUsers(googlefake.User("a@email.com"), googlefake.User("b@email.com")).
+		WithGroup(googlefake.Group("aws-dev@email.com"), "a@email.com", "b@email.com")
+	other := syncedUser("b@email.com")
+	other.ExternalID = "hr-42"
+	// a was created by an earlier version, b by another tool
+	awsClient := awsfake.NewClient().
+		WithUsers(aws.NewUser("a", "a", "a@email.com", true), other).
+		WithGroup(aws.NewGroup("aws-dev"), "a@email.com", "b@email.com")
+	cfg := config.New()
+	cfg.Yes = true
+
+	changes, err := newSyncGSuite(cfg, awsClient, googleClient, nil).getChanges(nil)
+	assert.NoError(t, err)
+	if assert.Len(t, changes.updateUsers, 1) {
+		assert.Equal(t, "a@email.com", changes.updateUsers[0].Username)
+	}
+
+	assert.NoError(t, newSyncGSuite(cfg, awsClient, googleClient, nil).SyncGroupsUsers(nil))
+	a, err := awsClient.FindUserByEmail("a@email.com")
+	assert.NoError(t, err)
+	assert.Equal(t, "id-a@email.com", a.ExternalID)
+	b, err := awsClient.FindUserByEmail("b@email.com")
+	assert.NoError(t, err)
+	assert.Equal(t, "hr-42", b.ExternalID)
+
+	changes, err = newSyncGSuite(cfg, awsClient, googleClient, nil).getChanges(nil)
+	assert.NoError(t, err)
+	assert.Empty(t, changes.updateUsers)
+}
@@ -0,0 +1,289 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/awslabs/ssosync/internal/aws"
+	"github.com/awslabs/ssosync/internal/config"
+	"github.com/awslabs/ssosync/internal/state"
+
+	log "github.com/sirupsen/logrus"
+	admin "google.golang.org/api/admin/directory/v1"
+)
+
+// SyncUser reconciles a single user of Google Workspace with AWS SSO: the
+// user is created or updated, then added to or removed from the groups in
+// scope, i.e. matching any of queries and not ignored. Groups out of scope are left
+// untouched, and a user missing in Google Workspace is not deleted, this is
+// done by a full sync only.
+func (s *syncGSuite) SyncUser(email string, queries []string) error {
+	log := log.WithField("user", email)
+	if s.ignoreUser(email) {
+		return fmt.Errorf("user %s is ignored by the configuration", email)
+	}
+	log.Info("get google user")
+	googleUsers, err := s.google.GetUsers("email:" + email)
+	if err != nil {
+		log.Warn("Error getting Google user")
+		return err
+	}
+	var gUser *admin.User
+	for _, u := range googleUsers {
+		if aws.NormalizeName(u.PrimaryEmail) == aws.NormalizeName(email) {
+			gUser = u
+		}
+	}
+	if gUser == nil {
+		log.Error("User not found in Google")
+		return fmt.Errorf("user %s not found in Google Workspace, it can only be deleted by a full sync", email)
+	}
+	if reason := s.outOfScope(gUser); reason != "" {
+		return fmt.Errorf("user %s is out of scope by its %s", email, reason)
+	}
+	kept, _, err := s.handleMissingNames([]*admin.User{gUser})
+	if err != nil {
+		return err
+	}
+	if len(kept) > 0 {
+		kept, _, err = s.handleOversizedAttributes(kept)
+		if err != nil {
+			return err
+		}
+	}
+	if len(kept) == 0 {
+		return nil
+	}
+	if err := s.checkAWSUserName(gUser); err != nil {
+		return err
+	}
+
+	awsUser, err := s.syncUserAttributes(gUser)
+	if err != nil {
+		return err
+	}
+
+	googleGroups, err := s.getGoogleGroups(queries)
+	if err != nil {
+		return err
+	}
+	memberGroupIDs, err := s.awsMemberGroupIDs(awsUser)
+	if err != nil {
+		return err
+	}
+	policies := newGroupPolicies(s.cfg.GroupPolicies, googleGroups)
+	// the removals are deferred while a blackout window is open, like by a
+	// full sync, see deferDestructiveChanges
+	now := time.Now()
+	window, err := openBlackoutWindow(s.cfg.BlackoutWindows, now)
+	if err != nil {
+		log.WithError(err).Error("Invalid blackout window")
+		return err
+	}
+	for _, g := range googleGroups {
+		log := log.WithField("group", g.Name)
+		if s.ignoreGroup(g.Email) {
+			log.Debug("ignoring group")
+			continue
+		}
+		member, err := s.google.HasMember(g.Id, email)
+		if err != nil {
+			log.Warn("Error checking group membership in Google")
+			return err
+		}
+		awsGroup, err := s.aws.FindGroupByDisplayName(g.Name)
+		if err != nil && !errors.Is(err, aws.ErrGroupNotFound) {
+			log.Warn("Error finding group in AWS")
+			return err
+		}
+		if errors.Is(err, aws.ErrGroupNotFound) {
+			// the group may have been renamed in Google
+			awsGroup, err = s.findRenamedGroup(g)
+			if err != nil {
+				return err
+			}
+		}
+		if awsGroup == nil {
+			if !member {
+				continue
+			}
+			log.Info("creating group")
+			awsGroup, err = s.aws.CreateGroup(aws.NewManagedGroup(g.Name, g.Id))
+			if err != nil {
+				log.Error("creating group")
+				return err
+			}
+		}
+		inGroup := memberGroupIDs[awsGroup.ID]
+		if memberGroupIDs == nil {
+			inGroup, err = s.aws.IsUserInGroup(awsUser, awsGroup)
+			if err != nil {
+				log.Warn("Error checking group membership in AWS")
+				return err
+			}
+		}
+		if member != inGroup && !awsGroup.ManagedFor(g.Id) {
+			log.Warn("Group about to be modified was not created by ssosync, it has neither the id of its Google group nor the ssosync marker as external id")
+		}
+		switch {
+		case member && !inGroup:
+			log.Info("adding user to group")
+			if err := s.aws.AddUserToGroup(awsUser, awsGroup); err != nil {
+				log.Warn("Error adding user to group in AWS")
+				return err
+			}
+		case !member && inGroup && policies.protected(g.Name, neverDeleteMembers):
+			log.Warn("Removal protected by group policy, skipping it")
+		case !member && inGroup && window != nil:
+			c := state.Change{Op: state.OpDelete, Kind: state.KindMember, Name: awsUser.Username, Group: awsGroup.DisplayName}
+			if _, ok := s.state.Deferred[c.Key()]; !ok {
+				s.state.Deferred[c.Key()] = &state.Deferred{Change: c, Since: now}
+			}
+			log.WithField("window", window.String()).Warn("Destructive change deferred by blackout window")
+		case !member && inGroup:
+			log.Warn("removing user from group")
+			if err := s.aws.RemoveUserFromGroup(awsUser, awsGroup); err != nil {
+				log.Warn("Error removing user from group in AWS")
+				return err
+			}
+		default:
+			log.WithField("member", member).Debug("Group membership matches in AWS and Google")
+		}
+	}
+	s.state.SetUser(gUser.PrimaryEmail, gUser.Etag, awsUser.ID)
+	log.Info("User synced successfully")
+	return nil
+}
+
+// awsMemberGroupIDs returns the ids of the AWS groups u is a member of, read
+// with a single request, or nil when the SCIM endpoint doesn't filter the
+// groups by member and the membership of each group must be checked
+func (s *syncGSuite) awsMemberGroupIDs(u *aws.User) (map[string]bool, error) {
+	if s.memberGroupsNotSupported {
+		return nil, nil
+	}
+	ids, err := s.aws.GetMemberGroupIDs(u)
+	if errors.Is(err, aws.ErrMembersNotSupported) {
+		log.Info("SCIM endpoint doesn't filter groups by member, checking the membership of each group")
+		s.memberGroupsNotSupported = true
+		return nil, nil
+	}
+	if err != nil {
+		log.WithField("user", u.Username).Warn("Error getting user groups from AWS")
+		return nil, err
+	}
+	groups := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		groups[id] = true
+	}
+	return groups, nil
+}
+
+// findRenamedGroup returns the AWS group of the Google group g, with the id of
+// g as external id, renamed after g, nil when there is none
+func (s *syncGSuite) findRenamedGroup(g *admin.Group) (*aws.Group, error) {
+	awsGroups, err := s.aws.GetGroups()
+	if err != nil {
+		log.Error("error getting aws groups")
+		return nil, err
+	}
+	_, renames := getGroupRenames(awsGroups, []*admin.Group{g})
+	if len(renames) == 0 {
+		return nil, nil
+	}
+	r := renames[0]
+	log := log.WithFields(log.Fields{"group": r.group.DisplayName, "name": r.name})
+	log.Warn("renaming group")
+	if err := s.aws.RenameGroup(r.group, r.name); err != nil {
+		log.Error("renaming group")
+		return nil, err
+	}
+	renamed := *r.group
+	renamed.DisplayName = r.name
+	return &renamed, nil
+}
+
+// syncUserAttributes creates the Google user in AWS, or updates its
+// attributes when they differ, and returns the AWS user
+func (s *syncGSuite) syncUserAttributes(gUser *admin.User) (*aws.User, error) {
+	log := log.WithField("user", gUser.PrimaryEmail)
+	awsUser, err := s.aws.FindUserByEmail(gUser.PrimaryEmail)
+	if err != nil && !errors.Is(err, aws.ErrUserNotFound) {
+		log.Warn("Error finding user in AWS")
+		return nil, err
+	}
+	if errors.Is(err, aws.ErrUserNotFound) {
+		log.Info("creating user")
+		awsUser, err = s.aws.CreateUser(s.mapping.user(gUser, s.awsUserID))
+		if err != nil {
+			log.Error("error creating user")
+			return nil, err
+		}
+		log.Info("User created successfully in AWS")
+		return awsUser, nil
+	}
+	want := s.mapping.user(gUser, s.awsUserID)
+	if userHash(awsUser, s.mapping) != userHash(want, s.mapping) {
+		log.Info("User attributes mismatch, updating user")
+		// the user keeps the attributes ssosync doesn't sync
+		update := *awsUser
+		s.mapping.update(&update, want)
+		_, err = s.aws.UpdateUser(&update)
+		if err != nil {
+			log.Error("error updating user")
+			return nil, err
+		}
+		log.Info("User updated successfully in AWS")
+	}
+	return awsUser, nil
+}
+
+// DoSyncUser reconciles a single user, see SyncUser
+func DoSyncUser(ctx context.Context, cfg *config.Config, email string) error {
+	if cfg.SyncMethod != config.DefaultSyncMethod {
+		return fmt.Errorf("syncing a single user is only supported with the %q sync method", config.DefaultSyncMethod)
+	}
+	if cfg.RunID == "" {
+		cfg.RunID = newRunID()
+	}
+	log.WithFields(log.Fields{
+		"runId": cfg.RunID,
+		"user":  email,
+	}).Info("Starting single user synchronization")
+	googleClient, awsClient, err := newClients(ctx, cfg, false, nil)
+	if err != nil {
+		return err
+	}
+	store, st, err := loadState(cfg)
+	if err != nil {
+		return err
+	}
+	c := New(cfg, awsClient, googleClient, st)
+	if err := c.SyncUser(email, cfg.GroupMatch); err != nil {
+		log.WithError(err).Error("Error synchronizing user")
+		return err
+	}
+	if store != nil {
+		if err := store.Save(st); err != nil {
+			log.WithError(err).Error("Error saving state")
+			return err
+		}
+	}
+	return nil
+}
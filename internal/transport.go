@@ -0,0 +1,118 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"fmt"
+	"net/http"
+	"sync/atomic"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// providerRequestIDHeaders are the response headers in which AWS and Google
+// return the identifier of a request
+var providerRequestIDHeaders = []string{
+	"X-Amzn-Requestid",
+	"X-Amz-Request-Id",
+	"X-Goog-Request-Id",
+}
+
+// requestIDTransport sets a descriptive User-Agent and a unique X-Request-ID
+// on every outgoing request, and logs the request IDs of failed requests so
+// they can be correlated with the provider's support.
+type requestIDTransport struct {
+	base      http.RoundTripper
+	userAgent string
+	runID     string
+	count     uint64
+}
+
+func newRequestIDTransport(base http.RoundTripper, version string, runID string) *requestIDTransport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &requestIDTransport{
+		base:      base,
+		userAgent: fmt.Sprintf("ssosync/%s (run %s)", version, runID),
+		runID:     runID,
+	}
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *requestIDTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	requestID := fmt.Sprintf("%s-%d", t.runID, atomic.AddUint64(&t.count, 1))
+
+	// the request must not be modified, see http.RoundTripper
+	r := req.Clone(req.Context())
+	if ua := r.Header.Get("User-Agent"); ua != "" {
+		r.Header.Set("User-Agent", t.userAgent+" "+ua)
+	} else {
+		r.Header.Set("User-Agent", t.userAgent)
+	}
+	r.Header.Set("X-Request-ID", requestID)
+
+	resp, err := t.base.RoundTrip(r)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"method":    r.Method,
+			"host":      r.URL.Host,
+			"requestId": requestID,
+		}).WithError(err).Warn("HTTP request failed")
+		return resp, err
+	}
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		fields := log.Fields{
+			"method":    r.Method,
+			"host":      r.URL.Host,
+			"path":      r.URL.Path,
+			"status":    resp.StatusCode,
+			"requestId": requestID,
+		}
+		if id := providerRequestID(resp.Header); id != "" {
+			fields["providerRequestId"] = id
+		}
+		log.WithFields(fields).Warn("HTTP request returned an error status")
+	}
+
+	return resp, nil
+}
+
+// hostTransport sends the requests to host with its own transport, e.g. the
+// tuned pool of connections to AWS SSO, and the others with base
+type hostTransport struct {
+	host string
+	own  http.RoundTripper
+	base http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *hostTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Host == t.host {
+		return t.own.RoundTrip(req)
+	}
+	return t.base.RoundTrip(req)
+}
+
+// providerRequestID returns the request ID set by the provider on a response
+func providerRequestID(h http.Header) string {
+	for _, k := range providerRequestIDHeaders {
+		if v := h.Get(k); v != "" {
+			return v
+		}
+	}
+	return ""
+}
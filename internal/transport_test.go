@@ -0,0 +1,76 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_requestIDTransport(t *testing.T) {
+	var got []*http.Request
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = append(got, r)
+		w.Header().Set("X-Amzn-Requestid", "aws-request-id")
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	c := &http.Client{Transport: newRequestIDTransport(nil, "1.0.0", "run1")}
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+	req.Header.Set("User-Agent", "google-api-go-client/0.5")
+	resp, err := c.Do(req)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, "aws-request-id", providerRequestID(resp.Header))
+
+	req, _ = http.NewRequest(http.MethodGet, srv.URL, nil)
+	resp, err = c.Do(req)
+	assert.NoError(t, err)
+	resp.Body.Close()
+
+	assert.Len(t, got, 2)
+	assert.Equal(t, "ssosync/1.0.0 (run run1) google-api-go-client/0.5", got[0].Header.Get("User-Agent"))
+	assert.Equal(t, "run1-1", got[0].Header.Get("X-Request-ID"))
+	assert.Equal(t, "ssosync/1.0.0 (run run1)", got[1].Header.Get("User-Agent"))
+	assert.Equal(t, "run1-2", got[1].Header.Get("X-Request-ID"))
+}
+
+func Test_hostTransport(t *testing.T) {
+	var scim, other int
+	scimSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { scim++ }))
+	defer scimSrv.Close()
+	otherSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { other++ }))
+	defer otherSrv.Close()
+
+	u, _ := url.Parse(scimSrv.URL)
+	c := &http.Client{Transport: &hostTransport{
+		host: u.Host,
+		own:  sharedSCIMTransport(scimTransportOptions{maxConns: 1}),
+		base: sharedTransport(),
+	}}
+	for _, target := range []string{scimSrv.URL, otherSrv.URL, scimSrv.URL} {
+		resp, err := c.Get(target)
+		assert.NoError(t, err)
+		resp.Body.Close()
+	}
+	assert.Equal(t, 2, scim)
+	assert.Equal(t, 1, other)
+}
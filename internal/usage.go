@@ -0,0 +1,139 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"context"
+	"net/http"
+	"runtime"
+	"sync/atomic"
+	"time"
+
+	"github.com/awslabs/ssosync/internal/state"
+	log "github.com/sirupsen/logrus"
+)
+
+// usage meters the requests a run sends to Google and AWS. A call is a
+// request made by a client, which the transports below it may hold to stay
+// under the rate limits and send several times when it is retried; each
+// attempt sent is a request. The calls and requests are timed, the time a
+// call took beyond its requests is the time it waited on rate limits and
+// between retries. The peak of the heap in use is sampled too. The methods
+// do nothing on a nil usage.
+type usage struct {
+	calls       int64
+	callTime    int64
+	requests    int64
+	requestTime int64
+	peakHeap    uint64
+}
+
+// memorySampleInterval is the interval between two samples of the heap in
+// use, reading the statistics stops the world for a few microseconds
+const memorySampleInterval = 100 * time.Millisecond
+
+// sampleMemory samples the heap in use every interval until ctx is done
+func (u *usage) sampleMemory(ctx context.Context, interval time.Duration) {
+	if u == nil {
+		return
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		u.sampleHeap()
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// sampleHeap samples the heap in use, and returns its peak so far
+func (u *usage) sampleHeap() uint64 {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	for {
+		peak := atomic.LoadUint64(&u.peakHeap)
+		if m.HeapInuse <= peak {
+			return peak
+		}
+		if atomic.CompareAndSwapUint64(&u.peakHeap, peak, m.HeapInuse) {
+			return m.HeapInuse
+		}
+	}
+}
+
+// callTransport returns base metering the calls of the clients
+func (u *usage) callTransport(base http.RoundTripper) http.RoundTripper {
+	if u == nil {
+		return base
+	}
+	return &meteredTransport{base: base, count: &u.calls, elapsed: &u.callTime}
+}
+
+// requestTransport returns base metering the requests actually sent
+func (u *usage) requestTransport(base http.RoundTripper) http.RoundTripper {
+	if u == nil {
+		return base
+	}
+	return &meteredTransport{base: base, count: &u.requests, elapsed: &u.requestTime}
+}
+
+// report logs and returns the resources used by the run so far, nil when
+// u is nil
+func (u *usage) report() *state.Usage {
+	if u == nil {
+		return nil
+	}
+	calls, requests := atomic.LoadInt64(&u.calls), atomic.LoadInt64(&u.requests)
+	retries := requests - calls
+	if retries < 0 {
+		retries = 0
+	}
+	wait := time.Duration(atomic.LoadInt64(&u.callTime) - atomic.LoadInt64(&u.requestTime))
+	if wait < 0 {
+		wait = 0
+	}
+	r := &state.Usage{
+		Requests:            requests,
+		Retries:             retries,
+		ThrottleWaitSeconds: wait.Seconds(),
+		PeakMemoryBytes:     u.sampleHeap(),
+	}
+	log.WithFields(log.Fields{
+		"requests":        r.Requests,
+		"retries":         r.Retries,
+		"throttleWait":    wait.Round(time.Millisecond).String(),
+		"peakMemoryBytes": r.PeakMemoryBytes,
+	}).Info("Resource usage of the run")
+	return r
+}
+
+// meteredTransport counts and times the requests sent with base
+type meteredTransport struct {
+	base    http.RoundTripper
+	count   *int64
+	elapsed *int64
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *meteredTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.base.RoundTrip(req)
+	atomic.AddInt64(t.count, 1)
+	atomic.AddInt64(t.elapsed, int64(time.Since(start)))
+	return resp, err
+}
@@ -0,0 +1,83 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// retryingTransport sends every request twice, waiting before the retry
+type retryingTransport struct {
+	base http.RoundTripper
+	wait time.Duration
+}
+
+func (t *retryingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	time.Sleep(t.wait)
+	return t.base.RoundTrip(req)
+}
+
+func Test_usage(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	u := &usage{}
+	c := &http.Client{Transport: u.callTransport(&retryingTransport{
+		base: u.requestTransport(http.DefaultTransport),
+		wait: 20 * time.Millisecond,
+	})}
+	for i := 0; i < 3; i++ {
+		resp, err := c.Get(srv.URL)
+		assert.NoError(t, err)
+		resp.Body.Close()
+	}
+
+	r := u.report()
+	assert.Equal(t, int64(6), r.Requests)
+	assert.Equal(t, int64(3), r.Retries)
+	assert.True(t, r.ThrottleWaitSeconds >= 0.06, "waited %fs", r.ThrottleWaitSeconds)
+	assert.NotZero(t, r.PeakMemoryBytes)
+
+	// the heap sampled is the peak one
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		u.sampleMemory(ctx, time.Millisecond)
+		close(done)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+	<-done
+	peak := atomic.LoadUint64(&u.peakHeap)
+	assert.NotZero(t, peak)
+	assert.True(t, u.report().PeakMemoryBytes >= peak)
+
+	// a nil usage meters nothing
+	var none *usage
+	assert.True(t, none.callTransport(http.DefaultTransport) == http.DefaultTransport)
+	assert.Nil(t, none.report())
+}
@@ -0,0 +1,324 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/awslabs/ssosync/internal/aws"
+	"github.com/awslabs/ssosync/internal/config"
+	"github.com/awslabs/ssosync/internal/google"
+	admin "google.golang.org/api/admin/directory/v1"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// userMapping derives the AWS users from the Google users: the attributes
+// of aws.NewUser, the extended attributes with --sync-extended-attributes
+// and the templates of user_attributes over them. The zero value is the
+// default mapping.
+type userMapping struct {
+	// extended syncs the extended attributes, see withExtendedAttributes
+	extended bool
+	// language syncs the preferred language, see withLanguage
+	language bool
+	// aliases syncs the aliases as emails, see withAliases
+	aliases bool
+	// templates are the templates of user_attributes, in their order
+	templates []attributeTemplate
+	// userName is the template of the user names with --user-name, nil
+	// when the users are named after their email
+	userName *template.Template
+}
+
+// attributeTemplate is the template of a SCIM attribute
+type attributeTemplate struct {
+	attribute string
+	tmpl      *template.Template
+}
+
+// userTemplateData holds the fields of the templates of user_attributes
+type userTemplateData struct {
+	// Email is the primary email of the user
+	Email string
+	// Local is the part of the email before the @
+	Local string
+	// GivenName is the given name of the user
+	GivenName string
+	// FamilyName is the family name of the user
+	FamilyName string
+	// ID is the id of the Google user
+	ID string
+	// CustomSchemas are the custom schemas of the user, read when the
+	// source of an attribute is one of their fields, see customSchemas.Field
+	CustomSchemas customSchemas
+	// User is the Google user, for its other fields, e.g. .User.OrgUnitPath
+	User *admin.User
+}
+
+// newUserMapping returns the user mapping of cfg, the invalid templates,
+// reported by the lint, are left out
+func newUserMapping(cfg *config.Config) *userMapping {
+	m := &userMapping{extended: cfg.SyncExtendedAttributes, language: cfg.SyncLanguage, aliases: cfg.SyncAliases}
+	for _, a := range cfg.UserAttributes {
+		tmpl, err := a.Parse()
+		if err != nil {
+			log.WithError(err).Warn("Invalid user attribute, using the default mapping")
+			continue
+		}
+		m.templates = append(m.templates, attributeTemplate{attribute: a.Attribute, tmpl: tmpl})
+	}
+	userName, err := config.ParseUserName(cfg.UserName)
+	if err != nil {
+		log.WithError(err).Warn("Invalid user name, naming the users after their email")
+	}
+	m.userName = userName
+	return m
+}
+
+// patchPaths returns the paths of the SCIM attributes m syncs, the ones a
+// PATCH request may remove, see aws.Config.ManagedPaths
+func (m *userMapping) patchPaths() []string {
+	paths := []string{"userName", "name", "displayName", "emails", "externalId", "active"}
+	if m.extended {
+		paths = append(paths, "phoneNumbers", "title", "addresses", aws.EnterpriseUserSchema)
+	}
+	if m.language {
+		paths = append(paths, "preferredLanguage", "locale")
+	}
+	for _, t := range m.templates {
+		switch {
+		case strings.HasPrefix(t.attribute, "name."):
+			// name is replaced whole, it is already managed
+		case t.attribute == config.UserAttributeEmail:
+		case strings.HasPrefix(t.attribute, "enterprise."):
+			paths = append(paths, aws.EnterpriseUserSchema+":"+strings.TrimPrefix(t.attribute, "enterprise."))
+		default:
+			paths = append(paths, t.attribute)
+		}
+	}
+	return paths
+}
+
+// user returns the AWS user of the Google user gUser, see
+// withExtendedAttributes for managerID. A template failing for gUser leaves
+// the default value of its attribute. The display name follows the given
+// and family names of the templates, unless it has a template too. With a
+// user name template, the user name is its SCIMUserName, the email when the
+// template fails or is empty.
+func (m *userMapping) user(gUser *admin.User, managerID func(email string) string) *aws.User {
+	// the archived users in scope are deactivated, see --archived-users
+	u := aws.NewUser(gUser.Name.GivenName, gUser.Name.FamilyName, gUser.PrimaryEmail, google.StatusOf(gUser) == google.UserActive)
+	u.ExternalID = gUser.Id
+	if m.extended {
+		withExtendedAttributes(u, gUser, managerID)
+	}
+	if m.language {
+		withLanguage(u, gUser)
+	}
+	if m.aliases {
+		withAliases(u, gUser)
+	}
+	if len(m.templates) == 0 && m.userName == nil {
+		return u
+	}
+	data := userTemplateData{
+		Email:         gUser.PrimaryEmail,
+		Local:         strings.SplitN(gUser.PrimaryEmail, "@", 2)[0],
+		GivenName:     gUser.Name.GivenName,
+		FamilyName:    gUser.Name.FamilyName,
+		ID:            gUser.Id,
+		CustomSchemas: gUser.CustomSchemas,
+		User:          gUser,
+	}
+	if m.userName != nil {
+		u.SCIMUserName = gUser.PrimaryEmail
+		var b strings.Builder
+		switch err := m.userName.Execute(&b, data); {
+		case err != nil:
+			log.WithField("user", gUser.PrimaryEmail).WithError(err).Warn("Cannot execute the template of the user name, using the email")
+		case strings.TrimSpace(b.String()) == "":
+			log.WithField("user", gUser.PrimaryEmail).Warn("Empty user name, using the email")
+		default:
+			u.SCIMUserName = strings.TrimSpace(b.String())
+		}
+	}
+	if len(m.templates) == 0 {
+		return u
+	}
+	displayName := false
+	for _, t := range m.templates {
+		var b strings.Builder
+		if err := t.tmpl.Execute(&b, data); err != nil {
+			log.WithFields(log.Fields{
+				"user":      gUser.PrimaryEmail,
+				"attribute": t.attribute,
+			}).WithError(err).Warn("Cannot execute the template of the user attribute, using the default value")
+			continue
+		}
+		setUserAttribute(u, t.attribute, b.String())
+		displayName = displayName || t.attribute == config.UserAttributeDisplayName
+	}
+	if !displayName {
+		setUserAttribute(u, config.UserAttributeDisplayName, u.Name.GivenName+" "+u.Name.FamilyName)
+	}
+	return u
+}
+
+// update sets the attributes of src synced by m to dst, the other
+// attributes of dst are kept. The external id of dst is only set when it
+// has none.
+func (m *userMapping) update(dst *aws.User, src *aws.User) {
+	dst.Username = src.Username
+	if m.userName != nil {
+		dst.SCIMUserName = src.SCIMUserName
+	}
+	setUserAttribute(dst, config.UserAttributeEmail, userAttribute(src, config.UserAttributeEmail))
+	if dst.ExternalID == "" {
+		dst.ExternalID = src.ExternalID
+	}
+	dst.Name = src.Name
+	dst.DisplayName = src.DisplayName
+	dst.Active = src.Active
+	if m.extended {
+		copyExtendedAttributes(dst, src)
+	}
+	if m.language {
+		dst.PreferredLanguage, dst.Locale = src.PreferredLanguage, src.Locale
+	}
+	if m.aliases {
+		copyAliases(dst, src)
+	}
+	for _, t := range m.templates {
+		setUserAttribute(dst, t.attribute, userAttribute(src, t.attribute))
+	}
+}
+
+// hashed returns the attributes of the templates of m which userHash
+// doesn't hash by default, with their values in u
+func (m *userMapping) hashed(u *aws.User) string {
+	var b strings.Builder
+	for _, t := range m.templates {
+		switch t.attribute {
+		case config.UserAttributeGivenName, config.UserAttributeFamilyName:
+		default:
+			fmt.Fprintf(&b, " %s=%q", t.attribute, userAttribute(u, t.attribute))
+		}
+	}
+	return b.String()
+}
+
+// userAttribute returns the value of attribute, one of
+// config.UserAttributeNames, of u
+func userAttribute(u *aws.User, attribute string) string {
+	switch attribute {
+	case config.UserAttributeGivenName:
+		return u.Name.GivenName
+	case config.UserAttributeFamilyName:
+		return u.Name.FamilyName
+	case config.UserAttributeDisplayName:
+		return u.DisplayName
+	case config.UserAttributeEmail:
+		for _, e := range u.Emails {
+			if e.Primary {
+				return e.Value
+			}
+		}
+		return ""
+	case config.UserAttributeTitle:
+		return u.Title
+	case config.UserAttributePreferredLanguage:
+		return u.PreferredLanguage
+	case config.UserAttributeLocale:
+		return u.Locale
+	case config.UserAttributeTimezone:
+		return u.Timezone
+	}
+	if u.Enterprise == nil {
+		return ""
+	}
+	switch attribute {
+	case config.UserAttributeEmployeeNumber:
+		return u.Enterprise.EmployeeNumber
+	case config.UserAttributeCostCenter:
+		return u.Enterprise.CostCenter
+	case config.UserAttributeOrganization:
+		return u.Enterprise.Organization
+	case config.UserAttributeDivision:
+		return u.Enterprise.Division
+	case config.UserAttributeDepartment:
+		return u.Enterprise.Department
+	}
+	return ""
+}
+
+// setUserAttribute sets attribute, one of config.UserAttributeNames, of u
+// to value, cut to the limits of AWS SSO
+func setUserAttribute(u *aws.User, attribute string, value string) {
+	switch attribute {
+	case config.UserAttributeGivenName:
+		u.Name.GivenName = aws.Truncate(value, aws.MaxNameLength)
+	case config.UserAttributeFamilyName:
+		u.Name.FamilyName = aws.Truncate(value, aws.MaxNameLength)
+	case config.UserAttributeDisplayName:
+		u.DisplayName = aws.Truncate(value, aws.MaxDisplayNameLength)
+	case config.UserAttributeEmail:
+		// the emails may be shared with a copy of u
+		u.Emails = append([]aws.UserEmail(nil), u.Emails...)
+		for i := range u.Emails {
+			if u.Emails[i].Primary {
+				u.Emails[i].Value = value
+				return
+			}
+		}
+		u.Emails = append(u.Emails, aws.UserEmail{Value: value, Type: "work", Primary: true})
+	case config.UserAttributeTitle:
+		u.Title = value
+	case config.UserAttributePreferredLanguage:
+		u.PreferredLanguage = value
+	case config.UserAttributeLocale:
+		u.Locale = value
+	case config.UserAttributeTimezone:
+		u.Timezone = value
+	case config.UserAttributeEmployeeNumber:
+		setEnterpriseAttribute(u, func(e *aws.EnterpriseUser) { e.EmployeeNumber = value })
+	case config.UserAttributeCostCenter:
+		setEnterpriseAttribute(u, func(e *aws.EnterpriseUser) { e.CostCenter = value })
+	case config.UserAttributeOrganization:
+		setEnterpriseAttribute(u, func(e *aws.EnterpriseUser) { e.Organization = value })
+	case config.UserAttributeDivision:
+		setEnterpriseAttribute(u, func(e *aws.EnterpriseUser) { e.Division = value })
+	case config.UserAttributeDepartment:
+		setEnterpriseAttribute(u, func(e *aws.EnterpriseUser) { e.Department = value })
+	}
+}
+
+// setEnterpriseAttribute sets an attribute of the enterprise extension of u
+// with set, on a copy as it may be shared with a copy of u. The extension is
+// removed once it has no attribute.
+func setEnterpriseAttribute(u *aws.User, set func(e *aws.EnterpriseUser)) {
+	var e aws.EnterpriseUser
+	if u.Enterprise != nil {
+		e = *u.Enterprise
+	}
+	set(&e)
+	if e == (aws.EnterpriseUser{}) {
+		u.SetEnterprise(nil)
+		return
+	}
+	u.SetEnterprise(&e)
+}
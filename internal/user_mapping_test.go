@@ -0,0 +1,96 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"testing"
+
+	"github.com/awslabs/ssosync/internal/aws"
+	awsfake "github.com/awslabs/ssosync/internal/aws/fake"
+	"github.com/awslabs/ssosync/internal/config"
+	googlefake "github.com/awslabs/ssosync/internal/google/fake"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/googleapi"
+)
+
+func Test_userMapping(t *testing.T) {
+	cfg := config.New()
+	cfg.UserAttributes = []config.UserAttribute{
+		{Attribute: config.UserAttributeGivenName, Template: "{{.GivenName | upper}}"},
+		{Attribute: config.UserAttributeEmail, Template: "{{.Local}}@aws.corp.com"},
+		{Attribute: config.UserAttributeTitle, Template: "{{.User.OrgUnitPath}}"},
+		{Attribute: config.UserAttributeFamilyName, Template: "{{index .User.Emails 3}}"},
+	}
+	g := googlefake.User("ann@corp.com")
+	g.OrgUnitPath = "/Engineering"
+	u := newUserMapping(cfg).user(g, nil)
+
+	assert.Equal(t, "ann@corp.com", u.Username)
+	assert.Equal(t, "ANN", u.Name.GivenName)
+	// the template failed, the family name is the default one
+	assert.Equal(t, "ann", u.Name.FamilyName)
+	assert.Equal(t, "ANN ann", u.DisplayName)
+	assert.Equal(t, "ann@aws.corp.com", userAttribute(u, config.UserAttributeEmail))
+	assert.Equal(t, "/Engineering", u.Title)
+
+	want := aws.NewUser("ann", "ann", "ann@corp.com", true)
+	want.ExternalID = g.Id
+	assert.Equal(t, want, (&userMapping{}).user(g, nil))
+}
+
+func Test_userMappingCustomSchemas(t *testing.T) {
+	cfg := config.New()
+	cfg.UserAttributes = []config.UserAttribute{
+		{Attribute: config.UserAttributeCostCenter, Source: "customSchemas.HR.costCenter"},
+		{Attribute: config.UserAttributeEmployeeNumber, Source: "customSchemas.HR.employeeId"},
+		{Attribute: config.UserAttributeDivision, Source: "customSchemas.HR.division"},
+	}
+	g := googlefake.User("ann@corp.com")
+	g.CustomSchemas = map[string]googleapi.RawMessage{"HR": googleapi.RawMessage(`{"costCenter": "R&D", "employeeId": 42}`)}
+	u := newUserMapping(cfg).user(g, nil)
+	assert.Equal(t, &aws.EnterpriseUser{CostCenter: "R&D", EmployeeNumber: "42"}, u.Enterprise)
+	assert.Contains(t, u.Schemas, aws.EnterpriseUserSchema)
+
+	// the user keeps its other enterprise attributes
+	dst := aws.NewUser("ann", "ann", "ann@corp.com", true)
+	dst.SetEnterprise(&aws.EnterpriseUser{Department: "Platform", CostCenter: "Sales"})
+	newUserMapping(cfg).update(dst, u)
+	assert.Equal(t, &aws.EnterpriseUser{CostCenter: "R&D", EmployeeNumber: "42", Department: "Platform"}, dst.Enterprise)
+
+	assert.Nil(t, newUserMapping(cfg).user(googlefake.User("bob@corp.com"), nil).Enterprise)
+}
+
+func TestSyncGroupsUsersUserAttributes(t *testing.T) {
+	googleClient := googlefake.NewClient().
+		WithUsers(googlefake.User("a@email.com")).
+		WithGroup(googlefake.Group("aws-dev@email.com"), "a@email.com")
+	awsClient := awsfake.NewClient().
+		WithUsers(aws.NewUser("a", "a", "a@email.com", true)).
+		WithGroup(aws.NewGroup("aws-dev"), "a@email.com")
+	cfg := config.New()
+	cfg.Yes = true
+	cfg.UserAttributes = []config.UserAttribute{
+		{Attribute: config.UserAttributeDisplayName, Template: "{{.GivenName}} ({{.Email}})"},
+	}
+
+	assert.NoError(t, newSyncGSuite(cfg, awsClient, googleClient, nil).SyncGroupsUsers(nil))
+	u, err := awsClient.FindUserByEmail("a@email.com")
+	assert.NoError(t, err)
+	assert.Equal(t, "a (a@email.com)", u.DisplayName)
+
+	changes, err := newSyncGSuite(cfg, awsClient, googleClient, nil).getChanges(nil)
+	assert.NoError(t, err)
+	assert.Empty(t, changes.updateUsers)
+}
@@ -0,0 +1,143 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/awslabs/ssosync/internal/aws"
+
+	log "github.com/sirupsen/logrus"
+	admin "google.golang.org/api/admin/directory/v1"
+)
+
+// checkUserNames fails when several Google users would have the same AWS SSO
+// user name, e.g. with --user-name local and users of several domains sharing
+// a local part, as AWS SSO rejects all the users but the first with a 409 in
+// the middle of the run. It is checked before anything is written.
+func (s *syncGSuite) checkUserNames(googleUsers []*admin.User) error {
+	if s.mapping.userName == nil {
+		return nil
+	}
+	emails := make(map[string][]string, len(googleUsers))
+	for _, u := range googleUsers {
+		name := s.userNameOf(u)
+		emails[name] = append(emails[name], u.PrimaryEmail)
+	}
+	duplicates := make([]string, 0)
+	for name, users := range emails {
+		if len(users) > 1 {
+			duplicates = append(duplicates, duplicateUserName(name, users))
+		}
+	}
+	if len(duplicates) == 0 {
+		return nil
+	}
+	return duplicateUserNamesError(duplicates)
+}
+
+// userNameCheck returns a function failing when the Google user given has
+// the AWS SSO user name of a user given before, to check the users streamed
+// by the users_groups sync method before each is written
+func (s *syncGSuite) userNameCheck() func(*admin.User) error {
+	if s.mapping.userName == nil {
+		return func(*admin.User) error { return nil }
+	}
+	emails := make(map[string]string)
+	return func(u *admin.User) error {
+		name := s.userNameOf(u)
+		if email, ok := emails[name]; ok && aws.NormalizeName(email) != aws.NormalizeName(u.PrimaryEmail) {
+			return duplicateUserNamesError([]string{duplicateUserName(name, []string{email, u.PrimaryEmail})})
+		}
+		emails[name] = u.PrimaryEmail
+		return nil
+	}
+}
+
+// checkAWSUserName fails when an AWS SSO user with another email than the
+// Google user u, e.g. of a Google user out of scope, has its user name, as
+// AWS SSO would reject u with a 409. It checks the single user of sync-user,
+// the user names of the other users are indexed on the way.
+func (s *syncGSuite) checkAWSUserName(u *admin.User) error {
+	if s.mapping.userName == nil {
+		return nil
+	}
+	name := s.userNameOf(u)
+	var other string
+	err := s.aws.ForEachUser(func(au *aws.User) error {
+		if aws.NormalizeName(au.SCIMUserName) == name && aws.NormalizeName(au.Username) != aws.NormalizeName(u.PrimaryEmail) {
+			other = au.Username
+		}
+		return nil
+	})
+	if err != nil {
+		log.WithError(err).Warn("Error listing the AWS users")
+		return err
+	}
+	if other == "" {
+		return nil
+	}
+	return duplicateUserNamesError([]string{duplicateUserName(name, []string{other, u.PrimaryEmail})})
+}
+
+// userNameOf returns the normalized AWS SSO user name of the Google user u
+func (s *syncGSuite) userNameOf(u *admin.User) string {
+	// only the user name is needed, not the manager of the user
+	noManager := func(string) string { return "" }
+	return aws.NormalizeName(s.mapping.user(u, noManager).SCIMUserName)
+}
+
+// duplicateUserName describes the user name of several users with emails
+func duplicateUserName(name string, emails []string) string {
+	sort.Strings(emails)
+	return fmt.Sprintf("%s (%s)", name, strings.Join(emails, ", "))
+}
+
+// duplicateUserNamesError logs and returns the error of the user names of
+// several users, described by duplicateUserName
+func duplicateUserNamesError(duplicates []string) error {
+	sort.Strings(duplicates)
+	log.WithField("userNames", duplicates).Error("Several Google users have the same AWS SSO user name")
+	return fmt.Errorf("several Google Workspace users have the same AWS SSO user name, change --user-name: %s", strings.Join(duplicates, "; "))
+}
+
+// userNamesOf returns the AWS SSO user names of users, by user id, nil when
+// they are named after their email. They aren't kept by the JSON of the
+// users, see aws.NewUserNameClient.
+func userNamesOf(users []*aws.User) map[string]string {
+	var names map[string]string
+	for _, u := range users {
+		if u.SCIMUserName == "" {
+			continue
+		}
+		if names == nil {
+			names = make(map[string]string, len(users))
+		}
+		names[u.ID] = u.SCIMUserName
+	}
+	return names
+}
+
+// withUserNames sets the AWS SSO user names of users from names, returned
+// by userNamesOf
+func withUserNames(users []*aws.User, names map[string]string) {
+	for _, u := range users {
+		if name, ok := names[u.ID]; ok {
+			u.SCIMUserName = name
+		}
+	}
+}
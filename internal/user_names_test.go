@@ -0,0 +1,149 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"testing"
+
+	"github.com/awslabs/ssosync/internal/aws"
+	awsfake "github.com/awslabs/ssosync/internal/aws/fake"
+	"github.com/awslabs/ssosync/internal/config"
+	googlefake "github.com/awslabs/ssosync/internal/google/fake"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_userMappingUserName(t *testing.T) {
+	gUser := googlefake.User("Ann.Smith@corp.com")
+	tests := []struct {
+		name     string
+		userName string
+		want     string
+	}{
+		{"email", config.UserNameEmail, ""},
+		{"local", config.UserNameLocal, "Ann.Smith"},
+		{"id", config.UserNameID, "id-Ann.Smith@corp.com"},
+		{"template", "{{.Local | lower}}", "ann.smith"},
+		{"empty template", "{{.User.OrgUnitPath}}", "Ann.Smith@corp.com"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.New()
+			cfg.UserName = tt.userName
+			u := newUserMapping(cfg).user(gUser, nil)
+			assert.Equal(t, "Ann.Smith@corp.com", u.Username)
+			assert.Equal(t, tt.want, u.SCIMUserName)
+		})
+	}
+}
+
+func TestSyncGroupsUsersUserName(t *testing.T) {
+	googleClient := googlefake.NewClient().
+		WithUsers(googlefake.User("a@email.com"), googlefake.User("b@email.com")).
+		WithGroup(googlefake.Group("aws-dev@email.com"), "a@email.com", "b@email.com")
+	scim := awsfake.NewClient().
+		WithUsers(aws.NewUser("a", "a", "a@email.com", true)).
+		WithGroup(aws.NewGroup("aws-dev"), "a@email.com")
+	cfg := config.New()
+	cfg.Yes = true
+	cfg.UserName = config.UserNameLocal
+
+	// the user named after its email is renamed, not created again
+	assert.NoError(t, newSyncGSuite(cfg, aws.NewUserNameClient(scim), googleClient, nil).SyncGroupsUsers(nil))
+	for _, name := range []string{"a", "b"} {
+		u, err := scim.FindUserByEmail(name)
+		assert.NoError(t, err)
+		assert.Equal(t, name+"@email.com", u.Emails[0].Value)
+	}
+	users, err := scim.GetUsers()
+	assert.NoError(t, err)
+	assert.Len(t, users, 2)
+	group, err := scim.FindGroupByDisplayName("aws-dev")
+	assert.NoError(t, err)
+	members, err := scim.GetGroupMemberIDs(group)
+	assert.NoError(t, err)
+	assert.Len(t, members, 2)
+
+	changes, err := newSyncGSuite(cfg, aws.NewUserNameClient(scim), googleClient, nil).getChanges(nil)
+	assert.NoError(t, err)
+	assert.Empty(t, changes.addUsers)
+	assert.Empty(t, changes.updateUsers)
+	assert.Empty(t, changes.deleteUsers)
+	assert.Empty(t, changes.addMembers)
+	assert.Empty(t, changes.removeMembers)
+
+	cfg.UserName = config.UserNameID
+	changes, err = newSyncGSuite(cfg, aws.NewUserNameClient(scim), googleClient, nil).getChanges(nil)
+	assert.NoError(t, err)
+	assert.Len(t, changes.updateUsers, 2)
+	assert.Empty(t, changes.addMembers)
+	assert.Empty(t, changes.removeMembers)
+}
+
+func TestSyncGroupsUsersDuplicateUserNames(t *testing.T) {
+	googleClient := googlefake.NewClient().
+		WithUsers(googlefake.User("a@one.com"), googlefake.User("A@two.com"), googlefake.User("b@one.com")).
+		WithGroup(googlefake.Group("aws-dev@one.com"), "a@one.com", "A@two.com", "b@one.com")
+	scim := awsfake.NewClient()
+	cfg := config.New()
+	cfg.Yes = true
+	cfg.UserName = config.UserNameLocal
+
+	// a@one.com and A@two.com would both be named a, nothing is written
+	err := newSyncGSuite(cfg, aws.NewUserNameClient(scim), googleClient, nil).SyncGroupsUsers(nil)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "a (A@two.com, a@one.com)")
+	}
+	users, err := scim.GetUsers()
+	assert.NoError(t, err)
+	assert.Empty(t, users)
+
+	cfg.UserName = config.UserNameEmail
+	assert.NoError(t, newSyncGSuite(cfg, scim, googleClient, nil).SyncGroupsUsers(nil))
+}
+
+func TestSyncUsersDuplicateUserNames(t *testing.T) {
+	googleClient := googlefake.NewClient().
+		WithUsers(googlefake.User("a@one.com"), googlefake.User("A@two.com"))
+	scim := awsfake.NewClient()
+	cfg := config.New()
+	cfg.SyncMethod = config.SyncMethodUsersGroups
+	cfg.UserName = config.UserNameLocal
+
+	// the users are streamed, the second one named a isn't written
+	err := newSyncGSuite(cfg, aws.NewUserNameClient(scim), googleClient, nil).SyncUsers("")
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "a (A@two.com, a@one.com)")
+	}
+	users, err := scim.GetUsers()
+	assert.NoError(t, err)
+	assert.Len(t, users, 1)
+}
+
+func TestSyncUserUserNameTaken(t *testing.T) {
+	googleClient := googlefake.NewClient().WithUsers(googlefake.User("a@one.com"), googlefake.User("a@two.com"))
+	taken := aws.NewUser("a", "a", "a@two.com", true)
+	taken.Username = "a"
+	scim := awsfake.NewClient().WithUsers(taken)
+	cfg := config.New()
+	cfg.UserName = config.UserNameLocal
+
+	err := newSyncGSuite(cfg, aws.NewUserNameClient(scim), googleClient, nil).SyncUser("a@one.com", nil)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "a (a@one.com, a@two.com)")
+	}
+
+	// the user named a is the one of the Google user
+	assert.NoError(t, newSyncGSuite(cfg, aws.NewUserNameClient(scim), googleClient, nil).SyncUser("a@two.com", nil))
+}
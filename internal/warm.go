@@ -0,0 +1,127 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/awslabs/ssosync/internal/config"
+	"github.com/awslabs/ssosync/internal/google"
+	"github.com/hashicorp/go-cleanhttp"
+	"golang.org/x/oauth2"
+)
+
+// warm keeps what the runs of a process can share, so the invocations of a
+// warm Lambda don't open new connections, with their TLS handshakes, nor
+// request a new Google token every time: the pool of connections to Google
+// and AWS, and the sources of the Google tokens. The clients themselves,
+// with their caches, ID maps and rate limiters, are created for every run,
+// so concurrent runs, e.g. of different tenants, share none of them.
+var warm struct {
+	sync.Mutex
+	transport http.RoundTripper
+	// scimTransport is the pool of connections to AWS SSO, tuned with
+	// scimOptions
+	scimTransport http.RoundTripper
+	scimOptions   scimTransportOptions
+	// tokens are the token sources by hash of the Google credentials and
+	// admin, so the runs of different tenants don't evict each other's
+	tokens map[[sha256.Size]byte]oauth2.TokenSource
+}
+
+// scimTransportOptions tune the pool of connections to AWS SSO
+type scimTransportOptions struct {
+	maxConns        int
+	idleConnTimeout time.Duration
+	keepAlive       bool
+	http2           bool
+}
+
+func newSCIMTransportOptions(cfg *config.Config) scimTransportOptions {
+	return scimTransportOptions{
+		maxConns:        cfg.SCIMMaxConns,
+		idleConnTimeout: cfg.SCIMIdleConnTimeout,
+		keepAlive:       cfg.SCIMKeepAlive,
+		http2:           cfg.SCIMHTTP2,
+	}
+}
+
+// maxWarmTokens bounds the token sources kept, they are all dropped, e.g.
+// after many rotations of the credentials, once there are more
+const maxWarmTokens = 16
+
+// sharedTransport returns the transport of the pool of connections shared
+// by the runs
+func sharedTransport() http.RoundTripper {
+	warm.Lock()
+	defer warm.Unlock()
+	if warm.transport == nil {
+		warm.transport = cleanhttp.DefaultPooledTransport()
+	}
+	return warm.transport
+}
+
+// sharedSCIMTransport returns the transport of the pool of connections to
+// AWS SSO shared by the runs, a new pool when opts changed
+func sharedSCIMTransport(opts scimTransportOptions) http.RoundTripper {
+	warm.Lock()
+	defer warm.Unlock()
+	if warm.scimTransport == nil || warm.scimOptions != opts {
+		t := cleanhttp.DefaultPooledTransport()
+		if opts.maxConns > 0 {
+			// the idle connections are kept as well, instead of being closed
+			// when more than GOMAXPROCS+1 of them wait for a request
+			t.MaxConnsPerHost = opts.maxConns
+			t.MaxIdleConnsPerHost = opts.maxConns
+		}
+		t.IdleConnTimeout = opts.idleConnTimeout
+		t.DisableKeepAlives = !opts.keepAlive
+		t.ForceAttemptHTTP2 = opts.http2
+		if !opts.http2 {
+			// an empty map disables HTTP/2, see net/http
+			t.TLSNextProto = make(map[string]func(string, *tls.Conn) http.RoundTripper)
+		}
+		warm.scimTransport, warm.scimOptions = t, opts
+	}
+	return warm.scimTransport
+}
+
+// googleTokens returns the source of the Google tokens of the service
+// account key creds impersonating adminEmail, granted the extra scopes,
+// which is reused by the next runs with the same credentials and scopes,
+// until they change, e.g. when the secret is rotated
+func googleTokens(adminEmail string, creds []byte, scopes ...string) (oauth2.TokenSource, error) {
+	key := sha256.Sum256(append([]byte(adminEmail+"\x00"+strings.Join(scopes, " ")+"\x00"), creds...))
+	transport := sharedTransport()
+	warm.Lock()
+	defer warm.Unlock()
+	if tokens, ok := warm.tokens[key]; ok {
+		return tokens, nil
+	}
+	tokens, err := google.NewTokenSource(adminEmail, creds, &http.Client{Transport: transport}, scopes...)
+	if err != nil {
+		return nil, err
+	}
+	if warm.tokens == nil || len(warm.tokens) >= maxWarmTokens {
+		warm.tokens = make(map[[sha256.Size]byte]oauth2.TokenSource)
+	}
+	warm.tokens[key] = tokens
+	return tokens, nil
+}
@@ -0,0 +1,98 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_googleTokens(t *testing.T) {
+	creds := []byte(`{"type":"service_account","client_email":"ssosync@example.iam.gserviceaccount.com","private_key":"key","token_uri":"https://oauth2.example.com/token"}`)
+	rotated := []byte(`{"type":"service_account","client_email":"ssosync@example.iam.gserviceaccount.com","private_key":"rotated","token_uri":"https://oauth2.example.com/token"}`)
+
+	first, err := googleTokens("admin@example.com", creds)
+	assert.NoError(t, err)
+	// the next runs reuse the source, and the tokens it caches
+	again, err := googleTokens("admin@example.com", creds)
+	assert.NoError(t, err)
+	assert.True(t, first == again)
+
+	// until the credentials change
+	other, err := googleTokens("admin@example.com", rotated)
+	assert.NoError(t, err)
+	assert.False(t, first == other)
+	other, err = googleTokens("other-admin@example.com", rotated)
+	assert.NoError(t, err)
+	assert.False(t, first == other)
+	// and the runs of other tenants don't evict it
+	again, err = googleTokens("admin@example.com", creds)
+	assert.NoError(t, err)
+	assert.True(t, first == again)
+
+	_, err = googleTokens("admin@example.com", []byte("not json"))
+	assert.Error(t, err)
+
+	assert.True(t, sharedTransport() == sharedTransport())
+}
+
+func Test_googleTokensConcurrent(t *testing.T) {
+	creds := []byte(`{"type":"service_account","client_email":"ssosync@example.iam.gserviceaccount.com","private_key":"key","token_uri":"https://oauth2.example.com/token"}`)
+	admins := []string{"a@example.com", "b@example.com", "c@example.com"}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 30; i++ {
+		wg.Add(1)
+		go func(admin string) {
+			defer wg.Done()
+			_, err := googleTokens(admin, creds)
+			assert.NoError(t, err)
+		}(admins[i%len(admins)])
+	}
+	wg.Wait()
+
+	for _, admin := range admins {
+		first, err := googleTokens(admin, creds)
+		assert.NoError(t, err)
+		again, err := googleTokens(admin, creds)
+		assert.NoError(t, err)
+		assert.True(t, first == again)
+	}
+}
+
+func Test_sharedSCIMTransport(t *testing.T) {
+	opts := scimTransportOptions{maxConns: 8, idleConnTimeout: time.Minute, keepAlive: true}
+	first := sharedSCIMTransport(opts)
+	assert.True(t, first == sharedSCIMTransport(opts))
+	transport := first.(*http.Transport)
+	assert.Equal(t, 8, transport.MaxConnsPerHost)
+	assert.Equal(t, 8, transport.MaxIdleConnsPerHost)
+	assert.Equal(t, time.Minute, transport.IdleConnTimeout)
+	assert.False(t, transport.DisableKeepAlives)
+	assert.False(t, transport.ForceAttemptHTTP2)
+	assert.NotNil(t, transport.TLSNextProto)
+
+	// a new pool once the options change
+	opts.keepAlive, opts.http2 = false, true
+	other := sharedSCIMTransport(opts)
+	assert.False(t, first == other)
+	assert.True(t, other.(*http.Transport).DisableKeepAlives)
+	assert.True(t, other.(*http.Transport).ForceAttemptHTTP2)
+	assert.False(t, sharedTransport() == other)
+}
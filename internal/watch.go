@@ -0,0 +1,200 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/awslabs/ssosync/internal/aws"
+	"github.com/awslabs/ssosync/internal/config"
+	"github.com/awslabs/ssosync/internal/google"
+	log "github.com/sirupsen/logrus"
+)
+
+// ErrNotificationRejected is returned for a push notification without the
+// token of the channels, --watch-token
+var ErrNotificationRejected = errors.New("notification rejected, it doesn't have the token of the channels")
+
+// DoWatch registers the channels of the push notifications of the changes to
+// the users and group memberships of Google Workspace, delivered to
+// --watch-address, see DoNotification. The channels expire after
+// --watch-ttl, DoWatch must be run again before, e.g. on a schedule. The
+// service account must be granted google.WatchScopes too.
+func DoWatch(ctx context.Context, cfg *config.Config) ([]*google.Channel, error) {
+	if cfg.WatchAddress == "" || cfg.WatchToken == "" {
+		return nil, errors.New("--watch-address and --watch-token are required to watch Google Workspace")
+	}
+	if cfg.RunID == "" {
+		cfg.RunID = newRunID()
+	}
+	creds, err := googleCredentials(cfg)
+	if err != nil {
+		return nil, err
+	}
+	tokens, err := google.NewTokenSource(cfg.GoogleAdmin, creds, &http.Client{Transport: sharedTransport()}, google.WatchScopes...)
+	if err != nil {
+		log.WithError(err).Error("Error creating Google client")
+		return nil, err
+	}
+	_, transport := newHTTPClient(cfg, nil)
+	w, err := google.NewWatcher(ctx, tokens, cfg.GoogleCustomerId, &http.Client{Transport: google.NewThrottledTransport(transport, cfg.GoogleRequestsPerSecond)})
+	if err != nil {
+		log.WithError(err).Error("Error creating Google client")
+		return nil, err
+	}
+	channels, err := w.Watch("ssosync-"+cfg.RunID, cfg.WatchAddress, cfg.WatchToken, cfg.WatchTTL)
+	for _, c := range channels {
+		log.WithFields(log.Fields{
+			"id":         c.ID,
+			"resource":   c.Resource,
+			"expiration": c.Expiration,
+		}).Info("Notification channel registered")
+	}
+	if err != nil {
+		log.WithError(err).Error("Error registering notification channel")
+		return channels, err
+	}
+	return channels, nil
+}
+
+// DoNotification syncs the users of a push notification of a channel
+// registered by DoWatch, instead of the whole directory. A user changed in
+// Google Workspace, or added to or removed from a group, is synced with its
+// memberships, see SyncUser, when it is already in AWS SSO, a member of a
+// group in scope, or when all the users are provisioned (--all-users). The
+// users deleted in Google Workspace are left to the full syncs.
+func DoNotification(ctx context.Context, cfg *config.Config, header http.Header, body []byte) error {
+	token := header.Get(google.ChannelTokenHeader)
+	if cfg.WatchToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(cfg.WatchToken)) != 1 {
+		log.Warn("Notification rejected, its channel token is invalid")
+		return ErrNotificationRejected
+	}
+	n, err := google.ParseNotification(header, body)
+	if err != nil {
+		log.WithError(err).Warn("Invalid notification")
+		return err
+	}
+	log := log.WithFields(log.Fields{
+		"event": n.Event,
+		"users": n.Users,
+	})
+	switch {
+	case n.Event == "sync" || len(n.Users) == 0:
+		log.Info("Notification without users to sync")
+		return nil
+	case n.Event == "delete":
+		log.Info("User deleted in Google Workspace, it is deleted by the next full sync")
+		return nil
+	case cfg.SyncMethod != config.DefaultSyncMethod:
+		return fmt.Errorf("syncing the users of notifications is only supported with the %q sync method", config.DefaultSyncMethod)
+	}
+	if cfg.RunID == "" {
+		cfg.RunID = newRunID()
+	}
+	log.WithField("runId", cfg.RunID).Info("Starting notified users synchronization")
+	googleClient, awsClient, err := newClients(ctx, cfg, false, nil)
+	if err != nil {
+		return err
+	}
+	store, st, err := loadState(cfg)
+	if err != nil {
+		return err
+	}
+	s := newSyncGSuite(cfg, awsClient, googleClient, st)
+	for _, email := range n.Users {
+		if err := s.syncNotifiedUser(email); err != nil {
+			log.WithError(err).Error("Error synchronizing user")
+			return err
+		}
+	}
+	if store != nil {
+		if err := store.Save(st); err != nil {
+			log.WithError(err).Error("Error saving state")
+			return err
+		}
+	}
+	return nil
+}
+
+// syncNotifiedUser syncs the user of a notification, unless it is out of
+// scope: ignored, not a user of Google Workspace, e.g. the external member
+// of a group, or neither in AWS SSO nor a member of a group in scope
+func (s *syncGSuite) syncNotifiedUser(email string) error {
+	log := log.WithField("user", email)
+	if s.ignoreUser(email) {
+		log.Debug("ignoring user")
+		return nil
+	}
+	gUser, err := s.google.GetUser(email)
+	if err != nil {
+		log.Warn("Error getting Google user")
+		return err
+	}
+	if gUser == nil {
+		log.Info("Not a user of Google Workspace, skipping it")
+		return nil
+	}
+	if reason := s.outOfScope(gUser); reason != "" {
+		log.WithField("reason", reason).Debug("ignoring user out of scope")
+		return nil
+	}
+	// the user is looked up by its primary email from then on
+	email = gUser.PrimaryEmail
+	if !s.cfg.AllUsers {
+		_, err := s.aws.FindUserByEmail(email)
+		if err != nil && !errors.Is(err, aws.ErrUserNotFound) {
+			log.Warn("Error finding user in AWS")
+			return err
+		}
+		if err != nil {
+			member, err := s.memberOfScope(email)
+			if err != nil {
+				return err
+			}
+			if !member {
+				log.Info("User neither in AWS nor a member of a group in scope, skipping it")
+				return nil
+			}
+		}
+	}
+	return s.SyncUser(email, s.cfg.GroupMatch)
+}
+
+// memberOfScope tells if the user with email is a member of one of the
+// Google groups in scope, directly or through a nested group
+func (s *syncGSuite) memberOfScope(email string) (bool, error) {
+	googleGroups, err := s.getGoogleGroups(s.cfg.GroupMatch)
+	if err != nil {
+		return false, err
+	}
+	for _, g := range googleGroups {
+		if s.ignoreGroup(g.Email) {
+			continue
+		}
+		member, err := s.google.HasMember(g.Id, email)
+		if err != nil {
+			log.WithField("group", g.Name).Warn("Error checking group membership in Google")
+			return false, err
+		}
+		if member {
+			return true, nil
+		}
+	}
+	return false, nil
+}
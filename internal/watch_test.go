@@ -0,0 +1,76 @@
+// Copyright (c) 2020, Amazon.com, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/awslabs/ssosync/internal/aws"
+	awsfake "github.com/awslabs/ssosync/internal/aws/fake"
+	"github.com/awslabs/ssosync/internal/config"
+	"github.com/awslabs/ssosync/internal/google"
+	googlefake "github.com/awslabs/ssosync/internal/google/fake"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDoNotificationRejectsToken(t *testing.T) {
+	cfg := config.New()
+	cfg.WatchToken = "secret"
+	header := http.Header{}
+	header.Set(google.ResourceStateHeader, "sync")
+
+	assert.ErrorIs(t, DoNotification(context.Background(), cfg, header, nil), ErrNotificationRejected)
+	header.Set(google.ChannelTokenHeader, "guess")
+	assert.ErrorIs(t, DoNotification(context.Background(), cfg, header, nil), ErrNotificationRejected)
+	header.Set(google.ChannelTokenHeader, "secret")
+	assert.NoError(t, DoNotification(context.Background(), cfg, header, nil))
+
+	// without a token every notification is rejected
+	cfg.WatchToken = ""
+	header.Set(google.ChannelTokenHeader, "")
+	assert.ErrorIs(t, DoNotification(context.Background(), cfg, header, nil), ErrNotificationRejected)
+}
+
+func Test_syncNotifiedUser(t *testing.T) {
+	googleClient := googlefake.NewClient().
+		WithUsers(googlefake.User("member@email.com"), googlefake.User("provisioned@email.com"), googlefake.User("other@email.com")).
+		WithGroup(googlefake.Group("aws-dev@email.com"), "member@email.com")
+	// the group was renamed in Google since the last full sync
+	awsClient := awsfake.NewClient().
+		WithUsers(aws.NewUser("Old", "Name", "provisioned@email.com", true)).
+		WithGroup(aws.NewManagedGroup("aws-developers", "id-aws-dev@email.com"))
+	renamed, _ := awsClient.FindGroupByDisplayName("aws-developers")
+	s := newSyncGSuite(config.New(), awsClient, googleClient, nil)
+
+	for _, email := range []string{"member@email.com", "provisioned@email.com", "other@email.com", "external@other.com"} {
+		assert.NoError(t, s.syncNotifiedUser(email))
+	}
+	users, _ := awsClient.GetUsers()
+	var names []string
+	for _, u := range users {
+		names = append(names, u.Username)
+	}
+	// the user neither in AWS nor in a group in scope isn't provisioned
+	assert.Equal(t, []string{"member@email.com", "provisioned@email.com"}, names)
+	g, err := awsClient.FindGroupByDisplayName("aws-dev")
+	assert.NoError(t, err)
+	assert.Equal(t, renamed.ID, g.ID)
+	ids, _ := awsClient.GetGroupMemberIDs(g)
+	assert.Len(t, ids, 1)
+	u, _ := awsClient.FindUserByEmail("provisioned@email.com")
+	assert.Equal(t, "provisioned", u.Name.GivenName)
+}